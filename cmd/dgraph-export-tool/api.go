@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/capabilities"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/grpcapi"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/lease"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/tenant"
+	apiv1 "github.com/sputnik-systems/dgraph-export-tool/pkg/api/v1"
+)
+
+func (p *dgraphParams) apiHandler(ctx context.Context, cancel context.CancelFunc) {
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	http.Handle("/metrics", metrics.Handler())
+	http.Handle("/ui/", uiHandler())
+	http.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
+	http.Handle("/api/", p.apiRoutes(ctx))
+	if err := http.ListenAndServe(":8081", nil); err != nil {
+		klog.Error(err)
+	}
+
+	klog.Info("http handler finished")
+
+	cancel()
+}
+
+// apiRoutes returns API handler behind rate limit, authentication,
+// role and scope checks.
+func (p *dgraphParams) apiRoutes(ctx context.Context) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/api/v1/export", p.apiExportHandler(ctx))
+	api.HandleFunc("/api/v1/jobs", p.apiJobsHandler)
+	api.HandleFunc("/api/v1/jobs/", p.apiJobsHandler)
+	api.HandleFunc("/api/v1/status", p.apiStatusHandler)
+	api.HandleFunc("/api/v1/version", apiVersionHandler)
+	api.HandleFunc("/api/v1/restore-points", p.apiRestorePointsHandler)
+	api.HandleFunc("/api/v1/exports/latest", p.apiLatestExportHandler)
+	api.HandleFunc("/api/v1/backups/", p.apiBackupsHandler)
+	api.HandleFunc("/api/v1/restore", p.apiRestoreHandler(ctx))
+	api.HandleFunc("/api/v1/state/export", p.apiStateExportHandler)
+	api.HandleFunc("/api/v1/catalog/rebuild", p.apiCatalogRebuildHandler)
+	api.HandleFunc("/api/v1/prune", p.apiPruneHandler)
+	api.HandleFunc("/api/v1/hooks/schema-changed", p.apiSchemaChangedHandler(ctx))
+	api.HandleFunc("/api/v1/tokens", p.apiTokensHandler)
+	api.HandleFunc("/api/v1/tokens/", p.apiTokenHandler)
+	api.HandleFunc("/api/v1/openapi.json", apiOpenAPIHandler)
+	if p.swaggerUI {
+		api.HandleFunc("/api/v1/docs", apiSwaggerUIHandler)
+	}
+
+	var handler http.Handler = api
+	if p.readOnly {
+		handler = readOnlyHandler(api)
+	}
+
+	return p.limiter.Handler(p.auth.Handler(roleHandler(scopeHandler(handler))))
+}
+
+// readOnlyHandler rejects requests which may change anything, so
+// read-only instance can't trigger or delete anything whatever the token.
+func readOnlyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Forbidden in read-only mode", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *dgraphParams) grpcHandler(ctx context.Context, cancel context.CancelFunc, addr string, opts ...grpc.ServerOption) {
+	api := grpcapi.NewServer(ctx, p.jobs, p.runFormats,
+		grpcapi.WithAuth(p.auth),
+		grpcapi.WithLimiter(p.limiter),
+		grpcapi.WithExportLimit(p.exportCap),
+		grpcapi.WithReadOnly(p.readOnly),
+		grpcapi.WithBackend(grpcBackend{p: p}),
+	)
+	srv := grpc.NewServer(append(opts, api.Interceptors()...)...)
+	apiv1.RegisterManagementServiceServer(srv, api)
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		klog.Error(err)
+	} else if err := srv.Serve(lis); err != nil {
+		klog.Error(err)
+	}
+
+	klog.Info("grpc handler finished")
+
+	cancel()
+}
+
+// What export request does when -api.max-concurrent-exports is reached.
+const (
+	onLimitReject = "reject"
+	onLimitQueue  = "queue"
+)
+
+func (p *dgraphParams) apiExportHandler(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			onLimit := r.URL.Query().Get("onLimit")
+			switch onLimit {
+			case "", onLimitReject, onLimitQueue:
+			default:
+				http.Error(w, fmt.Sprintf("Unsupported onLimit %q, use %s or %s", onLimit, onLimitReject, onLimitQueue), http.StatusBadRequest)
+				return
+			}
+
+			in, err := decodeExportRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := scopeExport(apiauth.FromContext(r.Context()), &in); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			run, err := p.exportRun(in)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			key, jobCtx := idempotencyKey(r), ownerContext(ctx, r)
+			j, created, err := p.jobs.StartWithin(jobCtx, job.KindExport, key, job.PriorityManual, p.exportCap, run.runFormats)
+			if errors.Is(err, job.ErrLimitReached) {
+				if onLimit != onLimitQueue {
+					http.Error(w, fmt.Sprintf("%d exports are queued or running already, use onLimit=%s to queue export anyway", p.exportCap, onLimitQueue), http.StatusConflict)
+					return
+				}
+
+				// queued export isn't waited for, it may take several export periods
+				j, _ = p.jobs.Start(jobCtx, job.KindExport, key, job.PriorityManual, run.runFormats)
+				klog.Infof("export limit is reached, queued job %s", j.ID)
+				w.Header().Set("X-Job-Id", j.ID)
+				w.WriteHeader(http.StatusAccepted)
+
+				writeJSON(w, j.Status())
+				return
+			}
+			if !created {
+				klog.Infof("export request with idempotency key %q is served by job %s", key, j.ID)
+				w.Header().Set("Idempotent-Replayed", "true")
+			}
+			w.Header().Set("X-Job-Id", j.ID)
+
+			// failed export is reported in result, only gone client isn't answered
+			if _, err := j.Wait(r.Context()); err != nil && r.Context().Err() != nil {
+				return
+			}
+
+			writeJSON(w, exportResult(j.Status(), run.dest))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// jobsQuery parses job history query parameters: limit, cursor,
+// state and since/until in RFC 3339.
+func jobsQuery(values url.Values) (job.Query, error) {
+	q := job.Query{
+		Cursor: values.Get("cursor"),
+		State:  job.State(values.Get("state")),
+	}
+
+	var err error
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	if v := values.Get("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid since %q, use RFC 3339 time", v)
+		}
+	}
+	if v := values.Get("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("invalid until %q, use RFC 3339 time", v)
+		}
+	}
+
+	return q, q.Validate()
+}
+
+// apiExportResult is the result of export request. It's decoupled from
+// Dgraph admin API types, so changes of their payload don't break clients.
+type apiExportResult struct {
+	Status          job.State `json:"status"`
+	Code            string    `json:"code,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	ErrorClass      string    `json:"errorClass,omitempty"`
+	Files           []string  `json:"files"`
+	StartedAt       time.Time `json:"startedAt"`
+	FinishedAt      time.Time `json:"finishedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Destination     string    `json:"destination"`
+
+	// Issues are problems Dgraph reported, e.g. GraphQL errors, so
+	// auth and destination failures are told apart without parsing message.
+	Issues []failure.Issue `json:"issues,omitempty"`
+}
+
+// exportResult maps finished export job to API result, message is
+// Dgraph response message or error of failed export.
+func exportResult(st job.Status, dest string) apiExportResult {
+	res := apiExportResult{
+		Status:          st.State,
+		Files:           make([]string, 0),
+		StartedAt:       st.StartedAt,
+		FinishedAt:      st.FinishedAt,
+		DurationSeconds: st.FinishedAt.Sub(st.StartedAt).Seconds(),
+		Destination:     redact.URL(dest),
+	}
+	if st.Output != nil {
+		res.Code = string(st.Output.Response.Code)
+		res.Message = string(st.Output.Response.Message)
+		res.Files = st.Output.GetFiles()
+	}
+	if st.Err != nil {
+		res.Message = st.Err.Error()
+		res.ErrorClass = string(failure.Of(st.Err))
+		res.Issues = failure.Issues(st.Err)
+	}
+
+	return res
+}
+
+// apiJobsHandler serves job list at /api/v1/jobs, page of finished jobs
+// at /api/v1/jobs with query parameters, job status at /api/v1/jobs/{id}
+// and job events at /api/v1/jobs/{id}/events. DELETE /api/v1/jobs/{id}
+// cancels queued or running job.
+func (p *dgraphParams) apiJobsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/jobs"), "/")
+	if r.Method == http.MethodDelete && path != "" && !strings.Contains(path, "/") {
+		p.apiCancelJob(w, r, path)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if path == "" && len(r.URL.Query()) > 0 {
+		if apiauth.FromContext(r.Context()).Scoped() {
+			http.Error(w, "Job history is forbidden for namespace scoped token", http.StatusForbidden)
+			return
+		}
+
+		q, err := jobsQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := p.jobs.History(r.Context(), q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, page)
+		return
+	}
+	if path == "" {
+		jobs := make([]job.Status, 0)
+		for _, j := range p.jobs.List() {
+			if s := j.Status(); jobVisible(r, s) {
+				jobs = append(jobs, s)
+			}
+		}
+
+		writeJSON(w, jobs)
+		return
+	}
+
+	id, events := strings.CutSuffix(path, "/events")
+	if strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	j, ok := p.jobs.Get(id)
+	if !ok || !jobVisible(r, j.Status()) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	if events {
+		apiJobEvents(w, r, j)
+	} else {
+		writeJSON(w, j.Status())
+	}
+}
+
+// apiCancelJob cancels job, its status is returned once the job finishes
+// or after a short wait, since aborting transfers takes a moment.
+func (p *dgraphParams) apiCancelJob(w http.ResponseWriter, r *http.Request, id string) {
+	j, ok := p.jobs.Get(id)
+	if !ok || !jobVisible(r, j.Status()) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !j.Cancel() {
+		http.Error(w, "Job is finished", http.StatusConflict)
+		return
+	}
+	klog.Infof("job %s is cancelled", id)
+
+	select {
+	case <-j.Done():
+	case <-time.After(cancelWait):
+	}
+
+	writeJSON(w, j.Status())
+}
+
+// cancelWait is how long job cancellation request waits for job to finish.
+const cancelWait = 5 * time.Second
+
+// apiJobEvents streams job events as Server-Sent Events.
+func apiJobEvents(w http.ResponseWriter, r *http.Request, j *job.Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	next := 0
+	if lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = lastID + 1
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		events, changed, finished := j.Events(next)
+		for _, event := range events {
+			b, err := json.Marshal(event)
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, event.Type, b)
+			next++
+		}
+		flusher.Flush()
+
+		if finished {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+type apiStatus struct {
+	Identity     string        `json:"identity"`
+	Leader       string        `json:"leader"`
+	LeaderInfo   *lease.Holder `json:"leaderInfo,omitempty"`
+	IsLeader     bool          `json:"isLeader"`
+	DryRun       bool          `json:"dryRun"`
+	ReadOnly     bool          `json:"readOnly"`
+	Endpoint     string        `json:"endpoint"`
+	Destination  string        `json:"destination"`
+	ExportPeriod string        `json:"exportPeriod"`
+	NextExport   *time.Time    `json:"nextExport,omitempty"`
+	QueueDepth   int           `json:"queueDepth"`
+	Circuit      string        `json:"circuit"`
+	BackupSLO    string        `json:"backupSLO"`
+	LastJob      *job.Status   `json:"lastJob,omitempty"`
+
+	// Retention is omitted when retention is disabled.
+	Retention *apiRetention `json:"retention,omitempty"`
+
+	Rolling *rollingStatus     `json:"rolling,omitempty"`
+	Tenants []tenant.Readiness `json:"tenants,omitempty"`
+
+	// Capabilities are admin API features of Dgraph, omitted until detected.
+	Capabilities *capabilities.Capabilities `json:"capabilities,omitempty"`
+}
+
+func apiVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, buildinfo.Get())
+}
+
+func (p *dgraphParams) apiStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, p.status(r.Context()))
+}
+
+// status returns state of the tool instance.
+func (p *dgraphParams) status(ctx context.Context) apiStatus {
+	st := apiStatus{
+		Identity:     p.identity,
+		DryRun:       p.dryRun,
+		ReadOnly:     p.readOnly,
+		Endpoint:     redact.URL(p.endpoint),
+		Destination:  redact.URL(p.dest),
+		ExportPeriod: p.period.String(),
+		QueueDepth:   p.jobs.QueueDepth(),
+		Circuit:      p.breaker.State(),
+		BackupSLO:    p.slo.String(),
+		Retention:    p.retentionStatus(),
+	}
+	if p.elector != nil {
+		st.Leader = p.elector.GetLeader()
+		st.IsLeader = p.elector.IsLeader()
+	}
+	if p.holders != nil && (st.Leader != "" || p.readOnly) {
+		// holder record is written after lease is taken, so it may belong to previous leader yet
+		h, err := p.holders.Get(ctx)
+		switch {
+		case err != nil:
+			klog.Warningf("failed to get lease holder metadata: %v", err)
+		case h != nil && p.readOnly:
+			// read-only instance doesn't watch lease, holder is the best guess
+			st.Leader = h.Identity
+			st.LeaderInfo = h
+		case h != nil && h.Identity == st.Leader:
+			st.LeaderInfo = h
+		}
+	}
+	if next := p.nextExport.Load(); next != 0 {
+		t := time.Unix(0, next)
+		st.NextExport = &t
+	}
+	if jobs := p.jobs.List(); len(jobs) > 0 {
+		last := jobs[0].Status()
+		st.LastJob = &last
+	} else if page, err := p.jobs.History(ctx, job.Query{Limit: 1}); err != nil {
+		klog.Warningf("failed to read last job from history: %v", err)
+	} else if len(page.Jobs) > 0 {
+		// last run survives restarts when job history is persistent
+		st.LastJob = &page.Jobs[0]
+	}
+	if p.rollingExport.cycle != nil {
+		st.Rolling = p.rollingExport.cycle.Status()
+	}
+	if p.tenants != nil {
+		st.Tenants = p.tenants.Status()
+	}
+	st.Capabilities = p.caps.get()
+
+	return st
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, string(b))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ratelimit"
+	"github.com/sputnik-systems/dgraph-export-tool/pkg/testing/dgraphtest"
+)
+
+// newTestAuth returns authenticator of tokens named as their roles and
+// of tenant operator token scoped to namespace 5, token values are
+// their names.
+func newTestAuth(t *testing.T) *apiauth.Authenticator {
+	t.Helper()
+
+	dir := t.TempDir()
+	var tokens []apiauth.Token
+	for _, tok := range []apiauth.Token{
+		{Name: "admin", Role: apiauth.RoleAdmin},
+		{Name: "operator", Role: apiauth.RoleOperator},
+		{Name: "viewer", Role: apiauth.RoleViewer},
+		{Name: "tenant", Role: apiauth.RoleOperator, Namespaces: []int64{5}},
+	} {
+		tok.TokenFile = filepath.Join(dir, tok.Name)
+		if err := os.WriteFile(tok.TokenFile, []byte(tok.Name+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, tok)
+	}
+
+	return apiauth.New(tokens)
+}
+
+// serveAPI sends request to API routes, token is sent unless it's empty.
+func serveAPI(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAPIRoutes(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	p.auth = newTestAuth(t)
+	h := p.apiRoutes(context.Background())
+
+	for _, tc := range []struct {
+		method, path, token, body string
+		code                      int
+		message                   string
+	}{
+		{http.MethodGet, "/api/v1/status", "", "", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/api/v1/status", "unknown", "", http.StatusUnauthorized, "Unauthorized"},
+		{http.MethodGet, "/api/v1/status", "viewer", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/v1/prune", "viewer", "", http.StatusForbidden, "viewer role"},
+		{http.MethodGet, "/api/v1/tokens", "operator", "", http.StatusForbidden, "admin role"},
+		{http.MethodGet, "/api/v1/tokens/tenant", "tenant", "", http.StatusForbidden, "admin role"},
+		{http.MethodGet, "/api/v1/status", "tenant", "", http.StatusForbidden, "namespace scoped token"},
+		{http.MethodDelete, "/api/v1/backups/" + exportedDir, "tenant", "", http.StatusForbidden, "namespace scoped token"},
+		{http.MethodGet, "/api/v1/restore-points", "tenant", "", http.StatusOK, ""},
+		{http.MethodPost, "/api/v1/export", "tenant", `{"namespace":6}`, http.StatusForbidden, "namespace 6"},
+		// handler is reached, retention isn't configured
+		{http.MethodPost, "/api/v1/prune", "operator", "", http.StatusConflict, "retention is disabled"},
+	} {
+		w := serveAPI(h, tc.method, tc.path, tc.token, tc.body)
+		if w.Code != tc.code || !strings.Contains(w.Body.String(), tc.message) {
+			t.Errorf("%s %s with %q token: %d %q, want %d %q", tc.method, tc.path, tc.token, w.Code, w.Body, tc.code, tc.message)
+		}
+	}
+
+	if w := serveAPI(h, http.MethodGet, "/api/v1/status", "", ""); w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("unauthorized response has no WWW-Authenticate header")
+	}
+}
+
+func TestAPIRoutesReadOnly(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	p.auth = newTestAuth(t)
+	p.readOnly = true
+	h := p.apiRoutes(context.Background())
+
+	if w := serveAPI(h, http.MethodPost, "/api/v1/export", "admin", ""); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "read-only") {
+		t.Errorf("export on read-only instance: %d %q", w.Code, w.Body)
+	}
+	if w := serveAPI(h, http.MethodGet, "/api/v1/restore-points", "viewer", ""); w.Code != http.StatusOK {
+		t.Errorf("listing on read-only instance: %d %q", w.Code, w.Body)
+	}
+	if got := exportRequests(alpha); got != 0 {
+		t.Errorf("read-only instance requested %d exports", got)
+	}
+}
+
+func TestAPIRoutesRateLimit(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	p.auth = newTestAuth(t)
+	p.limiter = ratelimit.New(0, 0, 0.001, 2)
+	h := p.apiRoutes(context.Background())
+
+	// unauthenticated requests take tokens as well, so guessing is limited
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		token := "viewer"
+		if i > 0 {
+			token = "wrong"
+		}
+		w := serveAPI(h, http.MethodGet, "/api/v1/version", token, "")
+		if w.Code != want {
+			t.Errorf("request %d: %d, want %d", i+1, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("limited response has no Retry-After header")
+		}
+	}
+}
+
+func TestAPIStatusRedacted(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	p.endpoint = strings.Replace(alpha.AdminURL(), "://", "://groot:s3cr3t@", 1)
+	h := p.apiRoutes(context.Background())
+
+	w := serveAPI(h, http.MethodGet, "/api/v1/status", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: %d %q", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "s3cr3t") || !strings.Contains(w.Body.String(), "groot") {
+		t.Errorf("status is %s, want endpoint with redacted password", w.Body)
+	}
+}
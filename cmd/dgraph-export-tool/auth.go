@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+// scopedRoutes are API paths namespace scoped tokens may request,
+// handlers limit them to namespaces of the token.
+var scopedRoutes = map[string]bool{
+	"/api/v1/export":         true,
+	"/api/v1/jobs":           true,
+	"/api/v1/restore-points": true,
+	"/api/v1/restore":        true,
+	"/api/v1/version":        true,
+	"/api/v1/openapi.json":   true,
+}
+
+// scopeHandler responds with 403 Forbidden to requests of namespace
+// scoped tokens to other paths, e.g. status or backup deletion.
+func scopeHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiauth.FromContext(r.Context()).Scoped() &&
+			!scopedRoutes[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/api/v1/jobs/") {
+			http.Error(w, "Forbidden for namespace scoped token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// roleHandler responds with 403 Forbidden to requests beyond role of
+// token: viewers may only read and only admins may manage tokens.
+func roleHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := apiauth.FromContext(r.Context())
+		switch {
+		case t == nil:
+		case (r.URL.Path == "/api/v1/tokens" || strings.HasPrefix(r.URL.Path, "/api/v1/tokens/")) &&
+			t.Role != apiauth.RoleAdmin:
+			http.Error(w, "Forbidden for token without admin role", http.StatusForbidden)
+			return
+		case t.Role == apiauth.RoleViewer && r.Method != http.MethodGet && r.Method != http.MethodHead:
+			http.Error(w, "Forbidden for token with viewer role", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errForbidden fails requests beyond namespaces of scoped token.
+var errForbidden = errors.New("forbidden")
+
+// ownerContext returns ctx jobs requested with r are started with,
+// they are owned by the token request is authenticated with.
+func ownerContext(ctx context.Context, r *http.Request) context.Context {
+	if t := apiauth.FromContext(r.Context()); t != nil {
+		return job.WithOwner(ctx, t.Name)
+	}
+
+	return ctx
+}
+
+// idempotencyKey returns Idempotency-Key of request, keys of scoped
+// tokens are prefixed with token name, so tenants can't get each
+// other's jobs by reusing their keys.
+func idempotencyKey(r *http.Request) string {
+	key := r.Header.Get("Idempotency-Key")
+	if t := apiauth.FromContext(r.Context()); key != "" && t.Scoped() {
+		return t.Name + "/" + key
+	}
+
+	return key
+}
+
+// jobVisible returns whether token of request may see job.
+func jobVisible(r *http.Request, s job.Status) bool {
+	t := apiauth.FromContext(r.Context())
+	return !t.Scoped() || s.Owner == t.Name
+}
+
+// scopeExport limits export request of scoped token to its namespaces,
+// namespace may be omitted when token has only one.
+func scopeExport(t *apiauth.Token, in *apiExportRequest) error {
+	if !t.Scoped() {
+		return nil
+	}
+
+	if in.Namespace == nil {
+		if len(t.Namespaces) > 1 {
+			return fmt.Errorf("%w: namespace is required", errForbidden)
+		}
+		in.Namespace = &t.Namespaces[0]
+	}
+	if !t.Allows(*in.Namespace) {
+		return fmt.Errorf("%w: namespace %d", errForbidden, *in.Namespace)
+	}
+
+	return nil
+}
+
+// scopeRestore limits restore request of scoped token to backups of
+// its namespaces, which are restored into the same namespace unless
+// another one of the token is given.
+func scopeRestore(t *apiauth.Token, in *apiRestoreRequest, point *restorepoint.Point) error {
+	if !t.Scoped() {
+		return nil
+	}
+
+	if !pointVisible(t, *point) {
+		return fmt.Errorf("%w: backup %s", errForbidden, point.ID)
+	}
+	if in.SourceNamespace == nil {
+		in.SourceNamespace = point.Namespace
+	}
+	if in.TargetNamespace == nil {
+		in.TargetNamespace = in.SourceNamespace
+	}
+	for _, ns := range []int64{*in.SourceNamespace, *in.TargetNamespace} {
+		if !t.Allows(ns) {
+			return fmt.Errorf("%w: namespace %d", errForbidden, ns)
+		}
+	}
+
+	return nil
+}
+
+// pointVisible returns whether token may list and restore point, scoped
+// tokens only get exports of single namespace of theirs.
+func pointVisible(t *apiauth.Token, point restorepoint.Point) bool {
+	return !t.Scoped() || point.Namespace != nil && *point.Namespace >= 0 && t.Allows(*point.Namespace)
+}
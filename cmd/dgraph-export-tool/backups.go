@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+func (p *dgraphParams) apiRestorePointsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	points, err := p.restorePoints(r.Context(), s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, points)
+}
+
+// restorePoints lists restore points at s token of ctx may see.
+func (p *dgraphParams) restorePoints(ctx context.Context, s storage.Storage) ([]restorepoint.Point, error) {
+	points, err := restorepoint.List(ctx, s, p.pointOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if t := apiauth.FromContext(ctx); t.Scoped() {
+		visible := make([]restorepoint.Point, 0, len(points))
+		for _, point := range points {
+			if pointVisible(t, point) {
+				visible = append(visible, point)
+			}
+		}
+		points = visible
+	}
+
+	return points, nil
+}
+
+// apiExportFile describes file of export, Checksum is omitted when
+// neither manifest nor destination has one.
+type apiExportFile struct {
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// apiLatestExport describes the newest verified export.
+type apiLatestExport struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Format    string          `json:"format"`
+	Files     []apiExportFile `json:"files"`
+}
+
+// apiLatestExportHandler serves files of the newest verified export at
+// /api/v1/exports/latest, so downstream jobs can discover new exports.
+// Type query parameter selects full or delta exports, full by default.
+func (p *dgraphParams) apiLatestExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	typ := r.URL.Query().Get("type")
+	switch typ {
+	case "":
+		typ = restorepoint.TypeFull
+	case restorepoint.TypeFull, restorepoint.TypeDelta:
+	default:
+		http.Error(w, "Type must be full or delta", http.StatusBadRequest)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	out, err := p.latestExport(r.Context(), s, typ)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "No verified export found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		writeJSON(w, out)
+	}
+}
+
+func (p *dgraphParams) latestExport(ctx context.Context, s storage.Storage, typ string) (*apiLatestExport, error) {
+	points, err := restorepoint.List(ctx, s, p.pointOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, point := range points {
+		if point.Type != typ || !point.Verified {
+			continue
+		}
+
+		m, err := manifest.Read(ctx, s, point.ID)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := s.List(ctx, point.ID)
+		if err != nil {
+			return nil, err
+		}
+		listed := make(map[string]storage.Object, len(objects))
+		for _, obj := range objects {
+			listed[obj.Key] = obj
+		}
+
+		out := &apiLatestExport{
+			ID:        point.ID,
+			Type:      point.Type,
+			CreatedAt: m.CreatedAt,
+			Format:    m.Format,
+			Files:     make([]apiExportFile, 0, len(m.Files)),
+		}
+		dest := strings.TrimRight(redact.URL(p.dest), "/")
+		for _, key := range m.Files {
+			obj := listed[key]
+			file := apiExportFile{
+				Key:  key,
+				Size: obj.Size,
+				URL:  dest + "/" + key,
+			}
+			// manifest checksum is preferred, multipart uploads
+			// have ETag with parts count, it isn't MD5
+			if sum, ok := m.Checksums[key]; ok {
+				file.Checksum = sum
+			} else if obj.ETag != "" && !strings.Contains(obj.ETag, "-") {
+				file.Checksum = "md5:" + obj.ETag
+			}
+			out.Files = append(out.Files, file)
+		}
+
+		return out, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+// apiCatalogRebuildResponse lists exports manifests were written for.
+type apiCatalogRebuildResponse struct {
+	Rebuilt []string `json:"rebuilt"`
+	DryRun  bool     `json:"dryRun"`
+}
+
+// apiCatalogRebuildHandler writes manifests for exports found at destination
+// without them, so exports made before the tool was adopted are cataloged.
+func (p *dgraphParams) apiCatalogRebuildHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	dryRun := p.dryRun || r.URL.Query().Get("dryRun") == "true"
+	rebuilt, err := restorepoint.Rebuild(r.Context(), s, redact.URL(p.dest), p.signer, dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	klog.Infof("catalog rebuilt, %d exports got manifests", len(rebuilt))
+
+	writeJSON(w, apiCatalogRebuildResponse{
+		Rebuilt: append([]string{}, rebuilt...),
+		DryRun:  dryRun,
+	})
+}
+
+// apiBackupsHandler serves /api/v1/backups/{id} and its hold, copy and diff actions.
+func (p *dgraphParams) apiBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/backups"), "/")
+	id, action, _ := strings.Cut(path, "/")
+	switch {
+	case id == "":
+		http.NotFound(w, r)
+	case action == "":
+		p.apiBackupHandler(w, r, id)
+	case action == "hold":
+		p.apiBackupHoldHandler(w, r, id)
+	case action == "copy":
+		p.apiBackupCopyHandler(w, r, id)
+	case action == "diff":
+		p.apiBackupDiffHandler(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *dgraphParams) apiBackupHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	force := r.URL.Query().Get("force") == "true"
+	opts := append(p.pointOptions(), restorepoint.WithFreshness(p.retention.Freshness))
+	err := restorepoint.Delete(r.Context(), s, id, force, opts...)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Backup not found", http.StatusNotFound)
+	case errors.Is(err, restorepoint.ErrProtected):
+		http.Error(w, err.Error()+", use force=true to delete it anyway", http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		klog.Infof("backup %s deleted (force: %t)", id, force)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *dgraphParams) apiBackupHoldHandler(w http.ResponseWriter, r *http.Request, id string) {
+	var fn func(s storage.Storage) (*restorepoint.Point, error)
+	switch r.Method {
+	case http.MethodPost:
+		fn = func(s storage.Storage) (*restorepoint.Point, error) {
+			return restorepoint.Hold(r.Context(), s, id, r.URL.Query().Get("reason"))
+		}
+	case http.MethodDelete:
+		fn = func(s storage.Storage) (*restorepoint.Point, error) {
+			return restorepoint.Release(r.Context(), s, id)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	point, err := fn(s)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, point)
+}
+
+// apiBackupDiffHandler compares backup id with backup given by "to"
+// query parameter, schema summaries are compared with schema=true.
+func (p *dgraphParams) apiBackupDiffHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		http.Error(w, "Backup to compare with is required", http.StatusBadRequest)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	withSchema := r.URL.Query().Get("schema") == "true"
+	diff, err := restorepoint.Compare(r.Context(), s, id, to, withSchema, p.pointOptions()...)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, diff)
+}
+
+// apiCopyRequest is the body of backup copy request. Credentials of
+// the tool destination are used when target ones are not set.
+type apiCopyRequest struct {
+	Destination string `json:"destination"`
+	AccessKey   string `json:"accessKey"`
+	SecretKey   string `json:"secretKey"`
+	Anonymous   bool   `json:"anonymous"`
+}
+
+func (p *dgraphParams) apiBackupCopyHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var in apiCopyRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.Destination == "" {
+		http.Error(w, "Destination is required", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := p.credentials()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	src, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	var opts []storage.Option
+	switch {
+	case in.Anonymous:
+	case in.AccessKey != "" || in.SecretKey != "":
+		opts = append(opts, storage.WithAccessKey(in.AccessKey), storage.WithSecretKey(in.SecretKey))
+	case !p.anonymous:
+		opts = append(opts, storage.WithAccessKey(creds.accessKey), storage.WithSecretKey(creds.secretKey))
+	}
+	dst, err := storage.New(in.Destination, opts...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target := redact.URL(in.Destination)
+	klog.Infof("copying backup %s to %s", id, target)
+
+	size, err := restorepoint.Copy(r.Context(), dst, src, id, restorepoint.WithPool(p.workers))
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		err = redact.Error(err, in.AccessKey, in.SecretKey)
+		klog.Errorf("failed to copy backup %s to %s: %v", id, target, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	klog.Infof("backup %s copied to %s, %d bytes", id, target, size)
+
+	point, err := restorepoint.Get(r.Context(), dst, id, p.pointOptions()...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, point)
+}
+
+// apiStorage opens destination or writes error response.
+func (p *dgraphParams) apiStorage(w http.ResponseWriter) (storage.Storage, bool) {
+	s, err := p.destination()
+	if errors.Is(err, storage.ErrUnsupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return s, true
+}
+
+// destination opens destination with current credentials.
+func (p *dgraphParams) destination() (storage.Storage, error) {
+	creds, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.newStorage(creds)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/capabilities"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/health"
+)
+
+// capabilityCache keeps admin API features detected by schema introspection.
+// They are detected again once Dgraph recovers, since it may come back upgraded.
+type capabilityCache struct {
+	mu   sync.Mutex
+	caps *capabilities.Capabilities
+}
+
+func (c *capabilityCache) get() *capabilities.Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.caps
+}
+
+func (c *capabilityCache) set(caps *capabilities.Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.caps = caps
+}
+
+// capabilities returns admin API features, detecting them on first use.
+// Features of Dgraph version from compatibility matrix are used when schema
+// can't be introspected. Nil is returned when both fail, features are
+// assumed supported then.
+func (p *dgraphParams) capabilities(ctx context.Context) *capabilities.Capabilities {
+	if caps := p.caps.get(); caps != nil {
+		return caps
+	}
+
+	creds, err := p.credentials()
+	if err != nil {
+		klog.Warningf("failed to detect dgraph capabilities: %v", err)
+		return nil
+	}
+	c, err := capabilities.NewClient(p.adminEndpoint(),
+		capabilities.WithAuthToken(creds.authToken),
+		capabilities.WithAPIKey(creds.apiKey),
+		capabilities.WithRetries(p.retries),
+		capabilities.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		klog.Warningf("failed to detect dgraph capabilities: %v", err)
+		return nil
+	}
+	version, verr := p.dgraphVersion(ctx, creds)
+	caps, err := c.Detect(ctx)
+	switch {
+	case err == nil:
+		caps.Version = version
+	case verr != nil:
+		klog.Warningf("failed to detect dgraph capabilities, assuming all features are supported: %v; version: %v", err, verr)
+		return nil
+	default:
+		if caps = capabilities.ForVersion(version); caps == nil {
+			klog.Warningf("failed to detect dgraph capabilities of version %s, assuming all features are supported: %v", version, err)
+			return nil
+		}
+		klog.Warningf("failed to introspect dgraph admin schema, features of version %s are assumed: %v", version, err)
+	}
+
+	klog.Infof("dgraph capabilities: %+v", *caps)
+	p.caps.set(caps)
+
+	return caps
+}
+
+// dgraphVersion returns version of alpha serving admin API
+// reported by REST /health, available in all Dgraph versions.
+func (p *dgraphParams) dgraphVersion(ctx context.Context, creds *credentials) (string, error) {
+	hc, err := health.NewClient(p.adminEndpoint(),
+		health.WithAuthToken(creds.authToken),
+		health.WithAPIKey(creds.apiKey),
+		health.WithRetries(p.retries),
+		health.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		return "", err
+	}
+	self, err := hc.Self(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return string(self.Version), nil
+}
+
+// checkCapabilities returns error when export needs feature
+// missing in Dgraph version serving admin API.
+func (p *dgraphParams) checkCapabilities(ctx context.Context) error {
+	features := []capabilities.Feature{capabilities.FeatureExport}
+	if p.namespace != 0 {
+		features = append(features, capabilities.FeatureExportNamespace)
+	}
+	if p.anonymous {
+		features = append(features, capabilities.FeatureExportAnonymous)
+	}
+
+	return p.capabilities(ctx).Require(features...)
+}
+
+// capabilityList returns names of supported features for ctl output.
+func capabilityList(c *capabilities.Capabilities) string {
+	var names []string
+	for _, m := range capabilities.Matrix {
+		if c.Supports(m.Feature) {
+			names = append(names, string(m.Feature))
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, "none")
+	}
+	if c.Version != "" {
+		return strings.Join(names, ", ") + " (Dgraph " + c.Version + ")"
+	}
+
+	return strings.Join(names, ", ")
+}
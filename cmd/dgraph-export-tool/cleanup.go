@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+)
+
+const (
+	// exportMarkerSuffix ends names of files exports keep in Dgraph tmp
+	// dir while they run, so cleanup of other instances waits for them.
+	exportMarkerSuffix = ".export-running"
+
+	// exportMarkerTTL is time marker is considered fresh after it was
+	// touched, markers left by crashed instances are ignored after it.
+	exportMarkerTTL = 5 * time.Minute
+)
+
+// markExport creates marker of running export and keeps it fresh until
+// returned function is called. Failures are only logged, since they
+// don't affect export itself.
+func (t dgraphTmp) markExport(id string, dryRun bool) (release func()) {
+	if dryRun {
+		return func() {}
+	}
+
+	path := filepath.Join(t.prefix, "."+id+exportMarkerSuffix)
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		klog.Warningf("failed to create export marker: %v", err)
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(exportMarkerTTL / 5)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				if err := os.Chtimes(path, now, now); err != nil {
+					klog.Warningf("failed to touch export marker: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		if err := os.Remove(path); err != nil {
+			klog.Warningf("failed to remove export marker: %v", err)
+		}
+	}
+}
+
+// runningExports returns fresh markers of exports running now.
+func (t dgraphTmp) runningExports(now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(t.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var running []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), exportMarkerSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) < exportMarkerTTL {
+			running = append(running, entry.Name())
+		}
+	}
+
+	return running, nil
+}
+
+// dirs returns names of Dgraph export tmp dirs existing now.
+func (t dgraphTmp) dirs() (map[string]bool, error) {
+	entries, err := os.ReadDir(t.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]bool)
+	for _, entry := range entries {
+		match, err := filepath.Match(t.pattern, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if entry.IsDir() && match {
+			dirs[entry.Name()] = true
+		}
+	}
+
+	return dirs, nil
+}
+
+// removeFiles removes Dgraph export tmp dirs. It's skipped while another
+// export runs. Unless existed is nil, only dirs missing from it, i.e.
+// created by the export just finished, are removed. Otherwise dirs
+// modified less than minAge ago are kept, since exports made outside of
+// the tool may be writing to them.
+func (t dgraphTmp) removeFiles(ctx context.Context, dryRun bool, existed map[string]bool) error {
+	now := time.Now()
+
+	running, err := t.runningExports(now)
+	if err != nil {
+		return err
+	}
+	if len(running) > 0 {
+		klog.Infof("skip tmp dir cleanup, exports are running: %v", running)
+		job.Report(ctx, "cleanup", "skipped, %d exports are running", len(running))
+		return nil
+	}
+
+	dirs, err := t.dirs()
+	if err != nil {
+		return err
+	}
+
+	for name := range dirs {
+		path := filepath.Join(t.prefix, name)
+
+		if existed != nil {
+			if existed[name] {
+				continue
+			}
+		} else {
+			modified, err := lastModified(path)
+			if err != nil {
+				return err
+			}
+			if age := now.Sub(modified); age < t.minAge {
+				klog.Infof("keep directory modified %s ago: %s", age.Truncate(time.Second), path)
+				continue
+			}
+		}
+
+		if dryRun {
+			klog.Infof("dry-run: would remove directory: %s", path)
+			continue
+		}
+		klog.Infof("removing directory: %s", path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		job.Report(ctx, "cleanup", "removed directory %s", path)
+	}
+
+	return nil
+}
+
+// lastModified returns modification time of the newest entry under dir.
+func lastModified(dir string) (time.Time, error) {
+	var last time.Time
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// entries removed while walking don't matter
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return last, err
+}
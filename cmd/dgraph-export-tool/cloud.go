@@ -0,0 +1,9 @@
+package main
+
+import "strings"
+
+// adminEndpoint returns /admin endpoint, Dgraph Cloud serves export
+// at /admin/slash while health and state are queried at /admin.
+func (p *dgraphParams) adminEndpoint() string {
+	return strings.TrimSuffix(strings.TrimRight(p.endpoint, "/"), "/slash")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// envPrefix starts names of environment variables flags are read from,
+// e.g. DGRAPH_BACKUP_DGRAPH_ENDPOINT_URL sets dgraph.endpoint-url.
+const envPrefix = "DGRAPH_BACKUP_"
+
+// envName returns environment variable of flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// applyConfig sets flags missing on command line from environment and
+// then from JSON config file mapping flag names to values, so precedence
+// is flags > env > file. Config file path is flag itself, e.g. -config
+// or DGRAPH_BACKUP_CONFIG.
+func applyConfig(fs *flag.FlagSet, configFlag string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	known := make(map[string]bool)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		known[envName(f.Name)] = true
+		if set[f.Name] || err != nil {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if err = fs.Set(f.Name, value); err != nil {
+				err = fmt.Errorf("invalid value of %s: %w", envName(f.Name), err)
+				return
+			}
+			set[f.Name] = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, envPrefix) && !known[name] {
+			klog.Warningf("environment variable %s doesn't match any flag", name)
+		}
+	}
+
+	file := fs.Lookup(configFlag).Value.String()
+	if file == "" {
+		return nil
+	}
+
+	values, err := readConfig(file)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil || name == configFlag {
+			return fmt.Errorf("config file %s: unknown flag %q", file, name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("config file %s: invalid value of %s: %w", file, name, err)
+		}
+	}
+
+	return nil
+}
+
+// readConfig reads JSON object with flag values, values may be strings,
+// numbers or booleans.
+func readConfig(file string) (map[string]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as written, e.g. large byte counts aren't turned into floats
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var raw map[string]interface{}
+	if err := d.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", file, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("config file %s: value of %s must be string, number or boolean", file, name)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,962 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restore"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+const ctlUsage = `Usage: %s ctl [-server URL] [-token-file FILE] <command> [args]
+
+Commands:
+  export [-idempotency-key KEY] [-on-limit reject|queue] [-format rdf|json]
+         [-namespace N] [-destination URL] [-anonymous] [-dry-run]
+                                 request export and wait for it to finish,
+                                 set flags override daemon configuration
+  status                         show daemon status
+  jobs [-follow] [ID]            list jobs or show single job
+  jobs -history [-limit N] [-cursor C] [-state succeeded|failed|cancelled]
+       [-since TIME] [-until TIME]
+                                 list finished jobs page by page
+  cancel ID                      cancel queued or running job
+  restore-points                 list exports available for restore
+  latest-export [-type full|delta]
+                                 list files of the latest verified export
+  hold [-reason TEXT] ID         exclude backup from retention
+  release ID                     make held backup subject to retention again
+  delete [-force] ID             delete backup
+  copy ID DESTINATION            copy backup to another destination
+  diff [-schema] FROM TO         compare file counts and sizes of two backups
+  restore [-follow] [-materialize] [-create-namespace] [-apply-acl]
+          [-apply-graphql-schema] [-admin URL] -alpha ADDR -zero ADDR ID
+                                 restore backup into cluster
+  state-export                   print state snapshot for disaster recovery
+  catalog rebuild [-dry-run]     write manifests for exports made without the tool
+  prune [-dry-run]               apply retention policy to exports now
+  schema-changed [-idempotency-key KEY]
+                                 start export after schema migration
+  tokens [list]                  list API tokens managed with the API
+  tokens create [-role admin|operator|viewer] [-namespaces N,M] NAME
+                                 issue API token and print its value
+  tokens rotate NAME             replace value of API token
+  tokens delete NAME             revoke API token
+  version                        show client and server versions
+
+`
+
+// ctl runs management API client command and returns exit code.
+func ctl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:8081", "Management API address")
+	tokenFile := fs.String("token-file", "", "File with API bearer token, DGRAPH_EXPORT_TOOL_TOKEN is used if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), ctlUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	token, err := secretSource("DGRAPH_EXPORT_TOOL_TOKEN", *tokenFile).Get()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c := &ctlClient{
+		server: strings.TrimRight(*server, "/"),
+		client: &http.Client{Transport: bearerTransport{token: token}},
+		out:    os.Stdout,
+	}
+
+	switch fs.Arg(0) {
+	case "export":
+		err = c.export(fs.Args()[1:])
+	case "status":
+		err = c.status()
+	case "jobs":
+		err = c.jobs(fs.Args()[1:])
+	case "cancel":
+		err = c.cancel(fs.Args()[1:])
+	case "restore-points":
+		err = c.restorePoints()
+	case "latest-export":
+		err = c.latestExport(fs.Args()[1:])
+	case "hold":
+		err = c.hold(fs.Args()[1:])
+	case "release":
+		err = c.release(fs.Args()[1:])
+	case "delete":
+		err = c.delete(fs.Args()[1:])
+	case "copy":
+		err = c.copy(fs.Args()[1:])
+	case "diff":
+		err = c.diff(fs.Args()[1:])
+	case "restore":
+		err = c.restore(fs.Args()[1:])
+	case "state-export":
+		err = c.stateExport()
+	case "catalog":
+		err = c.catalog(fs.Args()[1:])
+	case "prune":
+		err = c.prune(fs.Args()[1:])
+	case "schema-changed":
+		err = c.schemaChanged(fs.Args()[1:])
+	case "tokens":
+		err = c.tokens(fs.Args()[1:])
+	case "version":
+		err = c.version()
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+type ctlClient struct {
+	server string
+	client *http.Client
+	out    io.Writer
+}
+
+// bearerTransport authenticates requests with API token, if any.
+type bearerTransport struct {
+	token string
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token == "" {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// ctlJob is a job as returned by the API.
+type ctlJob struct {
+	ID         string        `json:"id"`
+	Kind       string        `json:"kind"`
+	Key        string        `json:"idempotencyKey"`
+	Priority   string        `json:"priority"`
+	State      string        `json:"state"`
+	Files      []string      `json:"files"`
+	Error      string        `json:"error"`
+	QueuedAt   time.Time     `json:"queuedAt"`
+	StartedAt  *time.Time    `json:"startedAt"`
+	FinishedAt *time.Time    `json:"finishedAt"`
+	Progress   *job.Progress `json:"progress"`
+}
+
+func (j *ctlJob) duration() time.Duration {
+	switch {
+	case j.StartedAt == nil:
+		return 0
+	case j.FinishedAt == nil:
+		return time.Since(*j.StartedAt).Truncate(time.Second)
+	default:
+		return j.FinishedAt.Sub(*j.StartedAt).Truncate(time.Millisecond)
+	}
+}
+
+func (c *ctlClient) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	key := fs.String("idempotency-key", "", "Idempotency-Key header value")
+	onLimit := fs.String("on-limit", onLimitReject, "What to do when export limit is reached: reject or queue")
+	format := fs.String("format", formatRDF, "Export format: rdf or json")
+	namespace := fs.Int64("namespace", 0, "Namespace to export")
+	dest := fs.String("destination", "", "Export destination url")
+	anonymous := fs.Bool("anonymous", false, "Write to destination without credentials")
+	dryRun := fs.Bool("dry-run", false, "Only log what export would do")
+	_ = fs.Parse(args)
+
+	// only flags set explicitly override daemon configuration
+	var in apiExportRequest
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "format":
+			in.Format = format
+		case "namespace":
+			in.Namespace = namespace
+		case "destination":
+			in.Destination = dest
+		case "anonymous":
+			in.Anonymous = anonymous
+		case "dry-run":
+			in.DryRun = dryRun
+		}
+	})
+
+	var body io.Reader
+	if !in.empty() {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.server+"/api/v1/export?onLimit="+url.QueryEscape(*onLimit), body)
+	if err != nil {
+		return err
+	}
+	if *key != "" {
+		req.Header.Set("Idempotency-Key", *key)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		fmt.Fprintf(c.out, "export limit is reached, job %s is queued\n", resp.Header.Get("X-Job-Id"))
+		return nil
+	}
+
+	var out apiExportResult
+	if err := json.Unmarshal(b, &out); err != nil {
+		return fmt.Errorf("job %s failed: %s", resp.Header.Get("X-Job-Id"), strings.TrimSpace(string(b)))
+	}
+	if out.Status != job.StateSucceeded {
+		if out.ErrorClass != "" {
+			return fmt.Errorf("job %s %s (%s): %s", resp.Header.Get("X-Job-Id"), out.Status, out.ErrorClass, out.Message)
+		}
+		return fmt.Errorf("job %s %s: %s", resp.Header.Get("X-Job-Id"), out.Status, out.Message)
+	}
+
+	fmt.Fprintf(c.out, "job %s succeeded in %s\n", resp.Header.Get("X-Job-Id"), time.Duration(out.DurationSeconds*float64(time.Second)).Truncate(time.Millisecond))
+	for _, file := range out.Files {
+		fmt.Fprintln(c.out, file)
+	}
+
+	return nil
+}
+
+func (c *ctlClient) status() error {
+	var st struct {
+		apiStatus
+		LastJob *ctlJob `json:"lastJob"`
+	}
+	if err := c.get("/api/v1/status", &st); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Identity:\t%s\n", st.Identity)
+	fmt.Fprintf(tw, "Leader:\t%s (this instance: %t)\n", st.Leader, st.IsLeader)
+	if h := st.LeaderInfo; h != nil {
+		fmt.Fprintf(tw, "Leader pod:\t%s/%s in cluster %q\n", h.Namespace, h.Pod, h.Cluster)
+		fmt.Fprintf(tw, "Leader version:\t%s, started at %s\n", h.Version, h.StartedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(tw, "Endpoint:\t%s\n", st.Endpoint)
+	fmt.Fprintf(tw, "Destination:\t%s\n", st.Destination)
+	fmt.Fprintf(tw, "Export period:\t%s\n", st.ExportPeriod)
+	fmt.Fprintf(tw, "Dry run:\t%t\n", st.DryRun)
+	fmt.Fprintf(tw, "Read-only:\t%t\n", st.ReadOnly)
+	fmt.Fprintf(tw, "Queued jobs:\t%d\n", st.QueueDepth)
+	fmt.Fprintf(tw, "Dgraph circuit:\t%s\n", st.Circuit)
+	fmt.Fprintf(tw, "Backup SLO:\t%s\n", st.BackupSLO)
+	if st.LastJob != nil {
+		fmt.Fprintf(tw, "Last job:\t%s %s, queued at %s\n",
+			st.LastJob.ID, st.LastJob.State, st.LastJob.QueuedAt.Format(time.RFC3339))
+	}
+	if c := st.Capabilities; c != nil {
+		fmt.Fprintf(tw, "Dgraph features:\t%s\n", capabilityList(c))
+	}
+	if r := st.Rolling; r != nil {
+		state := "running"
+		if r.FinishedAt != nil {
+			state = "finished at " + r.FinishedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "Rolling cycle:\t%d/%d namespaces exported, %d failed, %s\n", r.Succeeded, r.Total, len(r.Failed), state)
+	}
+	for _, t := range st.Tenants {
+		state := "ready"
+		if !t.Ready {
+			state = "not ready: " + t.Error
+		}
+		fmt.Fprintf(tw, "Tenant %s:\t%s, namespace %d, %s\n", t.Name, state, t.Namespace, t.Destination)
+	}
+
+	return tw.Flush()
+}
+
+func (c *ctlClient) jobs(args []string) error {
+	fs := flag.NewFlagSet("jobs", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "Stream job events until it is finished")
+	history := fs.Bool("history", false, "List finished jobs page by page")
+	limit := fs.Int("limit", job.DefaultPageSize, "Jobs per history page")
+	cursor := fs.String("cursor", "", "History page cursor printed with previous page")
+	state := fs.String("state", "", "List history jobs in state: succeeded, failed or cancelled")
+	since := fs.String("since", "", "List history jobs finished since RFC 3339 time")
+	until := fs.String("until", "", "List history jobs finished before RFC 3339 time")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		var page struct {
+			Jobs       []ctlJob
+			NextCursor string
+		}
+		if *history {
+			q := url.Values{"limit": {strconv.Itoa(*limit)}}
+			for name, value := range map[string]string{"cursor": *cursor, "state": *state, "since": *since, "until": *until} {
+				if value != "" {
+					q.Set(name, value)
+				}
+			}
+			if err := c.get("/api/v1/jobs?"+q.Encode(), &page); err != nil {
+				return err
+			}
+		} else if err := c.get("/api/v1/jobs", &page.Jobs); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tKIND\tPRIORITY\tSTATE\tQUEUED\tDURATION\tFILES\tERROR")
+		for _, j := range page.Jobs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				j.ID, j.Kind, j.Priority, j.State, j.QueuedAt.Format(time.RFC3339), j.duration(), len(j.Files), j.Error)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if page.NextCursor != "" {
+			fmt.Fprintf(c.out, "next page: -cursor %s\n", page.NextCursor)
+		}
+
+		return nil
+	}
+
+	id := fs.Arg(0)
+	if *follow {
+		return c.events(id)
+	}
+
+	var j ctlJob
+	if err := c.get("/api/v1/jobs/"+id, &j); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", j.ID)
+	fmt.Fprintf(tw, "Kind:\t%s\n", j.Kind)
+	if j.Key != "" {
+		fmt.Fprintf(tw, "Idempotency key:\t%s\n", j.Key)
+	}
+	fmt.Fprintf(tw, "Priority:\t%s\n", j.Priority)
+	fmt.Fprintf(tw, "State:\t%s\n", j.State)
+	fmt.Fprintf(tw, "Queued:\t%s\n", j.QueuedAt.Format(time.RFC3339))
+	if j.StartedAt != nil {
+		fmt.Fprintf(tw, "Started:\t%s\n", j.StartedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(tw, "Duration:\t%s\n", j.duration())
+	if pr := j.Progress; pr != nil && pr.TotalNQuads > 0 {
+		fmt.Fprintf(tw, "Restored:\t%s\n", pr)
+	} else if pr != nil {
+		fmt.Fprintf(tw, "Written:\t%d files, %d bytes\n", pr.Files, pr.Bytes)
+	}
+	if j.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", j.Error)
+	}
+	for _, file := range j.Files {
+		fmt.Fprintf(tw, "File:\t%s\n", file)
+	}
+
+	return tw.Flush()
+}
+
+func (c *ctlClient) restorePoints() error {
+	var points []restorepoint.Point
+	if err := c.get("/api/v1/restore-points", &points); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tTYPE\tFILES\tSIZE\tVERIFIED\tHELD\tPROBLEM")
+	for _, p := range points {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%t\t%t\t%s\n",
+			p.ID, p.Time.Format(time.RFC3339), p.Type, p.Files, p.Size, p.Verified, p.Held, p.Problem)
+	}
+
+	return tw.Flush()
+}
+
+func (c *ctlClient) latestExport(args []string) error {
+	fs := flag.NewFlagSet("latest-export", flag.ExitOnError)
+	typ := fs.String("type", "full", "Export type, full or delta")
+	_ = fs.Parse(args)
+
+	var e apiLatestExport
+	if err := c.get("/api/v1/exports/latest?"+url.Values{"type": {*typ}}.Encode(), &e); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s %s %s (%s)\n", e.ID, e.Type, e.CreatedAt.Format(time.RFC3339), e.Format)
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSIZE\tCHECKSUM\tURL")
+	for _, f := range e.Files {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", f.Key, f.Size, f.Checksum, f.URL)
+	}
+
+	return tw.Flush()
+}
+
+func (c *ctlClient) hold(args []string) error {
+	fs := flag.NewFlagSet("hold", flag.ExitOnError)
+	reason := fs.String("reason", "", "Why backup is held, e.g. pre-migration snapshot")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("backup id is required")
+	}
+
+	path := "/api/v1/backups/" + url.PathEscape(fs.Arg(0)) + "/hold"
+	if *reason != "" {
+		path += "?" + url.Values{"reason": {*reason}}.Encode()
+	}
+
+	var p restorepoint.Point
+	if err := c.do(http.MethodPost, path, &p); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "backup %s is held\n", p.ID)
+
+	return nil
+}
+
+func (c *ctlClient) diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	withSchema := fs.Bool("schema", false, "Compare schema summaries recorded in manifests")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("ids of two backups are required")
+	}
+
+	query := url.Values{"to": {fs.Arg(1)}}
+	if *withSchema {
+		query.Set("schema", "true")
+	}
+
+	var d restorepoint.Diff
+	if err := c.get("/api/v1/backups/"+url.PathEscape(fs.Arg(0))+"/diff?"+query.Encode(), &d); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tFROM\tTO\tCHANGE")
+	fmt.Fprintf(tw, "ID\t%s\t%s\t\n", d.From.ID, d.To.ID)
+	fmt.Fprintf(tw, "Time\t%s\t%s\t%s\n", d.From.Time.Format(time.RFC3339), d.To.Time.Format(time.RFC3339), d.To.Time.Sub(d.From.Time))
+	fmt.Fprintf(tw, "Type\t%s\t%s\t\n", d.From.Type, d.To.Type)
+	fmt.Fprintf(tw, "Files\t%d\t%d\t%+d\n", d.From.Files, d.To.Files, d.FilesChange)
+	fmt.Fprintf(tw, "Size\t%d\t%d\t%+d (%s)\n", d.From.Size, d.To.Size, d.SizeChange, percentChange(d.From.Size, d.SizeChange))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, name := range d.AddedFiles {
+		fmt.Fprintf(c.out, "+ %s\n", name)
+	}
+	for _, name := range d.RemovedFiles {
+		fmt.Fprintf(c.out, "- %s\n", name)
+	}
+	for _, f := range d.ChangedFiles {
+		fmt.Fprintf(c.out, "~ %s: %d -> %d bytes\n", f.Name, f.FromSize, f.ToSize)
+	}
+
+	switch {
+	case !*withSchema:
+	case d.Schema == nil:
+		fmt.Fprintln(c.out, "Schema: not recorded in manifests")
+	default:
+		fmt.Fprintf(c.out, "Schema: %s\n", d.Schema)
+	}
+
+	return nil
+}
+
+// percentChange formats change relative to base size.
+func percentChange(base, change int64) string {
+	if base == 0 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%+.1f%%", float64(change)*100/float64(base))
+}
+
+func (c *ctlClient) delete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	force := fs.Bool("force", false, "Delete held backup, the last verified one or any backup while there is no fresh one")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("backup id is required")
+	}
+
+	path := "/api/v1/backups/" + url.PathEscape(fs.Arg(0))
+	if *force {
+		path += "?force=true"
+	}
+	if err := c.do(http.MethodDelete, path, nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "backup %s is deleted\n", fs.Arg(0))
+
+	return nil
+}
+
+func (c *ctlClient) cancel(args []string) error {
+	if len(args) != 1 {
+		return errors.New("job id is required")
+	}
+
+	var j ctlJob
+	if err := c.do(http.MethodDelete, "/api/v1/jobs/"+url.PathEscape(args[0]), &j); err != nil {
+		return err
+	}
+	if job.State(j.State) == job.StateQueued || job.State(j.State) == job.StateRunning {
+		fmt.Fprintf(c.out, "job %s is being cancelled\n", j.ID)
+	} else {
+		fmt.Fprintf(c.out, "job %s is cancelled\n", j.ID)
+	}
+
+	return nil
+}
+
+// copy copies backup with daemon credentials, target credentials
+// can be passed with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func (c *ctlClient) copy(args []string) error {
+	if len(args) != 2 {
+		return errors.New("backup id and destination are required")
+	}
+
+	body, err := json.Marshal(apiCopyRequest{
+		Destination: args[1],
+		AccessKey:   os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:   os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Post(c.server+"/api/v1/backups/"+url.PathEscape(args[0])+"/copy",
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	var p restorepoint.Point
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "backup %s copied, %d files, %d bytes\n", p.ID, p.Files, p.Size)
+
+	return nil
+}
+
+// restore queues restore of backup, password of target cluster user
+// can be passed with DGRAPH_PASSWORD and password of restored namespace
+// groot with DGRAPH_NAMESPACE_PASSWORD.
+func (c *ctlClient) restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	alpha := fs.String("alpha", "", "Target cluster alpha gRPC address")
+	zero := fs.String("zero", "", "Target cluster zero gRPC address")
+	user := fs.String("user", "", "Target cluster user, required with ACL")
+	source := fs.Int64("source-namespace", restore.AllNamespaces, "Namespace of backup to restore, -1 restores all of them; namespace of the backup is restored with scoped token")
+	target := fs.Int64("target-namespace", restore.AllNamespaces, "Namespace data is loaded into, -1 keeps backup namespaces; source namespace is used with scoped token")
+	materialize := fs.Bool("materialize", false, "Merge differential exports taken on top of backup into it before loading")
+	admin := fs.String("admin", "", "Target cluster HTTP admin endpoint, e.g. http://alpha:8080/admin, required to create namespace or apply ACL")
+	createNamespace := fs.Bool("create-namespace", false, "Create restored namespace unless it exists, user has to be guardian of the galaxy")
+	applyACL := fs.Bool("apply-acl", false, "Create ACL groups recorded at export time in restored namespace")
+	applyGQLSchema := fs.Bool("apply-graphql-schema", false, "Apply GraphQL schema captured at export time once data is loaded")
+	follow := fs.Bool("follow", false, "Stream job events until it is finished")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("backup id is required")
+	}
+
+	in := apiRestoreRequest{
+		Backup:      fs.Arg(0),
+		Alpha:       *alpha,
+		Zero:        *zero,
+		User:        *user,
+		Password:    os.Getenv("DGRAPH_PASSWORD"),
+		Materialize: *materialize,
+
+		Admin:              *admin,
+		CreateNamespace:    *createNamespace,
+		ApplyACL:           *applyACL,
+		ApplyGraphQLSchema: *applyGQLSchema,
+		NamespacePassword:  os.Getenv("DGRAPH_NAMESPACE_PASSWORD"),
+	}
+	// unset namespaces are chosen by server, e.g. for scoped tokens
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "source-namespace":
+			in.SourceNamespace = source
+		case "target-namespace":
+			in.TargetNamespace = target
+		}
+	})
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Post(c.server+"/api/v1/restore", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := readResponse(resp); err != nil {
+		return err
+	}
+
+	id := resp.Header.Get("X-Job-Id")
+	if *follow {
+		return c.events(id)
+	}
+	fmt.Fprintf(c.out, "restore job %s queued\n", id)
+
+	return nil
+}
+
+func (c *ctlClient) release(args []string) error {
+	if len(args) != 1 {
+		return errors.New("backup id is required")
+	}
+
+	var p restorepoint.Point
+	if err := c.do(http.MethodDelete, "/api/v1/backups/"+url.PathEscape(args[0])+"/hold", &p); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "backup %s is released\n", p.ID)
+
+	return nil
+}
+
+func (c *ctlClient) catalog(args []string) error {
+	if len(args) == 0 || args[0] != "rebuild" {
+		return errors.New("unknown catalog command, only rebuild is supported")
+	}
+
+	fs := flag.NewFlagSet("catalog rebuild", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show exports manifests would be written for")
+	_ = fs.Parse(args[1:])
+
+	path := "/api/v1/catalog/rebuild"
+	if *dryRun {
+		path += "?dryRun=true"
+	}
+
+	var out apiCatalogRebuildResponse
+	if err := c.do(http.MethodPost, path, &out); err != nil {
+		return err
+	}
+	for _, id := range out.Rebuilt {
+		fmt.Fprintln(c.out, id)
+	}
+	verb := "rebuilt"
+	if out.DryRun {
+		verb = "would be rebuilt"
+	}
+	fmt.Fprintf(c.out, "%d exports %s\n", len(out.Rebuilt), verb)
+
+	return nil
+}
+
+func (c *ctlClient) prune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show exports retention policy would be applied to")
+	_ = fs.Parse(args)
+
+	path := "/api/v1/prune"
+	if *dryRun {
+		path += "?dryRun=true"
+	}
+
+	var out apiPruneResponse
+	if err := c.do(http.MethodPost, path, &out); err != nil {
+		return err
+	}
+	for _, id := range out.Pruned {
+		fmt.Fprintln(c.out, id)
+	}
+	verb := "are processed"
+	if out.DryRun {
+		verb = "would be processed"
+	}
+	fmt.Fprintf(c.out, "%d exports %s with %s action\n", len(out.Pruned), verb, out.Action)
+	if len(out.Expiring) > 0 {
+		fmt.Fprintf(c.out, "%d more exports expire before the next export: %s\n", len(out.Expiring), strings.Join(out.Expiring, ", "))
+	}
+
+	return nil
+}
+
+func (c *ctlClient) tokens(args []string) error {
+	cmd := "list"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "list":
+		var tokens []apiauth.StoredToken
+		if err := c.get("/api/v1/tokens", &tokens); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tROLE\tNAMESPACES\tCREATED\tROTATED")
+		for _, t := range tokens {
+			namespaces := make([]string, 0, len(t.Namespaces))
+			for _, ns := range t.Namespaces {
+				namespaces = append(namespaces, strconv.FormatInt(ns, 10))
+			}
+			rotated := ""
+			if t.RotatedAt != nil {
+				rotated = t.RotatedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				t.Name, t.Role, strings.Join(namespaces, ","), t.CreatedAt.Format(time.RFC3339), rotated)
+		}
+
+		return tw.Flush()
+	case "create":
+		fs := flag.NewFlagSet("tokens create", flag.ExitOnError)
+		role := fs.String("role", string(apiauth.RoleOperator), "Token role, one of: admin, operator, viewer")
+		namespaces := fs.String("namespaces", "", "Comma separated namespaces and ranges token is scoped to, e.g. 1,5-10")
+		_ = fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errors.New("token name is required")
+		}
+
+		in := apiTokenRequest{Name: fs.Arg(0), Role: apiauth.Role(*role)}
+		var err error
+		if in.Namespaces, err = parseNamespaces(*namespaces); err != nil {
+			return err
+		}
+		body, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		return c.issueToken(http.MethodPost, "/api/v1/tokens", bytes.NewReader(body))
+	case "rotate":
+		if len(args) != 1 {
+			return errors.New("token name is required")
+		}
+
+		return c.issueToken(http.MethodPost, "/api/v1/tokens/"+url.PathEscape(args[0])+"/rotate", nil)
+	case "delete":
+		if len(args) != 1 {
+			return errors.New("token name is required")
+		}
+
+		if err := c.do(http.MethodDelete, "/api/v1/tokens/"+url.PathEscape(args[0]), nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "token %s is revoked\n", args[0])
+
+		return nil
+	default:
+		return fmt.Errorf("unknown tokens command %q", cmd)
+	}
+}
+
+// issueToken requests token creation or rotation and prints its value,
+// which can't be got again.
+func (c *ctlClient) issueToken(method, path string, body io.Reader) error {
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	var t apiTokenResponse
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "token %s with role %s, it isn't shown again:\n", t.Name, t.Role)
+	fmt.Fprintln(c.out, t.Token)
+
+	return nil
+}
+
+func (c *ctlClient) schemaChanged(args []string) error {
+	fs := flag.NewFlagSet("schema-changed", flag.ExitOnError)
+	key := fs.String("idempotency-key", "", "Idempotency-Key header value, e.g. migration version")
+	_ = fs.Parse(args)
+
+	req, err := http.NewRequest(http.MethodPost, c.server+"/api/v1/hooks/schema-changed", nil)
+	if err != nil {
+		return err
+	}
+	if *key != "" {
+		req.Header.Set("Idempotency-Key", *key)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := readResponse(resp); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "export job %s is started\n", resp.Header.Get("X-Job-Id"))
+
+	return nil
+}
+
+func (c *ctlClient) stateExport() error {
+	var snap json.RawMessage
+	if err := c.get("/api/v1/state/export", &snap); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, snap, "", "  "); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, b.String())
+
+	return nil
+}
+
+func (c *ctlClient) version() error {
+	fmt.Fprintf(c.out, "Client: %s\n", buildinfo.Get())
+
+	var info buildinfo.Info
+	if err := c.get("/api/v1/version", &info); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Server: %s\n", info)
+
+	return nil
+}
+
+// events prints job events streamed by the server until the stream ends.
+func (c *ctlClient) events(id string) error {
+	resp, err := c.client.Get(c.server + "/api/v1/jobs/" + id + "/events")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, err := readResponse(resp)
+		return err
+	}
+
+	for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event struct {
+			Time    time.Time `json:"time"`
+			Type    string    `json:"type"`
+			Message string    `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.out, "%s\t%s\t%s\n", event.Time.Format(time.RFC3339), event.Type, event.Message)
+	}
+
+	return nil
+}
+
+func (c *ctlClient) get(path string, v interface{}) error {
+	return c.do(http.MethodGet, path, v)
+}
+
+func (c *ctlClient) do(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, c.server+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := readResponse(resp)
+	if err != nil || v == nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func readResponse(resp *http.Response) ([]byte, error) {
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		msg := strings.TrimSpace(string(b))
+		if msg == "" {
+			msg = resp.Status
+		}
+
+		return nil, errors.New(msg)
+	}
+
+	return b, nil
+}
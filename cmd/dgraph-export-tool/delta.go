@@ -0,0 +1,175 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/checksum"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/delta"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/request"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+const deltaDirPrefix = "dgraph.delta."
+
+// deltaExport configures experimental differential exports.
+type deltaExport struct {
+	predicate string
+	interval  time.Duration
+	pageSize  int
+}
+
+// queryEndpoint returns alpha /query endpoint next to /admin one.
+func (p *dgraphParams) queryEndpoint() string {
+	return strings.TrimSuffix(p.adminEndpoint(), "/admin") + "/query"
+}
+
+// deltaLoop runs differential export every p.deltaExport.interval
+// while instance is leading.
+func (p *dgraphParams) deltaLoop(ctx context.Context) {
+	t := time.NewTicker(p.deltaExport.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			j, _ := p.jobs.Start(ctx, job.KindDelta, "", job.PriorityScheduled, p.runDelta)
+			if _, err := j.Wait(ctx); err != nil {
+				klog.Errorf("differential export failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runDelta exports nodes modified since the newest verified full export
+// or the latest delta on top of it.
+func (p *dgraphParams) runDelta(ctx context.Context) (*export.ExportOutput, error) {
+	ctx = request.WithID(ctx, request.NewID())
+
+	creds, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := p.newStorage(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := restorepoint.List(ctx, s, p.pointOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	base, since, err := deltaStart(points)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := delta.NewClient(p.queryEndpoint(), p.deltaExport.predicate,
+		delta.WithPageSize(p.deltaExport.pageSize),
+		delta.WithAuthToken(creds.authToken),
+		delta.WithAPIKey(creds.apiKey),
+		delta.WithRetries(p.retries),
+		delta.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	until := time.Now().UTC()
+	key := deltaDirPrefix + until.Format("20060102.150405") + "/delta.json.gz"
+	if p.dryRun {
+		klog.Infof("dry-run: would export nodes with %s since %s on top of %s to %s", p.deltaExport.predicate, since, base, key)
+		return &export.ExportOutput{}, nil
+	}
+
+	f, err := os.CreateTemp(runTmpDir(ctx, p.liveLoader.tmpDir), "delta-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// checksum is computed while compressed delta is written
+	cw := checksum.NewWriter(f)
+	zw := gzip.NewWriter(cw)
+	nodes, err := c.Export(ctx, zw, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export delta: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, key, f, size); err != nil {
+		return nil, fmt.Errorf("failed to upload delta: %w", err)
+	}
+	klog.Infof("exported %d nodes modified since %s to %s", nodes, since, key)
+	job.Report(ctx, "exported", "%s (%d nodes)", key, nodes)
+
+	m := &manifest.Manifest{
+		CreatedAt:   until,
+		Destination: redact.URL(p.dest),
+		Format:      "json",
+		Files:       []string{key},
+		Sizes:       map[string]int64{key: size},
+		Checksums:   map[string]string{key: cw.Sum()},
+		ToolVersion: buildinfo.Get().Version,
+		Pod:         p.podInfo(),
+		Delta: &manifest.Delta{
+			Base:      base,
+			Since:     since,
+			Predicate: p.deltaExport.predicate,
+		},
+	}
+	if _, err := m.Write(ctx, s, p.signer); err != nil {
+		return nil, fmt.Errorf("failed to write delta manifest: %w", err)
+	}
+	p.notifyExport(ctx, creds, m)
+
+	return &export.ExportOutput{ExportedFiles: []graphql.String{graphql.String(key)}}, nil
+}
+
+// deltaStart returns the newest verified restorable export among points
+// and time the next delta on top of it starts at.
+func deltaStart(points []restorepoint.Point) (base string, since time.Time, err error) {
+	for _, point := range points {
+		if point.Restorable() && point.Verified {
+			base, since = point.ID, point.Time
+			break
+		}
+	}
+	if base == "" {
+		return "", time.Time{}, errors.New("no verified full export to take delta on top of")
+	}
+
+	for _, point := range points {
+		if point.Type == restorepoint.TypeDelta && point.Base == base && point.Time.After(since) {
+			since = point.Time
+		}
+	}
+
+	return base, since, nil
+}
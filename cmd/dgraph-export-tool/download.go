@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/download"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+// downloadDirPrefix starts directories downloaded exports are stored in,
+// it's the prefix of Dgraph export directories to be listed with them.
+const downloadDirPrefix = "dgraph."
+
+// downloadURLs returns URLs export files have to be downloaded from:
+// signed URLs of Dgraph Cloud or exported files served over HTTP.
+func downloadURLs(resp *export.ExportOutput) []string {
+	urls := append([]string{}, resp.SignedURLs...)
+	for _, file := range resp.GetFiles() {
+		if download.IsURL(file) {
+			urls = append(urls, file)
+		}
+	}
+
+	return urls
+}
+
+// downloadExport stores files served at urls at destination and replaces
+// them in exported files of resp with their keys, so the rest of export
+// handling doesn't differ from exports written by Dgraph itself.
+func (p *dgraphParams) downloadExport(ctx context.Context, creds *credentials, resp *export.ExportOutput, urls []string) error {
+	s, err := p.newStorage(creds)
+	if err != nil {
+		return err
+	}
+
+	dir := downloadDir(urls[0], time.Now())
+	job.Report(ctx, "download", "downloading %d exported files into %s", len(urls), dir)
+
+	keys, err := download.New(http.DefaultClient, s, runTmpDir(ctx, os.TempDir()),
+		download.WithRetries(p.retries),
+		download.WithPool(p.workers),
+	).Files(ctx, dir, urls)
+	if err != nil {
+		// files of cancelled download would look like incomplete export
+		if ctx.Err() != nil {
+			if err := restorepoint.DeleteObjects(context.WithoutCancel(ctx), s, dir); err != nil {
+				klog.Warningf("failed to remove files of cancelled download: %v", err)
+			}
+		}
+		return err
+	}
+	klog.Infof("downloaded %d exported files into %s", len(keys), dir)
+
+	files := make([]graphql.String, 0, len(resp.ExportedFiles))
+	for _, file := range resp.ExportedFiles {
+		if !download.IsURL(string(file)) {
+			files = append(files, file)
+		}
+	}
+	for _, key := range keys {
+		files = append(files, graphql.String(key))
+	}
+	resp.ExportedFiles = files
+
+	return nil
+}
+
+// downloadDir returns directory downloaded files are stored in, Dgraph
+// export directory name is kept when files are served from one.
+func downloadDir(rawURL string, now time.Time) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if dir := path.Base(path.Dir(u.Path)); strings.HasPrefix(dir, downloadDirPrefix) {
+			return dir
+		}
+	}
+
+	return downloadDirPrefix + "download." + now.UTC().Format("20060102.150405")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+// lateRuns is number of late scheduled exports in a row
+// after which every next late one is warned about.
+const lateRuns = 3
+
+// driftTracker compares starts of scheduled exports with the time they
+// are due by export period, so exports shifted by long runs, deferrals
+// or leadership changes are noticed. It's kept while this instance
+// loses and regains leadership.
+type driftTracker struct {
+	mu sync.Mutex
+	// due is time the next scheduled export should start at.
+	due  time.Time
+	late int
+}
+
+// recordDrift observes how late scheduled export st started and
+// counts when the next one is due.
+func (p *dgraphParams) recordDrift(st job.Status) {
+	if st.StartedAt.IsZero() {
+		return
+	}
+
+	d := p.drift
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.due.IsZero() {
+		drift := max(st.StartedAt.Sub(d.due), 0)
+		metrics.ExportPeriodDrift.WithLabelValues(p.metricsRun().Values()...).Observe(drift.Seconds())
+
+		// tenth of period absorbs probes and short deferrals
+		if drift > p.period/10 {
+			d.late++
+		} else {
+			d.late = 0
+		}
+		if d.late >= lateRuns {
+			klog.Warningf("%d scheduled exports in a row started late, the last one by %s of period %s; check export duration, deferrals and leadership changes",
+				d.late, drift.Truncate(time.Second), p.period)
+		}
+	}
+
+	anchor := st.StartedAt
+	if p.anchor == scheduleAnchorCompletion && !st.FinishedAt.IsZero() {
+		anchor = st.FinishedAt
+	}
+	d.due = anchor.Add(p.period)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"path"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/request"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/events"
+)
+
+// emit publishes lifecycle event of run ctx belongs to.
+func (p *dgraphParams) emit(ctx context.Context, e events.Event) {
+	e.RunID = request.ID(ctx)
+	e.Identity = p.identity
+	p.events.Emit(e)
+}
+
+// exportDir returns directory of exported files, Dgraph writes all files
+// of single export into one directory.
+func exportDir(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	return path.Dir(files[0])
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+)
+
+// legacy returns whether Dgraph is accessed with HTTP admin endpoints
+// of versions without GraphQL admin API.
+func (p *dgraphParams) legacy() bool {
+	return p.flavor == apiFlavorLegacy
+}
+
+// findLegacyFiles fills files of export requested with legacy endpoint,
+// which doesn't report them: they are files of the newest export dir
+// written to destination since start. Manifest and retention need them,
+// so missing files are only warned about.
+func (p *dgraphParams) findLegacyFiles(ctx context.Context, creds *credentials, resp *export.ExportOutput, start time.Time) {
+	s, err := p.newStorage(creds)
+	if err != nil {
+		klog.Warningf("failed to find files of legacy export: %v", err)
+		return
+	}
+	objects, err := s.List(ctx, "")
+	if err != nil {
+		klog.Warningf("failed to find files of legacy export: %v", err)
+		return
+	}
+
+	var (
+		dir    string
+		newest time.Time
+	)
+	for _, obj := range objects {
+		d := path.Dir(obj.Key)
+		if obj.LastModified.Before(start) || !strings.HasPrefix(path.Base(d), "dgraph.") {
+			continue
+		}
+		if obj.LastModified.After(newest) {
+			dir, newest = d, obj.LastModified
+		}
+	}
+	if dir == "" {
+		klog.Warningf("no files of legacy export were found at destination, is it alpha export dir?")
+		return
+	}
+
+	var files []string
+	for _, obj := range objects {
+		if path.Dir(obj.Key) == dir && !obj.LastModified.Before(start) {
+			files = append(files, obj.Key)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		resp.ExportedFiles = append(resp.ExportedFiles, graphql.String(file))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+const groupPollInterval = 10 * time.Second
+
+// groupFileRe matches files written by group leaders, e.g. g01.rdf.gz.
+var groupFileRe = regexp.MustCompile(`^g(\d+)\.`)
+
+// waitGroups waits until files of every cluster group appear at destination
+// and records per-group status in cluster metadata. Each group leader
+// writes its own files, so export is incomplete until all of them are there.
+func (p *dgraphParams) waitGroups(ctx context.Context, creds *credentials, cluster *manifest.Cluster, files []string) error {
+	if len(cluster.Groups) == 0 {
+		klog.Warning("skip waiting for group files: cluster groups are unknown")
+		return nil
+	}
+
+	expected := make(map[uint64][]string)
+	for _, file := range files {
+		m := groupFileRe.FindStringSubmatch(path.Base(file))
+		if m == nil {
+			continue
+		}
+		id, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		expected[id] = append(expected[id], file)
+	}
+
+	list := func(ctx context.Context) (map[string]bool, error) {
+		found := make(map[string]bool, len(files))
+		for _, file := range files {
+			found[file] = true
+		}
+
+		return found, nil
+	}
+
+	s, err := p.newStorage(creds)
+	switch {
+	case errors.Is(err, storage.ErrUnsupported):
+		klog.Warningf("group files are checked against export response only: %v", err)
+	case err != nil:
+		return err
+	default:
+		list = func(ctx context.Context) (map[string]bool, error) {
+			objects, err := s.List(ctx, path.Dir(files[0]))
+			if err != nil {
+				return nil, err
+			}
+			found := make(map[string]bool, len(objects))
+			for _, obj := range objects {
+				found[obj.Key] = true
+			}
+
+			return found, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.groupWait)
+	defer cancel()
+
+	for {
+		found, err := list(ctx)
+		if err != nil && ctx.Err() == nil {
+			klog.Warningf("failed to list group files: %v", err)
+		}
+
+		missing := 0
+		for i := range cluster.Groups {
+			g := &cluster.Groups[i]
+			g.Files = expected[g.ID]
+			g.Status = manifest.GroupComplete
+			if len(g.Files) == 0 {
+				g.Status = manifest.GroupMissing
+			}
+			for _, file := range g.Files {
+				if !found[file] {
+					g.Status = manifest.GroupMissing
+				}
+			}
+			if g.Status == manifest.GroupMissing {
+				missing++
+			}
+		}
+
+		if missing == 0 {
+			for _, g := range cluster.Groups {
+				job.Report(ctx, "group", "group %d: %d files written", g.ID, len(g.Files))
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, g := range cluster.Groups {
+				job.Report(ctx, "group", "group %d: %s", g.ID, g.Status)
+			}
+			return fmt.Errorf("%w: files of %d of %d groups are missing at destination: %w",
+				failure.ErrPartialExport, missing, len(cluster.Groups), ctx.Err())
+		case <-time.After(groupPollInterval):
+		}
+	}
+}
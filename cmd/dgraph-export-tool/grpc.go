@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/grpcapi"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	apiv1 "github.com/sputnik-systems/dgraph-export-tool/pkg/api/v1"
+)
+
+// grpcBackend serves gRPC API calls beyond export jobs with the same
+// checks as HTTP API handlers.
+type grpcBackend struct {
+	p *dgraphParams
+}
+
+func (b grpcBackend) Status(ctx context.Context) (*apiv1.Status, error) {
+	st := b.p.status(ctx)
+
+	resp := &apiv1.Status{
+		Identity:     st.Identity,
+		Leader:       st.Leader,
+		IsLeader:     st.IsLeader,
+		DryRun:       st.DryRun,
+		ReadOnly:     st.ReadOnly,
+		Endpoint:     st.Endpoint,
+		Destination:  st.Destination,
+		ExportPeriod: st.ExportPeriod,
+		QueueDepth:   int64(st.QueueDepth),
+		Circuit:      st.Circuit,
+		BackupSlo:    st.BackupSLO,
+	}
+	if st.NextExport != nil {
+		resp.NextExport = timestamppb.New(*st.NextExport)
+	}
+	if st.LastJob != nil {
+		resp.LastJob = grpcapi.JobProto(*st.LastJob)
+	}
+
+	return resp, nil
+}
+
+func (b grpcBackend) RestorePoints(ctx context.Context) ([]restorepoint.Point, error) {
+	s, err := b.destination()
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := b.p.restorePoints(ctx, s)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return points, nil
+}
+
+func (b grpcBackend) Restore(ctx context.Context, req *apiv1.RestoreRequest) (job.Func, error) {
+	in := apiRestoreRequest{
+		Backup:             req.GetBackup(),
+		Alpha:              req.GetAlpha(),
+		Zero:               req.GetZero(),
+		User:               req.GetUser(),
+		Password:           req.GetPassword(),
+		SourceNamespace:    req.SourceNamespace,
+		TargetNamespace:    req.TargetNamespace,
+		Materialize:        req.GetMaterialize(),
+		Admin:              req.GetAdmin(),
+		CreateNamespace:    req.GetCreateNamespace(),
+		ApplyACL:           req.GetApplyAcl(),
+		ApplyGraphQLSchema: req.GetApplyGraphqlSchema(),
+		NamespacePassword:  req.GetNamespacePassword(),
+	}
+	if err := in.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if t := apiauth.FromContext(ctx); t.Scoped() {
+		s, err := b.destination()
+		if err != nil {
+			return nil, err
+		}
+		point, err := restorepoint.Get(ctx, s, in.Backup, b.p.pointOptions()...)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		if err := scopeRestore(t, &in, point); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	return b.p.restoreFunc(in.Backup, in.options()), nil
+}
+
+func (b grpcBackend) Prune(ctx context.Context, dryRun bool) (*apiv1.PruneResponse, error) {
+	dryRun = dryRun || b.p.dryRun
+	if err := b.p.pruneAllowed(dryRun); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	s, err := b.destination()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned, err := b.p.applyRetention(ctx, s, dryRun)
+	if errors.Is(err, restorepoint.ErrProtected) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	klog.Infof("retention applied by %s to %d exports, dry-run: %t", contextTokenName(ctx), len(pruned), dryRun)
+
+	resp := &apiv1.PruneResponse{
+		Action: string(b.p.retention.Action),
+		Pruned: pruned,
+		DryRun: dryRun,
+	}
+	if dryRun {
+		if resp.Expiring, err = b.p.expiring(ctx, s, pruned); err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+	}
+
+	return resp, nil
+}
+
+// destination opens destination, failures are gRPC status errors.
+func (b grpcBackend) destination() (storage.Storage, error) {
+	s, err := b.p.destination()
+	if errors.Is(err, storage.ErrUnsupported) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return s, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/health"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/state"
+)
+
+// exportEndpoint returns endpoint export is requested at, it's dedicated
+// replica when configured, so export I/O doesn't hit serving alphas.
+func (p *dgraphParams) exportEndpoint() string {
+	if p.exportURL != "" {
+		return p.exportURL
+	}
+
+	return p.endpoint
+}
+
+// checkLearner ensures dedicated export endpoint is served by learner
+// alpha: its address reported by /health is looked up in cluster state.
+func (p *dgraphParams) checkLearner(ctx context.Context, creds *credentials) error {
+	if p.exportURL == "" || !p.learner {
+		return nil
+	}
+
+	hc, err := health.NewClient(p.exportURL,
+		health.WithAuthToken(creds.authToken),
+		health.WithAPIKey(creds.apiKey),
+		health.WithRetries(p.retries),
+		health.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		return err
+	}
+	self, err := hc.Self(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get export endpoint node: %w", err)
+	}
+
+	sc, err := state.NewClient(p.adminEndpoint(),
+		state.WithAuthToken(creds.authToken),
+		state.WithAPIKey(creds.apiKey),
+		state.WithRetries(p.retries),
+		state.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		return err
+	}
+	members, err := sc.Members(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster members: %w", err)
+	}
+
+	for _, m := range members {
+		if m.Addr != self.Address {
+			continue
+		}
+		if !m.Learner {
+			return fmt.Errorf("export endpoint node %s is not a learner", self.Address)
+		}
+		klog.V(2).Infof("export endpoint node %s is a learner", self.Address)
+		return nil
+	}
+
+	return fmt.Errorf("export endpoint node %s is not a member of the cluster", self.Address)
+}
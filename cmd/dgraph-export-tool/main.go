@@ -2,78 +2,673 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"github.com/preved911/resourcelock/ydb"
-	ydbenv "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+	"github.com/redis/go-redis/v9"
 	ydbsdk "github.com/ydb-platform/ydb-go-sdk/v3"
 	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/klog"
 
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/breaker"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
 	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/health"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/load"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/request"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/events"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/fault"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/grpcapi"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/lease"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/notify"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/podinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ratelimit"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restore"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/retention"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/secret"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/signing"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/slo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/tenant"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/worker"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ydbschema"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctl(os.Args[2:]))
+	}
+
 	klog.InitFlags(nil)
 
+	showVersion := flag.Bool("version", false, "Print version and exit")
+	flag.String("config", "", "JSON file mapping flag names to values; flags given on command line take precedence over "+envPrefix+"* environment variables, which take precedence over the file")
 	dgraphEndpointURL := flag.String("dgraph.endpoint-url", "http://localhost:8080/admin", "Dgraph instance admin endpoint")
+	dgraphExportEndpointURL := flag.String("dgraph.export-endpoint-url", "", "Admin endpoint of dedicated replica exports are requested at, e.g. http://alpha-learner:8080/admin, dgraph.endpoint-url is used if empty")
+	dgraphExportEndpointLearner := flag.Bool("dgraph.export-endpoint-learner", true, "Require dgraph.export-endpoint-url node to be a learner according to cluster state")
 	dgraphExportDest := flag.String("dgraph.export-dest", "", "Dgraph export export destination url")
+	dgraphExportFormats := flag.String("dgraph.export-formats", formatRDF, "Comma separated formats, rdf and json, each export run is made in one after another, e.g. rdf,json for disaster recovery and analytics; retention.keep-last counts exports of every format, only rdf ones are restorable and count as fresh backups")
 	dgraphExportPeriod := flag.Duration("dgraph.export-period", time.Hour, "Dgraph export period")
+	dgraphExportScheduleAnchor := flag.String("dgraph.export-schedule-anchor", scheduleAnchorStart, "Count export period from previous export start or completion, one of: start, completion")
+	dgraphExportAnonymous := flag.Bool("dgraph.export-anonymous", false, "Access export destination without credentials, e.g. public buckets or in-cluster MinIO")
+	dgraphExportStallTimeout := flag.Duration("dgraph.export-stall-timeout", 0, "Export request is cancelled and retried when tracked progress doesn't advance for this long, 0 disables stall detection; time progress isn't observable is not counted, e.g. export to S3 without Dgraph tmp dir shared with the tool, and stalled export is retried once alpha stops refusing it as busy")
+	dgraphExportStallRetries := flag.Int("dgraph.export-stall-retries", 1, "How many times stalled export is retried before the run fails")
+	dgraphExportProgressInterval := flag.Duration("dgraph.export-progress-interval", 30*time.Second, "How often written files of running export are counted, 0 disables progress tracking")
+	dgraphExportValidateSample := flag.Int("dgraph.export-validate-sample", 0, "Number of exported files picked at random, read back and parsed after export, so truncated or corrupted files fail it: gzip has to be intact and data valid RDF or JSON; 0 disables validation")
+	dgraphExportGroupWait := flag.Duration("dgraph.export-group-wait", 0, "Wait up to this long for files of every alpha group to appear at destination before export succeeds, 0 disables the check")
+	dgraphExportRetentionMode := flag.String("dgraph.export-retention-mode", "", "Object Lock retention mode set on exported files, one of: GOVERNANCE, COMPLIANCE, empty disables retention")
+	dgraphExportRetentionPeriod := flag.Duration("dgraph.export-retention-period", 30*24*time.Hour, "How long exported files are retained with Object Lock")
+	dgraphExportMinFreeBytes := flag.Uint64("dgraph.export-min-free-bytes", 0, "Fail exports when local destination mount has less free bytes, 0 disables the check")
 	dgraphExportTmpPrefix := flag.String("dgraph.export-tmp-prefix", "/tmp", "Dgraph export temporary dir prefix")
 	dgraphExportTmpPattern := flag.String("dgraph.export-tmp-pattern", `export[0-9]*`, "Dgraph export temporary files name pattern")
 	dgraphExportTmpCleanup := flag.Bool("dgraph.export-tmp-cleanup", false, "Dgraph export temporary dir cleanup")
+	dgraphExportTmpDirTemplate := flag.String("dgraph.export-tmp-dir-template", "", "Directory created for every export run for its local files, e.g. downloaded or delta export files, and removed after it; {run} and {time} are replaced with run ID and start time, run ID subdirectory is used if template has no {run}. When set, tmp dir cleanup removes only Dgraph tmp dirs created during the run")
+	dgraphExportTmpMinAge := flag.Duration("dgraph.export-tmp-min-age", 10*time.Minute, "Dgraph export temporary dirs modified more recently are kept by cleanup, as they may still be written to")
+	dgraphAccessKeyFile := flag.String("dgraph.access-key-file", "", "File with destination access key, AWS_ACCESS_KEY_ID is used if empty")
+	dgraphSecretKeyFile := flag.String("dgraph.secret-key-file", "", "File with destination secret key, AWS_SECRET_ACCESS_KEY is used if empty")
+	dgraphAuthTokenFile := flag.String("dgraph.auth-token-file", "", "File with Dgraph admin auth token, DGRAPH_AUTH_TOKEN is used if empty")
+	dgraphAPIKeyFile := flag.String("dgraph.api-key-file", "", "File with Dgraph Cloud API key, DGRAPH_API_KEY is used if empty; exports are downloaded from signed URLs when it's set")
+	dgraphUserAgent := flag.String("dgraph.user-agent", "", "User-Agent of Dgraph admin requests, dgraph-export-tool/<version> is used if empty")
+	dgraphAPIFlavor := flag.String("dgraph.api-flavor", apiFlavorGraphQL, "Dgraph admin API exports are requested with, one of: graphql, legacy; legacy uses HTTP /admin/export of v1.x and v20.x alphas, export files are then looked up at destination, which must be alpha export dir, and namespace and anonymous exports are unsupported")
+	dgraphRetryAttempts := flag.Int("dgraph.retry-attempts", 3, "Attempts of Dgraph admin requests failed with transient errors, e.g. 502, 503 or connection reset. Export requests are retried only when they failed before being sent or with 502 or 503")
+	dgraphCircuitThreshold := flag.Int("dgraph.circuit-breaker-threshold", 5, "Consecutive failed exports after which requests to Dgraph are suspended, 0 disables circuit breaker")
+	dgraphBusyRetryDelay := flag.Duration("dgraph.busy-retry-delay", 5*time.Minute, "Delay of export retried after alpha refused it running another operation or draining, doubled on every refusal in a row up to export period; 0 waits for the next scheduled export")
+	dgraphCircuitProbeInterval := flag.Duration("dgraph.circuit-breaker-probe-interval", time.Minute, "Dgraph health probe interval while circuit breaker is open")
+	retentionKeepLast := flag.Int("retention.keep-last", 0, "Number of newest exports of the cluster and of every namespace kept regardless of age, 0 with zero max age disables retention")
+	retentionMaxAge := flag.Duration("retention.max-age", 0, "Age after which exports not among kept newest ones expire")
+	retentionAction := flag.String("retention.action", string(retention.ActionDelete), "What to do with expired exports, one of: delete, transition; transition copies objects onto themselves, so versioned buckets, e.g. ones with Object Lock, keep previous versions in former storage class until lifecycle rule expires noncurrent versions")
+	retentionStorageClass := flag.String("retention.storage-class", "GLACIER", "Storage class expired exports are moved to by transition action")
+	retentionMaxTotalSize := flag.String("retention.max-total-size", "", "Total size of exports of the cluster and of every namespace at destination, e.g. 2TB or 500GiB, oldest exports with their deltas are deleted after each run until the rest fits; held exports and the newest verified full export are kept. Empty disables the quota")
+	retentionFreshness := flag.Duration("retention.freshness-window", 0, "Expired exports and backups deleted with API are only deleted when a verified full RDF export was made within this window, so the last good backups survive outages; 0 disables the check")
+	sloWindow := flag.Duration("slo.window", 7*24*time.Hour, "Rolling window export success rate is tracked over")
+	sloTarget := flag.Float64("slo.target", 0.99, "Target ratio of successful exports")
+	sloHoldRetention := flag.Bool("slo.hold-retention", false, "Don't prune old exports while export success rate is below target")
+	notifyTarget := flag.String("notify.target", "", "Where manifest of successful export is published: sns:<topic arn>, sqs:<queue url>, nats://host:port/subject or http(s) webhook url, empty disables notifications")
+	notifyRegion := flag.String("notify.region", "", "Region of SNS or SQS target, taken from topic ARN or queue URL if empty")
+	notifyEndpoint := flag.String("notify.endpoint", "", "SNS endpoint, e.g. of compatible service, AWS regional endpoint is used if empty")
+	manifestSigningKey := flag.String("manifest.signing-key", "", "Key export manifests are signed with: ed25519:<PEM file with private key> or awskms:<key ARN>, empty disables signing")
+	manifestVerificationKey := flag.String("manifest.verification-key", "", "Key manifest signatures are checked with before restores and when listing backups, in the same form as signing key, e.g. ed25519:<PEM file with public key>; signing key is used if empty")
+	manifestKMSRegion := flag.String("manifest.kms-region", "", "Region of KMS key, taken from key ARN if empty")
+	manifestKMSEndpoint := flag.String("manifest.kms-endpoint", "", "KMS endpoint, e.g. of compatible service, AWS regional endpoint is used if empty")
+	manifestChecksums := flag.Bool("manifest.checksums", false, "Record SHA-256 checksums of exported files in manifest, files are read back from destination to compute them; always enabled with -manifest.signing-key")
+	manifestACLUser := flag.String("manifest.acl-user", "", "Dgraph ACL user of exported namespace, e.g. groot, ACL groups and rules of the namespace are read as and recorded in manifest, so restores can apply them to fresh clusters; empty disables recording")
+	manifestACLPasswordFile := flag.String("manifest.acl-password-file", "", "File with password of -manifest.acl-user, DGRAPH_ACL_PASSWORD is used if empty")
+	manifestKMSAlgorithm := flag.String("manifest.kms-algorithm", "ECDSA_SHA_256", "KMS signing algorithm, it must match key spec")
+	loadMetricsURL := flag.String("load.metrics-url", "", "Alpha Prometheus metrics url checked before scheduled export, derived from dgraph.endpoint-url if empty")
+	loadMaxPendingProposals := flag.Float64("load.max-pending-proposals", 0, "Scheduled export is deferred while alpha has more pending proposals, 0 disables the check")
+	loadMinDiskFreeBytes := flag.Float64("load.min-disk-free-bytes", 0, "Scheduled export is deferred while alpha has less free disk, 0 disables the check")
+	loadDeferDelay := flag.Duration("load.defer-delay", 10*time.Minute, "Delay of scheduled export deferred due to cluster load")
+	loadMaxDeferrals := flag.Int("load.max-deferrals", 3, "Scheduled export runs regardless of cluster load after this many deferrals")
+	eventsSink := flag.String("events.sink", "", "Where lifecycle events of exports are published: kafka://host:port[,host:port]/topic, nats://host:port/subject or http(s) webhook url, empty disables events")
+	eventsQueueSize := flag.Int("events.queue-size", 100, "Number of events queued for publishing, events are dropped when queue is full")
+	deltaPredicate := flag.String("delta.predicate", "", "Experimental: indexed datetime predicate set on every node mutation, differential exports of nodes modified since the previous export are taken when set")
+	deltaPeriod := flag.Duration("delta.period", time.Hour, "Differential export period")
+	deltaPageSize := flag.Int("delta.page-size", 1000, "Number of nodes fetched per differential export query")
+	verifySchedule := flag.Duration("verify.schedule", 0, "How often the newest backups at destination are checked for missing files, invalid signatures and, when manifest has them, checksum mismatches without taking exports; 0 disables verification")
+	verifyCount := flag.Int("verify.count", 3, "Number of the newest backups checked by verification runs")
+	verifyCache := flag.Bool("verify.cache", true, "Cache checksums verified by verification runs at destination, so files with unchanged ETag aren't read back again")
+	verifyCacheMaxAge := flag.Duration("verify.cache-max-age", 0, "How long cached checksums are trusted for unchanged files, 0 trusts them until files change")
+	schemaPollInterval := flag.Duration("schema.poll-interval", 0, "How often leader polls GraphQL schema and starts export once it changed, so schema migrations are bracketed by backups; 0 disables polling, POST /api/v1/hooks/schema-changed triggers such export anyway")
+	stateDBPath := flag.String("state.db-path", "", "Embedded database file job history is kept in when -ydb.jobs-table-name isn't used, created if missing; empty keeps jobs in memory only")
+	stateSnapshotInterval := flag.Duration("state.snapshot-interval", 0, "How often leader uploads state snapshot with backup history and config to destination, 0 disables uploads")
+	restoreLiveBinary := flag.String("restore.live-binary", "dgraph", "Dgraph binary used to run live loader for restores")
+	restoreTmpDir := flag.String("restore.tmp-dir", os.TempDir(), "Directory backup files are downloaded to for restores")
+	restoreMaxMutationRate := flag.Float64("restore.max-mutations-per-second", 0, "Rate live loader sends mutations of restored data at, halved when Dgraph reports too many pending proposals and raised back while it doesn't; 0 disables rate limiting")
+	restoreBatchSize := flag.Int("restore.batch-size", 0, "Number of N-Quads per live loader mutation, live loader default is used if 0")
+	restoreMaxPending := flag.Int("restore.max-pending", 0, "Number of transactions live loader has pending at once, live loader default is used if 0")
+	restoreChunkSize := flag.Int64("restore.chunk-size", 64<<20, "Backup files larger than this many bytes are downloaded in parallel ranged requests of this size, resumed by retried restore; 0 downloads them in single request")
+	rollingNamespaces := flag.String("rolling.namespaces", "", "Comma separated namespaces and ranges, e.g. 1,5-100, exported one by one in batches spread across export period; retention isn't applied to them")
+	rollingBatchSize := flag.Int("rolling.batch-size", 10, "Namespaces exported in one rolling export batch")
+	rollingBatchInterval := flag.Duration("rolling.batch-interval", 5*time.Minute, "Time between starts of rolling export batches")
+	tenantsConfig := flag.String("tenants.config", "", "JSON file with tenants exported to their own destinations: [{name, namespace, destination, accessKeyFile, secretKeyFile, anonymous}]")
+	tenantsCheckInterval := flag.Duration("tenants.check-interval", 10*time.Minute, "How often tenant destinations are checked for write access")
+	startupValidate := flag.Bool("startup.validate", true, "Check Dgraph health and destination write access on start")
+	dryRun := flag.Bool("dry-run", false, "Log what would be done without requesting exports or removing anything")
+	readOnly := flag.Bool("read-only", false, "Only serve listing and status API, e.g. for dashboards in other regions: leader election isn't joined, nothing is exported, restored, removed or written to lease and job tables")
+	runOnce := flag.Bool("run-once", false, "Request single export and exit with its result, e.g. in CronJob; leader election and API aren't started")
+	summaryFile := flag.String("summary-file", "", "File JSON summary of the run is written to in run-once mode")
+	metricsPushgatewayURL := flag.String("metrics.pushgateway-url", "", "Prometheus Pushgateway metrics are pushed to before exit in run-once mode")
+	metricsRemoteWriteURL := flag.String("metrics.remote-write-url", "", "Prometheus remote write endpoint metrics are sent to before exit in run-once mode")
+	metricsPushJob := flag.String("metrics.push-job", "dgraph-export-tool", "Job label of metrics pushed in run-once mode")
+	workerConcurrency := flag.Int("worker.concurrency", 4, "Number of export files, or chunks of restored ones, transferred at once")
+	metricsLabels := flag.String("metrics.labels", "cluster,namespace,destination", "Comma separated labels export metrics carry: cluster, namespace and destination backend, empty disables them")
+	metricsMaxLabelValues := flag.Int("metrics.max-label-values", 100, "Distinct values each metric label may have, later values are reported as \"other\", 0 disables the limit")
+	metricsClusterName := flag.String("metrics.cluster-name", "", "Cluster label of export metrics, -leaderelection.cluster-name is used if empty")
+	apiIdempotencyKeyTTL := flag.Duration("api.idempotency-key-ttl", 24*time.Hour, "How long finished jobs are matched by Idempotency-Key header of requests of the same kind; jobs finished before restart or leader change are matched when -state.db-path or -ydb.jobs-table-name keeps job history")
+	apiRateLimit := flag.Float64("api.rate-limit", 0, "API requests per second limit for all clients, 0 disables the limit")
+	apiRateLimitBurst := flag.Int("api.rate-limit-burst", 10, "API requests burst for all clients")
+	apiClientRateLimit := flag.Float64("api.client-rate-limit", 0, "API requests per second limit for single client address, 0 disables the limit")
+	apiClientRateLimitBurst := flag.Int("api.client-rate-limit-burst", 5, "API requests burst for single client address")
+	apiMaxConcurrentExports := flag.Int("api.max-concurrent-exports", 0, "Queued or running exports after which API export requests are rejected with 409 or, with onLimit=queue, queued without waiting; 0 disables the limit")
+	apiExportDestinations := flag.String("api.export-destinations", "", "Comma separated destination prefixes export requests may write to besides -dgraph.export-dest")
+	apiTokensConfig := flag.String("api.tokens-config", "", "JSON file with API bearer tokens: [{name, tokenFile, role, namespaces}]; role is one of admin (default), operator, viewer; tokens with namespaces may only export, list and restore backups of them and see their own jobs. Empty disables API authentication unless -ydb.tokens-table-name is set")
+	apiTokensRefreshInterval := flag.Duration("api.tokens-refresh-interval", 30*time.Second, "How often tokens managed with /api/v1/tokens are reloaded, so changes made through other replicas are picked up")
+	apiSwaggerUI := flag.Bool("api.swagger-ui", false, "Serve embedded browser of API document at /api/v1/docs")
+	grpcListenAddress := flag.String("grpc.listen-address", "", "gRPC management API listen address, empty disables it")
+	grpcTLSCertFile := flag.String("grpc.tls-cert-file", "", "gRPC server TLS certificate file")
+	grpcTLSKeyFile := flag.String("grpc.tls-key-file", "", "gRPC server TLS key file")
+	grpcTLSClientCAFile := flag.String("grpc.tls-client-ca-file", "", "CA file to verify gRPC client certificates with, enables mTLS, required with API tokens")
+	ydbEndpoint := flag.String("ydb.endpoint", "grpcs://ydb.serverless.yandexcloud.net:2135", "YDB endpoint")
 	ydbDatabaseName := flag.String("ydb.database-name", "", "YDB database name for init connection")
+	ydbDialTimeout := flag.Duration("ydb.dial-timeout", 0, "YDB dial timeout, 0 keeps SDK default")
+	ydbDiscoveryInterval := flag.Duration("ydb.discovery-interval", 0, "YDB endpoints discovery interval, 0 keeps SDK default")
+	ydbSessionPoolLimit := flag.Int("ydb.session-pool-limit", 0, "YDB table session pool size limit, 0 keeps SDK default")
+	ydbCAFile := flag.String("ydb.ca-file", "", "File with CA certificates YDB server certificate is verified with in addition to system ones")
+	ydbBalancer := flag.String("ydb.balancer", "", `YDB balancer, one of: round_robin, random_choice, single, or JSON config e.g. {"type":"random_choice","prefer":"local_dc","fallback":true}`)
 	ydbTableName := flag.String("ydb.table-name", "", "YDB table name")
 	ydbLeaseName := flag.String("ydb.lease-name", "", "YDB lease name")
+	ydbJobsTableName := flag.String("ydb.jobs-table-name", "", "YDB table finished jobs are kept in for GET /api/v1/jobs history queries, created if missing; empty keeps jobs in memory or -state.db-path")
+	ydbTokensTableName := flag.String("ydb.tokens-table-name", "", "YDB table API tokens managed with /api/v1/tokens are kept in hashed, created if missing; the first admin token is configured with -api.tokens-config. Empty disables tokens management")
+	jobsHistoryTTL := flag.Duration("jobs.history-ttl", 30*24*time.Hour, "How long finished jobs are kept in persistent history, 0 keeps them forever")
+	leaderElectionBackend := flag.String("leaderelection.backend", leaderElectionYDB, "Leader election lock backend, one of: ydb, file, postgres, mysql, redis")
+	leaderElectionFilePath := flag.String("leaderelection.file-path", "", "Lock record file of file backend, on local or shared POSIX filesystem with working flock")
+	leaderElectionSQLDSNFile := flag.String("leaderelection.sql-dsn-file", "", "File with DSN of postgres or mysql backend database, LEADERELECTION_SQL_DSN is used if empty")
+	leaderElectionSQLTable := flag.String("leaderelection.sql-table", "leader_election", "Lease table of postgres or mysql backend, created if missing")
+	leaderElectionSQLLeaseName := flag.String("leaderelection.sql-lease-name", "dgraph-export-tool", "Lease name of postgres or mysql backend")
+	leaderElectionRedisAddrs := flag.String("leaderelection.redis-addrs", "localhost:6379", "Comma separated addresses of redis backend, multiple addresses without master name select cluster mode")
+	leaderElectionRedisMasterName := flag.String("leaderelection.redis-master-name", "", "Sentinel master name of redis backend, addresses are sentinel ones then")
+	leaderElectionRedisPasswordFile := flag.String("leaderelection.redis-password-file", "", "File with password of redis backend, REDIS_PASSWORD is used if empty")
+	leaderElectionRedisKey := flag.String("leaderelection.redis-key", "dgraph-export-tool/leader", "Lease key of redis backend")
+	leaderElectionRedisTTL := flag.Duration("leaderelection.redis-ttl", 0, "Lease key expiration of redis backend, lease duration is used if zero")
 	leaseDuration := flag.Duration("leaderelection.lease-duration", 15*time.Second, "LeaderElection lease duration")
 	renewDeadline := flag.Duration("leaderelection.renew-deadline", 10*time.Second, "LeaderElection renew deadline")
 	retryPeriod := flag.Duration("leaderelection.retry-period", 2*time.Second, "LeaderElection retry period")
+	clusterName := flag.String("leaderelection.cluster-name", "", "Cluster name stored with lease holder metadata")
+	podNamespace := flag.String("leaderelection.pod-namespace", "", "Pod namespace stored with lease holder metadata and manifests, POD_NAMESPACE is used if empty")
+	podName := flag.String("leaderelection.pod-name", "", "Pod name stored with lease holder metadata and manifests, POD_NAME is used if empty")
+	kubernetesNodeName := flag.String("kubernetes.node-name", "", "Node name recorded with pod metadata in logs, manifests and lease holder metadata, NODE_NAME is used if empty")
+	kubernetesImage := flag.String("kubernetes.image", "", "Container image recorded with pod metadata, POD_IMAGE is used if empty")
+	kubernetesContainerName := flag.String("kubernetes.container-name", "", "Container of the tool whose image is read from pod object, the first one is used if empty")
+	kubernetesBusyAnnotation := flag.String("kubernetes.busy-annotation", "", "Annotation, e.g. backup-in-progress=true, set on own pod while export or restore is in flight, so node drains and chaos tools can avoid interrupting it; requires permission to patch pods, empty disables it")
+	kubernetesLookup := flag.Bool("kubernetes.lookup", true, "Read own pod object with in-cluster client to fill node and image not set with Downward API, requires permission to get pods")
+	debugFaultExportRate := flag.Float64("debug.fault-export-rate", 0, "Share of export requests failed on purpose to test alerting and retries, never use in production")
+	debugFaultUploadRate := flag.Float64("debug.fault-upload-rate", 0, "Share of uploads to destination, e.g. of manifests, failed on purpose, never use in production")
+	debugFaultVerifyRate := flag.Float64("debug.fault-verify-mismatch-rate", 0, "Share of backups reported with checksum mismatch by scheduled verification on purpose, never use in production")
+	debugFaultLockRenewRate := flag.Float64("debug.fault-lock-renew-rate", 0, "Share of leader lease renewals failed on purpose, never use in production")
 
 	flag.Parse()
+	if err := applyConfig(flag.CommandLine, "config"); err != nil {
+		klog.Fatal(err)
+	}
+
+	info := buildinfo.Get()
+	if *showVersion {
+		fmt.Println("dgraph-export-tool", info)
+		return
+	}
+	klog.Infof("dgraph-export-tool %s", info)
+	metrics.BuildInfo.WithLabelValues(info.Version, info.Commit, info.BuildDate, info.GoVersion).Set(1)
+
+	switch mode := storage.RetentionMode(strings.ToUpper(*dgraphExportRetentionMode)); mode {
+	case "", storage.RetentionGovernance, storage.RetentionCompliance:
+		*dgraphExportRetentionMode = string(mode)
+	default:
+		klog.Fatalf("unsupported export retention mode %q", *dgraphExportRetentionMode)
+	}
+
+	switch retention.Action(*retentionAction) {
+	case retention.ActionDelete, retention.ActionTransition:
+	default:
+		klog.Fatalf("unsupported retention action %q", *retentionAction)
+	}
+	maxTotalSize, err := parseSize(*retentionMaxTotalSize)
+	if err != nil {
+		klog.Fatalf("invalid retention.max-total-size: %v", err)
+	}
+	if maxTotalSize > 0 && retention.Action(*retentionAction) != retention.ActionDelete {
+		klog.Fatal("retention.max-total-size requires delete retention action")
+	}
+
+	switch *leaderElectionBackend {
+	case leaderElectionYDB, leaderElectionPostgres, leaderElectionMySQL, leaderElectionRedis:
+	case leaderElectionFile:
+		if *leaderElectionFilePath == "" {
+			klog.Fatal("leaderelection.file-path is required by file backend")
+		}
+	default:
+		klog.Fatalf("unsupported leader election backend %q", *leaderElectionBackend)
+	}
+	if *ydbTokensTableName != "" && *leaderElectionBackend != leaderElectionYDB {
+		klog.Fatal("ydb.tokens-table-name requires ydb leader election backend")
+	}
+
+	switch *dgraphExportScheduleAnchor {
+	case scheduleAnchorStart, scheduleAnchorCompletion:
+	default:
+		klog.Fatalf("unsupported export schedule anchor %q", *dgraphExportScheduleAnchor)
+	}
+
+	formats, err := parseFormats(*dgraphExportFormats)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	switch *dgraphAPIFlavor {
+	case apiFlavorGraphQL:
+	case apiFlavorLegacy:
+		// group layout and learner membership are read from GraphQL state
+		if *dgraphExportGroupWait > 0 {
+			klog.Fatal("dgraph.export-group-wait is not supported by legacy API flavor")
+		}
+		if *dgraphExportEndpointURL != "" && *dgraphExportEndpointLearner {
+			klog.Fatal("dgraph.export-endpoint-learner is not supported by legacy API flavor")
+		}
+	default:
+		klog.Fatalf("unsupported dgraph API flavor %q", *dgraphAPIFlavor)
+	}
+	if *schemaPollInterval > 0 && *dgraphAPIFlavor == apiFlavorLegacy {
+		klog.Fatal("schema.poll-interval is not supported by legacy API flavor")
+	}
+	if *manifestACLUser != "" && *dgraphAPIFlavor == apiFlavorLegacy {
+		klog.Fatal("manifest.acl-user is not supported by legacy API flavor")
+	}
 
 	params := dgraphParams{
 		endpoint:  *dgraphEndpointURL,
+		exportURL: *dgraphExportEndpointURL,
+		learner:   *dgraphExportEndpointLearner,
 		dest:      *dgraphExportDest,
-		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
-		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		format:    formats[0],
+		formats:   formats,
+		accessKey: secretSource("AWS_ACCESS_KEY_ID", *dgraphAccessKeyFile),
+		secretKey: secretSource("AWS_SECRET_ACCESS_KEY", *dgraphSecretKeyFile),
+		authToken: secretSource("DGRAPH_AUTH_TOKEN", *dgraphAuthTokenFile),
+		apiKey:    secretSource("DGRAPH_API_KEY", *dgraphAPIKeyFile),
+		anonymous: *dgraphExportAnonymous,
+		flavor:    *dgraphAPIFlavor,
+		userAgent: userAgent(*dgraphUserAgent),
+		retries:   *dgraphRetryAttempts,
+		breaker:   breaker.New(*dgraphCircuitThreshold),
+		probe:     *dgraphCircuitProbeInterval,
+		busyWait:  *dgraphBusyRetryDelay,
+		progress:  *dgraphExportProgressInterval,
+		stall: stallConfig{
+			timeout: *dgraphExportStallTimeout,
+			retries: *dgraphExportStallRetries,
+		},
+		groupWait: *dgraphExportGroupWait,
+		validateN: *dgraphExportValidateSample,
+		lockMode:  storage.RetentionMode(*dgraphExportRetentionMode),
+		lockFor:   *dgraphExportRetentionPeriod,
+		minFree:   *dgraphExportMinFreeBytes,
+		slo:       slo.New(*sloWindow, *sloTarget),
+		sloHold:   *sloHoldRetention,
+		snapshot:  *stateSnapshotInterval,
+		retention: retention.Policy{
+			KeepLast:     *retentionKeepLast,
+			MaxAge:       *retentionMaxAge,
+			Action:       retention.Action(*retentionAction),
+			StorageClass: *retentionStorageClass,
+			Freshness:    *retentionFreshness,
+			MaxTotalSize: maxTotalSize,
+		},
 		period:    *dgraphExportPeriod,
+		anchor:    *dgraphExportScheduleAnchor,
+		dryRun:    *dryRun,
+		readOnly:  *readOnly,
+		jobs:      job.NewManager(*apiIdempotencyKeyTTL),
+		limiter:   ratelimit.New(*apiRateLimit, *apiRateLimitBurst, *apiClientRateLimit, *apiClientRateLimitBurst),
+		exportCap: *apiMaxConcurrentExports,
+		swaggerUI: *apiSwaggerUI,
+		destAllow: splitList(*apiExportDestinations),
 		dgraphTmp: dgraphTmp{
 			prefix:  *dgraphExportTmpPrefix,
 			pattern: *dgraphExportTmpPattern,
 			cleanup: *dgraphExportTmpCleanup,
+			minAge:  *dgraphExportTmpMinAge,
+			runDir:  *dgraphExportTmpDirTemplate,
+		},
+		liveLoader: liveLoader{
+			binary:    *restoreLiveBinary,
+			tmpDir:    *restoreTmpDir,
+			chunkSize: *restoreChunkSize,
+			limits: restore.Throttle{
+				MutationsPerSecond: *restoreMaxMutationRate,
+				Batch:              *restoreBatchSize,
+				MaxPending:         *restoreMaxPending,
+			},
+		},
+		throttle: throttle{
+			url: *loadMetricsURL,
+			thresholds: load.Thresholds{
+				MaxPendingProposals: *loadMaxPendingProposals,
+				MinDiskFreeBytes:    *loadMinDiskFreeBytes,
+			},
+			delay:        *loadDeferDelay,
+			maxDeferrals: *loadMaxDeferrals,
+		},
+		notifier: notifier{
+			target:   *notifyTarget,
+			region:   *notifyRegion,
+			endpoint: *notifyEndpoint,
+		},
+		deltaExport: deltaExport{
+			predicate: *deltaPredicate,
+			interval:  *deltaPeriod,
+			pageSize:  *deltaPageSize,
+		},
+		verify: verifyConfig{
+			interval: *verifySchedule,
+			count:    *verifyCount,
+			cache:    *verifyCache,
+			cacheAge: *verifyCacheMaxAge,
+		},
+		gqlPoll: *schemaPollInterval,
+		rollingExport: rollingExport{
+			batchSize: *rollingBatchSize,
+			batchWait: *rollingBatchInterval,
+			cycle:     &rollingCycle{},
 		},
 	}
+	params.nextExport = new(atomic.Int64)
+	params.caps = &capabilityCache{}
+	params.drift = &driftTracker{}
+	params.workers = worker.New(*workerConcurrency)
+	params.checksums = *manifestChecksums
+	// signature of names and sizes only doesn't detect files replaced with ones of the same size
+	if *manifestSigningKey != "" && !params.checksums {
+		klog.Info("manifest checksums are enabled, signed manifests require them")
+		params.checksums = true
+	}
+	params.aclUser = *manifestACLUser
+	params.aclPassword = secretSource("DGRAPH_ACL_PASSWORD", *manifestACLPasswordFile)
+	params.clusterName = *metricsClusterName
+	if params.clusterName == "" {
+		params.clusterName = *clusterName
+	}
+	if err := metrics.ConfigureLabels(strings.Split(*metricsLabels, ","), *metricsMaxLabelValues); err != nil {
+		klog.Fatal(err)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	db, err := ydbsdk.Open(ctx, "grpcs://ydb.serverless.yandexcloud.net:2135",
-		ydbenv.WithEnvironCredentials(ctx),
-		ydbsdk.WithDatabase(*ydbDatabaseName),
+	namespaces, err := parseNamespaces(*rollingNamespaces)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if len(namespaces) > 0 && params.rollingExport.batchSize < 1 {
+		klog.Fatal("rolling.batch-size must be positive")
+	}
+	params.rollingExport.namespaces = namespaces
+
+	params.faults, err = fault.New(map[fault.Point]float64{
+		fault.Export:    *debugFaultExportRate,
+		fault.Upload:    *debugFaultUploadRate,
+		fault.Verify:    *debugFaultVerifyRate,
+		fault.LockRenew: *debugFaultLockRenewRate,
+	})
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	params.manifestKeys, err = newManifestKeys(*manifestSigningKey, *manifestVerificationKey,
+		signing.WithCredentials(params.accessKey, params.secretKey),
+		signing.WithRegion(*manifestKMSRegion),
+		signing.WithEndpoint(*manifestKMSEndpoint),
+		signing.WithAlgorithm(*manifestKMSAlgorithm),
 	)
 	if err != nil {
 		klog.Fatal(err)
 	}
-	defer db.Close(ctx)
+
+	if params.dryRun {
+		klog.Info("dry-run mode enabled, no exports will be requested and nothing will be removed")
+	}
+	if params.readOnly {
+		if *runOnce {
+			klog.Fatal("run-once mode can't be read-only, it requests export")
+		}
+		if *grpcListenAddress != "" {
+			klog.Fatal("gRPC API can't be served in read-only mode, it triggers exports")
+		}
+		klog.Info("read-only mode enabled, only listing and status API is served")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params.pod = podinfo.Info{
+		Pod:       envDefault(*podName, "POD_NAME"),
+		Namespace: envDefault(*podNamespace, "POD_NAMESPACE"),
+		Node:      envDefault(*kubernetesNodeName, "NODE_NAME"),
+		Image:     envDefault(*kubernetesImage, "POD_IMAGE"),
+	}
+	if *kubernetesLookup {
+		pod, err := podinfo.Lookup(ctx, params.pod, *kubernetesContainerName)
+		if err != nil {
+			klog.Warningf("failed to look up pod metadata: %v", err)
+		}
+		params.pod = pod
+	}
+	if params.pod.Pod != "" {
+		klog.Infof("running in pod %s", params.pod)
+	}
+
+	var jobOpts []job.Option
+	if *kubernetesBusyAnnotation != "" && !params.readOnly {
+		annotator, err := podinfo.NewAnnotator(ctx, params.pod, *kubernetesBusyAnnotation)
+		if err != nil {
+			klog.Warningf("pod annotation is disabled: %v", err)
+		} else {
+			jobOpts = append(jobOpts, job.WithRunHook(busyHook(annotator)))
+			params.jobs = job.NewManager(*apiIdempotencyKeyTTL, jobOpts...)
+		}
+	}
+
+	if *eventsSink != "" {
+		pub, err := notify.New(*eventsSink)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		params.events = events.New(pub, *eventsQueueSize)
+		if !*runOnce {
+			go params.events.Run(ctx)
+		}
+	}
+
+	if *runOnce {
+		os.Exit(params.runOnce(ctx, onceConfig{
+			validate:    *startupValidate,
+			summaryFile: *summaryFile,
+			push: metricsPush{
+				pushgatewayURL: *metricsPushgatewayURL,
+				remoteWriteURL: *metricsRemoteWriteURL,
+				job:            *metricsPushJob,
+			},
+		}))
+	}
+
+	if *startupValidate {
+		if err := params.validate(ctx); err != nil {
+			klog.Fatal(err)
+		}
+	}
+	// detected in background, so unavailable Dgraph doesn't delay start
+	if !params.legacy() {
+		go params.capabilities(ctx)
+	}
+
+	var tokens []apiauth.Token
+	if *apiTokensConfig != "" {
+		tokens, err = apiauth.Load(*apiTokensConfig)
+		if err != nil {
+			klog.Fatal(err)
+		}
+	}
+
+	// destinations are checked by writing probe object
+	if *tenantsConfig != "" && !params.readOnly {
+		tenants, err := tenant.Load(*tenantsConfig)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		// tenant destinations are reported, not required to start,
+		// so one tenant's expired key doesn't stop backups of others
+		params.tenants = tenant.NewChecker(tenants)
+		ready := params.tenants.Check(ctx)
+		klog.Infof("%d of %d tenant destinations are ready", ready, len(tenants))
+
+		go params.tenants.Run(ctx, *tenantsCheckInterval)
+	}
 
 	identity, err := os.Hostname()
 	if err != nil {
 		klog.Fatal(err)
 	}
 
-	lock := ydb.New(db, *ydbTableName, *ydbLeaseName, identity)
+	var (
+		lock    resourcelock.Interface
+		holders lease.Store
+		history job.History
+		tokenDB apiauth.Store
+	)
+	switch *leaderElectionBackend {
+	case leaderElectionYDB:
+		ydbOpts, err := ydbConfig{
+			database:          *ydbDatabaseName,
+			dialTimeout:       *ydbDialTimeout,
+			discoveryInterval: *ydbDiscoveryInterval,
+			sessionPoolLimit:  *ydbSessionPoolLimit,
+			caFile:            *ydbCAFile,
+			balancer:          *ydbBalancer,
+		}.options(ctx)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		db, err := ydbsdk.Open(ctx, *ydbEndpoint, ydbOpts...)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		defer db.Close(ctx)
+
+		// tables are created by instances taking part in election
+		if !params.readOnly {
+			if err := ydbschema.Migrate(ctx, db, lease.Table(*ydbTableName)); err != nil {
+				klog.Fatal(err)
+			}
+		}
+
+		lock = ydb.New(db, *ydbTableName, *ydbLeaseName, identity)
+		holders = lease.NewYDBStore(db, *ydbTableName, *ydbLeaseName)
+
+		if *ydbJobsTableName != "" {
+			if !params.readOnly {
+				if err := ydbschema.Migrate(ctx, db, job.HistoryTable(*ydbJobsTableName)); err != nil {
+					klog.Fatal(err)
+				}
+			}
+			history = job.NewYDBHistory(db, *ydbJobsTableName, *jobsHistoryTTL)
+		}
+
+		if *ydbTokensTableName != "" {
+			if !params.readOnly {
+				if err := ydbschema.Migrate(ctx, db, apiauth.TokensTable(*ydbTokensTableName)); err != nil {
+					klog.Fatal(err)
+				}
+			}
+			tokenDB = apiauth.NewYDBStore(db, *ydbTokensTableName)
+		}
+	case leaderElectionFile:
+		// replicas sharing host have the same hostname
+		identity = fmt.Sprintf("%s-%d", identity, os.Getpid())
+		lock = lease.NewFileLock(*leaderElectionFilePath, identity)
+		holders = lease.NewFileStore(*leaderElectionFilePath + ".holder")
+	case leaderElectionPostgres, leaderElectionMySQL:
+		dsn, err := secretSource("LEADERELECTION_SQL_DSN", *leaderElectionSQLDSNFile).Get()
+		if err != nil {
+			klog.Fatalf("failed to get leader election database DSN: %v", err)
+		}
+
+		db, err := sql.Open(*leaderElectionBackend, dsn)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		defer db.Close()
+
+		dialect := lease.Dialect(*leaderElectionBackend)
+		sqlLock := lease.NewSQLLock(db, dialect, *leaderElectionSQLTable, *leaderElectionSQLLeaseName, identity)
+		if !params.readOnly {
+			if err := sqlLock.CreateTable(ctx); err != nil {
+				klog.Fatal(err)
+			}
+		}
+
+		lock = sqlLock
+		holders = lease.NewSQLStore(db, dialect, *leaderElectionSQLTable, *leaderElectionSQLLeaseName)
+	case leaderElectionRedis:
+		password, err := secretSource("REDIS_PASSWORD", *leaderElectionRedisPasswordFile).Get()
+		if err != nil {
+			klog.Fatalf("failed to get redis password: %v", err)
+		}
+
+		client := redis.NewUniversalClient(&redis.UniversalOptions{
+			Addrs:      strings.Split(*leaderElectionRedisAddrs, ","),
+			MasterName: *leaderElectionRedisMasterName,
+			Password:   password,
+		})
+		defer client.Close()
+
+		ttl := *leaderElectionRedisTTL
+		if ttl == 0 {
+			ttl = *leaseDuration
+		}
+
+		lock = lease.NewRedisLock(client, *leaderElectionRedisKey, ttl, identity)
+		holders = lease.NewRedisStore(client, *leaderElectionRedisKey+"/holder")
+	}
+
+	holder := lease.Holder{
+		Identity:  identity,
+		Cluster:   *clusterName,
+		Namespace: params.pod.Namespace,
+		Pod:       params.pod.Pod,
+		Node:      params.pod.Node,
+		Image:     params.pod.Image,
+		Version:   buildinfo.Get().Version,
+		StartedAt: time.Now(),
+	}
+
 	lec := leaderelection.LeaderElectionConfig{
-		Lock:          lock,
+		Lock:          lease.Instrument(fault.Lock(lock, params.faults)),
 		LeaseDuration: *leaseDuration,
 		RenewDeadline: *renewDeadline,
 		RetryPeriod:   *retryPeriod,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
+				if err := holders.Put(ctx, holder); err != nil {
+					klog.Warningf("failed to store lease holder metadata: %v", err)
+				}
+				if params.snapshot > 0 {
+					go params.snapshotLoop(ctx)
+				}
+				if params.deltaExport.predicate != "" {
+					go params.deltaLoop(ctx)
+				}
+				if params.verify.interval > 0 {
+					go params.verifyLoop(ctx)
+				}
+				if params.gqlPoll > 0 {
+					go params.schemaPollLoop(ctx)
+				}
+				if len(params.rollingExport.namespaces) > 0 {
+					go params.rollingLoop(ctx)
+				}
 				params.exportLoop(ctx)
 			},
 			OnStoppedLeading: func() {
@@ -90,58 +685,226 @@ func main() {
 		klog.Fatal(err)
 	}
 
-	if err := lock.CreateTable(ctx); err != nil {
-		klog.Fatal(err)
+	// embedded database keeps job history without YDB, e.g. with file or SQL lock
+	if history == nil && *stateDBPath != "" && !params.readOnly {
+		h, err := job.OpenBoltHistory(*stateDBPath, *jobsHistoryTTL)
+		if err != nil {
+			klog.Fatalf("failed to open state database %s: %v", *stateDBPath, err)
+		}
+		defer h.Close()
+
+		history = h
+	}
+
+	if *apiTokensConfig != "" || tokenDB != nil {
+		params.auth = apiauth.New(tokens, apiauth.WithStore(tokenDB, *apiTokensRefreshInterval))
+	}
+
+	params.identity = identity
+	if !params.readOnly {
+		params.elector = le
+	}
+	params.holders = holders
+	if history != nil {
+		// jobs aren't run before API and leader election start,
+		// so the manager is replaced with one saving them to history
+		params.jobs = job.NewManager(*apiIdempotencyKeyTTL, append(jobOpts, job.WithHistory(history))...)
 	}
 
 	go params.apiHandler(ctx, cancel)
 
+	if *grpcListenAddress != "" {
+		// tokens mustn't be sent in clear nor to clients without certificates
+		if params.auth != nil && *grpcTLSClientCAFile == "" {
+			klog.Fatal("gRPC API with API tokens requires mTLS, set -grpc.tls-client-ca-file")
+		}
+		opts, err := grpcapi.ServerOptions(*grpcTLSCertFile, *grpcTLSKeyFile, *grpcTLSClientCAFile)
+		if err != nil {
+			klog.Fatal(err)
+		}
+
+		go params.grpcHandler(ctx, cancel, *grpcListenAddress, opts...)
+	}
+
+	if params.readOnly {
+		// leader is reported from holder record written by it
+		<-ctx.Done()
+		return
+	}
+
 	le.Run(ctx)
 }
 
+const (
+	apiFlavorGraphQL = "graphql"
+	apiFlavorLegacy  = "legacy"
+)
+
+const (
+	scheduleAnchorStart      = "start"
+	scheduleAnchorCompletion = "completion"
+)
+
+const (
+	leaderElectionYDB      = "ydb"
+	leaderElectionFile     = "file"
+	leaderElectionPostgres = string(lease.Postgres)
+	leaderElectionMySQL    = string(lease.MySQL)
+	leaderElectionRedis    = "redis"
+)
+
 type dgraphParams struct {
 	endpoint  string
+	exportURL string
+	learner   bool
 	dest      string
-	accessKey string
-	secretKey string
+	accessKey secret.Source
+	secretKey secret.Source
+	authToken secret.Source
+	apiKey    secret.Source
+	anonymous bool
+	format    string
+	formats   []string
+	flavor    string
+	namespace int64
+	userAgent string
+	retries   int
+	breaker   *breaker.Breaker
+	probe     time.Duration
+	busyWait  time.Duration
+	progress  time.Duration
+	stall     stallConfig
+	verify    verifyConfig
+	gqlPoll   time.Duration
+	groupWait time.Duration
+	validateN int
+	lockMode  storage.RetentionMode
+	lockFor   time.Duration
+	minFree   uint64
+	slo       *slo.Tracker
+	sloHold   bool
+	snapshot  time.Duration
+	retention retention.Policy
 	period    time.Duration
+	anchor    string
+	dryRun    bool
+	readOnly  bool
+	faults    *fault.Injector
+	jobs      *job.Manager
+	limiter   *ratelimit.Limiter
+	exportCap int
+	swaggerUI bool
+	destAllow []string
+	identity  string
+	elector   *leaderelection.LeaderElector
+	holders   lease.Store
+	tenants   *tenant.Checker
+	auth      *apiauth.Authenticator
+	pod       podinfo.Info
+	throttle  throttle
+	notifier  notifier
+	events    *events.Bus
+	// nextExport is unix time in nanoseconds of the next scheduled export,
+	// zero when this instance is not leading, shared by run copies.
+	nextExport *atomic.Int64
+	// caps are admin API features of Dgraph, shared by run copies.
+	caps *capabilityCache
+	// drift tracks start delays of scheduled exports, shared by run copies.
+	drift *driftTracker
+	// workers transfer export files, shared by run copies.
+	workers *worker.Pool
+	// checksums enables recording checksums of exported files in manifest.
+	checksums bool
+	// aclUser reads ACL of exported namespace recorded in manifest,
+	// it's not recorded when empty.
+	aclUser     string
+	aclPassword secret.Source
+	// clusterName is cluster label of export metrics.
+	clusterName string
 	dgraphTmp
+	liveLoader
+	deltaExport
+	rollingExport
+	manifestKeys
+}
+
+// liveLoader configures dgraph live runs restoring backups.
+type liveLoader struct {
+	binary    string
+	tmpDir    string
+	chunkSize int64
+	// limits throttle live loader restoring into live clusters.
+	limits restore.Throttle
 }
 
 type dgraphTmp struct {
 	prefix  string
 	pattern string
 	cleanup bool
+	minAge  time.Duration
+	// runDir is template of per-run directories, see makeRunTmpDir.
+	runDir string
 }
 
 func (p *dgraphParams) exportLoop(ctx context.Context) {
 	klog.V(3).Info("started export loop")
 
-	c, err := export.NewClient(p.endpoint, p.dest,
-		export.WithAccessKey(p.accessKey),
-		export.WithSecretKey(p.secretKey),
-	)
-	if err != nil {
-		klog.Fatal(err)
-	}
+	next := time.Now().Add(p.period)
+	defer p.nextExport.Store(0)
+
+	// deferrals counts consecutive runs deferred due to cluster load,
+	// busyRetries consecutive runs refused by busy alpha
+	deferrals, busyRetries := 0, 0
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		p.scheduleNext(timer, next)
 
-	for ticker := time.NewTicker(p.period); ; {
 		select {
-		case <-ticker.C:
+		case <-timer.C:
+			if p.breaker.IsOpen() {
+				if err := p.probeDgraph(ctx); err != nil {
+					klog.Warningf("circuit breaker is open, dgraph probe failed: %v", err)
+					next = time.Now().Add(p.probe)
+					continue
+				}
+				klog.Info("dgraph probe succeeded, closing circuit breaker")
+				p.breaker.Reset()
+				// alphas may have been upgraded while unavailable
+				p.caps.set(nil)
+			}
+
+			if deferrals < p.throttle.maxDeferrals {
+				if reason := p.clusterBusy(ctx); reason != "" {
+					deferrals++
+					klog.Warningf("export deferred by %s (%d/%d): %s", p.throttle.delay, deferrals, p.throttle.maxDeferrals, reason)
+					metrics.ExportsDeferred.Inc()
+					next = time.Now().Add(p.throttle.delay)
+					continue
+				}
+			}
+			deferrals = 0
+
 			klog.Info("make export export request")
 
-			resp, err := c.Export(ctx)
+			j, _ := p.jobs.Start(ctx, job.KindExport, "", job.PriorityScheduled, p.runFormats)
+			_, err := j.Wait(ctx)
 			if err != nil {
-				klog.Error(err)
-				continue
+				klog.Errorf("export failed (%s): %v", failure.Of(err), err)
 			}
 
-			klog.Infof("exported files: %v", resp.GetFiles())
-
-			if p.dgraphTmp.cleanup {
-				if err := cleanupTmpFiles(ctx, p.dgraphTmp.prefix, p.dgraphTmp.pattern); err != nil {
-					klog.Error(err)
+			p.recordDrift(j.Status())
+			next = p.nextRun(j.Status())
+			if errors.Is(err, failure.ErrClusterBusy) && p.busyWait > 0 {
+				busyRetries++
+				if retry := p.busyRetry(busyRetries); retry.Before(next) {
+					klog.Warningf("dgraph is busy, retrying export at %s", retry.Format(time.RFC3339))
+					next = retry
 				}
+			} else {
+				busyRetries = 0
 			}
 		case <-ctx.Done():
 			return
@@ -149,74 +912,549 @@ func (p *dgraphParams) exportLoop(ctx context.Context) {
 	}
 }
 
-func (p *dgraphParams) apiHandler(ctx context.Context, cancel context.CancelFunc) {
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
-	http.HandleFunc("/api/v1/export", p.apiExportHandler(ctx))
-	if err := http.ListenAndServe(":8081", nil); err != nil {
-		klog.Error(err)
+// busyRetry returns time of export retried after alpha refused attempt
+// as busy, delay doubles with every attempt in a row.
+func (p *dgraphParams) busyRetry(attempt int) time.Time {
+	delay := p.busyWait
+	for i := 1; i < attempt && delay < p.period; i++ {
+		delay *= 2
 	}
 
-	klog.Info("http handler finished")
-
-	cancel()
+	return time.Now().Add(delay)
 }
 
-func (p *dgraphParams) apiExportHandler(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			c, err := export.NewClient(p.endpoint, p.dest,
-				export.WithAccessKey(p.accessKey),
-				export.WithSecretKey(p.secretKey),
-			)
-			if err != nil {
-				fmt.Fprintln(w, err.Error())
-				return
-			}
-			resp, err := c.Export(ctx)
-			if err != nil {
-				fmt.Fprintln(w, err.Error())
-				return
-			}
+// nextRun returns time of the export following finished job. It's counted
+// from job start or completion, so long exports don't shift the schedule
+// in the former case and don't follow each other back to back in the latter.
+func (p *dgraphParams) nextRun(st job.Status) time.Time {
+	anchor := st.StartedAt
+	if p.anchor == scheduleAnchorCompletion || anchor.IsZero() {
+		anchor = st.FinishedAt
+	}
 
-			b, err := json.Marshal(resp)
-			if err != nil {
-				fmt.Fprintln(w, err.Error())
-				return
-			}
+	next := anchor.Add(p.period)
+	if now := time.Now(); next.Before(now) {
+		klog.Warningf("export took longer than period %s, starting next one immediately", p.period)
+		next = now
+	}
 
-			fmt.Fprintln(w, string(b))
+	return next
+}
+
+// scheduleNext resets timer to fire at next and records its time.
+func (p *dgraphParams) scheduleNext(timer *time.Timer, next time.Time) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
+	}
+	timer.Reset(time.Until(next))
+	p.nextExport.Store(next.UnixNano())
 
-		if p.dgraphTmp.cleanup {
-			if err := cleanupTmpFiles(ctx, p.dgraphTmp.prefix, p.dgraphTmp.pattern); err != nil {
-				klog.Error(err)
-			}
+	if p.dryRun {
+		klog.Infof("dry-run: next export at %s", next.Format(time.RFC3339))
+	}
+}
+
+// metricsRun returns run labels of export metrics.
+func (p *dgraphParams) metricsRun() metrics.Run {
+	return metrics.Run{
+		Cluster:     p.clusterName,
+		Namespace:   p.namespace,
+		Destination: p.dest,
+	}
+}
+
+// recordExport updates metrics of the last finished export.
+func (p *dgraphParams) recordExport(start time.Time, err error) {
+	success := 0.0
+	if err == nil {
+		success = 1
+	}
+	labels := p.metricsRun().Values()
+	metrics.LastExportSuccess.WithLabelValues(labels...).Set(success)
+	metrics.LastExportTimestamp.WithLabelValues(labels...).SetToCurrentTime()
+	metrics.LastExportDuration.WithLabelValues(labels...).Set(time.Since(start).Seconds())
+}
+
+// runFormats exports in every configured format one after another,
+// since alpha runs one export at a time anyway. Failure of one format
+// doesn't stop the rest, output lists files of all successful ones.
+// Backup SLO, retention and notification treat the whole run as one
+// export, so they follow once all formats are done.
+func (p *dgraphParams) runFormats(ctx context.Context) (*export.ExportOutput, error) {
+	out, manifests, err := p.exportFormats(ctx)
+	p.slo.Record(err == nil)
+	if out == nil {
+		return nil, err
+	}
+
+	creds, cerr := p.credentials()
+	if cerr != nil {
+		klog.Errorf("skip retention and notification: %v", cerr)
+		return out, err
+	}
+	// old exports are pruned only after new ones are complete
+	p.prune(ctx, creds)
+	p.notifyExport(ctx, creds, manifests...)
+
+	return out, err
+}
+
+// exportFormats runs exports of runFormats, output is nil unless
+// export in some format succeeded. It returns manifests of successful
+// exports in order of formats.
+func (p *dgraphParams) exportFormats(ctx context.Context) (*export.ExportOutput, []*manifest.Manifest, error) {
+	if len(p.formats) < 2 {
+		out, m, err := p.runExport(ctx)
+		return out, []*manifest.Manifest{m}, err
+	}
+
+	var (
+		out       *export.ExportOutput
+		manifests []*manifest.Manifest
+		errs      []error
+	)
+	for _, format := range p.formats {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		job.Report(ctx, "format", "exporting %s", format)
+		run := p.runCopy()
+		run.format = format
+		o, m, err := run.runExport(ctx)
+		if err != nil {
+			klog.Errorf("%s export failed: %v", format, err)
+			errs = append(errs, fmt.Errorf("%s export: %w", format, err))
+			continue
+		}
+		manifests = append(manifests, m)
+		if out == nil {
+			out = o
+			continue
+		}
+		if o != nil {
+			out.Response = o.Response
+			out.ExportedFiles = append(out.ExportedFiles, o.ExportedFiles...)
+			out.SignedURLs = append(out.SignedURLs, o.SignedURLs...)
 		}
 	}
+
+	return out, manifests, errors.Join(errs...)
 }
 
-func cleanupTmpFiles(ctx context.Context, prefix, pattern string) error {
-	entries, err := os.ReadDir(prefix)
+// runExport makes single export and returns manifest written for it,
+// manifest is nil in dry-run mode or when it couldn't be written.
+func (p *dgraphParams) runExport(ctx context.Context) (_ *export.ExportOutput, _ *manifest.Manifest, err error) {
+	start := time.Now()
+	// admin requests of the run share ID to be found in alpha logs
+	ctx = request.WithID(ctx, request.NewID())
+	p.emit(ctx, events.Event{Type: events.Started})
+	defer func() {
+		p.recordExport(start, err)
+		if err != nil {
+			metrics.ExportFailures.WithLabelValues(p.metricsRun().Values(string(failure.Of(err)))...).Inc()
+			p.emit(ctx, events.Event{
+				Type:       events.Failed,
+				Stage:      failedStage(err),
+				Error:      err.Error(),
+				ErrorClass: string(failure.Of(err)),
+			})
+		}
+	}()
+
+	if err := p.breaker.Allow(); err != nil {
+		return nil, nil, stageFailed(stageExport, fmt.Errorf("requests to dgraph are suspended: %w", err))
+	}
+
+	creds, err := p.credentials()
 	if err != nil {
-		return err
+		return nil, nil, stageFailed(stageConfig, err)
 	}
 
-	for _, entry := range entries {
-		match, err := filepath.Match(pattern, entry.Name())
-		if err != nil {
-			return err
+	c, err := p.newClient(creds)
+	if err != nil {
+		return nil, nil, stageFailed(stageConfig, err)
+	}
+
+	if s, err := p.newStorage(creds); err == nil {
+		if err := p.checkFreeSpace(ctx, s); err != nil {
+			return nil, nil, stageFailed(stageUpload, failure.Wrap(failure.ErrDestination, err))
 		}
-		if entry.IsDir() && match {
-			path := filepath.Join(prefix, entry.Name())
-			klog.Infof("removing directory: %s", path)
-			if err := os.RemoveAll(path); err != nil {
-				return err
-			}
+	}
+
+	if err := p.checkLearner(ctx, creds); err != nil {
+		return nil, nil, stageFailed(stageConfig, err)
+	}
+	// Dgraph Cloud export accepts format only, legacy API has no introspection
+	if creds.apiKey == "" && !p.legacy() {
+		if err := p.checkCapabilities(ctx); err != nil {
+			return nil, nil, stageFailed(stageConfig, err)
+		}
+	}
+
+	ctx, removeRunTmp, err := makeRunTmpDir(ctx, p.dgraphTmp.runDir, request.ID(ctx), start, p.dryRun)
+	if err != nil {
+		return nil, nil, stageFailed(stageExport, err)
+	}
+	defer removeRunTmp()
+
+	// with per-run dirs cleanup removes only Dgraph tmp dirs of this run
+	var existed map[string]bool
+	if p.dgraphTmp.cleanup && p.dgraphTmp.runDir != "" {
+		if existed, err = p.dgraphTmp.dirs(); err != nil {
+			klog.Warningf("dgraph tmp dirs won't be cleaned up: %v", err)
+		}
+	}
+
+	cluster := p.clusterMetadata(ctx, creds)
+
+	watch := &stallWatch{timeout: p.stall.timeout}
+	if p.progress > 0 && !p.dryRun {
+		pctx, stop := context.WithCancel(ctx)
+		defer stop()
+		go p.trackProgress(pctx, creds, time.Now(), watch)
+	}
+
+	// other instances sharing tmp dir don't clean it up while export runs
+	release := p.dgraphTmp.markExport(request.ID(ctx), p.dryRun)
+	resp, err := p.exportWatched(ctx, c, watch)
+	release()
+	// busy alpha is healthy, as well as one rejecting credentials or
+	// failing to write to destination, they aren't counted by the breaker
+	switch failure.Of(err) {
+	case failure.ClassClusterBusy:
+		metrics.ExportsBusy.WithLabelValues(p.metricsRun().Values()...).Inc()
+	case failure.ClassAuth, failure.ClassDestination:
+	default:
+		p.breaker.Done(err)
+	}
+	if err != nil {
+		return nil, nil, stageFailed(stageExport, err)
+	}
+	if p.legacy() && !p.dryRun {
+		p.findLegacyFiles(ctx, creds, resp, start)
+	}
+
+	if urls := downloadURLs(resp); len(urls) > 0 {
+		if err := p.downloadExport(ctx, creds, resp, urls); err != nil {
+			return nil, nil, stageFailed(stageUpload, failure.Wrap(failure.ErrDestination, fmt.Errorf("failed to download exported files: %w", err)))
+		}
+	}
+
+	klog.Infof("exported files: %v", resp.GetFiles())
+	for _, file := range resp.GetFiles() {
+		job.Report(ctx, "exported", "%s", file)
+	}
+	p.emit(ctx, events.Event{Type: events.Exported, Export: exportDir(resp.GetFiles()), Files: resp.GetFiles()})
+
+	// checks after export don't skip manifest and cleanup,
+	// their failure is returned at the end
+	var (
+		postErr error
+		m       *manifest.Manifest
+	)
+	if p.groupWait > 0 && !p.dryRun && len(resp.GetFiles()) > 0 {
+		if err := p.waitGroups(ctx, creds, &cluster, resp.GetFiles()); err != nil {
+			postErr = stageFailed(stageVerify, err)
+		}
+	}
+	if p.validateN > 0 && !p.dryRun && len(resp.GetFiles()) > 0 && postErr == nil {
+		if err := p.validateFiles(ctx, creds, resp.GetFiles()); err != nil {
+			postErr = stageFailed(stageVerify, err)
 		}
 	}
 
+	if !p.dryRun {
+		m = p.writeManifest(ctx, creds, cluster, resp.GetFiles())
+		if m != nil && postErr == nil {
+			p.emit(ctx, events.Event{Type: events.Verified, Export: m.Dir(), Files: m.Files})
+		}
+
+		retained := resp.GetFiles()
+		if m != nil && m.GraphQL != nil {
+			retained = append(retained[:len(retained):len(retained)], m.GraphQL.File)
+		}
+		if err := p.retainFiles(ctx, creds, retained); err != nil && postErr == nil {
+			postErr = stageFailed(stageUpload, failure.Wrap(failure.ErrDestination, err))
+		}
+	}
+
+	if p.dgraphTmp.cleanup && (p.dgraphTmp.runDir == "" || existed != nil) {
+		if err := p.dgraphTmp.removeFiles(ctx, p.dryRun, existed); err != nil {
+			klog.Error(err)
+		}
+	}
+
+	if postErr != nil {
+		return nil, nil, postErr
+	}
+	if !p.dryRun {
+		p.emit(ctx, events.Event{Type: events.Uploaded, Export: exportDir(resp.GetFiles()), Files: resp.GetFiles()})
+	}
+
+	return resp, m, nil
+}
+
+// credentials returns current values of secrets, re-reading changed secret files.
+func (p *dgraphParams) credentials() (*credentials, error) {
+	var (
+		creds credentials
+		err   error
+	)
+
+	if creds.accessKey, err = p.accessKey.Get(); err != nil {
+		return nil, fmt.Errorf("failed to get access key: %w", err)
+	}
+	if creds.secretKey, err = p.secretKey.Get(); err != nil {
+		return nil, fmt.Errorf("failed to get secret key: %w", err)
+	}
+	if creds.authToken, err = p.authToken.Get(); err != nil {
+		return nil, fmt.Errorf("failed to get auth token: %w", err)
+	}
+	if creds.apiKey, err = p.apiKey.Get(); err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	if p.dryRun {
+		klog.Infof("dry-run: resolved credentials (access key set: %t, secret key set: %t, auth token set: %t, API key set: %t)",
+			creds.accessKey != "", creds.secretKey != "", creds.authToken != "", creds.apiKey != "")
+	}
+
+	return &creds, nil
+}
+
+type credentials struct {
+	accessKey string
+	secretKey string
+	authToken string
+	apiKey    string
+}
+
+// newClient creates export client with given credentials.
+func (p *dgraphParams) newClient(creds *credentials) (*export.Client, error) {
+	return export.NewClient(p.exportEndpoint(), p.dest, p.exportOptions(creds)...)
+}
+
+// exportOptions maps configuration to export client options,
+// new client settings should be wired here only.
+func (p *dgraphParams) exportOptions(creds *credentials) []export.Option {
+	opts := []export.Option{
+		export.WithAuthToken(creds.authToken),
+		export.WithAPIKey(creds.apiKey),
+		export.WithAnonymous(p.anonymous),
+		export.WithFormat(p.exportFormat()),
+		export.WithNamespace(p.namespace),
+		export.WithRetries(p.retries),
+		export.WithUserAgent(p.userAgent),
+	}
+	if creds.apiKey != "" {
+		opts = append(opts, export.WithCloud())
+	}
+	if p.legacy() {
+		opts = append(opts, export.WithLegacy())
+	}
+	if !p.anonymous {
+		opts = append(opts,
+			export.WithAccessKey(creds.accessKey),
+			export.WithSecretKey(creds.secretKey),
+		)
+	}
+
+	return opts
+}
+
+// newStorage opens export destination with the same credentials Dgraph uses.
+func (p *dgraphParams) newStorage(creds *credentials) (storage.Storage, error) {
+	var opts []storage.Option
+	if !p.anonymous {
+		opts = append(opts,
+			storage.WithAccessKey(creds.accessKey),
+			storage.WithSecretKey(creds.secretKey),
+		)
+	}
+
+	if p.faults.Enabled(fault.Upload) {
+		opts = append(opts, storage.WithPutHook(func(string) error {
+			return p.faults.Fail(fault.Upload)
+		}))
+	}
+
+	return storage.New(p.dest, opts...)
+}
+
+// validate checks Dgraph cluster health and destination write access.
+func (p *dgraphParams) validate(ctx context.Context) error {
+	creds, err := p.credentials()
+	if err != nil {
+		return stageFailed(stageConfig, err)
+	}
+
+	hc, err := health.NewClient(p.adminEndpoint(),
+		health.WithAuthToken(creds.authToken),
+		health.WithAPIKey(creds.apiKey),
+		health.WithRetries(p.retries),
+		health.WithUserAgent(p.userAgent),
+		health.WithLegacy(p.legacy()),
+	)
+	if err != nil {
+		return stageFailed(stageConfig, err)
+	}
+
+	nodes, err := hc.Check(ctx)
+	if err != nil {
+		return stageFailed(stageExport, fmt.Errorf("dgraph health check failed: %w", err))
+	}
+	klog.Infof("dgraph cluster is healthy, nodes: %d", len(nodes))
+
+	if err := p.checkLearner(ctx, creds); err != nil {
+		return stageFailed(stageConfig, err)
+	}
+	if creds.apiKey == "" && !p.legacy() {
+		if err := p.checkCapabilities(ctx); err != nil {
+			return stageFailed(stageConfig, err)
+		}
+	}
+
+	s, err := p.newStorage(creds)
+	if errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("skip destination validation: %v", err)
+		return nil
+	}
+	if err != nil {
+		return stageFailed(stageConfig, err)
+	}
+
+	if p.readOnly {
+		// probe object would be written to destination
+		klog.Info("skip destination write check in read-only mode")
+		return nil
+	}
+	if err := storage.Probe(ctx, s); err != nil {
+		return stageFailed(stageUpload, fmt.Errorf("destination validation failed: %w", err))
+	}
+	klog.Infof("destination %q is writable", redact.URL(p.dest))
+
+	if err := p.checkFreeSpace(ctx, s); err != nil {
+		return stageFailed(stageUpload, err)
+	}
+
 	return nil
 }
+
+// checkFreeSpace fails if destination has less free space than configured.
+func (p *dgraphParams) checkFreeSpace(ctx context.Context, s storage.Storage) error {
+	sr, ok := s.(storage.SpaceReporter)
+	if !ok {
+		return nil
+	}
+
+	free, err := sr.FreeSpace(ctx)
+	if errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("skip free space check: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get destination free space: %w", err)
+	}
+	klog.V(1).Infof("destination has %d free bytes", free)
+
+	if free < p.minFree {
+		return fmt.Errorf("destination has %d free bytes, less than required %d", free, p.minFree)
+	}
+
+	return nil
+}
+
+// probeDgraph checks whether Dgraph is healthy again while circuit breaker is open.
+func (p *dgraphParams) probeDgraph(ctx context.Context) error {
+	creds, err := p.credentials()
+	if err != nil {
+		return err
+	}
+
+	hc, err := health.NewClient(p.adminEndpoint(),
+		health.WithAuthToken(creds.authToken),
+		health.WithAPIKey(creds.apiKey),
+		health.WithUserAgent(p.userAgent),
+		health.WithLegacy(p.legacy()),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = hc.Check(ctx)
+
+	return err
+}
+
+// export makes export request or, in dry-run mode, only logs it.
+func (p *dgraphParams) export(ctx context.Context, c *export.Client) (*export.ExportOutput, error) {
+	if p.dryRun {
+		klog.Infof("dry-run: would request export from %s to %q", p.exportEndpoint(), redact.URL(p.dest))
+
+		return &export.ExportOutput{}, nil
+	}
+
+	klog.Infof("requesting export to %s, request id %s", redact.URL(p.dest), request.ID(ctx))
+	job.Report(ctx, "export", "requesting export to %s, request id %s", redact.URL(p.dest), request.ID(ctx))
+	if err := p.faults.Fail(fault.Export); err != nil {
+		return nil, err
+	}
+
+	return c.Export(ctx)
+}
+
+// secretSource returns secret stored in file if it's set
+// or value of environment variable otherwise.
+func secretSource(env, file string) secret.Source {
+	if file != "" {
+		return secret.NewFile(file)
+	}
+
+	return secret.Static(os.Getenv(env))
+}
+
+func envDefault(value, env string) string {
+	if value != "" {
+		return value
+	}
+
+	return os.Getenv(env)
+}
+
+// busyHook keeps pod annotated while exports and restores run,
+// verification only reads backups and isn't worth waiting for.
+func busyHook(a *podinfo.Annotator) job.RunHook {
+	return func(kind job.Kind) func() {
+		if kind == job.KindVerify {
+			return func() {}
+		}
+
+		return a.Begin()
+	}
+}
+
+// splitList splits comma separated flag value, skipping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// userAgent returns User-Agent of Dgraph admin requests.
+func userAgent(value string) string {
+	if value != "" {
+		return value
+	}
+
+	return "dgraph-export-tool/" + buildinfo.Get().Version
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/breaker"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ratelimit"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/secret"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/slo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/worker"
+	"github.com/sputnik-systems/dgraph-export-tool/pkg/testing/dgraphtest"
+)
+
+// liveStubEnv makes test binary act as dgraph live loader, it writes
+// arguments and loaded N-Quads into the directory of the variable.
+const liveStubEnv = "DGRAPH_LIVE_STUB_DIR"
+
+func TestMain(m *testing.M) {
+	if dir := os.Getenv(liveStubEnv); dir != "" {
+		os.Exit(liveStub(dir, os.Args[1:]))
+	}
+
+	os.Exit(m.Run())
+}
+
+// liveStub loads files of --files argument like dgraph live does,
+// it fails as rejected login when alpha is "unreachable".
+func liveStub(dir string, args []string) int {
+	if err := os.WriteFile(filepath.Join(dir, "args"), []byte(strings.Join(args, " ")), 0o600); err != nil {
+		return 2
+	}
+	if err := os.WriteFile(filepath.Join(dir, "creds"), []byte(os.Getenv("DGRAPH_LIVE_CREDS")), 0o600); err != nil {
+		return 2
+	}
+
+	var files, alpha string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--files":
+			files = args[i+1]
+		case "--alpha":
+			alpha = args[i+1]
+		}
+	}
+	if alpha == "unreachable" {
+		fmt.Println("Processing data files")
+		fmt.Println("Unable to login: " + os.Getenv("DGRAPH_LIVE_CREDS"))
+		return 1
+	}
+
+	var loaded bytes.Buffer
+	for _, file := range strings.Split(files, ",") {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if _, err := io.Copy(&loaded, zr); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		f.Close()
+	}
+	if err := os.WriteFile(filepath.Join(dir, "loaded"), loaded.Bytes(), 0o600); err != nil {
+		return 2
+	}
+	fmt.Printf("Number of N-Quads processed: %d\n", bytes.Count(loaded.Bytes(), []byte("\n")))
+
+	return 0
+}
+
+const (
+	exportedDir = "dgraph.r1.u0101.0000"
+	exportedRDF = "<0x1> <name> \"alice\" .\n<0x2> <name> \"bob\" .\n"
+)
+
+// newTestParams returns params exporting from alpha into local
+// destination directory, the way flags of main configure them.
+func newTestParams(t *testing.T, alpha *dgraphtest.Server) *dgraphParams {
+	t.Helper()
+
+	return &dgraphParams{
+		endpoint:   alpha.AdminURL(),
+		dest:       t.TempDir(),
+		format:     formatRDF,
+		formats:    []string{formatRDF},
+		accessKey:  secret.Static(""),
+		secretKey:  secret.Static(""),
+		authToken:  secret.Static(""),
+		apiKey:     secret.Static(""),
+		flavor:     apiFlavorGraphQL,
+		userAgent:  userAgent(""),
+		retries:    3,
+		breaker:    breaker.New(5),
+		slo:        slo.New(time.Hour, 0.99),
+		period:     time.Hour,
+		anchor:     scheduleAnchorStart,
+		jobs:       job.NewManager(time.Hour),
+		limiter:    ratelimit.New(0, 10, 0, 10),
+		checksums:  true,
+		nextExport: new(atomic.Int64),
+		caps:       &capabilityCache{},
+		drift:      &driftTracker{},
+		workers:    worker.New(2),
+		liveLoader: liveLoader{tmpDir: t.TempDir()},
+	}
+}
+
+// writeExported writes files alpha reports as exported into destination,
+// as Dgraph writes them there itself.
+func writeExported(t *testing.T, p *dgraphParams) {
+	t.Helper()
+
+	dir := filepath.Join(p.dest, exportedDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"g01.rdf.gz":    exportedRDF,
+		"g01.schema.gz": "<name>:string @index(exact) .\n",
+	} {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write([]byte(content))
+		zw.Close()
+		if err := os.WriteFile(filepath.Join(dir, name), b.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// exportRequests returns export mutations alpha got.
+func exportRequests(alpha *dgraphtest.Server) int {
+	n := 0
+	for _, req := range alpha.Requests() {
+		if strings.Contains(req.Query, "export(") {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestExportRetried(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	writeExported(t, p)
+
+	// export alpha refused as unavailable hasn't started
+	alpha.FailNextExport(http.StatusServiceUnavailable)
+	j, _ := p.jobs.Start(context.Background(), job.KindExport, "", job.PriorityManual, p.runFormats)
+	out, err := j.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exportRequests(alpha); got != 2 {
+		t.Errorf("alpha got %d export requests, want 2", got)
+	}
+	if files := out.GetFiles(); len(files) != 2 || files[0] != exportedDir+"/g01.rdf.gz" {
+		t.Errorf("exported files are %v", files)
+	}
+	if got := p.slo.String(); !strings.HasPrefix(got, "100") {
+		t.Errorf("backup SLO is %s after successful run", got)
+	}
+}
+
+func TestExportNotResent(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	writeExported(t, p)
+
+	// alpha may still be exporting after gateway timed out
+	alpha.FailNextExport(http.StatusGatewayTimeout)
+	j, _ := p.jobs.Start(context.Background(), job.KindExport, "", job.PriorityManual, p.runFormats)
+	if _, err := j.Wait(context.Background()); err == nil {
+		t.Fatal("export timed out at gateway succeeded")
+	}
+	if got := exportRequests(alpha); got != 1 {
+		t.Errorf("alpha got %d export requests, want 1", got)
+	}
+
+	s, err := storage.New(p.dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifest.Read(context.Background(), s, exportedDir); err == nil {
+		t.Error("manifest of failed export is written")
+	}
+}
+
+func TestExportVerify(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	p.verify.count = 5
+	writeExported(t, p)
+	ctx := context.Background()
+
+	if _, _, err := p.runExport(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := storage.New(p.dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.Read(ctx, s, exportedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Format != formatRDF || len(m.Files) != 2 || m.Cluster.Version != "v23.1.0" {
+		t.Errorf("manifest is of %s export of %v by Dgraph %q", m.Format, m.Files, m.Cluster.Version)
+	}
+	for _, file := range m.Files {
+		if m.Sizes[file] == 0 || m.Checksums[file] == "" {
+			t.Errorf("manifest has no size or checksum of %s", file)
+		}
+	}
+
+	points, err := restorepoint.List(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || !points[0].Verified || !points[0].Restorable() {
+		t.Fatalf("restore points are %+v, want verified full export", points)
+	}
+	if _, err := p.runVerify(ctx); err != nil {
+		t.Errorf("runVerify() of intact export = %v", err)
+	}
+
+	// file is replaced with one of the same size, only checksum tells
+	file := filepath.Join(p.dest, exportedDir, "g01.rdf.gz")
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 0xff
+	if err := os.WriteFile(file, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.runVerify(ctx); err == nil || !strings.Contains(err.Error(), "1 of 1 checked backups have problems") {
+		t.Errorf("runVerify() of corrupted export = %v", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	alpha := dgraphtest.NewServer()
+	defer alpha.Close()
+	p := newTestParams(t, alpha)
+	writeExported(t, p)
+	ctx := context.Background()
+
+	if _, _, err := p.runExport(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := t.TempDir()
+	t.Setenv(liveStubEnv, stub)
+	p.liveLoader.binary = exe
+
+	opts := apiRestoreRequest{Backup: exportedDir, Alpha: "alpha:9080", Zero: "zero:5080", User: "groot", Password: "s3cr3t"}.options()
+	j, _ := p.jobs.Start(ctx, job.KindRestore, "", job.PriorityManual, p.restoreFunc(exportedDir, opts))
+	if _, err := j.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(stub, "args"))
+	if !strings.HasPrefix(string(args), "live --files ") || !strings.Contains(string(args), "--alpha alpha:9080 --zero zero:5080") {
+		t.Errorf("live loader is run with %q", args)
+	}
+	if strings.Contains(string(args), "s3cr3t") {
+		t.Error("password is passed in live loader arguments")
+	}
+	if creds, _ := os.ReadFile(filepath.Join(stub, "creds")); string(creds) != "user=groot;password=s3cr3t" {
+		t.Errorf("live loader credentials are %q", creds)
+	}
+	if loaded, _ := os.ReadFile(filepath.Join(stub, "loaded")); string(loaded) != exportedRDF {
+		t.Errorf("live loader loaded %q, want %q", loaded, exportedRDF)
+	}
+	if _, err := os.Stat(filepath.Join(p.liveLoader.tmpDir, "restore-"+exportedDir+".parts")); !os.IsNotExist(err) {
+		t.Errorf("downloaded chunks of restored backup are left behind: %v", err)
+	}
+
+	opts.Alpha = "unreachable"
+	j, _ = p.jobs.Start(ctx, job.KindRestore, "", job.PriorityManual, p.restoreFunc(exportedDir, opts))
+	_, err = j.Wait(ctx)
+	if err == nil || !strings.Contains(err.Error(), "Unable to login") || strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("failed restore = %v, want the last line of loader output without password", err)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/checksum"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/acl"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlschema"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/health"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/schema"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/state"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/podinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/signing"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// manifestKeys sign manifests of exports and check their signatures,
+// nil signer disables signing and nil verifier checks.
+type manifestKeys struct {
+	signer   signing.Signer
+	verifier signing.Verifier
+}
+
+func newManifestKeys(signingKey, verificationKey string, opts ...signing.Option) (manifestKeys, error) {
+	var (
+		keys manifestKeys
+		err  error
+	)
+
+	if signingKey != "" {
+		if keys.signer, err = signing.NewSigner(signingKey, opts...); err != nil {
+			return keys, err
+		}
+	}
+	if verificationKey == "" {
+		verificationKey = signingKey
+	}
+	if verificationKey != "" {
+		if keys.verifier, err = signing.NewVerifier(verificationKey, opts...); err != nil {
+			return keys, err
+		}
+	}
+
+	return keys, nil
+}
+
+// pointOptions returns options restore points are listed with,
+// so points with missing or invalid signature are not verified.
+func (k manifestKeys) pointOptions() []restorepoint.Option {
+	if k.verifier == nil {
+		return nil
+	}
+
+	return []restorepoint.Option{restorepoint.WithVerifier(k.verifier)}
+}
+
+// clusterMetadata collects Dgraph version and group layout at export time.
+// Metadata is informational, so failures are only logged.
+func (p *dgraphParams) clusterMetadata(ctx context.Context, creds *credentials) manifest.Cluster {
+	var cluster manifest.Cluster
+
+	hc, err := health.NewClient(p.adminEndpoint(),
+		health.WithAuthToken(creds.authToken),
+		health.WithAPIKey(creds.apiKey),
+		health.WithRetries(p.retries),
+		health.WithUserAgent(p.userAgent),
+		health.WithLegacy(p.legacy()),
+	)
+	if err != nil {
+		klog.Warningf("failed to get dgraph version: %v", err)
+		return cluster
+	}
+	nodes, err := hc.Check(ctx)
+	if err != nil && len(nodes) == 0 {
+		klog.Warningf("failed to get dgraph version: %v", err)
+	}
+	for _, node := range nodes {
+		if node.Instance == "alpha" {
+			cluster.Version = string(node.Version)
+			break
+		}
+	}
+
+	if caps := p.caps.get(); caps != nil && !caps.State {
+		klog.Warning("skip dgraph cluster state: state query is not supported on this Dgraph version")
+		return cluster
+	}
+
+	sc, err := state.NewClient(p.adminEndpoint(),
+		state.WithAuthToken(creds.authToken),
+		state.WithAPIKey(creds.apiKey),
+		state.WithRetries(p.retries),
+		state.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		klog.Warningf("failed to get dgraph cluster state: %v", err)
+		return cluster
+	}
+	st, err := sc.State(ctx)
+	if err != nil {
+		klog.Warningf("failed to get dgraph cluster state: %v", err)
+		return cluster
+	}
+
+	cluster.ID = string(st.Cid)
+	for _, g := range st.Groups {
+		group := manifest.Group{
+			ID:         uint64(g.ID),
+			Members:    make([]string, 0, len(g.Members)),
+			Predicates: make([]string, 0, len(g.Tablets)),
+		}
+		for _, m := range g.Members {
+			group.Members = append(group.Members, string(m.Addr))
+			if m.Leader {
+				group.Leader = string(m.Addr)
+			}
+		}
+		for _, t := range g.Tablets {
+			group.Predicates = append(group.Predicates, string(t.Predicate))
+		}
+		cluster.Groups = append(cluster.Groups, group)
+	}
+
+	return cluster
+}
+
+// writeManifest stores export manifest next to exported files and
+// returns it, nil is returned when manifest isn't written.
+func (p *dgraphParams) writeManifest(ctx context.Context, creds *credentials, cluster manifest.Cluster, files []string) *manifest.Manifest {
+	if len(files) == 0 {
+		return nil
+	}
+
+	s, err := p.newStorage(creds)
+	if errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("skip export manifest: %v", err)
+		return nil
+	}
+	if err != nil {
+		klog.Errorf("failed to write export manifest: %v", err)
+		return nil
+	}
+
+	ns := p.namespace
+	m := &manifest.Manifest{
+		CreatedAt:   time.Now().UTC(),
+		Destination: redact.URL(p.dest),
+		Format:      p.exportFormat(),
+		Files:       files,
+		Cluster:     cluster,
+		Namespace:   &ns,
+		ToolVersion: buildinfo.Get().Version,
+	}
+	m.Pod = p.podInfo()
+	p.compareSchema(ctx, s, m)
+	m.Sizes = fileSizes(ctx, s, m.Dir(), files)
+	if p.checksums {
+		m.Checksums = p.fileChecksums(ctx, s, files)
+	}
+	if p.aclUser != "" {
+		m.ACL = p.recordACL(ctx, creds)
+	}
+	if !p.legacy() {
+		m.GraphQL = p.captureGQLSchema(ctx, s, creds, m.Dir())
+	}
+
+	key, err := m.Write(ctx, s, p.signer)
+	if err != nil {
+		klog.Errorf("failed to write export manifest: %v", err)
+		return nil
+	}
+
+	klog.Infof("export manifest written to %s", key)
+	job.Report(ctx, "manifest", "%s", key)
+
+	return m
+}
+
+// compareSchema records exported schema summary in manifest and compares
+// it with the previous export, so accidentally dropped predicates or types
+// are noticed before restore.
+func (p *dgraphParams) compareSchema(ctx context.Context, s storage.Storage, m *manifest.Manifest) {
+	for _, file := range m.Files {
+		if !strings.HasSuffix(file, ".schema.gz") || strings.HasSuffix(file, ".gql_schema.gz") {
+			continue
+		}
+
+		sc, err := readSchema(ctx, s, file)
+		if err != nil {
+			klog.Warningf("failed to read exported schema %s: %v", file, err)
+			return
+		}
+		if m.Schema == nil {
+			m.Schema = sc
+		} else {
+			m.Schema.Merge(sc)
+		}
+	}
+	if m.Schema == nil {
+		return
+	}
+
+	prev, err := previousManifest(ctx, s, m)
+	if err != nil {
+		klog.Warningf("failed to find previous export manifest: %v", err)
+		return
+	}
+	if prev == nil || prev.Schema == nil {
+		return
+	}
+
+	diff := m.Schema.Compare(prev.Schema)
+	m.SchemaDiff = &diff
+	if diff.Empty() {
+		return
+	}
+
+	if len(diff.RemovedPredicates) > 0 || len(diff.RemovedTypes) > 0 {
+		klog.Warningf("schema changed since previous export: %s", diff)
+	} else {
+		klog.Infof("schema changed since previous export: %s", diff)
+	}
+	job.Report(ctx, "schema", "%s", diff)
+}
+
+// fileSizes returns sizes of exported files recorded in manifest, nil
+// when they can't be listed, manifest of such export is written without.
+func fileSizes(ctx context.Context, s storage.Storage, dir string, files []string) map[string]int64 {
+	objects, err := s.List(ctx, dir)
+	if err != nil {
+		klog.Warningf("failed to list exported files, manifest is written without their sizes: %v", err)
+		return nil
+	}
+
+	listed := make(map[string]int64, len(objects))
+	for _, obj := range objects {
+		listed[obj.Key] = obj.Size
+	}
+	sizes := make(map[string]int64, len(files))
+	for _, file := range files {
+		if size, ok := listed[file]; ok {
+			sizes[file] = size
+		}
+	}
+
+	return sizes
+}
+
+// fileChecksums returns checksums of exported files recorded in manifest,
+// files are streamed from destination on workers. Nil is returned when
+// any of them fails, manifest of such export is written without.
+func (p *dgraphParams) fileChecksums(ctx context.Context, s storage.Storage, files []string) map[string]string {
+	sums := make([]string, len(files))
+	err := p.workers.Run(ctx, "checksum", len(files), func(ctx context.Context, i int) error {
+		r, err := s.Get(ctx, files[i])
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		sums[i], _, err = checksum.Compute(r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", files[i], err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		klog.Warningf("failed to compute checksums of exported files, manifest is written without them: %v", err)
+		return nil
+	}
+
+	checksums := make(map[string]string, len(files))
+	for i, file := range files {
+		checksums[file] = sums[i]
+	}
+
+	return checksums
+}
+
+// recordACL returns ACL groups of exported namespace, they are read
+// from default namespace when all namespaces are exported. Nil is
+// returned when they can't be read, export doesn't fail then.
+func (p *dgraphParams) recordACL(ctx context.Context, creds *credentials) *acl.ACL {
+	ns := max(p.namespace, 0)
+
+	groups, err := p.aclGroups(ctx, creds, ns)
+	if err != nil {
+		klog.Warningf("failed to read ACL of namespace %d, manifest is written without it: %v", ns, err)
+		return nil
+	}
+
+	return &acl.ACL{Namespace: ns, Groups: groups}
+}
+
+func (p *dgraphParams) aclGroups(ctx context.Context, creds *credentials, ns int64) ([]acl.Group, error) {
+	c, err := p.aclClient(ctx, creds, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Groups(ctx)
+}
+
+// aclClient returns admin client logged in as -manifest.acl-user into
+// namespace ns.
+func (p *dgraphParams) aclClient(ctx context.Context, creds *credentials, ns int64) (*acl.Client, error) {
+	password, err := p.aclPassword.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ACL password: %w", err)
+	}
+
+	c, err := acl.NewClient(p.adminEndpoint(),
+		acl.WithAuthToken(creds.authToken),
+		acl.WithAPIKey(creds.apiKey),
+		acl.WithRetries(p.retries),
+		acl.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Login(ctx, p.aclUser, password, ns); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// captureGQLSchema writes GraphQL schema of exported namespace next to
+// exported files, so GraphQL applications are restored with data. Schema
+// of namespaces other than default is read with -manifest.acl-user login.
+// Nil is returned when there's no schema or it can't be captured.
+func (p *dgraphParams) captureGQLSchema(ctx context.Context, s storage.Storage, creds *credentials, dir string) *manifest.GraphQLSchema {
+	ns := max(p.namespace, 0)
+
+	opts := []gqlschema.Option{
+		gqlschema.WithAuthToken(creds.authToken),
+		gqlschema.WithAPIKey(creds.apiKey),
+		gqlschema.WithRetries(p.retries),
+		gqlschema.WithUserAgent(p.userAgent),
+	}
+	switch {
+	case p.aclUser != "":
+		c, err := p.aclClient(ctx, creds, ns)
+		if err != nil {
+			klog.Warningf("failed to capture GraphQL schema of namespace %d: %v", ns, err)
+			return nil
+		}
+		opts = append(opts, gqlschema.WithAccessJWT(c.AccessJWT()))
+	case ns != 0:
+		klog.V(2).Infof("skip GraphQL schema of namespace %d: it's only read with manifest.acl-user", ns)
+		return nil
+	}
+
+	c, err := gqlschema.NewClient(p.adminEndpoint(), opts...)
+	if err != nil {
+		klog.Warningf("failed to capture GraphQL schema of namespace %d: %v", ns, err)
+		return nil
+	}
+	schema, err := c.Get(ctx)
+	if err != nil {
+		klog.Warningf("failed to capture GraphQL schema of namespace %d: %v", ns, err)
+		return nil
+	}
+	if schema == "" {
+		return nil
+	}
+
+	key := path.Join(dir, manifest.GraphQLSchemaName)
+	if err := s.Put(ctx, key, strings.NewReader(schema), int64(len(schema))); err != nil {
+		klog.Warningf("failed to write GraphQL schema: %v", err)
+		return nil
+	}
+	// reading string never fails
+	sum, _, _ := checksum.Compute(strings.NewReader(schema))
+
+	job.Report(ctx, "graphql-schema", "%s", key)
+
+	return &manifest.GraphQLSchema{File: key, Namespace: ns, Checksum: sum}
+}
+
+func readSchema(ctx context.Context, s storage.Storage, file string) (*schema.Schema, error) {
+	r, err := s.Get(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return schema.ParseGzip(r)
+}
+
+// previousManifest returns manifest of the newest full export of the
+// same namespace as export of m, other namespaces have other schemas.
+func previousManifest(ctx context.Context, s storage.Storage, m *manifest.Manifest) (*manifest.Manifest, error) {
+	points, err := restorepoint.List(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	current := restorepoint.Point{Namespace: m.Namespace}
+	for _, point := range points {
+		if point.ID == m.Dir() || point.Type != restorepoint.TypeFull || !point.SameNamespace(current) {
+			continue
+		}
+
+		m, err := manifest.Read(ctx, s, point.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+
+		return m, err
+	}
+
+	return nil, nil
+}
+
+// podInfo returns pod metadata recorded in manifests, nil outside Kubernetes.
+func (p *dgraphParams) podInfo() *podinfo.Info {
+	if p.pod.Empty() {
+		return nil
+	}
+
+	pod := p.pod
+	return &pod
+}
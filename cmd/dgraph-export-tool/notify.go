@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/notify"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/sigv4"
+)
+
+// exportEvent is the message published after successful export run.
+// Manifest is of the first format exported, Exports lists manifests of
+// all formats when run made more than one.
+type exportEvent struct {
+	Type        string               `json:"type"`
+	ID          string               `json:"id"`
+	Destination string               `json:"destination"`
+	Manifest    *manifest.Manifest   `json:"manifest"`
+	Exports     []*manifest.Manifest `json:"exports,omitempty"`
+}
+
+const exportCompleted = "dgraph.export.completed"
+
+// notifier configures messages published after successful exports.
+type notifier struct {
+	target   string
+	region   string
+	endpoint string
+}
+
+// notifyExport publishes manifests of finished export run in one event,
+// nil ones are skipped. Notifications are best effort, failures are only
+// logged.
+func (p *dgraphParams) notifyExport(ctx context.Context, creds *credentials, manifests ...*manifest.Manifest) {
+	var written []*manifest.Manifest
+	for _, m := range manifests {
+		if m != nil {
+			written = append(written, m)
+		}
+	}
+	if p.notifier.target == "" || len(written) == 0 {
+		return
+	}
+	m := written[0]
+
+	pub, err := notify.New(p.notifier.target,
+		notify.WithCredentials(sigv4.Credentials{
+			AccessKey: creds.accessKey,
+			SecretKey: creds.secretKey,
+		}),
+		notify.WithRegion(p.notifier.region),
+		notify.WithEndpoint(p.notifier.endpoint),
+	)
+	if err != nil {
+		klog.Errorf("failed to publish export notification: %v", err)
+		return
+	}
+
+	event := exportEvent{
+		Type:        exportCompleted,
+		ID:          m.Dir(),
+		Destination: m.Destination,
+		Manifest:    m,
+	}
+	if len(written) > 1 {
+		event.Exports = written
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		klog.Errorf("failed to publish export notification: %v", err)
+		return
+	}
+
+	target := redact.URL(p.notifier.target)
+	if err := pub.Publish(ctx, exportCompleted, body); err != nil {
+		klog.Errorf("failed to publish export notification to %s: %v", target, err)
+		return
+	}
+	klog.Infof("export notification published to %s", target)
+	job.Report(ctx, "notify", "%s", target)
+}
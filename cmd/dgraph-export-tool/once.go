@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+// metricsPushTimeout limits time run-once mode waits for metrics
+// to be accepted before exit.
+const metricsPushTimeout = 30 * time.Second
+
+// Stages run can fail at, reported in run-once summary.
+const (
+	stageConfig = "config"
+	stageExport = "export"
+	stageVerify = "verify"
+	stageUpload = "upload"
+)
+
+// Exit codes of run-once mode, 2 matches invalid command line flags.
+const (
+	exitOK            = 0
+	exitExportFailed  = 1
+	exitConfigInvalid = 2
+	exitVerifyFailed  = 3
+	exitUploadFailed  = 4
+)
+
+var stageExitCodes = map[string]int{
+	stageConfig: exitConfigInvalid,
+	stageExport: exitExportFailed,
+	stageVerify: exitVerifyFailed,
+	stageUpload: exitUploadFailed,
+}
+
+// stageError marks error with stage of the run it happened at.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func stageFailed(stage string, err error) error {
+	return &stageError{stage: stage, err: err}
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// failedStage returns stage err happened at, errors without
+// one are counted as export failures.
+func failedStage(err error) string {
+	var se *stageError
+	if errors.As(err, &se) {
+		return se.stage
+	}
+
+	return stageExport
+}
+
+// onceConfig configures run-once mode.
+type onceConfig struct {
+	validate    bool
+	summaryFile string
+	push        metricsPush
+}
+
+// metricsPush configures where run-once mode sends metrics to,
+// since the process exits before they could be scraped.
+type metricsPush struct {
+	pushgatewayURL string
+	remoteWriteURL string
+	job            string
+}
+
+// runSummary is machine-readable result of run-once mode.
+type runSummary struct {
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exitCode"`
+	Stage      string    `json:"failedStage,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorClass string    `json:"errorClass,omitempty"`
+	JobID      string    `json:"jobId,omitempty"`
+	Files      []string  `json:"files"`
+	DryRun     bool      `json:"dryRun"`
+	Version    string    `json:"version"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	Issues []failure.Issue `json:"issues,omitempty"`
+}
+
+// runOnce runs single export and returns exit code, it doesn't take part
+// in leader election, so runs have to be serialized by the scheduler,
+// e.g. with CronJob concurrencyPolicy: Forbid.
+func (p *dgraphParams) runOnce(ctx context.Context, cfg onceConfig) int {
+	// process exits right after run, so events aren't published in background
+	defer p.events.Drain(ctx)
+
+	sum := runSummary{
+		Files:     []string{},
+		DryRun:    p.dryRun,
+		Version:   buildinfo.Get().Version,
+		StartedAt: time.Now(),
+	}
+
+	var err error
+	if cfg.validate {
+		err = p.validate(ctx)
+	}
+	if err == nil {
+		j, _ := p.jobs.Start(ctx, job.KindExport, "", job.PriorityScheduled, p.runFormats)
+		sum.JobID = j.ID
+
+		var out *export.ExportOutput
+		if out, err = j.Wait(ctx); err == nil && out != nil {
+			sum.Files = out.GetFiles()
+		}
+	}
+	sum.FinishedAt = time.Now()
+
+	if err != nil {
+		sum.Status = string(job.StateFailed)
+		sum.Stage = failedStage(err)
+		sum.ExitCode = stageExitCodes[sum.Stage]
+		sum.Error = err.Error()
+		sum.ErrorClass = string(failure.Of(err))
+		sum.Issues = failure.Issues(err)
+		klog.Errorf("%s failed: %v", sum.Stage, err)
+	} else {
+		sum.Status = string(job.StateSucceeded)
+		sum.ExitCode = exitOK
+		klog.Info("export finished")
+	}
+
+	if cfg.summaryFile != "" {
+		if err := writeSummary(cfg.summaryFile, sum); err != nil {
+			klog.Errorf("failed to write run summary: %v", err)
+		}
+	}
+
+	cfg.push.send(ctx)
+
+	return sum.ExitCode
+}
+
+func writeSummary(path string, sum runSummary) error {
+	b, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// send pushes current metrics, failures are only logged
+// not to fail the run they describe.
+func (m metricsPush) send(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, metricsPushTimeout)
+	defer cancel()
+
+	if m.pushgatewayURL != "" {
+		if err := metrics.Push(ctx, m.pushgatewayURL, m.job); err != nil {
+			klog.Errorf("failed to push metrics to pushgateway: %v", err)
+		}
+	}
+	if m.remoteWriteURL != "" {
+		if err := metrics.RemoteWrite(ctx, m.remoteWriteURL, m.job); err != nil {
+			klog.Errorf("failed to send metrics to remote write endpoint: %v", err)
+		}
+	}
+}
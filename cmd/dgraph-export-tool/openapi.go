@@ -0,0 +1,30 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openapiSpec []byte
+
+// docsPage browses API document without external assets, so it works
+// in air-gapped clusters as well.
+//
+//go:embed docs/index.html
+var docsPage []byte
+
+func apiOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openapiSpec)
+}
+
+func apiSwaggerUIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(docsPage)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/retention"
+)
+
+// Export formats supported by Dgraph.
+const (
+	formatRDF  = "rdf"
+	formatJSON = "json"
+)
+
+// apiExportRequest is the optional body of export request. Set fields
+// override daemon configuration for a single run, unknown fields are rejected.
+type apiExportRequest struct {
+	Format      *string `json:"format,omitempty"`
+	Namespace   *int64  `json:"namespace,omitempty"`
+	Destination *string `json:"destination,omitempty"`
+	Anonymous   *bool   `json:"anonymous,omitempty"`
+	DryRun      *bool   `json:"dryRun,omitempty"`
+}
+
+// decodeExportRequest reads export request body, empty body overrides nothing.
+func decodeExportRequest(r *http.Request) (apiExportRequest, error) {
+	var in apiExportRequest
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+		return in, err
+	}
+
+	return in, nil
+}
+
+func (in apiExportRequest) empty() bool {
+	return in == apiExportRequest{}
+}
+
+// exportRun returns configuration of export with request overrides applied
+// to a copy of p, so other runs aren't affected by them.
+func (p *dgraphParams) exportRun(in apiExportRequest) (*dgraphParams, error) {
+	if in.empty() {
+		return p, nil
+	}
+
+	run := p.runCopy()
+	if in.Format != nil {
+		switch *in.Format {
+		case formatRDF, formatJSON:
+			run.format = *in.Format
+			run.formats = []string{*in.Format}
+		default:
+			return nil, fmt.Errorf("unsupported format %q, use %s or %s", *in.Format, formatRDF, formatJSON)
+		}
+	}
+	if in.Namespace != nil {
+		run.namespace = *in.Namespace
+		// like with rolling exports, retention of scheduled exports
+		// is left to them
+		run.retention = retention.Policy{}
+	}
+	if in.Destination != nil {
+		if !p.destinationAllowed(*in.Destination) {
+			return nil, fmt.Errorf("destination %s isn't allowed, see -api.export-destinations", redact.URL(*in.Destination))
+		}
+		if *in.Destination != p.dest {
+			run.dest = *in.Destination
+			// retention of the daemon destination doesn't apply to ad-hoc exports
+			run.retention = retention.Policy{}
+		}
+	}
+	if in.Anonymous != nil {
+		run.anonymous = *in.Anonymous
+	}
+	if in.DryRun != nil {
+		// daemon started with -dry-run is never made to export for real
+		if p.dryRun && !*in.DryRun {
+			return nil, errors.New("dryRun can't be disabled, daemon is started with -dry-run")
+		}
+		run.dryRun = *in.DryRun
+	}
+
+	klog.Infof("export request overrides: format %s, namespace %d, destination %s, anonymous %t, dry-run %t",
+		run.exportFormat(), run.namespace, redact.URL(run.dest), run.anonymous, run.dryRun)
+
+	return run, nil
+}
+
+// destinationAllowed reports whether export requests may write to dest,
+// that is configured destination or one under -api.export-destinations.
+func (p *dgraphParams) destinationAllowed(dest string) bool {
+	if dest == p.dest {
+		return true
+	}
+	for _, prefix := range p.destAllow {
+		if dest == prefix || strings.HasPrefix(dest, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exportFormat returns format of exported files.
+func (p *dgraphParams) exportFormat() string {
+	if p.format == "" {
+		return formatRDF
+	}
+
+	return p.format
+}
+
+// parseFormats parses comma separated export formats, each one once.
+func parseFormats(value string) ([]string, error) {
+	formats := splitList(value)
+	if len(formats) == 0 {
+		return nil, errors.New("at least one export format is required")
+	}
+	for i, format := range formats {
+		switch format {
+		case formatRDF, formatJSON:
+		default:
+			return nil, fmt.Errorf("unsupported format %q, use %s or %s", format, formatRDF, formatJSON)
+		}
+		if slices.Contains(formats[:i], format) {
+			return nil, fmt.Errorf("export format %s is listed twice", format)
+		}
+	}
+
+	return formats, nil
+}
+
+// runCopy returns copy of configuration for a single run, components
+// like job manager and breaker stay shared.
+func (p *dgraphParams) runCopy() *dgraphParams {
+	run := *p
+	return &run
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// trackProgress periodically reports files written since export start
+// as job progress and to stall watch until ctx is done. Alpha writes
+// exports to local destinations directly, which are listed then, and
+// exports to remote ones to its temporary dir first, which is scanned
+// then: they are uploaded only when export is finished, and listing
+// the whole bucket on every tick costs requests for nothing.
+func (p *dgraphParams) trackProgress(ctx context.Context, creds *credentials, since time.Time, w *stallWatch) {
+	labels := p.metricsRun().Values()
+	defer func() {
+		metrics.ExportWrittenFiles.WithLabelValues(labels...).Set(0)
+		metrics.ExportWrittenBytes.WithLabelValues(labels...).Set(0)
+	}()
+
+	since = since.Truncate(time.Second)
+	written := p.writtenToTmp
+
+	s, err := p.newStorage(creds)
+	if err == nil && storage.IsLocal(s) {
+		written = (&storageProgress{s: s}).written
+	} else if err != nil && !errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("export progress is not tracked: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(p.progress)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pr, observable, err := written(ctx, since)
+			if err != nil {
+				if ctx.Err() == nil {
+					klog.Warningf("failed to get export progress: %v", err)
+				}
+				continue
+			}
+
+			metrics.ExportWrittenFiles.WithLabelValues(labels...).Set(float64(pr.Files))
+			metrics.ExportWrittenBytes.WithLabelValues(labels...).Set(float64(pr.Bytes))
+			job.SetProgress(ctx, pr)
+			w.observe(pr, observable)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// storageProgress counts files of export at destination. The whole
+// destination is listed only until dir of the export is found, only
+// the dir is listed then.
+type storageProgress struct {
+	s   storage.Storage
+	dir string
+}
+
+func (sp *storageProgress) written(ctx context.Context, since time.Time) (job.Progress, bool, error) {
+	var pr job.Progress
+
+	objects, err := sp.s.List(ctx, sp.dir)
+	if err != nil {
+		return pr, false, err
+	}
+
+	if sp.dir == "" {
+		for _, obj := range objects {
+			d := path.Dir(obj.Key)
+			if !obj.LastModified.Before(since) && strings.HasPrefix(path.Base(d), "dgraph.") {
+				sp.dir = d + "/"
+				break
+			}
+		}
+		if sp.dir == "" {
+			return pr, true, nil
+		}
+	}
+
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, sp.dir) && !obj.LastModified.Before(since) {
+			pr.Files++
+			pr.Bytes += obj.Size
+		}
+	}
+
+	return pr, true, nil
+}
+
+// writtenToTmp counts files in Dgraph temporary export dirs,
+// it works when the tool shares filesystem with alpha. Progress
+// isn't observable until alpha creates the dirs.
+func (p *dgraphParams) writtenToTmp(ctx context.Context, since time.Time) (job.Progress, bool, error) {
+	var pr job.Progress
+
+	dirs, err := filepath.Glob(filepath.Join(p.dgraphTmp.prefix, p.dgraphTmp.pattern))
+	if err != nil {
+		return pr, false, err
+	}
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !info.ModTime().Before(since) {
+				pr.Files++
+				pr.Bytes += info.Size()
+			}
+
+			return ctx.Err()
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pr, false, err
+		}
+	}
+
+	return pr, len(dirs) > 0, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/retention"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// apiPruneResponse lists exports retention policy was applied to.
+type apiPruneResponse struct {
+	Action retention.Action `json:"action"`
+	Pruned []string         `json:"pruned"`
+	DryRun bool             `json:"dryRun"`
+	// Expiring lists exports of dry run expiring before the next
+	// scheduled export besides pruned ones.
+	Expiring []string `json:"expiring,omitempty"`
+}
+
+// apiPruneHandler applies retention policy on demand, like it's done
+// after scheduled exports.
+func (p *dgraphParams) apiPruneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dryRun := p.dryRun || r.URL.Query().Get("dryRun") == "true"
+	if err := p.pruneAllowed(dryRun); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	pruned, err := p.applyRetention(r.Context(), s, dryRun)
+	if errors.Is(err, restorepoint.ErrProtected) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	klog.Infof("retention applied by %s to %d exports, dry-run: %t", tokenName(r), len(pruned), dryRun)
+
+	resp := apiPruneResponse{
+		Action: p.retention.Action,
+		Pruned: append([]string{}, pruned...),
+		DryRun: dryRun,
+	}
+	if dryRun {
+		if resp.Expiring, err = p.expiring(r.Context(), s, pruned); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	writeJSON(w, resp)
+}
+
+// expiring returns ids of exports retention policy expires by the next
+// scheduled export, leaving out pruned ones expired already.
+func (p *dgraphParams) expiring(ctx context.Context, s storage.Storage, pruned []string) ([]string, error) {
+	points, err := restorepoint.List(ctx, s, p.pointOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, point := range p.retention.Expired(points, time.Now().Add(p.period)) {
+		if !slices.Contains(pruned, point.ID) {
+			ids = append(ids, point.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// apiRetention is retention policy of status, durations are Go duration strings.
+type apiRetention struct {
+	Action          retention.Action `json:"action"`
+	KeepLast        int              `json:"keepLast,omitempty"`
+	MaxAge          string           `json:"maxAge,omitempty"`
+	MaxTotalSize    int64            `json:"maxTotalSize,omitempty"`
+	StorageClass    string           `json:"storageClass,omitempty"`
+	FreshnessWindow string           `json:"freshnessWindow,omitempty"`
+	// Held is set while export success rate below target holds retention.
+	Held bool `json:"held"`
+}
+
+// retentionStatus returns retention policy, nil when it's disabled.
+func (p *dgraphParams) retentionStatus() *apiRetention {
+	if !p.retention.Enabled() {
+		return nil
+	}
+
+	r := &apiRetention{
+		Action:       p.retention.Action,
+		KeepLast:     p.retention.KeepLast,
+		MaxTotalSize: p.retention.MaxTotalSize,
+		Held:         p.sloHold && p.slo.Violated(),
+	}
+	if p.retention.MaxAge > 0 {
+		r.MaxAge = p.retention.MaxAge.String()
+	}
+	if p.retention.Action == retention.ActionTransition {
+		r.StorageClass = p.retention.StorageClass
+	}
+	if p.retention.Freshness > 0 {
+		r.FreshnessWindow = p.retention.Freshness.String()
+	}
+
+	return r
+}
+
+// pruneAllowed returns why retention policy can't be applied on demand.
+func (p *dgraphParams) pruneAllowed(dryRun bool) error {
+	if !p.retention.Enabled() {
+		return errors.New("retention is disabled, set -retention.keep-last, -retention.max-age or -retention.max-total-size")
+	}
+	if p.sloHold && p.slo.Violated() && !dryRun {
+		return fmt.Errorf("retention is held, export success rate %s is below target", p.slo)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restore"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// apiRestoreRequest is the body of restore request. Namespaces are
+// optional, all namespaces of backup are restored as is by default.
+// Admin endpoint is only needed to create namespace, apply ACL or
+// GraphQL schema.
+type apiRestoreRequest struct {
+	Backup             string `json:"backup"`
+	Alpha              string `json:"alpha"`
+	Zero               string `json:"zero"`
+	User               string `json:"user"`
+	Password           string `json:"password"`
+	SourceNamespace    *int64 `json:"sourceNamespace"`
+	TargetNamespace    *int64 `json:"targetNamespace"`
+	Materialize        bool   `json:"materialize"`
+	Admin              string `json:"admin"`
+	CreateNamespace    bool   `json:"createNamespace"`
+	ApplyACL           bool   `json:"applyAcl"`
+	ApplyGraphQLSchema bool   `json:"applyGraphqlSchema"`
+	NamespacePassword  string `json:"namespacePassword"`
+}
+
+func (in apiRestoreRequest) options() restore.Options {
+	opts := restore.Options{
+		Alpha:           in.Alpha,
+		Zero:            in.Zero,
+		User:            in.User,
+		Password:        in.Password,
+		SourceNamespace: restore.AllNamespaces,
+		TargetNamespace: restore.AllNamespaces,
+		Materialize:     in.Materialize,
+
+		Admin:              in.Admin,
+		CreateNamespace:    in.CreateNamespace,
+		ApplyACL:           in.ApplyACL,
+		ApplyGraphQLSchema: in.ApplyGraphQLSchema,
+		NamespacePassword:  in.NamespacePassword,
+	}
+	if in.SourceNamespace != nil {
+		opts.SourceNamespace = *in.SourceNamespace
+	}
+	if in.TargetNamespace != nil {
+		opts.TargetNamespace = *in.TargetNamespace
+	}
+
+	return opts
+}
+
+// validate returns error of request missing required fields.
+func (in apiRestoreRequest) validate() error {
+	if in.Backup == "" || in.Alpha == "" || in.Zero == "" {
+		return errors.New("backup, alpha and zero are required")
+	}
+	if (in.CreateNamespace || in.ApplyACL || in.ApplyGraphQLSchema) && in.Admin == "" {
+		return errors.New("admin is required to create namespace, apply ACL or GraphQL schema")
+	}
+	if (in.CreateNamespace || in.ApplyACL) && in.User == "" {
+		return errors.New("user is required to create namespace or apply ACL")
+	}
+
+	return nil
+}
+
+// apiRestoreHandler queues restore job and responds without waiting for it,
+// restore progress is available with job API.
+func (p *dgraphParams) apiRestoreHandler(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var in apiRestoreRequest
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := in.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if t := apiauth.FromContext(r.Context()); t.Scoped() {
+			s, ok := p.apiStorage(w)
+			if !ok {
+				return
+			}
+			point, err := restorepoint.Get(r.Context(), s, in.Backup, p.pointOptions()...)
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if err := scopeRestore(t, &in, point); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		key := idempotencyKey(r)
+		j, created := p.jobs.Start(ownerContext(ctx, r), job.KindRestore, key, job.PriorityManual, p.restoreFunc(in.Backup, in.options()))
+		if !created {
+			klog.Infof("restore request with idempotency key %q is served by job %s", key, j.ID)
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		w.Header().Set("X-Job-Id", j.ID)
+		w.WriteHeader(http.StatusAccepted)
+
+		writeJSON(w, j.Status())
+	}
+}
+
+// restoreFunc returns job restoring backup id with opts.
+func (p *dgraphParams) restoreFunc(id string, opts restore.Options) job.Func {
+	return func(ctx context.Context) (*export.ExportOutput, error) {
+		creds, err := p.credentials()
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := p.newStorage(creds)
+		if err != nil {
+			return nil, err
+		}
+
+		klog.Infof("restoring backup %s with %s", id, opts)
+		r := restore.New(s, p.liveLoader.binary, p.liveLoader.tmpDir,
+			restore.WithVerifier(p.verifier),
+			restore.WithPool(p.workers),
+			restore.WithChunkSize(p.liveLoader.chunkSize),
+			restore.WithThrottle(p.liveLoader.limits),
+			restore.WithAdmin(p.retries, p.userAgent),
+		)
+		if err := r.Restore(ctx, id, opts); err != nil {
+			return nil, err
+		}
+		klog.Infof("backup %s restored into %s", id, opts.Alpha)
+
+		return nil, nil
+	}
+}
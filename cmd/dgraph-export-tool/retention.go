@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/events"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/retention"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// retainFiles protects exported files and manifest from deletion
+// with object retention, if it's configured.
+func (p *dgraphParams) retainFiles(ctx context.Context, creds *credentials, files []string) error {
+	if p.lockMode == "" || len(files) == 0 {
+		return nil
+	}
+
+	s, err := p.newStorage(creds)
+	if errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("skip object retention: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r, ok := s.(storage.Retainer)
+	if !ok {
+		klog.Warning("skip object retention: destination doesn't support it")
+		return nil
+	}
+
+	until := time.Now().Add(p.lockFor)
+	keys := append(files[:len(files):len(files)], path.Join(path.Dir(files[0]), manifest.Name))
+	for _, key := range keys {
+		if err := r.Retain(ctx, key, p.lockMode, until); err != nil {
+			return fmt.Errorf("failed to set retention of %s: %w", key, err)
+		}
+	}
+
+	klog.Infof("%d objects retained in %s mode until %s", len(keys), p.lockMode, until.Format(time.RFC3339))
+	job.Report(ctx, "retention", "%d objects retained in %s mode until %s", len(keys), p.lockMode, until.Format(time.RFC3339))
+
+	return nil
+}
+
+// prune applies retention policy to exports at destination.
+func (p *dgraphParams) prune(ctx context.Context, creds *credentials) {
+	if !p.retention.Enabled() {
+		return
+	}
+	if p.sloHold && p.slo.Violated() {
+		klog.Warningf("skip retention: export success rate %s is below target", p.slo)
+		job.Report(ctx, "prune", "skipped, export success rate %s is below target", p.slo)
+		return
+	}
+
+	s, err := p.newStorage(creds)
+	if errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("skip retention: %v", err)
+		return
+	}
+	if err != nil {
+		klog.Errorf("retention failed: %v", err)
+		return
+	}
+
+	_, err = p.applyRetention(ctx, s, p.dryRun)
+	if errors.Is(err, restorepoint.ErrProtected) {
+		klog.Warningf("skip retention: %v", err)
+		job.Report(ctx, "prune", "skipped, %v", err)
+		return
+	}
+	if err != nil {
+		klog.Errorf("retention failed: %v", err)
+		job.Report(ctx, "prune", "%v", err)
+	}
+}
+
+// applyRetention applies retention policy to exports at destination s
+// and returns ids of processed ones, see retention.Apply.
+func (p *dgraphParams) applyRetention(ctx context.Context, s storage.Storage, dryRun bool) ([]string, error) {
+	done, err := retention.Apply(ctx, s, p.retention, dryRun, p.pointOptions()...)
+	for _, id := range done {
+		if dryRun {
+			job.Report(ctx, "prune", "would %s %s", p.retention.Action, id)
+			continue
+		}
+		klog.Infof("retention: %s export %s", p.retention.Action, id)
+		job.Report(ctx, "prune", "%s %s", p.retention.Action, id)
+		p.emit(ctx, events.Event{Type: events.Pruned, Export: id})
+	}
+
+	return done, err
+}
+
+// sizeUnits are multipliers of size suffixes, B goes last
+// as other suffixes end with it.
+var sizeUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40}, {"PiB", 1 << 50},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"PB", 1e15},
+	{"B", 1},
+}
+
+// parseSize parses size in bytes with optional decimal or binary
+// suffix, e.g. 2TB or 500GiB. Empty value is zero.
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSpace(value)
+	if number == "" {
+		return 0, nil
+	}
+
+	unit := 1.0
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(n), u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 || n*unit >= 1<<63 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(n * unit), nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/retention"
+)
+
+// rollingExport configures per-namespace exports spread across export
+// period in batches, so clusters with many namespaces aren't exported at once.
+type rollingExport struct {
+	namespaces []int64
+	batchSize  int
+	batchWait  time.Duration
+	cycle      *rollingCycle
+}
+
+// rollingCycle tracks completion of namespaces of the current cycle.
+type rollingCycle struct {
+	mu     sync.Mutex
+	status rollingStatus
+}
+
+type rollingStatus struct {
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	Total       int        `json:"total"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      []int64    `json:"failed,omitempty"`
+	NextBatchAt *time.Time `json:"nextBatchAt,omitempty"`
+}
+
+func (c *rollingCycle) start(total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status = rollingStatus{StartedAt: time.Now(), Total: total}
+	metrics.RollingCycleNamespaces.WithLabelValues("total").Set(float64(total))
+	metrics.RollingCycleNamespaces.WithLabelValues("succeeded").Set(0)
+	metrics.RollingCycleNamespaces.WithLabelValues("failed").Set(0)
+}
+
+func (c *rollingCycle) done(namespace int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.status.Failed = append(c.status.Failed, namespace)
+		metrics.RollingCycleNamespaces.WithLabelValues("failed").Set(float64(len(c.status.Failed)))
+		return
+	}
+	c.status.Succeeded++
+	metrics.RollingCycleNamespaces.WithLabelValues("succeeded").Set(float64(c.status.Succeeded))
+}
+
+func (c *rollingCycle) waiting(next time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.NextBatchAt = &next
+}
+
+func (c *rollingCycle) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.status.FinishedAt = &now
+	c.status.NextBatchAt = nil
+	if len(c.status.Failed) == 0 {
+		metrics.RollingCycleCompleted.Set(float64(now.Unix()))
+	}
+}
+
+// Status returns copy of cycle status, nil before the first cycle.
+func (c *rollingCycle) Status() *rollingStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status.StartedAt.IsZero() {
+		return nil
+	}
+	st := c.status
+	st.Failed = append([]int64(nil), c.status.Failed...)
+
+	return &st
+}
+
+// rollingLoop starts a cycle exporting every configured namespace
+// each export period while instance is leading.
+func (p *dgraphParams) rollingLoop(ctx context.Context) {
+	if need := time.Duration(len(p.rollingBatches())-1) * p.rollingExport.batchWait; need > p.period {
+		klog.Warningf("rolling export batches take %s, longer than export period %s", need, p.period)
+	}
+
+	for {
+		start := time.Now()
+		p.runCycle(ctx)
+
+		select {
+		case <-time.After(time.Until(start.Add(p.period))):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runCycle exports namespaces batch by batch, batches start
+// p.rollingExport.batchWait apart.
+func (p *dgraphParams) runCycle(ctx context.Context) {
+	cycle := p.rollingExport.cycle
+	cycle.start(len(p.rollingExport.namespaces))
+	klog.Infof("started rolling export of %d namespaces", len(p.rollingExport.namespaces))
+
+	for i, batch := range p.rollingBatches() {
+		if i > 0 {
+			next := time.Now().Add(p.rollingExport.batchWait)
+			cycle.waiting(next)
+			select {
+			case <-time.After(time.Until(next)):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		jobs := make([]*job.Job, 0, len(batch))
+		for _, ns := range batch {
+			run := p.runCopy()
+			run.namespace = ns
+			// retention counts exports of all namespaces together,
+			// so it's left to the regular export
+			run.retention = retention.Policy{}
+
+			j, _ := p.jobs.Start(ctx, job.KindExport, "", job.PriorityScheduled, run.runFormats)
+			jobs = append(jobs, j)
+		}
+		for k, j := range jobs {
+			_, err := j.Wait(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				klog.Errorf("rolling export of namespace %d failed: %v", batch[k], err)
+			}
+			cycle.done(batch[k], err)
+		}
+	}
+
+	cycle.finish()
+	st := cycle.Status()
+	klog.Infof("rolling export cycle finished: %d of %d namespaces exported", st.Succeeded, st.Total)
+}
+
+// rollingBatches splits namespaces into batches of configured size.
+func (p *dgraphParams) rollingBatches() [][]int64 {
+	var batches [][]int64
+	for ns := p.rollingExport.namespaces; len(ns) > 0; {
+		n := min(p.rollingExport.batchSize, len(ns))
+		batches = append(batches, ns[:n])
+		ns = ns[n:]
+	}
+
+	return batches
+}
+
+// parseNamespaces parses comma separated namespaces and ranges, e.g. 1,5-10.
+func parseNamespaces(value string) ([]int64, error) {
+	var namespaces []int64
+	for _, item := range splitList(value) {
+		from, to, isRange := strings.Cut(item, "-")
+		first, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace %q", item)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.ParseInt(to, 10, 64); err != nil || last < first {
+				return nil, fmt.Errorf("invalid namespace range %q", item)
+			}
+		}
+		for ns := first; ns <= last; ns++ {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	return namespaces, nil
+}
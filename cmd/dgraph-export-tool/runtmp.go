@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// runTmpDirKey is context key of export run directory.
+type runTmpDirKey struct{}
+
+// makeRunTmpDir creates directory local files of export run, e.g.
+// downloaded or delta export files, are written to. Its path is template
+// with {run} and {time} replaced by run ID and start time, run ID is
+// appended to templates without it, so every run gets its own directory.
+// Returned function removes exactly that directory. Nothing is created
+// for empty template, files go to default temporary dirs then.
+func makeRunTmpDir(ctx context.Context, template, id string, now time.Time, dryRun bool) (context.Context, func(), error) {
+	if template == "" || dryRun {
+		return ctx, func() {}, nil
+	}
+
+	if !strings.Contains(template, "{run}") {
+		template = filepath.Join(template, "{run}")
+	}
+	dir := strings.NewReplacer(
+		"{run}", id,
+		"{time}", now.UTC().Format("20060102.150405"),
+	).Replace(template)
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return ctx, nil, fmt.Errorf("failed to create run tmp dir: %w", err)
+	}
+	// Mkdir fails for existing dir, so other run's files are never removed
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return ctx, nil, fmt.Errorf("failed to create run tmp dir: %w", err)
+	}
+	klog.V(1).Infof("run tmp dir: %s", dir)
+
+	return context.WithValue(ctx, runTmpDirKey{}, dir), func() {
+		if err := os.RemoveAll(dir); err != nil {
+			klog.Warningf("failed to remove run tmp dir: %v", err)
+		}
+	}, nil
+}
+
+// runTmpDir returns directory of export run, fallback when it has none.
+func runTmpDir(ctx context.Context, fallback string) string {
+	if dir, ok := ctx.Value(runTmpDirKey{}).(string); ok {
+		return dir
+	}
+
+	return fallback
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlschema"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+// Sources of schema change notifications.
+const (
+	schemaSourceWebhook = "webhook"
+	schemaSourcePoll    = "poll"
+)
+
+// exportOnSchemaChange starts out-of-band export of changed schema,
+// so every schema migration is followed by a backup.
+func (p *dgraphParams) exportOnSchemaChange(ctx context.Context, source, key string) (*job.Job, bool) {
+	metrics.SchemaChangeExports.WithLabelValues(source).Inc()
+
+	return p.jobs.Start(ctx, job.KindExport, key, job.PriorityManual, func(ctx context.Context) (*export.ExportOutput, error) {
+		job.Report(ctx, "trigger", "schema changed, reported by %s", source)
+		return p.runFormats(ctx)
+	})
+}
+
+// apiSchemaChangedHandler lets migration pipelines request export after
+// applying schema. Export isn't waited for, job API follows it.
+func (p *dgraphParams) apiSchemaChangedHandler(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := idempotencyKey(r)
+		j, created := p.exportOnSchemaChange(ownerContext(ctx, r), schemaSourceWebhook, key)
+		if !created {
+			klog.Infof("schema change with idempotency key %q is served by job %s", key, j.ID)
+			w.Header().Set("Idempotent-Replayed", "true")
+		} else {
+			klog.Infof("schema change is reported, started export job %s", j.ID)
+		}
+		w.Header().Set("X-Job-Id", j.ID)
+		w.WriteHeader(http.StatusAccepted)
+
+		writeJSON(w, j.Status())
+	}
+}
+
+// schemaPollLoop polls GraphQL schema every p.gqlPoll while instance
+// is leading and exports when it changes. Schema seen first is baseline,
+// it's been exported by regular schedule.
+func (p *dgraphParams) schemaPollLoop(ctx context.Context) {
+	t := time.NewTicker(p.gqlPoll)
+	defer t.Stop()
+
+	var last string
+	for {
+		select {
+		case <-t.C:
+			hash, err := p.gqlSchemaHash(ctx)
+			if err != nil {
+				klog.Warningf("failed to get GraphQL schema: %v", err)
+				continue
+			}
+			if last != "" && hash != last {
+				j, _ := p.exportOnSchemaChange(ctx, schemaSourcePoll, "schema-changed/"+hash)
+				klog.Infof("GraphQL schema changed, started export job %s", j.ID)
+			}
+			last = hash
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *dgraphParams) gqlSchemaHash(ctx context.Context) (string, error) {
+	creds, err := p.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	c, err := gqlschema.NewClient(p.adminEndpoint(),
+		gqlschema.WithAuthToken(creds.authToken),
+		gqlschema.WithAPIKey(creds.apiKey),
+		gqlschema.WithRetries(p.retries),
+		gqlschema.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		return "", err
+	}
+	schema, err := c.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(schema))
+	return hex.EncodeToString(sum[:8]), nil
+}
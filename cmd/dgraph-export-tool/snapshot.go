@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/snapshot"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// takeSnapshot collects tool state, restore points are listed at s.
+func (p *dgraphParams) takeSnapshot(ctx context.Context, s storage.Storage) (*snapshot.Snapshot, error) {
+	points, err := restorepoint.List(ctx, s, p.pointOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot.Snapshot{
+		CreatedAt:     time.Now(),
+		Identity:      p.identity,
+		Version:       buildinfo.Get().Version,
+		Config:        make(map[string]string),
+		BackupSLO:     p.slo.String(),
+		RestorePoints: points,
+		Jobs:          make([]job.Status, 0),
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		snap.Config[f.Name] = redact.URL(f.Value.String())
+	})
+	for _, j := range p.jobs.List() {
+		snap.Jobs = append(snap.Jobs, j.Status())
+	}
+	if p.holders != nil {
+		if h, err := p.holders.Get(ctx); err != nil {
+			klog.Warningf("failed to get lease holder metadata: %v", err)
+		} else {
+			snap.Leader = h
+		}
+	}
+
+	return snap, nil
+}
+
+// apiStateExportHandler serves state snapshot at /api/v1/state/export.
+func (p *dgraphParams) apiStateExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s, ok := p.apiStorage(w)
+	if !ok {
+		return
+	}
+
+	snap, err := p.takeSnapshot(r.Context(), s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+snapshot.Name+`"`)
+	writeJSON(w, snap)
+}
+
+// snapshotLoop uploads state snapshot to destination every p.snapshot
+// while instance is leading.
+func (p *dgraphParams) snapshotLoop(ctx context.Context) {
+	t := time.NewTicker(p.snapshot)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := p.uploadSnapshot(ctx); err != nil {
+				klog.Errorf("failed to upload state snapshot: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *dgraphParams) uploadSnapshot(ctx context.Context) error {
+	creds, err := p.credentials()
+	if err != nil {
+		return err
+	}
+
+	s, err := p.newStorage(creds)
+	if err != nil {
+		return err
+	}
+
+	snap, err := p.takeSnapshot(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if p.dryRun {
+		klog.Infof("dry-run: would upload state snapshot with %d restore points", len(snap.RestorePoints))
+		return nil
+	}
+	if err := snap.Write(ctx, s); err != nil {
+		return err
+	}
+	klog.V(2).Infof("uploaded state snapshot with %d restore points", len(snap.RestorePoints))
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+var errStalled = errors.New("export stalled")
+
+// stallConfig configures cancelling of exports whose written
+// bytes stop advancing, e.g. on a wedged alpha.
+type stallConfig struct {
+	timeout time.Duration
+	retries int
+}
+
+// stallWatch cancels export attempt when progress reported by
+// trackProgress doesn't change for timeout.
+type stallWatch struct {
+	timeout time.Duration
+
+	mu        sync.Mutex
+	last      job.Progress
+	changedAt time.Time
+	cancel    context.CancelCauseFunc
+}
+
+// attempt returns context of the next export attempt,
+// stall timeout is counted from its start.
+func (w *stallWatch) attempt(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.changedAt = time.Now()
+	w.cancel = cancel
+
+	return ctx, cancel
+}
+
+// observe records progress and cancels attempt stalled for timeout.
+// Timeout isn't counted while progress isn't observable, e.g. alpha
+// uploads exports to S3 only when they are finished, and nothing is
+// seen before unless its temporary dir is shared.
+func (w *stallWatch) observe(pr job.Progress, observable bool) {
+	if w == nil || w.timeout <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !observable {
+		w.changedAt = time.Now()
+		return
+	}
+	if pr != w.last {
+		w.last = pr
+		w.changedAt = time.Now()
+		return
+	}
+	if w.cancel != nil && time.Since(w.changedAt) >= w.timeout {
+		w.cancel(errStalled)
+	}
+}
+
+// exportWatched requests export, cancelling and retrying it up to
+// p.stall.retries times when nothing is written for p.stall.timeout.
+// Alpha may go on with cancelled export, only the request is given up,
+// so retry refused as busy is repeated until alpha is idle.
+func (p *dgraphParams) exportWatched(ctx context.Context, c *export.Client, w *stallWatch) (*export.ExportOutput, error) {
+	var stalledAt time.Time
+	for attempt := 0; ; {
+		actx, cancel := w.attempt(ctx)
+		resp, err := p.export(actx, c)
+		stalled := errors.Is(context.Cause(actx), errStalled)
+		cancel(nil)
+		if !stalled && !stalledAt.IsZero() && errors.Is(err, failure.ErrClusterBusy) {
+			if err := p.waitIdle(ctx, stalledAt); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !stalled {
+			return resp, err
+		}
+		stalledAt = time.Now()
+
+		metrics.ExportsStalled.WithLabelValues(p.metricsRun().Values()...).Inc()
+		if attempt >= p.stall.retries {
+			err := fmt.Errorf("%w: nothing written for %s, %d retries failed", errStalled, p.stall.timeout, p.stall.retries)
+			return nil, failure.Wrap(failure.ErrTimeout, err)
+		}
+
+		attempt++
+		klog.Warningf("export stalled, nothing written for %s, retrying (%d/%d)", p.stall.timeout, attempt, p.stall.retries)
+		job.Report(ctx, "stalled", "nothing written for %s, retrying (%d/%d)", p.stall.timeout, attempt, p.stall.retries)
+	}
+}
+
+// waitIdle waits before export is requested again from alpha busy with
+// export of stalled attempt. Alpha is given up to export period to
+// finish it, the run fails as refused by busy alpha then.
+func (p *dgraphParams) waitIdle(ctx context.Context, stalledAt time.Time) error {
+	delay := p.busyWait
+	if delay <= 0 {
+		delay = p.stall.timeout
+	}
+	if time.Since(stalledAt)+delay > p.period {
+		err := fmt.Errorf("%w: alpha is still busy with export of stalled attempt after %s", errStalled, time.Since(stalledAt).Round(time.Second))
+		return failure.Wrap(failure.ErrClusterBusy, err)
+	}
+
+	klog.Warningf("alpha is busy with export of stalled attempt, retrying in %s", delay)
+	job.Report(ctx, "stalled", "alpha is busy with export of stalled attempt, retrying in %s", delay)
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/load"
+)
+
+// throttle defers scheduled exports while cluster is busy.
+type throttle struct {
+	url          string
+	thresholds   load.Thresholds
+	delay        time.Duration
+	maxDeferrals int
+}
+
+// metricsURL returns alpha metrics url next to /admin endpoint.
+func (p *dgraphParams) metricsURL() string {
+	if p.throttle.url != "" {
+		return p.throttle.url
+	}
+
+	return strings.TrimSuffix(p.adminEndpoint(), "/admin") + "/debug/prometheus_metrics"
+}
+
+// clusterBusy returns why scheduled export should be deferred, empty
+// reason means export may start. Export isn't deferred when metrics
+// can't be read.
+func (p *dgraphParams) clusterBusy(ctx context.Context) string {
+	if !p.throttle.thresholds.Enabled() {
+		return ""
+	}
+
+	c, err := load.NewClient(p.metricsURL(),
+		load.WithRetries(p.retries),
+		load.WithUserAgent(p.userAgent),
+	)
+	if err != nil {
+		klog.Warningf("failed to check cluster load: %v", err)
+		return ""
+	}
+
+	reason, err := c.Check(ctx, p.throttle.thresholds)
+	if err != nil {
+		klog.Warningf("failed to check cluster load: %v", err)
+		return ""
+	}
+
+	return reason
+}
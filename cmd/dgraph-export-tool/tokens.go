@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+)
+
+// apiTokenRequest is the body of token creation request.
+type apiTokenRequest struct {
+	Name       string       `json:"name"`
+	Role       apiauth.Role `json:"role"`
+	Namespaces []int64      `json:"namespaces,omitempty"`
+}
+
+// apiTokenResponse is issued token with its value, which is returned
+// only once.
+type apiTokenResponse struct {
+	apiauth.StoredToken
+
+	Token string `json:"token"`
+}
+
+func (p *dgraphParams) apiTokensHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := p.auth.Stored(r.Context())
+		if err != nil {
+			apiTokenError(w, err)
+			return
+		}
+		if tokens == nil {
+			tokens = []apiauth.StoredToken{}
+		}
+		writeJSON(w, tokens)
+	case http.MethodPost:
+		in := apiTokenRequest{Role: apiauth.RoleOperator}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		t, value, err := p.auth.Issue(r.Context(), apiauth.Token{Name: in.Name, Role: in.Role, Namespaces: in.Namespaces})
+		if err != nil {
+			apiTokenError(w, err)
+			return
+		}
+		klog.Infof("API token %s with role %s issued by %s", t.Name, t.Role, tokenName(r))
+
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, apiTokenResponse{StoredToken: *t, Token: value})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// apiTokenHandler serves /api/v1/tokens/{name} and its rotate action.
+func (p *dgraphParams) apiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/tokens/"), "/")
+	switch {
+	case name == "":
+		http.NotFound(w, r)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := p.auth.Revoke(r.Context(), name); err != nil {
+			apiTokenError(w, err)
+			return
+		}
+		klog.Infof("API token %s revoked by %s", name, tokenName(r))
+		w.WriteHeader(http.StatusNoContent)
+	case action == "rotate" && r.Method == http.MethodPost:
+		t, value, err := p.auth.Rotate(r.Context(), name)
+		if err != nil {
+			apiTokenError(w, err)
+			return
+		}
+		klog.Infof("API token %s rotated by %s", name, tokenName(r))
+		writeJSON(w, apiTokenResponse{StoredToken: *t, Token: value})
+	case action == "" || action == "rotate":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func apiTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, apiauth.ErrUnmanaged):
+		http.Error(w, err.Error()+", set -ydb.tokens-table-name", http.StatusNotImplemented)
+	case errors.Is(err, apiauth.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, apiauth.ErrExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, apiauth.ErrNotFound):
+		http.Error(w, "Token not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// tokenName returns name of token request is authenticated with.
+func tokenName(r *http.Request) string {
+	return contextTokenName(r.Context())
+}
+
+// contextTokenName returns name of token call with ctx is authenticated
+// with, like tokenName does for requests.
+func contextTokenName(ctx context.Context) string {
+	if t := apiauth.FromContext(ctx); t != nil {
+		return t.Name
+	}
+
+	return "anonymous"
+}
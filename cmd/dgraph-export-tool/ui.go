@@ -0,0 +1,20 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves embedded dashboard at /ui/.
+func uiHandler() http.Handler {
+	root, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(root)))
+}
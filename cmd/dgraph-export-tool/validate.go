@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/validate"
+)
+
+// validateFiles reads back p.validateN exported files picked at random
+// and parses them, so truncated or corrupted files fail export while it
+// can be retried instead of being the only backup left.
+func (p *dgraphParams) validateFiles(ctx context.Context, creds *credentials, files []string) error {
+	s, err := p.newStorage(creds)
+	if errors.Is(err, storage.ErrUnsupported) {
+		klog.Warningf("skip validation of exported files: %v", err)
+		return nil
+	}
+	if err != nil {
+		return failure.Wrap(failure.ErrDestination, err)
+	}
+
+	sample := sampleFiles(files, p.validateN)
+	err = p.workers.Run(ctx, "validate", len(sample), func(ctx context.Context, i int) error {
+		r, err := s.Get(ctx, sample[i])
+		if err != nil {
+			return failure.Wrap(failure.ErrDestination, err)
+		}
+		defer r.Close()
+
+		err = validate.File(r, sample[i])
+		if errors.Is(err, validate.ErrInvalid) {
+			metrics.ValidatedFiles.WithLabelValues("invalid").Inc()
+			return failure.Wrap(failure.ErrPartialExport, err)
+		}
+		if err != nil {
+			return failure.Wrap(failure.ErrDestination, err)
+		}
+
+		metrics.ValidatedFiles.WithLabelValues("ok").Inc()
+		job.Report(ctx, "validated", "%s", sample[i])
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("%d of %d exported files are validated", len(sample), len(files))
+
+	return nil
+}
+
+// sampleFiles returns up to n files picked at random.
+func sampleFiles(files []string, n int) []string {
+	if n >= len(files) {
+		return files
+	}
+
+	sample := make([]string, 0, n)
+	for _, i := range rand.Perm(len(files))[:n] {
+		sample = append(sample, files[i])
+	}
+
+	return sample
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/fault"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+// verifyConfig configures scheduled verification of backups at destination.
+type verifyConfig struct {
+	interval time.Duration
+	count    int
+	// cache makes runs skip files verified before, unless they changed
+	// or were verified more than cacheAge ago.
+	cache    bool
+	cacheAge time.Duration
+}
+
+// verifyLoop checks the newest backups every p.verify.interval
+// while instance is leading.
+func (p *dgraphParams) verifyLoop(ctx context.Context) {
+	t := time.NewTicker(p.verify.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			j, _ := p.jobs.Start(ctx, job.KindVerify, "", job.PriorityVerify, p.runVerify)
+			if _, err := j.Wait(ctx); err != nil {
+				klog.Errorf("backup verification failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runVerify checks manifests, signatures and file checksums of the
+// newest p.verify.count backups without exporting anything, so files
+// corrupted or removed by bucket lifecycle rules are found before
+// restore needs them. It fails when any of them has a problem.
+func (p *dgraphParams) runVerify(ctx context.Context) (*export.ExportOutput, error) {
+	creds, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := p.newStorage(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := append(p.pointOptions(), restorepoint.WithPool(p.workers))
+	if p.verify.cache && !p.dryRun {
+		opts = append(opts, restorepoint.WithVerificationCache(p.verify.cacheAge))
+	}
+	points, err := restorepoint.List(ctx, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) > p.verify.count {
+		points = points[:p.verify.count]
+	}
+
+	bad := 0
+	for _, point := range points {
+		checked, err := restorepoint.Check(ctx, s, point.ID, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify backup %s: %w", point.ID, err)
+		}
+		if checked.Problem == "" && p.faults.Fail(fault.Verify) != nil {
+			checked.Problem = "checksum mismatch is injected"
+		}
+		if checked.Problem != "" {
+			bad++
+			klog.Warningf("backup %s is not restorable: %s", checked.ID, checked.Problem)
+			job.Report(ctx, "problem", "%s: %s", checked.ID, checked.Problem)
+			continue
+		}
+		job.Report(ctx, "verified", "%s", checked.ID)
+	}
+
+	metrics.VerifyCheckedBackups.WithLabelValues("ok").Set(float64(len(points) - bad))
+	metrics.VerifyCheckedBackups.WithLabelValues("problem").Set(float64(bad))
+	metrics.LastVerifyTimestamp.SetToCurrentTime()
+
+	if bad > 0 {
+		return nil, fmt.Errorf("%d of %d checked backups have problems", bad, len(points))
+	}
+	klog.Infof("verified %d newest backups", len(points))
+
+	return nil, nil
+}
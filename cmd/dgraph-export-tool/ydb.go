@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	ydbenv "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+	ydbsdk "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/balancers"
+)
+
+// ydbConfig holds YDB connection settings, zero values keep SDK defaults.
+type ydbConfig struct {
+	database          string
+	dialTimeout       time.Duration
+	discoveryInterval time.Duration
+	sessionPoolLimit  int
+	caFile            string
+	balancer          string
+}
+
+func (c ydbConfig) options(ctx context.Context) ([]ydbsdk.Option, error) {
+	opts := []ydbsdk.Option{
+		ydbenv.WithEnvironCredentials(ctx),
+		ydbsdk.WithDatabase(c.database),
+	}
+	if c.dialTimeout > 0 {
+		opts = append(opts, ydbsdk.WithDialTimeout(c.dialTimeout))
+	}
+	if c.discoveryInterval > 0 {
+		opts = append(opts, ydbsdk.WithDiscoveryInterval(c.discoveryInterval))
+	}
+	if c.sessionPoolLimit > 0 {
+		opts = append(opts, ydbsdk.WithSessionPoolSizeLimit(c.sessionPoolLimit))
+	}
+	if c.caFile != "" {
+		opts = append(opts, ydbsdk.WithCertificatesFromFile(c.caFile))
+	}
+	if c.balancer != "" {
+		b, err := balancers.CreateFromConfig(c.balancer)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ydbsdk.WithBalancer(b))
+	}
+
+	return opts, nil
+}
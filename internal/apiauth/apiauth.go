@@ -0,0 +1,198 @@
+// Package apiauth authenticates management API requests with bearer
+// tokens. Tokens may be scoped to Dgraph namespaces, so tenants of
+// multi-tenant clusters can back up and restore their own namespaces.
+package apiauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/secret"
+)
+
+// Token is API client credential. Token without namespaces grants
+// access to the whole API its role permits, scoped one only to its
+// namespaces.
+type Token struct {
+	Name       string  `json:"name"`
+	TokenFile  string  `json:"tokenFile"`
+	Role       Role    `json:"role,omitempty"`
+	Namespaces []int64 `json:"namespaces,omitempty"`
+}
+
+// Role is set of API requests token is permitted.
+type Role string
+
+const (
+	// RoleAdmin permits everything, tokens management included.
+	RoleAdmin Role = "admin"
+	// RoleOperator permits everything but tokens management.
+	RoleOperator Role = "operator"
+	// RoleViewer permits only reading requests.
+	RoleViewer Role = "viewer"
+)
+
+// Validate returns error unless role r is known one.
+func (r Role) Validate() error {
+	switch r {
+	case RoleAdmin, RoleOperator, RoleViewer:
+		return nil
+	default:
+		return fmt.Errorf("unknown API token role %q", r)
+	}
+}
+
+// Load reads JSON list of tokens from file.
+func Load(path string) ([]Token, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse API tokens config %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for i, t := range tokens {
+		switch {
+		case t.Name == "":
+			return nil, fmt.Errorf("API token with file %s has no name", t.TokenFile)
+		case names[t.Name]:
+			return nil, fmt.Errorf("API token %q is configured twice", t.Name)
+		case t.TokenFile == "":
+			return nil, fmt.Errorf("API token %q has no token file", t.Name)
+		}
+		names[t.Name] = true
+
+		// tokens configured before roles were introduced grant everything
+		if tokens[i].Role == "" {
+			tokens[i].Role = RoleAdmin
+		}
+		if err := tokens[i].Role.Validate(); err != nil {
+			return nil, fmt.Errorf("API token %q: %w", t.Name, err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Scoped returns whether token is limited to its namespaces.
+func (t *Token) Scoped() bool {
+	return t != nil && len(t.Namespaces) > 0
+}
+
+// Allows returns whether token grants access to namespace ns,
+// nil token of unauthenticated API allows everything.
+func (t *Token) Allows(ns int64) bool {
+	return !t.Scoped() || slices.Contains(t.Namespaces, ns)
+}
+
+type contextKey struct{}
+
+// FromContext returns token request was authenticated with, nil
+// when authentication is disabled.
+func FromContext(ctx context.Context) *Token {
+	t, _ := ctx.Value(contextKey{}).(*Token)
+	return t
+}
+
+// NewContext returns ctx of request authenticated with token t.
+func NewContext(ctx context.Context, t *Token) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// Authenticator is middleware checking Authorization header of requests.
+// Token files are read on every request, so rotated tokens are picked up
+// without restart.
+type Authenticator struct {
+	tokens []token
+
+	store *cachedStore
+}
+
+type token struct {
+	Token
+	value secret.Source
+}
+
+// Option configures Authenticator.
+type Option func(a *Authenticator)
+
+// WithStore makes Authenticator accept tokens managed in store besides
+// configured ones. Stored tokens are cached for refresh interval, so
+// tokens changed by other replicas are picked up within it.
+func WithStore(store Store, refresh time.Duration) Option {
+	return func(a *Authenticator) {
+		if store != nil {
+			a.store = &cachedStore{Store: store, refresh: refresh}
+		}
+	}
+}
+
+func New(tokens []Token, opts ...Option) *Authenticator {
+	a := &Authenticator{}
+	for _, t := range tokens {
+		if t.Role == "" {
+			t.Role = RoleAdmin
+		}
+		a.tokens = append(a.tokens, token{Token: t, value: secret.NewFile(t.TokenFile)})
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Handler responds with 401 Unauthorized to requests without valid bearer
+// token, nil authenticator passes all requests through.
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := a.Authenticate(r.Context(), r.Header.Get("Authorization"))
+		if t == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dgraph-export-tool"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), t)))
+	})
+}
+
+// Authenticate returns token of Authorization header value "Bearer <token>",
+// nil when it's missing or isn't valid.
+func (a *Authenticator) Authenticate(ctx context.Context, header string) *Token {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || got == "" {
+		return nil
+	}
+
+	for i := range a.tokens {
+		t := &a.tokens[i]
+		want, err := t.value.Get()
+		if err != nil {
+			klog.Warningf("failed to read API token %s: %v", t.Name, err)
+			continue
+		}
+		if want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1 {
+			return &t.Token
+		}
+	}
+
+	return a.store.authenticate(ctx, got)
+}
@@ -0,0 +1,143 @@
+package apiauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	if err := os.WriteFile(file, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := New([]Token{{Name: "tenant", TokenFile: file, Namespaces: []int64{5}}})
+	var got *Token
+	h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+
+	for _, tc := range []struct {
+		header string
+		code   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		got = nil
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil)
+		if tc.header != "" {
+			r.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tc.code {
+			t.Errorf("Authorization %q: code %d, want %d", tc.header, w.Code, tc.code)
+		}
+		if tc.code == http.StatusOK && (got == nil || got.Name != "tenant") {
+			t.Errorf("Authorization %q: token %v, want tenant", tc.header, got)
+		}
+	}
+
+	if !got.Allows(5) || got.Allows(6) {
+		t.Errorf("token scoped to namespace 5 allows 5: %t, 6: %t", got.Allows(5), got.Allows(6))
+	}
+	var none *Token
+	if none.Scoped() || !none.Allows(6) {
+		t.Error("nil token of unauthenticated API must allow every namespace")
+	}
+}
+
+type memoryStore map[string]StoredToken
+
+func (s memoryStore) List(ctx context.Context) ([]StoredToken, error) {
+	var tokens []StoredToken
+	for _, t := range s {
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (s memoryStore) Create(ctx context.Context, t StoredToken) error {
+	if _, ok := s[t.Name]; ok {
+		return ErrExists
+	}
+	s[t.Name] = t
+	return nil
+}
+
+func (s memoryStore) Update(ctx context.Context, t StoredToken) error {
+	if _, ok := s[t.Name]; !ok {
+		return ErrNotFound
+	}
+	s[t.Name] = t
+	return nil
+}
+
+func (s memoryStore) Delete(ctx context.Context, name string) error {
+	if _, ok := s[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s, name)
+	return nil
+}
+
+func TestStoredTokens(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore{}
+	a := New([]Token{{Name: "bootstrap", TokenFile: filepath.Join(t.TempDir(), "missing")}}, WithStore(store, time.Hour))
+
+	if _, _, err := a.Issue(ctx, Token{Name: "bootstrap", Role: RoleViewer}); !errors.Is(err, ErrExists) {
+		t.Errorf("issue of configured token name: %v, want ErrExists", err)
+	}
+	if _, _, err := a.Issue(ctx, Token{Name: "ci", Role: RoleAdmin, Namespaces: []int64{1}}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("issue of scoped admin token: %v, want ErrInvalid", err)
+	}
+
+	st, value, err := a.Issue(ctx, Token{Name: "ci", Role: RoleOperator, Namespaces: []int64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := store["ci"]; stored.Hash != Hash(value) || stored.Hash == value || st.Hash != stored.Hash {
+		t.Errorf("token must be stored hashed, got %q for value %q", stored.Hash, value)
+	}
+	if got := a.Authenticate(ctx, "Bearer "+value); got == nil || got.Name != "ci" || got.Role != RoleOperator || !got.Scoped() {
+		t.Errorf("issued token authenticated as %v, want scoped ci operator", got)
+	}
+
+	_, rotated, err := a.Rotate(ctx, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Authenticate(ctx, "Bearer "+value) != nil {
+		t.Error("previous value of rotated token must not be accepted")
+	}
+	if a.Authenticate(ctx, "Bearer "+rotated) == nil {
+		t.Error("new value of rotated token must be accepted")
+	}
+
+	if err := a.Revoke(ctx, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if a.Authenticate(ctx, "Bearer "+rotated) != nil {
+		t.Error("revoked token must not be accepted")
+	}
+	if _, _, err := a.Rotate(ctx, "ci"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rotation of revoked token: %v, want ErrNotFound", err)
+	}
+
+	var none *Authenticator
+	if _, err := none.Stored(ctx); !errors.Is(err, ErrUnmanaged) {
+		t.Errorf("tokens of unauthenticated API: %v, want ErrUnmanaged", err)
+	}
+}
@@ -0,0 +1,230 @@
+package apiauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	// ErrNotFound is returned for tokens not in store.
+	ErrNotFound = errors.New("API token not found")
+	// ErrExists is returned when token with the same name exists.
+	ErrExists = errors.New("API token already exists")
+	// ErrUnmanaged is returned when tokens aren't kept in store.
+	ErrUnmanaged = errors.New("API tokens management is disabled")
+	// ErrInvalid is returned for tokens which can't be issued.
+	ErrInvalid = errors.New("invalid API token")
+)
+
+// StoredToken is API token managed with the API. Token value is shown
+// only when it's issued, store keeps its hash.
+type StoredToken struct {
+	Name       string     `json:"name"`
+	Role       Role       `json:"role"`
+	Namespaces []int64    `json:"namespaces,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RotatedAt  *time.Time `json:"rotatedAt,omitempty"`
+
+	// Hash is hex encoded SHA-256 of token value.
+	Hash string `json:"-"`
+}
+
+// Store keeps managed API tokens.
+type Store interface {
+	List(ctx context.Context) ([]StoredToken, error)
+	// Create fails with ErrExists if token with the same name exists.
+	Create(ctx context.Context, t StoredToken) error
+	// Update fails with ErrNotFound unless token exists.
+	Update(ctx context.Context, t StoredToken) error
+	// Delete fails with ErrNotFound unless token exists.
+	Delete(ctx context.Context, name string) error
+}
+
+// Hash returns hash token value is kept in store with.
+func Hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// generate returns random token value.
+func generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Managed returns whether tokens can be managed with a.
+func (a *Authenticator) Managed() bool {
+	return a != nil && a.store != nil
+}
+
+// Stored returns managed tokens.
+func (a *Authenticator) Stored(ctx context.Context) ([]StoredToken, error) {
+	if !a.Managed() {
+		return nil, ErrUnmanaged
+	}
+
+	return a.store.List(ctx)
+}
+
+// Issue stores token with name, role and namespaces of t and returns
+// its value, which can't be got later.
+func (a *Authenticator) Issue(ctx context.Context, t Token) (*StoredToken, string, error) {
+	if !a.Managed() {
+		return nil, "", ErrUnmanaged
+	}
+
+	switch {
+	case t.Name == "":
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalid)
+	case t.Role == RoleAdmin && len(t.Namespaces) > 0:
+		return nil, "", fmt.Errorf("%w: admin token can't be scoped to namespaces", ErrInvalid)
+	}
+	if err := t.Role.Validate(); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// configured tokens are looked up first, stored one would never match
+	for _, c := range a.tokens {
+		if c.Name == t.Name {
+			return nil, "", fmt.Errorf("%w: %s is configured with file", ErrExists, t.Name)
+		}
+	}
+
+	value, err := generate()
+	if err != nil {
+		return nil, "", err
+	}
+	st := StoredToken{
+		Name:       t.Name,
+		Role:       t.Role,
+		Namespaces: t.Namespaces,
+		CreatedAt:  time.Now().UTC(),
+		Hash:       Hash(value),
+	}
+	if err := a.store.Create(ctx, st); err != nil {
+		return nil, "", err
+	}
+	a.store.invalidate()
+
+	return &st, value, nil
+}
+
+// Rotate replaces value of stored token name, the previous one stops
+// being accepted.
+func (a *Authenticator) Rotate(ctx context.Context, name string) (*StoredToken, string, error) {
+	if !a.Managed() {
+		return nil, "", ErrUnmanaged
+	}
+
+	tokens, err := a.store.List(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	var st *StoredToken
+	for i := range tokens {
+		if tokens[i].Name == name {
+			st = &tokens[i]
+		}
+	}
+	if st == nil {
+		return nil, "", ErrNotFound
+	}
+
+	value, err := generate()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	st.RotatedAt = &now
+	st.Hash = Hash(value)
+	if err := a.store.Update(ctx, *st); err != nil {
+		return nil, "", err
+	}
+	a.store.invalidate()
+
+	return st, value, nil
+}
+
+// Revoke deletes stored token name.
+func (a *Authenticator) Revoke(ctx context.Context, name string) error {
+	if !a.Managed() {
+		return ErrUnmanaged
+	}
+
+	if err := a.store.Delete(ctx, name); err != nil {
+		return err
+	}
+	a.store.invalidate()
+
+	return nil
+}
+
+// cachedStore keeps tokens of store in memory, so requests don't
+// query it every time.
+type cachedStore struct {
+	Store
+
+	refresh time.Duration
+
+	mu       sync.Mutex
+	tokens   []StoredToken
+	loadedAt time.Time
+}
+
+func (s *cachedStore) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loadedAt = time.Time{}
+}
+
+// cached returns tokens loaded within refresh interval, the previous
+// ones are kept when store is unavailable, until the next attempt.
+func (s *cachedStore) cached(ctx context.Context) []StoredToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loadedAt.IsZero() && time.Since(s.loadedAt) < s.refresh {
+		return s.tokens
+	}
+
+	// failed loads are retried later too, so invalid tokens don't query store
+	s.loadedAt = time.Now()
+	tokens, err := s.List(ctx)
+	if err != nil {
+		klog.Warningf("failed to load API tokens: %v", err)
+		return s.tokens
+	}
+	s.tokens = tokens
+
+	return s.tokens
+}
+
+// authenticate returns stored token with value, nil store has none.
+func (s *cachedStore) authenticate(ctx context.Context, value string) *Token {
+	if s == nil {
+		return nil
+	}
+
+	hash := Hash(value)
+	for _, st := range s.cached(ctx) {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(st.Hash)) == 1 {
+			return &Token{Name: st.Name, Role: st.Role, Namespaces: st.Namespaces}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package apiauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ydbschema"
+)
+
+// YDBStore keeps managed API tokens in YDB table, a row per token
+// with its hash and the rest of it as JSON.
+type YDBStore struct {
+	db    *ydb.Driver
+	table string
+}
+
+func NewYDBStore(db *ydb.Driver, table string) *YDBStore {
+	return &YDBStore{
+		db:    db,
+		table: table,
+	}
+}
+
+func (s *YDBStore) List(ctx context.Context) ([]StoredToken, error) {
+	var tokens []StoredToken
+	err := s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		tokens = nil
+		query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, s.db.Name())
+		query += fmt.Sprintf("SELECT hash, value FROM %s ORDER BY name;", s.table)
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters())
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		defer res.Close()
+
+		for res.NextResultSet(ctx) {
+			for res.NextRow() {
+				var hash, value string
+				if err := res.ScanNamed(
+					named.OptionalWithDefault("hash", &hash),
+					named.OptionalWithDefault("value", &value),
+				); err != nil {
+					return err
+				}
+
+				var t StoredToken
+				if err := json.Unmarshal([]byte(value), &t); err != nil {
+					return err
+				}
+				t.Hash = hash
+				tokens = append(tokens, t)
+			}
+		}
+
+		return res.Err()
+	}, table.WithIdempotent())
+
+	return tokens, err
+}
+
+func (s *YDBStore) Create(ctx context.Context, t StoredToken) error {
+	return s.put(ctx, t, false)
+}
+
+func (s *YDBStore) Update(ctx context.Context, t StoredToken) error {
+	return s.put(ctx, t, true)
+}
+
+// put writes token t, which must exist already or must not, depending
+// on update.
+func (s *YDBStore) put(ctx context.Context, t StoredToken, update bool) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		exists, err := s.exists(ctx, tx, t.Name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case update && !exists:
+			return ErrNotFound
+		case !update && exists:
+			return ErrExists
+		}
+
+		query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, s.db.Name())
+		query += "DECLARE $name AS Utf8;"
+		query += "DECLARE $hash AS Utf8;"
+		query += "DECLARE $value AS Json;"
+		query += fmt.Sprintf("UPSERT INTO %s (name, hash, value) VALUES ($name, $hash, $value);", s.table)
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+			table.ValueParam("$name", types.TextValue(t.Name)),
+			table.ValueParam("$hash", types.TextValue(t.Hash)),
+			table.ValueParam("$value", types.JSONValueFromBytes(b)),
+		))
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		return res.Close()
+	}, table.WithIdempotent())
+}
+
+func (s *YDBStore) Delete(ctx context.Context, name string) error {
+	return s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		exists, err := s.exists(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+
+		query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, s.db.Name())
+		query += "DECLARE $name AS Utf8;"
+		query += fmt.Sprintf("DELETE FROM %s WHERE name = $name;", s.table)
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+			table.ValueParam("$name", types.TextValue(name)),
+		))
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		return res.Close()
+	}, table.WithIdempotent())
+}
+
+func (s *YDBStore) exists(ctx context.Context, tx table.TransactionActor, name string) (bool, error) {
+	query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, s.db.Name())
+	query += "DECLARE $name AS Utf8;"
+	query += fmt.Sprintf("SELECT name FROM %s WHERE name = $name;", s.table)
+	res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+		table.ValueParam("$name", types.TextValue(name)),
+	))
+	if err != nil {
+		return false, err
+	}
+	if err := res.Err(); err != nil {
+		return false, err
+	}
+	defer res.Close()
+
+	exists := false
+	for res.NextResultSet(ctx) {
+		for res.NextRow() {
+			exists = true
+		}
+	}
+
+	return exists, res.Err()
+}
+
+// TokensTable returns structure of API tokens table.
+func TokensTable(name string) ydbschema.Table {
+	return ydbschema.Table{
+		Name: name,
+		Columns: []options.Column{
+			{Name: "name", Type: types.TypeUTF8},
+			{Name: "hash", Type: types.Optional(types.TypeUTF8)},
+			{Name: "value", Type: types.Optional(types.TypeJSON)},
+		},
+		PrimaryKey: []string{"name"},
+	}
+}
@@ -0,0 +1,85 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+const (
+	StateClosed = "closed"
+	StateOpen   = "open"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Breaker opens after threshold consecutive failures and stays open
+// until Reset, zero threshold disables it.
+type Breaker struct {
+	threshold int
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+}
+
+func New(threshold int) *Breaker {
+	return &Breaker{threshold: threshold}
+}
+
+// Allow returns ErrOpen if requests shouldn't be made.
+func (b *Breaker) Allow() error {
+	if b.IsOpen() {
+		return ErrOpen
+	}
+
+	return nil
+}
+
+// Done records request result, canceled requests aren't counted.
+func (b *Breaker) Done(err error) {
+	if errors.Is(err, context.Canceled) || b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold && !b.open {
+		b.open = true
+		metrics.DgraphCircuitOpen.Set(1)
+	}
+}
+
+// Reset closes breaker, e.g. after successful probe.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.open = false
+	metrics.DgraphCircuitOpen.Set(0)
+}
+
+func (b *Breaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open
+}
+
+func (b *Breaker) State() string {
+	if b.IsOpen() {
+		return StateOpen
+	}
+
+	return StateClosed
+}
@@ -0,0 +1,72 @@
+// Package buildinfo describes the binary, so backups can be traced
+// to the tool version that produced them.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Values are set at build time, e.g.
+// -ldflags "-X github.com/sputnik-systems/dgraph-export-tool/internal/buildinfo.Version=v1.0.0".
+// Empty ones are filled from module and VCS info embedded by go build.
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// Info is version of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns version of the running binary.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if v := bi.Main.Version; info.Version == "" && v != "" && v != "(devel)" {
+			info.Version = v
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = info.Commit
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+
+	return info
+}
+
+// String returns version in --version output format.
+func (i Info) String() string {
+	s := i.Version
+	if i.Commit != "" && i.Commit != i.Version {
+		s += " (commit " + i.Commit
+		if i.BuildDate != "" {
+			s += ", built " + i.BuildDate
+		}
+		s += ")"
+	}
+
+	return s + " " + i.GoVersion
+}
@@ -0,0 +1,82 @@
+// Package checksum computes checksums of export files recorded in
+// manifests. Data is streamed through hash in fixed size chunks, so
+// memory use doesn't depend on size of multi-GB export files.
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync"
+)
+
+// Prefix starts checksums, it names the hash algorithm.
+const Prefix = "sha256:"
+
+// bufferSize is size of chunks data is hashed in.
+const bufferSize = 256 << 10
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, bufferSize)
+		return &b
+	},
+}
+
+// Compute reads r to the end and returns checksum of read data and its size.
+func Compute(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+
+	buf := buffers.Get().(*[]byte)
+	defer buffers.Put(buf)
+
+	// hash doesn't implement io.ReaderFrom, so buf is always used
+	n, err := io.CopyBuffer(h, onlyReader{r}, *buf)
+	if err != nil {
+		return "", n, err
+	}
+
+	return format(h), n, nil
+}
+
+// Writer hashes data written through it to underlying writer, so
+// checksum of compressed or encrypted file is computed in the same
+// pass that writes it instead of reading it back.
+type Writer struct {
+	w    io.Writer
+	h    hash.Hash
+	size int64
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, h: sha256.New()}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.h.Write(p[:n])
+	w.size += int64(n)
+
+	return n, err
+}
+
+// Sum returns checksum of data written so far.
+func (w *Writer) Sum() string {
+	return format(w.h)
+}
+
+// Size returns number of bytes written so far.
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+func format(h hash.Hash) string {
+	return Prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// onlyReader hides io.WriterTo of readers like *os.File,
+// their WriteTo would allocate its own buffer.
+type onlyReader struct {
+	io.Reader
+}
@@ -0,0 +1,95 @@
+package checksum
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	sum, size, err := Compute(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; sum != want {
+		t.Errorf("Compute() = %s, want %s", sum, want)
+	}
+	if size != 5 {
+		t.Errorf("size = %d, want 5", size)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	zw := gzip.NewWriter(w)
+	if _, err := io.Copy(zw, io.LimitReader(zeros{}, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, size, err := Compute(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Sum() != sum || w.Size() != size {
+		t.Errorf("Writer checksum %s of %d bytes, want %s of %d bytes", w.Sum(), w.Size(), sum, size)
+	}
+}
+
+// TestComputeMemory guards against buffering whole file:
+// allocations must not grow with size of hashed data.
+func TestComputeMemory(t *testing.T) {
+	allocs := func(size int64) float64 {
+		return testing.AllocsPerRun(5, func() {
+			if _, _, err := Compute(io.LimitReader(zeros{}, size)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	small, large := allocs(1<<10), allocs(64<<20)
+	if large > small {
+		t.Errorf("hashing 64 MiB takes %v allocations, 1 KiB takes %v", large, small)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func BenchmarkCompute(b *testing.B) {
+	const size = 64 << 20
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Compute(io.LimitReader(zeros{}, size)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriterGzip(b *testing.B) {
+	const size = 64 << 20
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := NewWriter(io.Discard)
+		zw := gzip.NewWriter(w)
+		if _, err := io.Copy(zw, io.LimitReader(zeros{}, size)); err != nil {
+			b.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package delta exports nodes modified since the previous run with DQL,
+// an experimental alternative to full exports of mostly static graphs.
+// It relies on a datetime predicate with index, e.g. updatedAt, that
+// applications set on every mutation of a node.
+package delta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+)
+
+const defaultPageSize = 1000
+
+// Client queries nodes modified in given period from alpha /query endpoint.
+type Client struct {
+	endpoint  string
+	predicate string
+	pageSize  int
+	authToken string
+	apiKey    string
+	attempts  int
+	userAgent string
+	doer      *retry.Doer
+}
+
+type Option func(*Client)
+
+// WithPageSize sets number of nodes fetched per query.
+func WithPageSize(n int) Option {
+	return func(c *Client) {
+		c.pageSize = n
+	}
+}
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of query requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+// NewClient returns client of /query endpoint selecting nodes by predicate.
+func NewClient(endpoint, predicate string, opts ...Option) (*Client, error) {
+	if predicate == "" || strings.ContainsAny(predicate, "<>\"{}() \t\n") {
+		return nil, fmt.Errorf("invalid delta predicate %q", predicate)
+	}
+
+	c := &Client{
+		endpoint:  endpoint,
+		predicate: predicate,
+		pageSize:  defaultPageSize,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.doer = retry.New(c.attempts, c.userAgent)
+
+	return c, nil
+}
+
+// Export writes JSON array of nodes with predicate value in [since, until)
+// to w and returns number of written nodes. Nodes include all their
+// predicates, edges are written as references to uids.
+func (c *Client) Export(ctx context.Context, w io.Writer, since, until time.Time) (int, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+
+	nodes, after := 0, "0x0"
+	for {
+		page, err := c.page(ctx, since, until, after)
+		if err != nil {
+			return nodes, err
+		}
+
+		for _, node := range page {
+			sep := ",\n"
+			if nodes == 0 {
+				sep = "\n"
+			}
+			if _, err := io.WriteString(w, sep); err != nil {
+				return nodes, err
+			}
+			if _, err := w.Write(node); err != nil {
+				return nodes, err
+			}
+			nodes++
+		}
+
+		if len(page) < c.pageSize {
+			break
+		}
+
+		var last struct {
+			UID string `json:"uid"`
+		}
+		if err := json.Unmarshal(page[len(page)-1], &last); err != nil || last.UID == "" {
+			return nodes, fmt.Errorf("failed to get uid of the last node of page: %v", err)
+		}
+		after = last.UID
+	}
+
+	_, err := io.WriteString(w, "\n]\n")
+
+	return nodes, err
+}
+
+func (c *Client) page(ctx context.Context, since, until time.Time, after string) ([]json.RawMessage, error) {
+	query := fmt.Sprintf(`{
+  delta(func: ge(<%[1]s>, %[2]q), first: %[4]d, after: %[5]s) @filter(lt(<%[1]s>, %[3]q)) {
+    uid
+    dgraph.type
+    expand(_all_) {
+      uid
+    }
+  }
+}`, c.predicate, since.UTC().Format(time.RFC3339Nano), until.UTC().Format(time.RFC3339Nano), c.pageSize, after)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(query)), nil
+	}
+	req.Header.Set("Content-Type", "application/dql")
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		m(req)
+	}
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return nil, redact.Error(err, c.authToken, c.apiKey)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query failed with status %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	var out struct {
+		Data struct {
+			Delta []json.RawMessage `json:"delta"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	if len(out.Errors) > 0 {
+		msgs := make([]string, 0, len(out.Errors))
+		for _, e := range out.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return nil, errors.New(redact.String(strings.Join(msgs, "; "), c.authToken, c.apiKey))
+	}
+
+	return out.Data.Delta, nil
+}
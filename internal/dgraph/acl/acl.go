@@ -0,0 +1,283 @@
+// Package acl reads and applies Dgraph ACL groups and creates namespaces
+// of multi-tenant clusters, requests are made with ACL login.
+package acl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlerr"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/state"
+)
+
+// Groot is the default guardian of every namespace.
+const Groot = "groot"
+
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cli = graphql.NewClient(endpoint, retry.New(c.attempts, c.userAgent)).
+		WithRequestModifier(c.modify)
+
+	return c, nil
+}
+
+type Client struct {
+	cli       *graphql.Client
+	authToken string
+	apiKey    string
+	attempts  int
+	userAgent string
+	// accessJWT is set by Login.
+	accessJWT string
+	password  string
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of admin endpoint requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+func (c *Client) modify(r *http.Request) {
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		m(r)
+	}
+	if c.accessJWT != "" {
+		r.Header.Set("X-Dgraph-AccessToken", c.accessJWT)
+	}
+}
+
+func (c *Client) redact(err error) error {
+	return gqlerr.From(err, c.authToken, c.apiKey, c.accessJWT, c.password)
+}
+
+// ACL is access control of single namespace. Users aren't included,
+// their passwords can't be read back from Dgraph.
+type ACL struct {
+	Namespace int64   `json:"namespace"`
+	Groups    []Group `json:"groups"`
+}
+
+// Group is ACL group with its predicate permissions.
+type Group struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule grants group permission on predicate, it's a bitmask of
+// read (4), write (2) and modify (1).
+type Rule struct {
+	Predicate  string `json:"predicate"`
+	Permission int    `json:"permission"`
+}
+
+// Login logs user into namespace, following requests are made on
+// behalf of the user.
+func (c *Client) Login(ctx context.Context, user, password string, namespace int64) error {
+	var mutation struct {
+		Login struct {
+			Response struct {
+				AccessJWT graphql.String `graphql:"accessJWT"`
+			}
+		} `graphql:"login(userId: $user, password: $password, namespace: $namespace)"`
+	}
+	vars := map[string]interface{}{
+		"user":      graphql.String(user),
+		"password":  graphql.String(password),
+		"namespace": graphql.Int(namespace),
+	}
+
+	c.password = password
+	if err := c.cli.Mutate(ctx, &mutation, vars); err != nil {
+		return fmt.Errorf("failed to log in as %s into namespace %d: %w", user, namespace, c.redact(err))
+	}
+	if mutation.Login.Response.AccessJWT == "" {
+		return fmt.Errorf("failed to log in as %s into namespace %d: no access token returned", user, namespace)
+	}
+	c.accessJWT = string(mutation.Login.Response.AccessJWT)
+
+	return nil
+}
+
+// AccessJWT returns access token of logged in user, empty before Login.
+func (c *Client) AccessJWT() string {
+	return c.accessJWT
+}
+
+// Groups returns groups of namespace user is logged into.
+func (c *Client) Groups(ctx context.Context) ([]Group, error) {
+	var query struct {
+		QueryGroup []Group
+	}
+
+	if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return nil, c.redact(err)
+	}
+
+	return query.QueryGroup, nil
+}
+
+// AddGroupInput and UpdateGroupInput are named after admin schema
+// input types, variable types are derived from them.
+type AddGroupInput struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+type UpdateGroupInput struct {
+	Filter struct {
+		Name struct {
+			Eq string `json:"eq"`
+		} `json:"name"`
+	} `json:"filter"`
+	Set struct {
+		Rules []Rule `json:"rules"`
+	} `json:"set"`
+}
+
+// Apply creates missing groups in namespace user is logged into and
+// sets rules of existing ones. Rules of existing groups on predicates
+// not in groups are kept.
+func (c *Client) Apply(ctx context.Context, groups []Group) error {
+	existing, err := c.Groups(ctx)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(existing))
+	for _, g := range existing {
+		names[g.Name] = true
+	}
+
+	var add []AddGroupInput
+	for _, g := range groups {
+		if !names[g.Name] {
+			add = append(add, AddGroupInput{Name: g.Name, Rules: nonNil(g.Rules)})
+			continue
+		}
+		if len(g.Rules) == 0 {
+			continue
+		}
+
+		var in UpdateGroupInput
+		in.Filter.Name.Eq = g.Name
+		in.Set.Rules = g.Rules
+
+		var mutation struct {
+			UpdateGroup struct {
+				Group []struct {
+					Name graphql.String
+				}
+			} `graphql:"updateGroup(input: $input)"`
+		}
+		if err := c.cli.Mutate(ctx, &mutation, map[string]interface{}{"input": in}); err != nil {
+			return fmt.Errorf("failed to update group %s: %w", g.Name, c.redact(err))
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+
+	var mutation struct {
+		AddGroup struct {
+			Group []struct {
+				Name graphql.String
+			}
+		} `graphql:"addGroup(input: $input)"`
+	}
+	if err := c.cli.Mutate(ctx, &mutation, map[string]interface{}{"input": add}); err != nil {
+		return fmt.Errorf("failed to add groups: %w", c.redact(err))
+	}
+
+	return nil
+}
+
+// nonNil returns empty rules instead of nil, since rules are required
+// by addGroup of older Dgraph versions.
+func nonNil(rules []Rule) []Rule {
+	if rules == nil {
+		return []Rule{}
+	}
+
+	return rules
+}
+
+// AddNamespace creates namespace with guardian groot having password
+// and returns its ID, which is chosen by Dgraph. User has to be logged
+// in as guardian of the galaxy, i.e. into namespace 0.
+func (c *Client) AddNamespace(ctx context.Context, password string) (int64, error) {
+	var mutation struct {
+		AddNamespace struct {
+			NamespaceID state.UInt64 `graphql:"namespaceId"`
+		} `graphql:"addNamespace(input: {password: $password})"`
+	}
+	vars := map[string]interface{}{
+		"password": graphql.String(password),
+	}
+
+	if err := c.cli.Mutate(ctx, &mutation, vars); err != nil {
+		return 0, fmt.Errorf("failed to add namespace: %w", gqlerr.From(err, c.authToken, c.apiKey, c.accessJWT, c.password, password))
+	}
+
+	return int64(mutation.AddNamespace.NamespaceID), nil
+}
+
+// Namespaces returns namespaces of cluster, they are listed in state
+// since Dgraph v21.03.
+func (c *Client) Namespaces(ctx context.Context) ([]int64, error) {
+	var query struct {
+		State struct {
+			Namespaces []state.UInt64
+		}
+	}
+
+	if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return nil, c.redact(err)
+	}
+
+	namespaces := make([]int64, 0, len(query.State.Namespaces))
+	for _, ns := range query.State.Namespaces {
+		namespaces = append(namespaces, int64(ns))
+	}
+
+	return namespaces, nil
+}
@@ -0,0 +1,27 @@
+// Package auth sets headers authenticating requests to Dgraph admin endpoint.
+package auth
+
+import (
+	"net/http"
+
+	"github.com/hasura/go-graphql-client"
+)
+
+// Modifier returns request modifier setting token of alphas started with
+// --security "token=..." and Dgraph Cloud API key, nil when both are empty.
+func Modifier(token, apiKey string) graphql.RequestModifier {
+	if token == "" && apiKey == "" {
+		return nil
+	}
+
+	return func(r *http.Request) {
+		if token != "" {
+			r.Header.Set("X-Dgraph-AuthToken", token)
+		}
+		if apiKey != "" {
+			// Dg-Auth is used by Dgraph Cloud, X-Auth-Token by former Slash GraphQL
+			r.Header.Set("Dg-Auth", apiKey)
+			r.Header.Set("X-Auth-Token", apiKey)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package capabilities detects features of Dgraph admin API by schema
+// introspection, or by version when introspection is unavailable, so
+// features missing in older versions are reported clearly instead of
+// failing with GraphQL validation errors.
+package capabilities
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlerr"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+)
+
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cli = graphql.NewClient(endpoint, retry.New(c.attempts, c.userAgent))
+
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		c.cli = c.cli.WithRequestModifier(m)
+	}
+
+	return c, nil
+}
+
+type Client struct {
+	cli       *graphql.Client
+	authToken string
+	apiKey    string
+	attempts  int
+	userAgent string
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of admin endpoint requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+// Capabilities are admin API features of Dgraph version serving it.
+type Capabilities struct {
+	// Export is export mutation, ExportNamespace and ExportAnonymous
+	// are its namespace and anonymous input fields.
+	Export          bool `json:"export"`
+	ExportNamespace bool `json:"exportNamespace"`
+	ExportAnonymous bool `json:"exportAnonymous"`
+	// Backup is binary backup mutation and ListBackups is query
+	// listing binary backups, both are enterprise features.
+	Backup      bool `json:"backup"`
+	ListBackups bool `json:"listBackups"`
+	Restore     bool `json:"restore"`
+	State       bool `json:"state"`
+	// ListBackupsFields are fields of manifests listBackups returns,
+	// nil when they weren't introspected.
+	ListBackupsFields []string `json:"listBackupsFields,omitempty"`
+	// Version is Dgraph version serving admin API, set by caller.
+	Version string `json:"version,omitempty"`
+}
+
+type field struct {
+	Name graphql.String
+}
+
+// Detect introspects admin schema.
+func (c *Client) Detect(ctx context.Context) (*Capabilities, error) {
+	var query struct {
+		Schema struct {
+			QueryType struct {
+				Fields []field
+			}
+			MutationType struct {
+				Fields []field
+			}
+		} `graphql:"__schema"`
+		ExportInput struct {
+			InputFields []field
+		} `graphql:"__type(name: \"ExportInput\")"`
+		Manifest struct {
+			Fields []field
+		} `graphql:"manifest: __type(name: \"Manifest\")"`
+	}
+
+	if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return nil, gqlerr.From(err, c.authToken, c.apiKey)
+	}
+
+	names := make(map[string]bool)
+	for _, f := range query.Schema.QueryType.Fields {
+		names["query."+string(f.Name)] = true
+	}
+	for _, f := range query.Schema.MutationType.Fields {
+		names["mutation."+string(f.Name)] = true
+	}
+	for _, f := range query.ExportInput.InputFields {
+		names["export."+string(f.Name)] = true
+	}
+
+	caps := &Capabilities{
+		Export:          names["mutation.export"],
+		ExportNamespace: names["export.namespace"],
+		ExportAnonymous: names["export.anonymous"],
+		Backup:          names["mutation.backup"],
+		ListBackups:     names["query.listBackups"],
+		Restore:         names["mutation.restore"],
+		State:           names["query.state"],
+	}
+	if caps.ListBackups {
+		caps.ListBackupsFields = []string{}
+		for _, f := range query.Manifest.Fields {
+			caps.ListBackupsFields = append(caps.ListBackupsFields, string(f.Name))
+		}
+	}
+
+	return caps, nil
+}
@@ -0,0 +1,115 @@
+package capabilities
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sputnik-systems/dgraph-export-tool/pkg/testing/dgraphtest"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema dgraphtest.Schema
+		want   Capabilities
+	}{
+		{
+			name: "enterprise",
+			schema: dgraphtest.Schema{
+				Queries:           []string{"health", "state", "listBackups"},
+				Mutations:         []string{"export", "backup", "restore"},
+				ExportInputFields: []string{"format", "namespace", "destination", "anonymous"},
+				ManifestFields:    []string{"backupId", "path", "readTs"},
+			},
+			want: Capabilities{
+				Export:            true,
+				ExportNamespace:   true,
+				ExportAnonymous:   true,
+				Backup:            true,
+				ListBackups:       true,
+				Restore:           true,
+				State:             true,
+				ListBackupsFields: []string{"backupId", "path", "readTs"},
+			},
+		},
+		{
+			name: "before namespaces",
+			schema: dgraphtest.Schema{
+				Queries:           []string{"health", "state"},
+				Mutations:         []string{"export"},
+				ExportInputFields: []string{"format", "destination"},
+			},
+			want: Capabilities{
+				Export: true,
+				State:  true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := dgraphtest.NewServer()
+			defer s.Close()
+			s.SetSchema(tt.schema)
+
+			c, err := NewClient(s.AdminURL())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.Detect(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Detect() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    *Capabilities
+	}{
+		{"v1.2.8", &Capabilities{Version: "v1.2.8"}},
+		{"v20.11.3", &Capabilities{Version: "v20.11.3", Export: true, State: true, Backup: true, Restore: true, ListBackups: true}},
+		{"v23.1.0-rc1", &Capabilities{Version: "v23.1.0-rc1", Export: true, ExportNamespace: true, ExportAnonymous: true,
+			Backup: true, ListBackups: true, Restore: true, State: true}},
+		{"master", nil},
+	}
+
+	for _, tt := range tests {
+		if got := ForVersion(tt.version); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ForVersion(%q) = %+v, want %+v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	caps := ForVersion("v20.11.3")
+
+	err := caps.Require(FeatureExport, FeatureExportNamespace)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Require() = %v, want ErrUnsupported", err)
+	}
+	if want := "namespace export is not supported by Dgraph v20.11.3, it requires v21.03.0 or newer"; err.Error() != want {
+		t.Errorf("Require() = %q, want %q", err, want)
+	}
+	if err := caps.RequireListBackupsFields("readTs"); err != nil {
+		t.Errorf("RequireListBackupsFields() = %v, fields which weren't introspected must pass", err)
+	}
+
+	caps.ListBackupsFields = []string{"since"}
+	if err := caps.RequireListBackupsFields("readTs"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("RequireListBackupsFields() = %v, want ErrUnsupported", err)
+	}
+
+	var none *Capabilities
+	if err := none.Require(FeatureExportNamespace); err != nil {
+		t.Errorf("Require() of undetected capabilities = %v, want nil", err)
+	}
+}
@@ -0,0 +1,203 @@
+package capabilities
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Feature is admin API feature export and restore requests depend on.
+type Feature string
+
+const (
+	FeatureExport          Feature = "export"
+	FeatureExportNamespace Feature = "namespace export"
+	FeatureExportAnonymous Feature = "anonymous export"
+	FeatureBackup          Feature = "binary backup"
+	FeatureListBackups     Feature = "list backups"
+	FeatureRestore         Feature = "restore"
+	FeatureState           Feature = "state"
+)
+
+// Matrix is compatibility matrix of features with the first Dgraph
+// release supporting them. It's used when admin schema can't be
+// introspected, e.g. with introspection disabled, and to tell which
+// version unsupported feature needs.
+var Matrix = []struct {
+	Feature Feature
+	Since   string
+}{
+	{FeatureExport, "v20.03.0"},
+	{FeatureState, "v20.03.0"},
+	{FeatureBackup, "v20.03.0"},
+	{FeatureRestore, "v20.07.0"},
+	{FeatureListBackups, "v20.11.0"},
+	{FeatureExportNamespace, "v21.03.0"},
+	{FeatureExportAnonymous, "v21.03.0"},
+}
+
+// ErrUnsupported is wrapped by errors of features missing in Dgraph.
+var ErrUnsupported = errors.New("unsupported by dgraph")
+
+// UnsupportedError is returned instead of requests Dgraph would reject.
+type UnsupportedError struct {
+	Feature Feature
+	// Version is Dgraph version serving admin API, empty when unknown.
+	Version string
+	// Since is the first release supporting feature, empty when unknown.
+	Since string
+}
+
+func (e *UnsupportedError) Error() string {
+	msg := fmt.Sprintf("%s is not supported", e.Feature)
+	if e.Version != "" {
+		msg += " by Dgraph " + e.Version
+	} else {
+		msg += " on this Dgraph version"
+	}
+	if e.Since != "" {
+		msg += ", it requires " + e.Since + " or newer"
+	}
+
+	return msg
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return ErrUnsupported
+}
+
+// ForVersion returns capabilities of Dgraph version according to Matrix,
+// nil when version can't be parsed, e.g. of development builds.
+func ForVersion(version string) *Capabilities {
+	v, ok := parseVersion(version)
+	if !ok {
+		return nil
+	}
+
+	caps := &Capabilities{Version: version}
+	for _, m := range Matrix {
+		since, _ := parseVersion(m.Since)
+		if compareVersions(v, since) >= 0 {
+			caps.set(m.Feature)
+		}
+	}
+
+	return caps
+}
+
+// Supports returns whether feature f is available.
+func (c *Capabilities) Supports(f Feature) bool {
+	switch f {
+	case FeatureExport:
+		return c.Export
+	case FeatureExportNamespace:
+		return c.ExportNamespace
+	case FeatureExportAnonymous:
+		return c.ExportAnonymous
+	case FeatureBackup:
+		return c.Backup
+	case FeatureListBackups:
+		return c.ListBackups
+	case FeatureRestore:
+		return c.Restore
+	case FeatureState:
+		return c.State
+	}
+
+	return false
+}
+
+func (c *Capabilities) set(f Feature) {
+	switch f {
+	case FeatureExport:
+		c.Export = true
+	case FeatureExportNamespace:
+		c.ExportNamespace = true
+	case FeatureExportAnonymous:
+		c.ExportAnonymous = true
+	case FeatureBackup:
+		c.Backup = true
+	case FeatureListBackups:
+		c.ListBackups = true
+	case FeatureRestore:
+		c.Restore = true
+	case FeatureState:
+		c.State = true
+	}
+}
+
+// Require returns UnsupportedError unless all features are available.
+// Nil capabilities of undetected Dgraph allow everything.
+func (c *Capabilities) Require(features ...Feature) error {
+	if c == nil {
+		return nil
+	}
+
+	for _, f := range features {
+		if !c.Supports(f) {
+			return &UnsupportedError{Feature: f, Version: c.Version, Since: since(f)}
+		}
+	}
+
+	return nil
+}
+
+// RequireListBackupsFields returns UnsupportedError unless listBackups
+// query is available and its manifests have all fields. Fields are
+// only checked when they were introspected.
+func (c *Capabilities) RequireListBackupsFields(fields ...string) error {
+	if err := c.Require(FeatureListBackups); err != nil || c == nil || c.ListBackupsFields == nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if !slices.Contains(c.ListBackupsFields, f) {
+			return &UnsupportedError{Feature: Feature("listBackups field " + f), Version: c.Version}
+		}
+	}
+
+	return nil
+}
+
+func since(f Feature) string {
+	for _, m := range Matrix {
+		if m.Feature == f {
+			return m.Since
+		}
+	}
+
+	return ""
+}
+
+// parseVersion parses release part of versions like v21.03.2 or
+// v23.1.0-rc1, ignoring pre-release and build suffixes.
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+
+	release, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	parts := strings.Split(release, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+
+	return v, true
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+
+	return 0
+}
@@ -6,6 +6,12 @@ import (
 	"net/url"
 
 	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlerr"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
 )
 
 func NewClient(endpoint, dest string, opts ...Option) (*Client, error) {
@@ -15,7 +21,7 @@ func NewClient(endpoint, dest string, opts ...Option) (*Client, error) {
 	}
 
 	c := &Client{
-		cli: graphql.NewClient(endpoint, nil),
+		endpoint: endpoint,
 		in: ExportInput{
 			Format:      "rdf",
 			Destination: graphql.String(dest),
@@ -26,23 +32,58 @@ func NewClient(endpoint, dest string, opts ...Option) (*Client, error) {
 		opt(c)
 	}
 
+	c.cli = graphql.NewClient(endpoint, retry.New(c.attempts, c.userAgent).WithSecrets(c.secrets()...).NonIdempotent())
+
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		c.cli = c.cli.WithRequestModifier(m)
+	}
+
 	return c, nil
 }
 
 type Client struct {
-	cli *graphql.Client
-	in  ExportInput
+	cli       *graphql.Client
+	endpoint  string
+	in        ExportInput
+	authToken string
+	apiKey    string
+	cloud     bool
+	legacy    bool
+	attempts  int
+	userAgent string
 }
 
 // https://github.com/dgraph-io/dgraph/blob/v23.1.0/protos/pb/pb.pb.go#L4946
+// Anonymous and Namespace are omitted when unset, since Dgraph
+// versions before them reject unknown input fields.
 type ExportInput struct {
 	Format       graphql.String  `json:"format"`
 	Destination  graphql.String  `json:"destination"`
 	AccessKey    graphql.String  `json:"accessKey"`
 	SecretKey    graphql.String  `json:"secretKey"`
 	SessionToken graphql.String  `json:"sessionToken"`
-	Anonymous    graphql.Boolean `json:"anonymous"`
-	Namespace    graphql.Int     `json:"namespace"`
+	Anonymous    graphql.Boolean `json:"anonymous,omitempty"`
+	Namespace    graphql.Int     `json:"namespace,omitempty"`
+}
+
+// String hides credentials, so input is safe to log.
+func (in ExportInput) String() string {
+	return fmt.Sprintf("{Format:%s Destination:%s AccessKey:%s SecretKey:%s SessionToken:%s Anonymous:%t Namespace:%d}",
+		in.Format, redact.URL(string(in.Destination)),
+		hidden(in.AccessKey), hidden(in.SecretKey), hidden(in.SessionToken),
+		in.Anonymous, in.Namespace)
+}
+
+func (in ExportInput) GoString() string {
+	return "export.ExportInput" + in.String()
+}
+
+func hidden(value graphql.String) string {
+	if value == "" {
+		return ""
+	}
+
+	return redact.Placeholder
 }
 
 type Option func(*Client)
@@ -59,13 +100,71 @@ func WithSecretKey(value string) Option {
 	}
 }
 
+// WithRetries sets how many times request failed with transient error is
+// tried, export is sent again only when Dgraph couldn't have started it.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of admin endpoint requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+// WithCloud makes export use mutation of Dgraph Cloud /admin/slash endpoint,
+// exported files are returned as signed URLs instead of written to destination.
+func WithCloud() Option {
+	return func(c *Client) {
+		c.cloud = true
+	}
+}
+
 func WithAnonymous(value bool) Option {
 	return func(c *Client) {
 		c.in.Anonymous = graphql.Boolean(value)
 	}
 }
 
+// WithFormat sets export format, rdf or json.
+func WithFormat(value string) Option {
+	return func(c *Client) {
+		c.in.Format = graphql.String(value)
+	}
+}
+
+// WithNamespace sets namespace exported from multi-tenant cluster.
+func WithNamespace(value int64) Option {
+	return func(c *Client) {
+		c.in.Namespace = graphql.Int(value)
+	}
+}
+
 func (c *Client) Export(ctx context.Context) (*ExportOutput, error) {
+	if c.cloud {
+		return c.exportCloud(ctx)
+	}
+	if c.legacy {
+		return c.exportLegacy(ctx)
+	}
+
 	vars := map[string]interface{}{
 		"input": c.in,
 	}
@@ -74,16 +173,79 @@ func (c *Client) Export(ctx context.Context) (*ExportOutput, error) {
 		ExportOutput `graphql:"export(input: $input)"`
 	}
 
-	if err := c.cli.Mutate(context.Background(), &mutation, vars); err != nil {
-		return nil, err
+	if err := c.cli.Mutate(ctx, &mutation, vars); err != nil {
+		return nil, failure.Classify(c.redactError(err))
 	}
 
-	if resp := mutation.ExportOutput.Response; resp.Code != "Success" {
-		return nil, fmt.Errorf(
-			`export finished with unseccessfull code "%s": %s`, resp.Code, resp.Message)
+	resp := &mutation.ExportOutput
+	resp.Response.Message = graphql.String(redact.String(string(resp.Response.Message), c.secrets()...))
+
+	if resp.Response.Code != "Success" {
+		return nil, failure.Classify(unsuccessful(string(resp.Response.Code), string(resp.Response.Message)))
 	}
 
-	return &mutation.ExportOutput, nil
+	return resp, nil
+}
+
+// exportCloud requests export with Dgraph Cloud mutation, it accepts format only.
+func (c *Client) exportCloud(ctx context.Context) (*ExportOutput, error) {
+	vars := map[string]interface{}{
+		"format": c.in.Format,
+	}
+
+	var mutation struct {
+		Export struct {
+			Response struct {
+				Message graphql.String
+				Code    graphql.String
+			}
+			SignedUrls []graphql.String
+		} `graphql:"export(format: $format)"`
+	}
+
+	if err := c.cli.Mutate(ctx, &mutation, vars); err != nil {
+		return nil, failure.Classify(c.redactError(err))
+	}
+
+	resp := &ExportOutput{}
+	resp.Response.Code = mutation.Export.Response.Code
+	resp.Response.Message = graphql.String(redact.String(string(mutation.Export.Response.Message), c.secrets()...))
+	if resp.Response.Code != "" && resp.Response.Code != "Success" {
+		return nil, failure.Classify(unsuccessful(string(resp.Response.Code), string(resp.Response.Message)))
+	}
+	for _, u := range mutation.Export.SignedUrls {
+		resp.SignedURLs = append(resp.SignedURLs, string(u))
+	}
+	if len(resp.SignedURLs) == 0 {
+		return nil, fmt.Errorf("export returned no signed URLs")
+	}
+
+	return resp, nil
+}
+
+func (c *Client) secrets() []string {
+	return []string{
+		string(c.in.AccessKey),
+		string(c.in.SecretKey),
+		string(c.in.SessionToken),
+		c.authToken,
+		c.apiKey,
+	}
+}
+
+// unsuccessful returns error of export response with code other than
+// Success, response is carried as issue like GraphQL errors are.
+func unsuccessful(code, message string) error {
+	return failure.WithIssues(
+		fmt.Errorf(`export finished with unseccessfull code "%s": %s`, code, message),
+		[]failure.Issue{{Message: message, Code: code}},
+	)
+}
+
+// redactError removes credentials from error messages, admin API is
+// free to echo request input in them. GraphQL errors are carried as issues.
+func (c *Client) redactError(err error) error {
+	return gqlerr.From(err, c.secrets()...)
 }
 
 // https://github.com/dgraph-io/dgraph/blob/v23.1.0/protos/pb/pb.pb.go#L5063
@@ -94,6 +256,10 @@ type ExportOutput struct {
 	}
 
 	ExportedFiles []graphql.String
+
+	// SignedURLs are links to download files exported by Dgraph Cloud,
+	// they grant access to data, so they are never serialized.
+	SignedURLs []string `graphql:"-" json:"-"`
 }
 
 func (resp *ExportOutput) GetFiles() []string {
@@ -0,0 +1,336 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/pkg/testing/dgraphtest"
+)
+
+func TestExport(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+
+	c, err := NewClient(s.AdminURL(), "s3:///bucket/path",
+		WithAccessKey("access"),
+		WithSecretKey("secret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"dgraph.r1.u0101.0000/g01.rdf.gz", "dgraph.r1.u0101.0000/g01.schema.gz"}
+	if got := resp.GetFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFiles() = %v, want %v", got, want)
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	in, _ := reqs[0].Variables["input"].(map[string]interface{})
+	for key, want := range map[string]interface{}{
+		"format":      "rdf",
+		"destination": "s3:///bucket/path",
+		"accessKey":   "access",
+		"secretKey":   "secret",
+	} {
+		if in[key] != want {
+			t.Errorf("input.%s = %v, want %v", key, in[key], want)
+		}
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(s *dgraphtest.Server)
+	}{
+		{
+			name: "unsuccessful code",
+			setup: func(s *dgraphtest.Server) {
+				s.SetExportResponse(dgraphtest.ExportResponse{Code: "Failure", Message: "no space left"})
+			},
+		},
+		{
+			name: "http error",
+			setup: func(s *dgraphtest.Server) {
+				s.FailNext(http.StatusServiceUnavailable)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := dgraphtest.NewServer()
+			defer s.Close()
+			tt.setup(s)
+
+			c, err := NewClient(s.AdminURL(), "s3:///bucket/path")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := c.Export(context.Background()); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestExportErrorClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		resp  dgraphtest.ExportResponse
+		class failure.Class
+	}{
+		{
+			name:  "operation running",
+			resp:  dgraphtest.ExportResponse{Errors: []string{"another operation is already running"}},
+			class: failure.ClassClusterBusy,
+		},
+		{
+			name:  "draining mode",
+			resp:  dgraphtest.ExportResponse{Errors: []string{"the server is in draining mode and client requests will only be allowed after exiting this mode"}},
+			class: failure.ClassClusterBusy,
+		},
+		{
+			name:  "expired token",
+			resp:  dgraphtest.ExportResponse{Errors: []string{"unable to parse jwt token: token is expired"}},
+			class: failure.ClassAuth,
+		},
+		{
+			name:  "no space left",
+			resp:  dgraphtest.ExportResponse{Code: "Failure", Message: "no space left"},
+			class: failure.ClassDestination,
+		},
+		{
+			name:  "unsuccessful code",
+			resp:  dgraphtest.ExportResponse{Code: "Failure", Message: "unexpected error"},
+			class: failure.ClassUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := dgraphtest.NewServer()
+			defer s.Close()
+			s.SetExportResponse(tt.resp)
+
+			c, err := NewClient(s.AdminURL(), "s3:///bucket/path")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = c.Export(context.Background())
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if got := failure.Of(err); got != tt.class {
+				t.Errorf("failure.Of(%v) = %q, want %q", err, got, tt.class)
+			}
+		})
+	}
+}
+
+func TestExportIssues(t *testing.T) {
+	tests := []struct {
+		name string
+		resp dgraphtest.ExportResponse
+		want []failure.Issue
+	}{
+		{
+			name: "graphql errors",
+			resp: dgraphtest.ExportResponse{Errors: []string{"unauthorized ip address", "key secret-key-value is invalid"}},
+			want: []failure.Issue{{Message: "unauthorized ip address"}, {Message: "key [REDACTED] is invalid"}},
+		},
+		{
+			name: "unsuccessful code",
+			resp: dgraphtest.ExportResponse{Code: "Failure", Message: "no space left"},
+			want: []failure.Issue{{Message: "no space left", Code: "Failure"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := dgraphtest.NewServer()
+			defer s.Close()
+			s.SetExportResponse(tt.resp)
+
+			c, err := NewClient(s.AdminURL(), "s3:///bucket/path", WithSecretKey("secret-key-value"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = c.Export(context.Background())
+			if got := failure.Issues(err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failure.Issues(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportRedactsSecrets(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+	s.SetExportResponse(dgraphtest.ExportResponse{
+		Code:    "Failure",
+		Message: "invalid credentials access-secret-value/secret-key-value",
+	})
+
+	c, err := NewClient(s.AdminURL(), "s3:///bucket/path",
+		WithAccessKey("access-secret-value"),
+		WithSecretKey("secret-key-value"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Export(context.Background())
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	for _, msg := range []string{err.Error(), fmt.Sprintf("%v", c.in), fmt.Sprintf("%#v", c.in)} {
+		if strings.Contains(msg, "access-secret-value") || strings.Contains(msg, "secret-key-value") {
+			t.Errorf("secret is not redacted: %s", msg)
+		}
+	}
+}
+
+func TestExportRetries(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+	s.FailNext(http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	c, err := NewClient(s.AdminURL(), "s3:///bucket/path", WithRetries(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Export(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(s.Requests()); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestExportNotRetriedAfterTimeout(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+	s.FailNext(http.StatusGatewayTimeout)
+
+	c, err := NewClient(s.AdminURL(), "s3:///bucket/path", WithRetries(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Export(context.Background()); err == nil {
+		t.Error("expected error, got nil")
+	}
+	if got := len(s.Requests()); got != 1 {
+		t.Errorf("got %d requests, export that may have started must not be sent again", got)
+	}
+}
+
+func TestExportCloud(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+	s.SetExportResponse(dgraphtest.ExportResponse{
+		Code:       "Success",
+		SignedURLs: []string{"https://storage.example.com/export/g01.rdf.gz?signature=secret"},
+	})
+
+	c, err := NewClient(s.AdminURL()+"/slash", "", WithAPIKey("api-key"), WithCloud())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"https://storage.example.com/export/g01.rdf.gz?signature=secret"}
+	if !reflect.DeepEqual(resp.SignedURLs, want) {
+		t.Errorf("SignedURLs = %v, want %v", resp.SignedURLs, want)
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	if got := reqs[0].Header.Get("Dg-Auth"); got != "api-key" {
+		t.Errorf("Dg-Auth header = %q, want %q", got, "api-key")
+	}
+	if got := reqs[0].Variables["format"]; got != "rdf" {
+		t.Errorf("format = %v, want rdf", got)
+	}
+}
+
+func TestExportLegacy(t *testing.T) {
+	s := dgraphtest.NewServer()
+	defer s.Close()
+
+	c, err := NewClient(s.AdminURL(), "/dgraph/export", WithAuthToken("token"), WithLegacy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := resp.GetFiles(); len(files) != 0 {
+		t.Errorf("GetFiles() = %v, legacy endpoint doesn't report files", files)
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	if reqs[0].Method != http.MethodGet {
+		t.Errorf("method = %s, want GET", reqs[0].Method)
+	}
+	if got := reqs[0].Header.Get("X-Dgraph-AuthToken"); got != "token" {
+		t.Errorf("X-Dgraph-AuthToken header = %q, want %q", got, "token")
+	}
+	for key, want := range map[string]string{"format": "rdf", "destination": "/dgraph/export"} {
+		if got := reqs[0].Variables[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	s.SetExportResponse(dgraphtest.ExportResponse{Errors: []string{"another operation is already running"}})
+	c, err = NewClient(s.AdminURL(), "s3:///bucket/path",
+		WithAccessKey("access"), WithSecretKey("secret"), WithLegacy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Export(context.Background()); failure.Of(err) != failure.ClassClusterBusy {
+		t.Errorf("failure.Of(%v) = %q, want %q", err, failure.Of(err), failure.ClassClusterBusy)
+	}
+	if req := s.Requests()[1]; req.Method != http.MethodPost || req.Variables["secretKey"] != "secret" {
+		t.Errorf("credentials must be posted in form, got %s %v", req.Method, req.Variables)
+	}
+
+	c, err = NewClient(s.AdminURL(), "s3:///bucket/path", WithNamespace(2), WithLegacy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Export(context.Background()); err == nil {
+		t.Error("namespace export with legacy endpoint must fail")
+	}
+}
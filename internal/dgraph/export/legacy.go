@@ -0,0 +1,126 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+)
+
+// WithLegacy makes export use HTTP /admin/export endpoint, for Dgraph
+// v1.x and v20.x alphas without usable export mutation of GraphQL admin API.
+func WithLegacy() Option {
+	return func(c *Client) {
+		c.legacy = true
+	}
+}
+
+// legacyResponse is body of /admin/export response, errors are
+// reported in GraphQL-like list by some versions.
+type legacyResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Errors  []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// exportLegacy requests export from HTTP endpoint. It doesn't report
+// exported files, they are looked up at destination by caller. Format
+// and destination are passed in query, so v1.x accepting GET only
+// works; credentials are posted in form to keep them out of access logs.
+func (c *Client) exportLegacy(ctx context.Context) (*ExportOutput, error) {
+	if c.in.Namespace != 0 || c.in.Anonymous {
+		return nil, fmt.Errorf("namespace and anonymous exports are not supported by legacy admin endpoint")
+	}
+
+	u, err := url.Parse(strings.TrimRight(c.endpoint, "/") + "/export")
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{"format": {string(c.in.Format)}}
+	if c.in.Destination != "" {
+		q.Set("destination", string(c.in.Destination))
+	}
+	u.RawQuery = q.Encode()
+
+	method, form := http.MethodGet, url.Values{}
+	for key, value := range map[string]graphql.String{
+		"accessKey":    c.in.AccessKey,
+		"secretKey":    c.in.SecretKey,
+		"sessionToken": c.in.SessionToken,
+	} {
+		if value != "" {
+			method = http.MethodPost
+			form.Set(key, string(value))
+		}
+	}
+
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, c.redactError(err)
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		m(req)
+	}
+
+	resp, err := retry.New(c.attempts, c.userAgent).WithSecrets(c.secrets()...).NonIdempotent().Do(req)
+	if err != nil {
+		return nil, failure.Classify(c.redactError(err))
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, failure.Classify(c.redactError(err))
+	}
+
+	var out legacyResponse
+	if err := json.Unmarshal(b, &out); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, failure.Classify(c.redactError(fmt.Errorf(
+				"legacy export responded with %s: %s", resp.Status, strings.TrimSpace(string(b)))))
+		}
+		return nil, fmt.Errorf("failed to decode legacy export response: %w", err)
+	}
+	var issues []failure.Issue
+	for _, e := range out.Errors {
+		issues = append(issues, failure.Issue{Message: redact.String(e.Message, c.secrets()...), Code: e.Code})
+	}
+	if len(out.Errors) > 0 {
+		out.Code, out.Message = out.Errors[0].Code, out.Errors[0].Message
+	}
+	out.Message = redact.String(out.Message, c.secrets()...)
+
+	if out.Code != "Success" || resp.StatusCode != http.StatusOK {
+		if len(issues) == 0 {
+			issues = []failure.Issue{{Message: out.Message, Code: out.Code}}
+		}
+		return nil, failure.Classify(failure.WithIssues(fmt.Errorf(
+			`export finished with unseccessfull code "%s": %s`, out.Code, out.Message), issues))
+	}
+
+	res := &ExportOutput{}
+	res.Response.Code = graphql.String(out.Code)
+	res.Response.Message = graphql.String(out.Message)
+
+	return res, nil
+}
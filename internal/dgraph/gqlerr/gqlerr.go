@@ -0,0 +1,38 @@
+// Package gqlerr turns errors lists of Dgraph GraphQL responses into errors
+// with their messages and codes, instead of the client's dump of them.
+package gqlerr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+)
+
+// From returns err of GraphQL request with secrets removed. GraphQL errors
+// are reported with their messages joined and carried as failure issues,
+// other errors are only redacted.
+func From(err error, secrets ...string) error {
+	var list graphql.Errors
+	if !errors.As(err, &list) || len(list) == 0 {
+		return redact.Error(err, secrets...)
+	}
+
+	issues := make([]failure.Issue, 0, len(list))
+	messages := make([]string, 0, len(list))
+	for _, e := range list {
+		issue := failure.Issue{Message: redact.String(e.Message, secrets...)}
+		// internal extensions of client errors hold request and response, they aren't kept
+		if code, ok := e.Extensions["code"].(string); ok {
+			issue.Code = code
+		}
+		issues = append(issues, issue)
+		messages = append(messages, issue.Message)
+	}
+
+	return failure.WithIssues(fmt.Errorf("%s", strings.Join(messages, "; ")), issues)
+}
@@ -0,0 +1,131 @@
+// Package gqlschema reads GraphQL schema applied to Dgraph with
+// updateGQLSchema, so schema migrations can be noticed, and applies
+// schema of restored backups.
+package gqlschema
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlerr"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+)
+
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cli = graphql.NewClient(endpoint, retry.New(c.attempts, c.userAgent))
+
+	m := auth.Modifier(c.authToken, c.apiKey)
+	if c.accessJWT != "" {
+		c.cli = c.cli.WithRequestModifier(func(r *http.Request) {
+			if m != nil {
+				m(r)
+			}
+			r.Header.Set("X-Dgraph-AccessToken", c.accessJWT)
+		})
+	} else if m != nil {
+		c.cli = c.cli.WithRequestModifier(m)
+	}
+
+	return c, nil
+}
+
+type Client struct {
+	cli       *graphql.Client
+	authToken string
+	apiKey    string
+	attempts  int
+	userAgent string
+	accessJWT string
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of admin endpoint requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+// WithAccessJWT sets ACL access token, e.g. of acl.Client logged into
+// namespace schema is read or applied in.
+func WithAccessJWT(value string) Option {
+	return func(c *Client) {
+		c.accessJWT = value
+	}
+}
+
+// Get returns current GraphQL schema, empty when none was applied.
+func (c *Client) Get(ctx context.Context) (string, error) {
+	var query struct {
+		GetGQLSchema *struct {
+			Schema graphql.String
+		} `graphql:"getGQLSchema"`
+	}
+
+	if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return "", gqlerr.From(err, c.authToken, c.apiKey, c.accessJWT)
+	}
+	if query.GetGQLSchema == nil {
+		return "", nil
+	}
+
+	return string(query.GetGQLSchema.Schema), nil
+}
+
+// Update applies GraphQL schema, Dgraph updates predicates and types
+// it's mapped to as well.
+func (c *Client) Update(ctx context.Context, schema string) error {
+	var mutation struct {
+		UpdateGQLSchema struct {
+			GQLSchema struct {
+				ID graphql.String `graphql:"id"`
+			} `graphql:"gqlSchema"`
+		} `graphql:"updateGQLSchema(input: {set: {schema: $schema}})"`
+	}
+	vars := map[string]interface{}{
+		"schema": graphql.String(schema),
+	}
+
+	if err := c.cli.Mutate(ctx, &mutation, vars); err != nil {
+		return gqlerr.From(err, c.authToken, c.apiKey, c.accessJWT)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlerr"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+)
+
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{endpoint: endpoint}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cli = graphql.NewClient(endpoint, retry.New(c.attempts, c.userAgent))
+
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		c.cli = c.cli.WithRequestModifier(m)
+	}
+
+	return c, nil
+}
+
+type Client struct {
+	cli       *graphql.Client
+	endpoint  string
+	authToken string
+	apiKey    string
+	attempts  int
+	userAgent string
+	legacy    bool
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of admin endpoint requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+// WithLegacy makes cluster health checked with REST /health?all,
+// for Dgraph versions without GraphQL admin API.
+func WithLegacy(value bool) Option {
+	return func(c *Client) {
+		c.legacy = value
+	}
+}
+
+// https://github.com/dgraph-io/dgraph/blob/v23.1.0/graphql/admin/admin.go#L80
+type NodeState struct {
+	Instance graphql.String
+	Address  graphql.String
+	Status   graphql.String
+	Group    graphql.String
+	Version  graphql.String
+}
+
+// Check returns health of cluster nodes and fails if any of them is unhealthy.
+func (c *Client) Check(ctx context.Context) ([]NodeState, error) {
+	var query struct {
+		Health []NodeState
+	}
+
+	if c.legacy {
+		nodes, err := c.rest(ctx, "all")
+		if err != nil {
+			return nil, err
+		}
+		query.Health = nodes
+	} else if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return nil, gqlerr.From(err, c.authToken, c.apiKey)
+	}
+
+	for _, node := range query.Health {
+		// v1.x nodes don't report status
+		if node.Status != "healthy" && !(c.legacy && node.Status == "") {
+			return query.Health, fmt.Errorf(
+				`%s %s is in "%s" status`, node.Instance, node.Address, node.Status)
+		}
+	}
+
+	return query.Health, nil
+}
+
+// Self returns health of the alpha serving admin endpoint. Unlike admin
+// health query listing all nodes, REST /health reports node itself only.
+func (c *Client) Self(ctx context.Context) (*NodeState, error) {
+	nodes, err := c.rest(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &nodes[0], nil
+}
+
+// rest requests REST /health with given raw query. Older versions report
+// node itself as object rather than list.
+func (c *Client) rest(ctx context.Context, query string) ([]NodeState, error) {
+	u := strings.TrimSuffix(strings.TrimRight(c.endpoint, "/"), "/admin") + "/health"
+	if query != "" {
+		u += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		m(req)
+	}
+
+	resp, err := retry.New(c.attempts, c.userAgent).Do(req)
+	if err != nil {
+		return nil, redact.Error(err, c.authToken, c.apiKey)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", u, resp.Status)
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", u, err)
+	}
+	var nodes []NodeState
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		nodes = make([]NodeState, 1)
+		err = json.Unmarshal(body, &nodes[0])
+	} else {
+		err = json.Unmarshal(body, &nodes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", u, err)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%s reported no nodes", u)
+	}
+
+	return nodes, nil
+}
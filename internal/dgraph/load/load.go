@@ -0,0 +1,135 @@
+// Package load reads alpha Prometheus metrics to tell whether cluster
+// is too busy for export to start.
+package load
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+)
+
+// Metrics read from alpha.
+// https://github.com/dgraph-io/dgraph/blob/v23.1.0/x/metrics.go
+const (
+	PendingProposals = "dgraph_pending_proposals_total"
+	DiskFree         = "dgraph_disk_free_bytes"
+)
+
+// Thresholds of cluster load, zero disables the check.
+type Thresholds struct {
+	MaxPendingProposals float64
+	MinDiskFreeBytes    float64
+}
+
+// Enabled tells whether any threshold is set.
+func (t Thresholds) Enabled() bool {
+	return t.MaxPendingProposals > 0 || t.MinDiskFreeBytes > 0
+}
+
+func NewClient(metricsURL string, opts ...Option) (*Client, error) {
+	if _, err := url.Parse(metricsURL); err != nil {
+		return nil, err
+	}
+
+	c := &Client{url: metricsURL}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.doer = retry.New(c.attempts, c.userAgent)
+
+	return c, nil
+}
+
+type Client struct {
+	url       string
+	attempts  int
+	userAgent string
+	doer      *retry.Doer
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of metrics requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// Check returns why cluster is overloaded according to t, empty reason
+// means export may start. Metrics alpha doesn't report are skipped.
+func (c *Client) Check(ctx context.Context, t Thresholds) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("alpha metrics responded with %s", resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse alpha metrics: %w", err)
+	}
+
+	if t.MaxPendingProposals > 0 {
+		if vs := values(families[PendingProposals]); len(vs) > 0 {
+			var sum float64
+			for _, v := range vs {
+				sum += v
+			}
+			if sum > t.MaxPendingProposals {
+				return fmt.Sprintf("%g pending proposals exceed %g", sum, t.MaxPendingProposals), nil
+			}
+		}
+	}
+	if t.MinDiskFreeBytes > 0 {
+		// series of data directories, the fullest one matters
+		for _, v := range values(families[DiskFree]) {
+			if v < t.MinDiskFreeBytes {
+				return fmt.Sprintf("%g bytes of free disk is below %g", v, t.MinDiskFreeBytes), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func values(f *dto.MetricFamily) []float64 {
+	var vs []float64
+	for _, m := range f.GetMetric() {
+		switch {
+		case m.Gauge != nil:
+			vs = append(vs, m.GetGauge().GetValue())
+		case m.Counter != nil:
+			vs = append(vs, m.GetCounter().GetValue())
+		case m.Untyped != nil:
+			vs = append(vs, m.GetUntyped().GetValue())
+		}
+	}
+
+	return vs
+}
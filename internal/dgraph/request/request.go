@@ -0,0 +1,34 @@
+// Package request identifies admin endpoint requests, so they can be
+// found in alpha and proxy logs.
+package request
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// IDHeader is header carrying ID of the run request is made by.
+const IDHeader = "X-Request-Id"
+
+type contextKey struct{}
+
+// WithID returns context requests made with are tagged with id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ID returns request ID set with WithID, empty if there is none.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+
+	return id
+}
+
+// NewID returns random request ID.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
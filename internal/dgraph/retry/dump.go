@@ -0,0 +1,132 @@
+package retry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+)
+
+// dumpLevel is verbosity requests and responses are logged with in full,
+// e.g. to see what export mutation Dgraph responded with unsuccessful code.
+const dumpLevel = 5
+
+// maxDumpSize limits logged bodies, live loader mutations and DQL
+// responses may be large.
+const maxDumpSize = 64 << 10
+
+// secretFields are JSON fields and form values whose values are never logged.
+var secretFields = map[string]bool{
+	"accesskey":    true,
+	"secretkey":    true,
+	"sessiontoken": true,
+	"password":     true,
+	"accessjwt":    true,
+	"refreshjwt":   true,
+	"token":        true,
+	"apikey":       true,
+}
+
+// WithSecrets sets values redacted from logged bodies besides secret
+// fields, e.g. credentials admin endpoint echoes in error messages.
+func (d *Doer) WithSecrets(secrets ...string) *Doer {
+	d.secrets = secrets
+
+	return d
+}
+
+// dumpRequest logs request with redacted body and sets body it consumed
+// to be sent again.
+func (d *Doer) dumpRequest(id string, req *http.Request) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		body = b
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	klog.Infof("dgraph request %s: %s %s %s", id, req.Method,
+		redact.URL(req.URL.String()), d.redactBody(body, req.Header.Get("Content-Type")))
+
+	return nil
+}
+
+// dumpResponse logs body of response to request id.
+func (d *Doer) dumpResponse(id string, resp *http.Response, body []byte) {
+	klog.Infof("dgraph response %s: %s %s", id, resp.Status,
+		d.redactBody(body, resp.Header.Get("Content-Type")))
+}
+
+// redactBody returns body with values of secret fields and known secrets
+// replaced, bodies which aren't JSON or form are only cut to maxDumpSize.
+func (d *Doer) redactBody(body []byte, contentType string) string {
+	s := string(body)
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(s); err == nil {
+			for key := range form {
+				if secretFields[strings.ToLower(key)] {
+					form.Set(key, redact.Placeholder)
+				}
+			}
+			s = form.Encode()
+		}
+	} else {
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if dec.Decode(&v) == nil {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if enc.Encode(redactValue("", v)) == nil {
+				s = strings.TrimSuffix(buf.String(), "\n")
+			}
+		}
+	}
+
+	s = redact.String(s, d.secrets...)
+	if len(s) > maxDumpSize {
+		s = fmt.Sprintf("%s... (%d bytes more)", s[:maxDumpSize], len(s)-maxDumpSize)
+	}
+
+	return s
+}
+
+// redactValue replaces values of secret fields in decoded JSON value v of
+// field key, destinations keep everything but credentials.
+func redactValue(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = redactValue(k, item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(key, item)
+		}
+	case string:
+		switch {
+		case secretFields[strings.ToLower(key)] && v != "":
+			return redact.Placeholder
+		case strings.EqualFold(key, "destination"):
+			return redact.URL(v)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,200 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/request"
+)
+
+const (
+	baseDelay = 500 * time.Millisecond
+	maxDelay  = 10 * time.Second
+)
+
+// Doer sends admin endpoint requests, retrying ones failed with
+// transient errors: network errors and 502, 503, 504 responses.
+// Delay between attempts grows exponentially with full jitter.
+// Requests are tagged with User-Agent and ID of the run they are made by.
+type Doer struct {
+	cli           *http.Client
+	attempts      int
+	userAgent     string
+	secrets       []string
+	nonIdempotent bool
+}
+
+// New returns Doer making at most attempts tries per request,
+// default Go User-Agent is sent when userAgent is empty.
+func New(attempts int, userAgent string) *Doer {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	return &Doer{
+		cli:       http.DefaultClient,
+		attempts:  attempts,
+		userAgent: userAgent,
+	}
+}
+
+// NonIdempotent limits retries to requests failed before they were sent,
+// e.g. with dial errors, and ones refused with 502 or 503. Requests timed
+// out or failed mid-way might have been applied, e.g. export mutation
+// would start second export if sent again.
+func (d *Doer) NonIdempotent() *Doer {
+	d.nonIdempotent = true
+
+	return d
+}
+
+func (d *Doer) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	id := request.ID(ctx)
+
+	if d.userAgent != "" {
+		req.Header.Set("User-Agent", d.userAgent)
+	}
+	if id != "" {
+		req.Header.Set(request.IDHeader, id)
+	}
+
+	if klog.V(dumpLevel) {
+		if err := d.dumpRequest(id, req); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var sent bool
+		trace := &httptrace.ClientTrace{WroteHeaders: func() { sent = true }}
+
+		start := time.Now()
+		resp, err := d.cli.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+		if err == nil && klog.V(2) {
+			resp.Body = d.logResponse(id, attempt, time.Since(start), resp)
+		}
+		if attempt >= d.attempts || !d.transient(ctx, resp, err, sent) {
+			return resp, err
+		}
+
+		if err == nil {
+			err = fmt.Errorf("%s", resp.Status)
+			resp.Body.Close()
+		}
+
+		delay := Backoff(attempt)
+		klog.Warningf("dgraph request failed, retry %d/%d in %s: %v", attempt, d.attempts-1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// logResponse logs latency and GraphQL extensions of response, e.g.
+// touched_uids, or whole body at dumpLevel, and returns body to be read
+// instead of consumed one.
+func (d *Doer) logResponse(id string, attempt int, latency time.Duration, resp *http.Response) io.ReadCloser {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var out struct {
+		Extensions json.RawMessage `json:"extensions"`
+	}
+	if err == nil && resp.StatusCode == http.StatusOK {
+		_ = json.Unmarshal(body, &out)
+	}
+	if len(out.Extensions) > 0 {
+		klog.Infof("dgraph request %s attempt %d: %s in %s, extensions: %s",
+			id, attempt, resp.Status, latency, out.Extensions)
+	} else {
+		klog.Infof("dgraph request %s attempt %d: %s in %s", id, attempt, resp.Status, latency)
+	}
+	if klog.V(dumpLevel) {
+		d.dumpResponse(id, resp, body)
+	}
+
+	if err != nil {
+		return io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+	}
+
+	return io.NopCloser(bytes.NewReader(body))
+}
+
+// errReader returns error body read failed with after buffered part of it.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// transient reports whether request failed with err or resp can be
+// retried, sent is set once request headers were written.
+func (d *Doer) transient(ctx context.Context, resp *http.Response, err error, sent bool) bool {
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return false
+		}
+		return !d.nonIdempotent || !sent
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	case http.StatusGatewayTimeout:
+		return !d.nonIdempotent
+	}
+
+	return false
+}
+
+// Backoff returns random delay up to base delay doubled for every attempt.
+func Backoff(attempt int) time.Duration {
+	d := maxDelay
+	if attempt < 16 {
+		d = baseDelay << (attempt - 1)
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// rewind returns copy of request with fresh body to send it again.
+func rewind(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return r, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body can't be sent again")
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+
+	return r, nil
+}
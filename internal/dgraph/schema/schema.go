@@ -0,0 +1,145 @@
+package schema
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a summary of exported DQL schema.
+type Schema struct {
+	Predicates []string `json:"predicates"`
+	Types      []string `json:"types"`
+}
+
+// Diff lists schema changes between two exports.
+type Diff struct {
+	AddedPredicates   []string `json:"addedPredicates,omitempty"`
+	RemovedPredicates []string `json:"removedPredicates,omitempty"`
+	AddedTypes        []string `json:"addedTypes,omitempty"`
+	RemovedTypes      []string `json:"removedTypes,omitempty"`
+}
+
+var (
+	// namespaceRe matches namespace prefix of schema lines, e.g. [0x0].
+	namespaceRe = regexp.MustCompile(`^\[0x[0-9a-f]+\]\s*`)
+	typeRe      = regexp.MustCompile(`^type\s+<?([^\s<>{]+)>?\s*\{`)
+	predicateRe = regexp.MustCompile(`^<?([^\s<>:]+)>?\s*:`)
+)
+
+// ParseGzip parses gzipped schema file, e.g. g01.schema.gz.
+func ParseGzip(r io.Reader) (*Schema, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return Parse(zr)
+}
+
+// Parse collects predicate and type names from exported schema.
+func Parse(r io.Reader) (*Schema, error) {
+	preds := make(map[string]bool)
+	types := make(map[string]bool)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := namespaceRe.ReplaceAllString(strings.TrimSpace(sc.Text()), "")
+		if m := typeRe.FindStringSubmatch(line); m != nil {
+			types[m[1]] = true
+		} else if m := predicateRe.FindStringSubmatch(line); m != nil {
+			preds[m[1]] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return &Schema{Predicates: keys(preds), Types: keys(types)}, nil
+}
+
+// Merge adds names from other schema, e.g. of another group.
+func (s *Schema) Merge(other *Schema) {
+	s.Predicates = union(s.Predicates, other.Predicates)
+	s.Types = union(s.Types, other.Types)
+}
+
+// Compare returns changes made from old to s.
+func (s *Schema) Compare(old *Schema) Diff {
+	return Diff{
+		AddedPredicates:   subtract(s.Predicates, old.Predicates),
+		RemovedPredicates: subtract(old.Predicates, s.Predicates),
+		AddedTypes:        subtract(s.Types, old.Types),
+		RemovedTypes:      subtract(old.Types, s.Types),
+	}
+}
+
+// Empty returns whether there are no changes.
+func (d Diff) Empty() bool {
+	return len(d.AddedPredicates)+len(d.RemovedPredicates)+len(d.AddedTypes)+len(d.RemovedTypes) == 0
+}
+
+func (d Diff) String() string {
+	var parts []string
+	for _, p := range []struct {
+		name  string
+		items []string
+	}{
+		{"added predicates", d.AddedPredicates},
+		{"removed predicates", d.RemovedPredicates},
+		{"added types", d.AddedTypes},
+		{"removed types", d.RemovedTypes},
+	} {
+		if len(p.items) > 0 {
+			parts = append(parts, p.name+": "+strings.Join(p.items, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func keys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func union(a, b []string) []string {
+	m := make(map[string]bool, len(a)+len(b))
+	for _, v := range a {
+		m[v] = true
+	}
+	for _, v := range b {
+		m[v] = true
+	}
+
+	return keys(m)
+}
+
+func subtract(a, b []string) []string {
+	m := make(map[string]bool, len(b))
+	for _, v := range b {
+		m[v] = true
+	}
+
+	var out []string
+	for _, v := range a {
+		if !m[v] {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,145 @@
+package state
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/auth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlerr"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+)
+
+func NewClient(endpoint string, opts ...Option) (*Client, error) {
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cli = graphql.NewClient(endpoint, retry.New(c.attempts, c.userAgent))
+
+	if m := auth.Modifier(c.authToken, c.apiKey); m != nil {
+		c.cli = c.cli.WithRequestModifier(m)
+	}
+
+	return c, nil
+}
+
+type Client struct {
+	cli       *graphql.Client
+	authToken string
+	apiKey    string
+	attempts  int
+	userAgent string
+}
+
+type Option func(*Client)
+
+// WithRetries sets how many times request failed with transient error is tried.
+func WithRetries(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithUserAgent sets User-Agent of admin endpoint requests.
+func WithUserAgent(value string) Option {
+	return func(c *Client) {
+		c.userAgent = value
+	}
+}
+
+// WithAuthToken sets token for alphas started with --security "token=...".
+func WithAuthToken(value string) Option {
+	return func(c *Client) {
+		c.authToken = value
+	}
+}
+
+// WithAPIKey sets Dgraph Cloud API key.
+func WithAPIKey(value string) Option {
+	return func(c *Client) {
+		c.apiKey = value
+	}
+}
+
+// UInt64 is Dgraph UInt64 scalar, encoded either as JSON number or string.
+type UInt64 uint64
+
+func (v *UInt64) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseUint(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = UInt64(n)
+
+	return nil
+}
+
+// https://github.com/dgraph-io/dgraph/blob/v23.1.0/graphql/admin/admin.go#L150
+type MembershipState struct {
+	Cid    graphql.String
+	Groups []ClusterGroup
+}
+
+type ClusterGroup struct {
+	ID      UInt64 `graphql:"id"`
+	Members []struct {
+		Addr   graphql.String
+		Leader graphql.Boolean
+	}
+	Tablets []struct {
+		Predicate graphql.String
+	}
+}
+
+// State returns cluster membership state.
+func (c *Client) State(ctx context.Context) (*MembershipState, error) {
+	var query struct {
+		State MembershipState
+	}
+
+	if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return nil, gqlerr.From(err, c.authToken, c.apiKey)
+	}
+
+	return &query.State, nil
+}
+
+// Member is alpha of cluster group.
+type Member struct {
+	Addr    graphql.String
+	Learner graphql.Boolean
+}
+
+// Members returns alphas of all groups. It's separate from State, since
+// learner field is missing in Dgraph before v21.03.
+func (c *Client) Members(ctx context.Context) ([]Member, error) {
+	var query struct {
+		State struct {
+			Groups []struct {
+				Members []Member
+			}
+		}
+	}
+
+	if err := c.cli.Query(ctx, &query, nil); err != nil {
+		return nil, gqlerr.From(err, c.authToken, c.apiKey)
+	}
+
+	var members []Member
+	for _, g := range query.State.Groups {
+		members = append(members, g.Members...)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,231 @@
+// Package download copies files served over HTTP, e.g. signed URLs of
+// Dgraph Cloud exports, into export destination.
+package download
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/retry"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/worker"
+)
+
+// Downloader stores files downloaded with client at destination.
+type Downloader struct {
+	client   *http.Client
+	storage  storage.Storage
+	tmpDir   string
+	attempts int
+	pool     *worker.Pool
+}
+
+type Option func(*Downloader)
+
+// WithRetries sets how many times failed download is tried,
+// including ones failed checksum verification.
+func WithRetries(attempts int) Option {
+	return func(d *Downloader) {
+		d.attempts = attempts
+	}
+}
+
+// WithPool downloads files on pool workers, one by one by default.
+func WithPool(pool *worker.Pool) Option {
+	return func(d *Downloader) {
+		d.pool = pool
+	}
+}
+
+// New returns downloader spooling files in tmpDir, since size of
+// uploaded object has to be known and servers may not send it.
+func New(client *http.Client, s storage.Storage, tmpDir string, opts ...Option) *Downloader {
+	d := &Downloader{
+		client:   client,
+		storage:  s,
+		tmpDir:   tmpDir,
+		attempts: 1,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// IsURL returns whether exported file is served over HTTP
+// rather than written to destination.
+func IsURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// Files downloads urls into dir at destination and returns keys of stored
+// objects, they are named after the last element of url path.
+func (d *Downloader) Files(ctx context.Context, dir string, urls []string) ([]string, error) {
+	parsed := make([]*url.URL, len(urls))
+	keys := make([]string, len(urls))
+	for i, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download url: %w", redact.Error(err, rawURL))
+		}
+		parsed[i] = u
+		keys[i] = path.Join(dir, path.Base(u.Path))
+	}
+
+	err := d.pool.Run(ctx, "download", len(urls), func(ctx context.Context, i int) error {
+		if err := d.file(ctx, parsed[i], keys[i]); err != nil {
+			return fmt.Errorf("failed to download %s: %w", keys[i], err)
+		}
+		klog.V(1).Infof("downloaded %s", keys[i])
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// file downloads u into key, retrying transient failures
+// with the same backoff as admin endpoint requests.
+func (d *Downloader) file(ctx context.Context, u *url.URL, key string) error {
+	for attempt := 1; ; attempt++ {
+		err := d.try(ctx, u, key)
+		if err == nil || attempt >= d.attempts || ctx.Err() != nil || permanent(err) {
+			return err
+		}
+
+		delay := retry.Backoff(attempt)
+		klog.Warningf("download of %s failed, retry %d/%d in %s: %v", key, attempt, d.attempts-1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (d *Downloader) try(ctx context.Context, u *url.URL, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// url query holds signature, it must not get into logs
+		return redact.Error(err, u.RawQuery)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+
+	f, err := os.CreateTemp(d.tmpDir, "download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && size != resp.ContentLength {
+		return fmt.Errorf("got %d bytes, want %d", size, resp.ContentLength)
+	}
+	if want := expectedMD5(resp.Header); want != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			return fmt.Errorf("md5 checksum is %s, want %s", got, want)
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return d.storage.Put(ctx, key, f, size)
+}
+
+// expectedMD5 returns hex MD5 of response body announced by server with
+// Content-MD5, GCS x-goog-hash or ETag header, empty when it's unknown.
+func expectedMD5(h http.Header) string {
+	if v := h.Get("Content-MD5"); v != "" {
+		return base64ToHex(v)
+	}
+	for _, v := range h.Values("X-Goog-Hash") {
+		for _, part := range strings.Split(v, ",") {
+			if b64, ok := strings.CutPrefix(strings.TrimSpace(part), "md5="); ok {
+				return base64ToHex(b64)
+			}
+		}
+	}
+	// ETag is MD5 of content only for single part objects without KMS or
+	// customer key encryption, multipart ETags don't look like MD5
+	if h.Get("X-Amz-Server-Side-Encryption") == "aws:kms" ||
+		h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return ""
+	}
+	if etag := strings.Trim(h.Get("ETag"), `"`); len(etag) == 32 {
+		if _, err := hex.DecodeString(etag); err == nil {
+			return strings.ToLower(etag)
+		}
+	}
+
+	return ""
+}
+
+func base64ToHex(v string) string {
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "unexpected response status " + e.status
+}
+
+// permanent returns whether download failed with client error,
+// expired signature or missing file don't get better with retries.
+func permanent(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	switch se.code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+
+	return se.code/100 == 4
+}
@@ -0,0 +1,117 @@
+// Package events publishes structured backup lifecycle events to sinks,
+// e.g. Kafka or NATS topics, for automation built on top of the tool.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/notify"
+)
+
+// Type is the lifecycle stage event reports.
+type Type string
+
+const (
+	Started  Type = "started"
+	Exported Type = "exported"
+	Verified Type = "verified"
+	Uploaded Type = "uploaded"
+	Pruned   Type = "pruned"
+	Failed   Type = "failed"
+)
+
+// Event describes lifecycle stage of single run, events of run share RunID.
+type Event struct {
+	Type     Type      `json:"type"`
+	Time     time.Time `json:"time"`
+	RunID    string    `json:"runId,omitempty"`
+	Identity string    `json:"identity,omitempty"`
+	// Export is export directory, it's set once export is done.
+	Export string   `json:"export,omitempty"`
+	Files  []string `json:"files,omitempty"`
+	Stage  string   `json:"stage,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	// ErrorClass tells failures apart, e.g. auth or destination.
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// Bus publishes events in background, so slow sinks don't delay exports.
+// Events are dropped when queue is full. Nil Bus drops all events.
+type Bus struct {
+	pub   notify.Publisher
+	queue chan Event
+}
+
+// New returns bus publishing to pub, up to size events are queued.
+func New(pub notify.Publisher, size int) *Bus {
+	return &Bus{
+		pub:   pub,
+		queue: make(chan Event, size),
+	}
+}
+
+// Emit queues event, its time is set when empty.
+func (b *Bus) Emit(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	select {
+	case b.queue <- e:
+	default:
+		klog.Warningf("event queue is full, dropped %s event of run %s", e.Type, e.RunID)
+		metrics.EventsDropped.Inc()
+	}
+}
+
+// Run publishes queued events until ctx is done.
+func (b *Bus) Run(ctx context.Context) {
+	for {
+		select {
+		case e := <-b.queue:
+			b.publish(ctx, e)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Drain publishes events left in queue, e.g. before exit of run-once mode.
+func (b *Bus) Drain(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	for {
+		select {
+		case e := <-b.queue:
+			b.publish(ctx, e)
+		default:
+			return
+		}
+	}
+}
+
+func (b *Bus) publish(ctx context.Context, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		klog.Errorf("failed to encode %s event: %v", e.Type, err)
+		return
+	}
+
+	// key of the run keeps its events ordered within Kafka partition
+	if err := b.pub.Publish(ctx, e.RunID, body); err != nil {
+		klog.Errorf("failed to publish %s event of run %s: %v", e.Type, e.RunID, err)
+		metrics.EventsFailed.Inc()
+		return
+	}
+	metrics.EventsPublished.WithLabelValues(string(e.Type)).Inc()
+}
@@ -0,0 +1,192 @@
+// Package failure defines classes of errors returned by clients of Dgraph
+// and export destinations, so scheduler, API and notifications can tell
+// failures apart, e.g. to choose retry delay or alert the right team.
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrAuth is returned when Dgraph rejects credentials of the tool.
+	ErrAuth = errors.New("authentication failed")
+	// ErrDestination is returned when export destination can't be
+	// read or written, e.g. bucket is missing or disk is full.
+	ErrDestination = errors.New("destination failed")
+	// ErrClusterBusy is returned when alpha refuses operation because another
+	// admin operation, e.g. backup or export, is running or it's in draining mode.
+	ErrClusterBusy = errors.New("dgraph is busy")
+	// ErrTimeout is returned when operation doesn't finish in time.
+	ErrTimeout = errors.New("timed out")
+	// ErrPartialExport is returned when export misses files of some groups.
+	ErrPartialExport = errors.New("export is incomplete")
+)
+
+// Class is name of error class reported by API, metrics and events.
+type Class string
+
+const (
+	ClassAuth          Class = "auth"
+	ClassDestination   Class = "destination"
+	ClassClusterBusy   Class = "cluster_busy"
+	ClassTimeout       Class = "timeout"
+	ClassPartialExport Class = "partial_export"
+	ClassUnknown       Class = "unknown"
+)
+
+// classes are checked in order, so incomplete export waited for
+// until timeout is reported as partial one.
+var classes = []struct {
+	err   error
+	class Class
+}{
+	{ErrPartialExport, ClassPartialExport},
+	{ErrAuth, ClassAuth},
+	{ErrClusterBusy, ClassClusterBusy},
+	{ErrDestination, ClassDestination},
+	{ErrTimeout, ClassTimeout},
+}
+
+// Of returns class of err, it's empty for nil error.
+func Of(err error) Class {
+	if err == nil {
+		return ""
+	}
+	for _, c := range classes {
+		if errors.Is(err, c.err) {
+			return c.class
+		}
+	}
+
+	return ClassUnknown
+}
+
+// Wrap marks err with class, errors already marked with it are kept as is.
+func Wrap(class, err error) error {
+	if err == nil || errors.Is(err, class) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", class, err)
+}
+
+// messages are parts of Dgraph errors telling their class.
+var messages = []struct {
+	class error
+	parts []string
+}{
+	{ErrClusterBusy, []string{
+		"already running",
+		"already in progress",
+		"draining mode",
+	}},
+	{ErrAuth, []string{
+		"403 forbidden",
+		"unauthorized",
+		"permission denied",
+		"token is expired",
+		"invalid jwt",
+		"no accessjwt",
+	}},
+	{ErrDestination, []string{
+		"nosuchbucket",
+		"access denied",
+		"no space left",
+		"invalid destination",
+		"unable to write",
+	}},
+}
+
+// Classify marks error returned by Dgraph with its class,
+// errors of unknown class are returned as is.
+func Classify(err error) error {
+	if err == nil || Of(err) != ClassUnknown {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, m := range messages {
+		for _, part := range m.parts {
+			if strings.Contains(msg, part) {
+				return Wrap(m.class, err)
+			}
+		}
+	}
+
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+		return Wrap(ErrTimeout, err)
+	}
+
+	return err
+}
+
+// New returns error with message msg of given class, e.g. to restore
+// error decoded from its message and class.
+func New(class Class, msg string) error {
+	for _, c := range classes {
+		if c.class == class {
+			return &classified{msg: msg, class: c.err}
+		}
+	}
+
+	return errors.New(msg)
+}
+
+type classified struct {
+	msg   string
+	class error
+}
+
+func (e *classified) Error() string {
+	return e.msg
+}
+
+func (e *classified) Unwrap() error {
+	return e.class
+}
+
+// Issue is single problem reported by Dgraph, e.g. entry of GraphQL
+// errors list or unsuccessful export response. Code is its code, e.g.
+// extensions code of GraphQL error, when Dgraph sets it.
+type Issue struct {
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+// WithIssues returns err carrying issues Dgraph reported, so callers can
+// tell them apart instead of parsing error message.
+func WithIssues(err error, issues []Issue) error {
+	if err == nil || len(issues) == 0 {
+		return err
+	}
+
+	return &issuesError{err: err, issues: issues}
+}
+
+// Issues returns issues err carries, nil when it has none.
+func Issues(err error) []Issue {
+	var ie *issuesError
+	if errors.As(err, &ie) {
+		return ie.issues
+	}
+
+	return nil
+}
+
+type issuesError struct {
+	err    error
+	issues []Issue
+}
+
+func (e *issuesError) Error() string {
+	return e.err.Error()
+}
+
+func (e *issuesError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,102 @@
+// Package fault injects failures of export requests, uploads, backup
+// verification and lease renewal, so operators can check alerting and
+// retries in staging. Nothing is injected unless rates are set.
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+// ErrInjected is wrapped by injected failures.
+var ErrInjected = errors.New("injected fault")
+
+// Point is operation failures are injected into.
+type Point string
+
+const (
+	Export    Point = "export"
+	Upload    Point = "upload"
+	Verify    Point = "verify"
+	LockRenew Point = "lock-renew"
+)
+
+// Injector fails operations with configured probabilities, nil Injector
+// fails nothing.
+type Injector struct {
+	rates map[Point]float64
+}
+
+// New returns injector failing operations at points with given rates,
+// from 0 to 1. It's nil when no rate is set.
+func New(rates map[Point]float64) (*Injector, error) {
+	enabled := false
+	for p, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("%s fault rate %v is out of [0, 1]", p, rate)
+		}
+		enabled = enabled || rate > 0
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	for p, rate := range rates {
+		if rate > 0 {
+			klog.Warningf("%s failures are injected at rate %v", p, rate)
+		}
+	}
+
+	return &Injector{rates: rates}, nil
+}
+
+// Enabled tells whether failures are injected at point p.
+func (i *Injector) Enabled(p Point) bool {
+	return i != nil && i.rates[p] > 0
+}
+
+// Fail returns injected error at rate of point p, nil otherwise.
+func (i *Injector) Fail(p Point) error {
+	if !i.Enabled(p) || rand.Float64() >= i.rates[p] {
+		return nil
+	}
+
+	metrics.InjectedFaults.WithLabelValues(string(p)).Inc()
+	klog.Warningf("injecting %s failure", p)
+
+	return fmt.Errorf("%s: %w", p, ErrInjected)
+}
+
+// Lock wraps lock to fail its renewals at LockRenew rate, so leader
+// loses lease like with unavailable lock backend.
+func Lock(lock resourcelock.Interface, i *Injector) resourcelock.Interface {
+	if !i.Enabled(LockRenew) {
+		return lock
+	}
+
+	return &faultyLock{Interface: lock, injector: i}
+}
+
+type faultyLock struct {
+	resourcelock.Interface
+
+	injector *Injector
+}
+
+func (l *faultyLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	// leader keeps acquire time of its record, acquiring sets it to renew time
+	if ler.HolderIdentity != "" && !ler.AcquireTime.Equal(&ler.RenewTime) {
+		if err := l.injector.Fail(LockRenew); err != nil {
+			return err
+		}
+	}
+
+	return l.Interface.Update(ctx, ler)
+}
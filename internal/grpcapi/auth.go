@@ -0,0 +1,114 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	apiv1 "github.com/sputnik-systems/dgraph-export-tool/pkg/api/v1"
+)
+
+// writeMethods may change anything, they are forbidden for viewers
+// and in read-only mode.
+var writeMethods = map[string]bool{
+	apiv1.ManagementService_TriggerExport_FullMethodName: true,
+	apiv1.ManagementService_Restore_FullMethodName:       true,
+	apiv1.ManagementService_Prune_FullMethodName:         true,
+}
+
+// scopedMethods are methods namespace scoped tokens may call, like
+// scoped routes of HTTP API. Exports of gRPC API are of the whole
+// cluster, so scoped tokens may only look at their jobs, backups of
+// their namespaces and restore them.
+var scopedMethods = map[string]bool{
+	apiv1.ManagementService_GetJob_FullMethodName:      true,
+	apiv1.ManagementService_WatchJob_FullMethodName:    true,
+	apiv1.ManagementService_ListBackups_FullMethodName: true,
+	apiv1.ManagementService_Restore_FullMethodName:     true,
+}
+
+// Interceptors returns server options applying rate limits, tokens,
+// roles and namespace scopes to calls the way HTTP API does.
+func (s *Server) Interceptors() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := s.authorize(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := s.authorize(ss.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		}),
+	}
+}
+
+// authorize returns ctx of call with token it's authenticated with,
+// calls which aren't permitted fail.
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	if s.limiter != nil && !s.limiter.Allow(peerAddr(ctx)) {
+		return nil, status.Error(codes.ResourceExhausted, "too many requests")
+	}
+	if s.readOnly && writeMethods[method] {
+		return nil, status.Error(codes.PermissionDenied, "forbidden in read-only mode")
+	}
+	if s.auth == nil {
+		return ctx, nil
+	}
+
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			header = v[0]
+		}
+	}
+	t := s.auth.Authenticate(ctx, header)
+	switch {
+	case t == nil:
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	case t.Role == apiauth.RoleViewer && writeMethods[method]:
+		return nil, status.Error(codes.PermissionDenied, "forbidden for token with viewer role")
+	case t.Scoped() && !scopedMethods[method]:
+		return nil, status.Error(codes.PermissionDenied, "forbidden for namespace scoped token")
+	}
+
+	return apiauth.NewContext(ctx, t), nil
+}
+
+// peerAddr returns host of client calling with ctx.
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// serverStream is stream with context of authorized call.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
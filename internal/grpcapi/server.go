@@ -0,0 +1,342 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/apiauth"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ratelimit"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	apiv1 "github.com/sputnik-systems/dgraph-export-tool/pkg/api/v1"
+)
+
+// Server implements gRPC management API on top of job manager.
+type Server struct {
+	apiv1.UnimplementedManagementServiceServer
+
+	ctx     context.Context
+	jobs    *job.Manager
+	export  job.Func
+	backend Backend
+
+	auth      *apiauth.Authenticator
+	limiter   *ratelimit.Limiter
+	exportCap int
+	readOnly  bool
+}
+
+// Backend serves calls beyond export jobs the way HTTP API does,
+// errors it returns are expected to be gRPC status errors.
+type Backend interface {
+	// Status returns state of the tool instance.
+	Status(ctx context.Context) (*apiv1.Status, error)
+	// RestorePoints returns restore points the token of ctx may see.
+	RestorePoints(ctx context.Context) ([]restorepoint.Point, error)
+	// Restore checks request and returns work of its restore job.
+	Restore(ctx context.Context, req *apiv1.RestoreRequest) (job.Func, error)
+	// Prune applies retention policy now.
+	Prune(ctx context.Context, dryRun bool) (*apiv1.PruneResponse, error)
+}
+
+// Option configures Server.
+type Option func(s *Server)
+
+// WithAuth makes Server authenticate calls with bearer tokens of
+// "authorization" metadata, the same ones HTTP API accepts.
+func WithAuth(a *apiauth.Authenticator) Option {
+	return func(s *Server) {
+		s.auth = a
+	}
+}
+
+// WithLimiter makes Server share rate limits with HTTP API.
+func WithLimiter(l *ratelimit.Limiter) Option {
+	return func(s *Server) {
+		s.limiter = l
+	}
+}
+
+// WithExportLimit makes Server reject exports when limit of them are
+// queued or running already, zero means no limit.
+func WithExportLimit(limit int) Option {
+	return func(s *Server) {
+		s.exportCap = limit
+	}
+}
+
+// WithReadOnly makes Server reject calls which may change anything.
+func WithReadOnly(readOnly bool) Option {
+	return func(s *Server) {
+		s.readOnly = readOnly
+	}
+}
+
+// WithBackend makes Server serve status, backups, restore and prune
+// calls with b, they are unimplemented otherwise.
+func WithBackend(b Backend) Option {
+	return func(s *Server) {
+		s.backend = b
+	}
+}
+
+// NewServer returns API server starting export jobs with ctx.
+func NewServer(ctx context.Context, jobs *job.Manager, export job.Func, opts ...Option) *Server {
+	s := &Server{
+		ctx:    ctx,
+		jobs:   jobs,
+		export: export,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *Server) TriggerExport(ctx context.Context, req *apiv1.TriggerExportRequest) (*apiv1.Job, error) {
+	j, created, err := s.jobs.StartWithin(s.jobContext(ctx), job.KindExport, req.GetIdempotencyKey(), job.PriorityManual, s.exportCap, s.export)
+	if errors.Is(err, job.ErrLimitReached) {
+		return nil, status.Errorf(codes.ResourceExhausted, "%d exports are queued or running already", s.exportCap)
+	}
+	if !created {
+		klog.Infof("export request with idempotency key %q is served by job %s", req.GetIdempotencyKey(), j.ID)
+	}
+
+	if req.GetWait() {
+		select {
+		case <-j.Done():
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	return JobProto(j.Status()), nil
+}
+
+func (s *Server) GetJob(ctx context.Context, req *apiv1.GetJobRequest) (*apiv1.Job, error) {
+	j, ok := s.job(ctx, req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "job %q not found", req.GetId())
+	}
+
+	return JobProto(j.Status()), nil
+}
+
+func (s *Server) WatchJob(req *apiv1.WatchJobRequest, stream apiv1.ManagementService_WatchJobServer) error {
+	j, ok := s.job(stream.Context(), req.GetId())
+	if !ok {
+		return status.Errorf(codes.NotFound, "job %q not found", req.GetId())
+	}
+
+	next := 0
+	for {
+		events, changed, finished := j.Events(next)
+		for _, event := range events {
+			// job is sent with its state at the time of sending
+			msg := JobProto(j.Status())
+			msg.Event = &apiv1.JobEvent{
+				Time:    timestamppb.New(event.Time),
+				Type:    event.Type,
+				Message: event.Message,
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+			next++
+		}
+
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+func (s *Server) GetStatus(ctx context.Context, req *apiv1.GetStatusRequest) (*apiv1.Status, error) {
+	if s.backend == nil {
+		return nil, status.Error(codes.Unimplemented, "status is unavailable")
+	}
+
+	return s.backend.Status(ctx)
+}
+
+func (s *Server) ListBackups(ctx context.Context, req *apiv1.ListBackupsRequest) (*apiv1.ListBackupsResponse, error) {
+	if s.backend == nil {
+		return nil, status.Error(codes.Unimplemented, "backups are unavailable")
+	}
+
+	points, err := s.backend.RestorePoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &apiv1.ListBackupsResponse{Backups: make([]*apiv1.Backup, 0, len(points))}
+	for _, point := range points {
+		resp.Backups = append(resp.Backups, backupProto(point))
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Restore(ctx context.Context, req *apiv1.RestoreRequest) (*apiv1.Job, error) {
+	if s.backend == nil {
+		return nil, status.Error(codes.Unimplemented, "restore is unavailable")
+	}
+
+	fn, err := s.backend.Restore(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	j, created := s.jobs.Start(s.jobContext(ctx), job.KindRestore, req.GetIdempotencyKey(), job.PriorityManual, fn)
+	if !created {
+		klog.Infof("restore request with idempotency key %q is served by job %s", req.GetIdempotencyKey(), j.ID)
+	}
+
+	return JobProto(j.Status()), nil
+}
+
+func (s *Server) Prune(ctx context.Context, req *apiv1.PruneRequest) (*apiv1.PruneResponse, error) {
+	if s.backend == nil {
+		return nil, status.Error(codes.Unimplemented, "prune is unavailable")
+	}
+
+	return s.backend.Prune(ctx, req.GetDryRun())
+}
+
+// jobContext returns context jobs started by call with ctx run with,
+// they are owned by the token call is authenticated with.
+func (s *Server) jobContext(ctx context.Context) context.Context {
+	if t := apiauth.FromContext(ctx); t != nil {
+		return job.WithOwner(s.ctx, t.Name)
+	}
+
+	return s.ctx
+}
+
+// job returns job id unless token of ctx may not see it, namespace
+// scoped tokens see only jobs they started.
+func (s *Server) job(ctx context.Context, id string) (*job.Job, bool) {
+	j, ok := s.jobs.Get(id)
+	if !ok {
+		return nil, false
+	}
+	if t := apiauth.FromContext(ctx); t.Scoped() && j.Status().Owner != t.Name {
+		return nil, false
+	}
+
+	return j, true
+}
+
+// JobProto returns job status as gRPC API message.
+func JobProto(st job.Status) *apiv1.Job {
+	j := &apiv1.Job{
+		Id:             st.ID,
+		Kind:           string(st.Kind),
+		IdempotencyKey: st.Key,
+		Priority:       st.Priority.String(),
+		QueuedAt:       timestamppb.New(st.QueuedAt),
+		WrittenFiles:   int64(st.Progress.Files),
+		WrittenBytes:   st.Progress.Bytes,
+	}
+
+	switch st.State {
+	case job.StateQueued:
+		j.State = apiv1.Job_STATE_QUEUED
+	case job.StateRunning:
+		j.State = apiv1.Job_STATE_RUNNING
+	case job.StateSucceeded:
+		j.State = apiv1.Job_STATE_SUCCEEDED
+	case job.StateFailed, job.StateCancelled:
+		// gRPC API has no separate state, error tells job was cancelled
+		j.State = apiv1.Job_STATE_FAILED
+	}
+
+	if !st.StartedAt.IsZero() {
+		j.StartedAt = timestamppb.New(st.StartedAt)
+	}
+	if !st.FinishedAt.IsZero() {
+		j.FinishedAt = timestamppb.New(st.FinishedAt)
+	}
+	if st.Output != nil {
+		j.Files = st.Output.GetFiles()
+	}
+	if st.Err != nil {
+		j.Error = st.Err.Error()
+	}
+
+	return j
+}
+
+func backupProto(point restorepoint.Point) *apiv1.Backup {
+	return &apiv1.Backup{
+		Id:        point.ID,
+		Time:      timestamppb.New(point.Time),
+		Type:      point.Type,
+		Files:     int64(point.Files),
+		Size:      point.Size,
+		Verified:  point.Verified,
+		Held:      point.Held,
+		Problem:   point.Problem,
+		Base:      point.Base,
+		Format:    point.Format,
+		Namespace: point.Namespace,
+		Signature: point.Signature,
+	}
+}
+
+// ServerOptions returns grpc server options enabling TLS when certFile is set
+// and client certificate verification (mTLS) when clientCAFile is set.
+func ServerOptions(certFile, keyFile, clientCAFile string) ([]grpc.ServerOption, error) {
+	if certFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("client CA file requires TLS certificate")
+		}
+
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		b, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(cfg))}, nil
+}
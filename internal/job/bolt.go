@@ -0,0 +1,140 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var historyBucket = []byte("jobs")
+
+// BoltHistory keeps finished jobs in embedded bbolt database for setups
+// without YDB, jobs finished more than ttl ago are deleted when new ones
+// are saved. The file is locked by one process at a time.
+type BoltHistory struct {
+	db  *bolt.DB
+	ttl time.Duration
+}
+
+// OpenBoltHistory opens database file at path, creating it if missing.
+func OpenBoltHistory(path string, ttl time.Duration) (*BoltHistory, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltHistory{db: db, ttl: ttl}, nil
+}
+
+func (h *BoltHistory) Close() error {
+	return h.db.Close()
+}
+
+func (h *BoltHistory) Save(ctx context.Context, s Status) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		if err := bucket.Put(historyKey(s.FinishedAt, s.ID), b); err != nil {
+			return err
+		}
+		if h.ttl <= 0 {
+			return nil
+		}
+
+		// keys are ordered by finish time, so expired jobs are at the beginning;
+		// they are collected first, since deleting with cursor skips keys
+		var expired [][]byte
+		expire := historyKey(time.Now().Add(-h.ttl), "")
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, expire) < 0; k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (h *BoltHistory) List(ctx context.Context, q Query) (Page, error) {
+	c, err := ParseCursor(q.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	p := Page{Jobs: make([]Status, 0)}
+	err = h.db.View(func(tx *bolt.Tx) error {
+		cur := tx.Bucket(historyBucket).Cursor()
+
+		// jobs are read backwards from the cursor or the end of range
+		var k, v []byte
+		switch {
+		case c != nil:
+			k, v = seekBefore(cur, historyKey(c.FinishedAt, c.ID))
+		case !q.Until.IsZero():
+			k, v = seekBefore(cur, historyKey(q.Until, ""))
+		default:
+			k, v = cur.Last()
+		}
+
+		for ; k != nil; k, v = cur.Prev() {
+			var s Status
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			if !q.Since.IsZero() && s.FinishedAt.Before(q.Since) {
+				return nil
+			}
+			if !q.match(s) {
+				continue
+			}
+			if len(p.Jobs) == q.Limit {
+				p.Next = nextCursor(p.Jobs)
+				return nil
+			}
+			p.Jobs = append(p.Jobs, s)
+		}
+
+		return nil
+	})
+
+	return p, err
+}
+
+// seekBefore positions cursor at the last key less than key.
+func seekBefore(c *bolt.Cursor, key []byte) ([]byte, []byte) {
+	k, _ := c.Seek(key)
+	if k == nil {
+		return c.Last()
+	}
+
+	return c.Prev()
+}
+
+// historyKey orders jobs by finish time and then by id.
+func historyKey(finishedAt time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(finishedAt.UnixNano()))
+
+	return append(key, id...)
+}
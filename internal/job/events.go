@@ -0,0 +1,57 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Event is a job state transition or progress report.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message,omitempty"`
+}
+
+type contextKey struct{}
+
+// Report adds event to the job running with ctx, if any.
+func Report(ctx context.Context, typ, format string, args ...interface{}) {
+	if j, ok := ctx.Value(contextKey{}).(*Job); ok {
+		j.addEvent(typ, fmt.Sprintf(format, args...))
+	}
+}
+
+func (j *Job) addEvent(typ, msg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.addEventLocked(typ, msg)
+}
+
+func (j *Job) addEventLocked(typ, msg string) {
+	j.events = append(j.events, Event{Time: time.Now(), Type: typ, Message: msg})
+
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Events returns events starting from index since and channel closed
+// on the next event. finished is true when no more events will be added.
+func (j *Job) Events(since int) (events []Event, changed <-chan struct{}, finished bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if since < len(j.events) {
+		events = append(events, j.events[since:]...)
+	}
+
+	select {
+	case <-j.done:
+		finished = true
+	default:
+		// queued job has more events to come as well as running one
+	}
+
+	return events, j.changed, finished
+}
@@ -0,0 +1,167 @@
+package job
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of history page size.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// History keeps finished jobs beyond the idempotency key TTL,
+// so runs can be audited after restarts.
+type History interface {
+	// Save stores finished job.
+	Save(ctx context.Context, s Status) error
+	// List returns finished jobs matching q, most recently finished first.
+	List(ctx context.Context, q Query) (Page, error)
+}
+
+// Query selects finished jobs, zero fields don't filter.
+type Query struct {
+	Limit  int
+	Cursor string
+	State  State
+	Since  time.Time
+	Until  time.Time
+	// Kind and Key select jobs started with idempotency key.
+	Kind Kind
+	Key  string
+}
+
+// Page is a part of job history, Next is cursor of the following
+// page and it's empty on the last one.
+type Page struct {
+	Jobs []Status `json:"jobs"`
+	Next string   `json:"nextCursor,omitempty"`
+}
+
+// Cursor is position in history ordered by finish time and job id.
+type Cursor struct {
+	FinishedAt time.Time
+	ID         string
+}
+
+// ParseCursor decodes cursor returned with previous page,
+// empty cursor is the beginning of history.
+func ParseCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	nanos, id, ok := strings.Cut(string(b), ".")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", s)
+	}
+
+	return &Cursor{FinishedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// String encodes cursor for API responses.
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.FinishedAt.UnixNano(), 10) + "." + c.ID))
+}
+
+// after reports whether s is past cursor c in history order.
+func (c *Cursor) after(s Status) bool {
+	if c == nil {
+		return true
+	}
+	if !s.FinishedAt.Equal(c.FinishedAt) {
+		return s.FinishedAt.Before(c.FinishedAt)
+	}
+
+	return s.ID < c.ID
+}
+
+// Validate checks query and sets default page size.
+func (q *Query) Validate() error {
+	switch {
+	case q.Limit == 0:
+		q.Limit = DefaultPageSize
+	case q.Limit < 0 || q.Limit > MaxPageSize:
+		return fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	}
+	switch q.State {
+	case "", StateSucceeded, StateFailed, StateCancelled:
+	default:
+		return fmt.Errorf("unsupported state %q, history has %s, %s and %s jobs only", q.State, StateSucceeded, StateFailed, StateCancelled)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return errors.New("since must be before until")
+	}
+	_, err := ParseCursor(q.Cursor)
+
+	return err
+}
+
+// match reports whether finished job s is selected by q, cursor aside.
+func (q Query) match(s Status) bool {
+	switch {
+	case q.State != "" && s.State != q.State:
+		return false
+	case !q.Since.IsZero() && s.FinishedAt.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !s.FinishedAt.Before(q.Until):
+		return false
+	case q.Kind != "" && s.Kind != q.Kind:
+		return false
+	case q.Key != "" && s.Key != q.Key:
+		return false
+	}
+
+	return true
+}
+
+// page selects page of q from finished jobs.
+func page(jobs []Status, q Query) (Page, error) {
+	c, err := ParseCursor(q.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		if !jobs[i].FinishedAt.Equal(jobs[k].FinishedAt) {
+			return jobs[i].FinishedAt.After(jobs[k].FinishedAt)
+		}
+		return jobs[i].ID > jobs[k].ID
+	})
+
+	p := Page{Jobs: make([]Status, 0)}
+	for _, s := range jobs {
+		if !q.match(s) || !c.after(s) {
+			continue
+		}
+		if len(p.Jobs) == q.Limit {
+			p.Next = nextCursor(p.Jobs)
+			break
+		}
+		p.Jobs = append(p.Jobs, s)
+	}
+
+	return p, nil
+}
+
+// nextCursor returns cursor following the last job of full page.
+func nextCursor(jobs []Status) string {
+	last := jobs[len(jobs)-1]
+
+	return Cursor{FinishedAt: last.FinishedAt, ID: last.ID}.String()
+}
@@ -0,0 +1,640 @@
+package job
+
+import (
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Kind is the kind of work done by a job.
+type Kind string
+
+const (
+	KindExport  Kind = "export"
+	KindRestore Kind = "restore"
+	KindDelta   Kind = "delta"
+	KindVerify  Kind = "verify"
+)
+
+// ErrLimitReached is returned when too many jobs of the kind are queued or running.
+var ErrLimitReached = errors.New("too many jobs are queued or running")
+
+// ErrCancelled fails jobs cancelled with Cancel.
+var ErrCancelled = errors.New("job was cancelled")
+
+// eventCancel is type of event added when job cancellation is requested.
+const eventCancel = "cancel"
+
+// Func is the work done by a job.
+type Func func(ctx context.Context) (*export.ExportOutput, error)
+
+// Job is a single export or restore run.
+type Job struct {
+	ID       string
+	Kind     Kind
+	Key      string
+	Priority Priority
+	// Owner is name of API token job was requested with, if any.
+	Owner string
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	fn     Func
+	index  int
+
+	mu         sync.Mutex
+	state      State
+	queuedAt   time.Time
+	output     *export.ExportOutput
+	err        error
+	startedAt  time.Time
+	finishedAt time.Time
+	progress   Progress
+	events     []Event
+	changed    chan struct{}
+	done       chan struct{}
+}
+
+// Status is a point-in-time copy of job state.
+type Status struct {
+	ID         string
+	Kind       Kind
+	Key        string
+	Priority   Priority
+	Owner      string
+	State      State
+	Output     *export.ExportOutput
+	Err        error
+	QueuedAt   time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Progress   Progress
+}
+
+// statusJSON is status encoding of API responses and job history.
+type statusJSON struct {
+	ID         string     `json:"id"`
+	Kind       Kind       `json:"kind"`
+	Key        string     `json:"idempotencyKey,omitempty"`
+	Priority   string     `json:"priority"`
+	Owner      string     `json:"owner,omitempty"`
+	State      State      `json:"state"`
+	Files      []string   `json:"files,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	ErrorClass string     `json:"errorClass,omitempty"`
+	QueuedAt   time.Time  `json:"queuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Progress   *Progress  `json:"progress,omitempty"`
+
+	// Issues are problems Dgraph reported, e.g. GraphQL errors.
+	Issues []failure.Issue `json:"issues,omitempty"`
+}
+
+// MarshalJSON encodes status for API responses.
+func (s Status) MarshalJSON() ([]byte, error) {
+	v := statusJSON{
+		ID:       s.ID,
+		Kind:     s.Kind,
+		Key:      s.Key,
+		Priority: s.Priority.String(),
+		Owner:    s.Owner,
+		State:    s.State,
+		QueuedAt: s.QueuedAt,
+	}
+
+	if s.Output != nil {
+		v.Files = s.Output.GetFiles()
+	}
+	if s.Err != nil {
+		v.Error = s.Err.Error()
+		v.ErrorClass = string(failure.Of(s.Err))
+		v.Issues = failure.Issues(s.Err)
+	}
+	if !s.StartedAt.IsZero() {
+		v.StartedAt = &s.StartedAt
+	}
+	if !s.FinishedAt.IsZero() {
+		v.FinishedAt = &s.FinishedAt
+	}
+	if s.Progress != (Progress{}) {
+		v.Progress = &s.Progress
+	}
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes status stored in job history, exported files
+// are restored as output and error as its message, class and issues only.
+func (s *Status) UnmarshalJSON(b []byte) error {
+	var v statusJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*s = Status{
+		ID:       v.ID,
+		Kind:     v.Kind,
+		Key:      v.Key,
+		Priority: parsePriority(v.Priority),
+		Owner:    v.Owner,
+		State:    v.State,
+		QueuedAt: v.QueuedAt,
+	}
+	if len(v.Files) > 0 {
+		s.Output = &export.ExportOutput{}
+		for _, file := range v.Files {
+			s.Output.ExportedFiles = append(s.Output.ExportedFiles, graphql.String(file))
+		}
+	}
+	if v.Error != "" {
+		s.Err = failure.WithIssues(failure.New(failure.Class(v.ErrorClass), v.Error), v.Issues)
+	}
+	if v.StartedAt != nil {
+		s.StartedAt = *v.StartedAt
+	}
+	if v.FinishedAt != nil {
+		s.FinishedAt = *v.FinishedAt
+	}
+	if v.Progress != nil {
+		s.Progress = *v.Progress
+	}
+
+	return nil
+}
+
+func (j *Job) run() {
+	j.mu.Lock()
+	j.state = StateRunning
+	j.startedAt = time.Now()
+	j.addEventLocked(string(StateRunning), "")
+	j.mu.Unlock()
+
+	ctx, fn := j.ctx, j.fn
+	j.ctx, j.fn = nil, nil
+
+	var (
+		out *export.ExportOutput
+		err = ctx.Err()
+	)
+	if err == nil {
+		out, err = fn(context.WithValue(ctx, contextKey{}, j))
+	}
+	// work aborted by cancellation may fail with any error
+	if err != nil && errors.Is(context.Cause(ctx), ErrCancelled) && !errors.Is(err, ErrCancelled) {
+		err = fmt.Errorf("%w: %w", ErrCancelled, err)
+	}
+	j.cancel(nil)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.output, j.err = out, err
+	j.finishedAt = time.Now()
+	switch {
+	case errors.Is(err, ErrCancelled):
+		j.state = StateCancelled
+		j.addEventLocked(string(StateCancelled), err.Error())
+	case err != nil:
+		j.state = StateFailed
+		j.addEventLocked(string(StateFailed), err.Error())
+	default:
+		j.state = StateSucceeded
+		j.addEventLocked(string(StateSucceeded), "")
+	}
+	close(j.done)
+}
+
+// Cancel cancels context of queued or running job, its work is expected
+// to abort and the job ends cancelled with error wrapping ErrCancelled.
+// False is returned for finished jobs.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.state != StateQueued && j.state != StateRunning {
+		return false
+	}
+
+	j.addEventLocked(eventCancel, "cancellation requested")
+	j.cancel(ErrCancelled)
+
+	return true
+}
+
+// Done returns channel closed when job is finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait blocks until job is finished or ctx is done.
+func (j *Job) Wait(ctx context.Context) (*export.ExportOutput, error) {
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.output, j.err
+}
+
+func (j *Job) Status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return Status{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Key:        j.Key,
+		Priority:   j.Priority,
+		Owner:      j.Owner,
+		State:      j.state,
+		Output:     j.output,
+		Err:        j.err,
+		QueuedAt:   j.queuedAt,
+		StartedAt:  j.startedAt,
+		FinishedAt: j.finishedAt,
+		Progress:   j.progress,
+	}
+}
+
+func (j *Job) finishedBefore(t time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return !j.finishedAt.IsZero() && j.finishedAt.Before(t)
+}
+
+// Manager runs jobs one at a time in priority order and remembers them
+// for keyTTL after they finish, so requests retried with the same
+// idempotency key get the same job. Jobs finished before restart or on
+// another leader are found by their key in history when it's set. Restores are run one at a time by
+// their own worker, so hours long restore doesn't hold scheduled exports.
+type Manager struct {
+	keyTTL  time.Duration
+	history History
+	hook    RunHook
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	keys    map[jobKey]*Job
+	queues  map[Kind]*queue
+	working map[Kind]bool
+}
+
+func NewManager(keyTTL time.Duration, opts ...Option) *Manager {
+	m := &Manager{
+		keyTTL:  keyTTL,
+		jobs:    make(map[string]*Job),
+		keys:    make(map[jobKey]*Job),
+		queues:  map[Kind]*queue{KindExport: {}, KindRestore: {}},
+		working: make(map[Kind]bool),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+type Option func(*Manager)
+
+// WithHistory makes manager save finished jobs to h.
+func WithHistory(h History) Option {
+	return func(m *Manager) {
+		m.history = h
+	}
+}
+
+// RunHook is called before job of kind runs, returned func is called
+// after it finishes.
+type RunHook func(kind Kind) (done func())
+
+// WithRunHook makes manager call hook around every job it runs.
+func WithRunHook(hook RunHook) Option {
+	return func(m *Manager) {
+		m.hook = hook
+	}
+}
+
+// Start queues fn as new job. If key is not empty and job of the same kind
+// and key is queued, running or finished less than keyTTL ago, that job is
+// returned instead and created is false.
+func (m *Manager) Start(ctx context.Context, kind Kind, key string, prio Priority, fn Func) (j *Job, created bool) {
+	j, created, _ = m.StartWithin(ctx, kind, key, prio, 0, fn)
+
+	return j, created
+}
+
+// StartWithin is like Start, but fails with ErrLimitReached when limit jobs
+// of kind are queued or running already. Job with the same key is returned
+// regardless of limit. Zero limit means no limit.
+func (m *Manager) StartWithin(ctx context.Context, kind Kind, key string, prio Priority, limit int, fn Func) (j *Job, created bool, err error) {
+	var saved *Status
+	if key != "" && m.history != nil && !m.known(kind, key) {
+		saved = m.saved(ctx, kind, key)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+
+	if key != "" {
+		if j, ok := m.keys[jobKey{kind, key}]; ok {
+			return j, false, nil
+		}
+		if saved != nil {
+			j = restored(*saved)
+			m.jobs[j.ID] = j
+			m.keys[jobKey{kind, key}] = j
+			return j, false, nil
+		}
+	}
+
+	if limit > 0 && m.active(kind) >= limit {
+		return nil, false, ErrLimitReached
+	}
+
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	ctx, cancel := context.WithCancelCause(ctx)
+	j = &Job{
+		ID:       newID(),
+		Kind:     kind,
+		Key:      key,
+		Priority: prio,
+		Owner:    owner,
+		ctx:      ctx,
+		cancel:   cancel,
+		fn:       fn,
+		state:    StateQueued,
+		queuedAt: time.Now(),
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	j.addEventLocked(string(StateQueued), prio.String())
+	m.jobs[j.ID] = j
+	if key != "" {
+		m.keys[jobKey{kind, key}] = j
+	}
+
+	l := lane(kind)
+	heap.Push(m.queues[l], j)
+	metrics.JobQueueDepth.Set(float64(m.queued()))
+	if !m.working[l] {
+		m.working[l] = true
+		go m.work(l)
+	}
+
+	return j, true, nil
+}
+
+// known reports whether job of kind with key is remembered.
+func (m *Manager) known(kind Kind, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	_, ok := m.keys[jobKey{kind, key}]
+
+	return ok
+}
+
+// saved returns job of kind with key finished less than keyTTL ago
+// from history, failure to read it is only logged.
+func (m *Manager) saved(ctx context.Context, kind Kind, key string) *Status {
+	ctx, cancel := context.WithTimeout(ctx, historyTimeout)
+	defer cancel()
+
+	page, err := m.history.List(ctx, Query{
+		Limit: 1,
+		Since: time.Now().Add(-m.keyTTL),
+		Kind:  kind,
+		Key:   key,
+	})
+	if err != nil {
+		klog.Errorf("failed to look up job with idempotency key %q in history: %v", key, err)
+		return nil
+	}
+	if len(page.Jobs) == 0 {
+		return nil
+	}
+
+	return &page.Jobs[0]
+}
+
+// restored returns finished job with status s read from history.
+func restored(s Status) *Job {
+	j := &Job{
+		ID:         s.ID,
+		Kind:       s.Kind,
+		Key:        s.Key,
+		Priority:   s.Priority,
+		Owner:      s.Owner,
+		state:      s.State,
+		queuedAt:   s.QueuedAt,
+		output:     s.Output,
+		err:        s.Err,
+		startedAt:  s.StartedAt,
+		finishedAt: s.FinishedAt,
+		progress:   s.Progress,
+		changed:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	close(j.done)
+
+	return j
+}
+
+// jobKey is idempotency key of job kind, requests of other kinds
+// reusing it, e.g. restore with key of export, aren't served by it.
+type jobKey struct {
+	kind Kind
+	key  string
+}
+
+type ownerKey struct{}
+
+// WithOwner returns context jobs started with get owner set.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// active returns number of queued or running jobs of kind.
+func (m *Manager) active(kind Kind) int {
+	n := 0
+	for _, j := range m.jobs {
+		if j.Kind != kind {
+			continue
+		}
+		j.mu.Lock()
+		if j.state == StateQueued || j.state == StateRunning {
+			n++
+		}
+		j.mu.Unlock()
+	}
+
+	return n
+}
+
+// lane returns kind of worker running jobs of kind, restores have their
+// own one and the rest share the other.
+func lane(kind Kind) Kind {
+	if kind == KindRestore {
+		return KindRestore
+	}
+
+	return KindExport
+}
+
+// queued returns number of jobs waiting to run, m.mu must be held.
+func (m *Manager) queued() int {
+	n := 0
+	for _, q := range m.queues {
+		n += q.Len()
+	}
+
+	return n
+}
+
+// work runs queued jobs of lane l until its queue is empty.
+func (m *Manager) work(l Kind) {
+	for {
+		m.mu.Lock()
+		q := m.queues[l]
+		if q.Len() == 0 {
+			m.working[l] = false
+			m.mu.Unlock()
+			return
+		}
+		j := heap.Pop(q).(*Job)
+		metrics.JobQueueDepth.Set(float64(m.queued()))
+		m.mu.Unlock()
+
+		done := func() {}
+		if m.hook != nil {
+			done = m.hook(j.Kind)
+		}
+		j.run()
+		done()
+		m.save(j)
+	}
+}
+
+// historyTimeout limits saving of a single job to history.
+const historyTimeout = 30 * time.Second
+
+// save stores finished job in history, failure doesn't affect the job.
+func (m *Manager) save(j *Job) {
+	if m.history == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), historyTimeout)
+	defer cancel()
+
+	if err := m.history.Save(ctx, j.Status()); err != nil {
+		klog.Errorf("failed to save job %s to history: %v", j.ID, err)
+	}
+}
+
+// History returns page of finished jobs, from history when it's set
+// or from jobs remembered for keyTTL otherwise.
+func (m *Manager) History(ctx context.Context, q Query) (Page, error) {
+	if err := q.Validate(); err != nil {
+		return Page{}, err
+	}
+	if m.history != nil {
+		return m.history.List(ctx, q)
+	}
+
+	var finished []Status
+	for _, j := range m.List() {
+		if s := j.Status(); s.State == StateSucceeded || s.State == StateFailed || s.State == StateCancelled {
+			finished = append(finished, s)
+		}
+	}
+
+	return page(finished, q)
+}
+
+// QueueDepth returns number of jobs waiting to run.
+func (m *Manager) QueueDepth() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.queued()
+}
+
+// Get returns job by id.
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+
+	return j, ok
+}
+
+// List returns known jobs, most recently queued first.
+func (m *Manager) List() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].queuedAt.After(jobs[k].queuedAt)
+	})
+
+	return jobs
+}
+
+// expire forgets jobs finished more than keyTTL ago.
+func (m *Manager) expire() {
+	deadline := time.Now().Add(-m.keyTTL)
+	for id, j := range m.jobs {
+		if j.finishedBefore(deadline) {
+			delete(m.jobs, id)
+			if j.Key != "" {
+				delete(m.keys, jobKey{j.Kind, j.Key})
+			}
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hasura/go-graphql-client"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/export"
+)
+
+func TestStartWithinHistory(t *testing.T) {
+	ctx := context.Background()
+	h, err := OpenBoltHistory(filepath.Join(t.TempDir(), "jobs.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	runs := 0
+	fn := func(context.Context) (*export.ExportOutput, error) {
+		runs++
+		return &export.ExportOutput{ExportedFiles: []graphql.String{"dgraph.r1/g01.rdf.gz"}}, nil
+	}
+
+	m := NewManager(time.Hour, WithHistory(h))
+	first, created := m.Start(ctx, KindExport, "key", PriorityManual, fn)
+	if !created {
+		t.Fatal("first job with key isn't created")
+	}
+	if _, err := first.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// job is saved to history after it's finished
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		page, err := h.List(ctx, Query{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Jobs) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job isn't saved to history")
+		}
+	}
+
+	// manager of restarted instance sees the same history
+	m = NewManager(time.Hour, WithHistory(h))
+	j, created := m.Start(ctx, KindExport, "key", PriorityManual, fn)
+	if created || j.ID != first.ID {
+		t.Fatalf("Start() after restart = %s, created: %t, want job %s from history", j.ID, created, first.ID)
+	}
+	out, err := j.Wait(ctx)
+	if err != nil || len(out.GetFiles()) != 1 || j.Status().State != StateSucceeded {
+		t.Errorf("job from history = %v, %v in state %s", out, err, j.Status().State)
+	}
+	if got, ok := m.Get(first.ID); !ok || got != j {
+		t.Error("job from history isn't remembered")
+	}
+
+	j, created = m.Start(ctx, KindRestore, "key", PriorityManual, fn)
+	if !created {
+		t.Errorf("restore with key of export got job %s", j.ID)
+	}
+	if _, err := j.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m = NewManager(time.Nanosecond, WithHistory(h))
+	j, created = m.Start(ctx, KindExport, "key", PriorityManual, fn)
+	if !created {
+		t.Errorf("job %s finished before key TTL is returned", j.ID)
+	}
+	if _, err := j.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 3 {
+		t.Errorf("%d jobs are run, want 3", runs)
+	}
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Progress is amount of data written by running export so far,
+// or N-Quads loaded by running restore.
+type Progress struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+
+	// NQuads are N-Quads restored of TotalNQuads, Percent is their
+	// ratio and RemainingSeconds is estimated from restore rate.
+	NQuads           int64   `json:"nquads,omitempty"`
+	TotalNQuads      int64   `json:"totalNquads,omitempty"`
+	Percent          float64 `json:"percent,omitempty"`
+	RemainingSeconds int64   `json:"remainingSeconds,omitempty"`
+}
+
+func (p Progress) String() string {
+	switch {
+	case p.NQuads > 0 && p.TotalNQuads == 0:
+		return fmt.Sprintf("%d N-Quads restored", p.NQuads)
+	case p.TotalNQuads == 0:
+		return fmt.Sprintf("%d files, %d bytes written", p.Files, p.Bytes)
+	}
+
+	return fmt.Sprintf("%d of %d N-Quads restored (%.1f%%), %s left",
+		p.NQuads, p.TotalNQuads, p.Percent, time.Duration(p.RemainingSeconds)*time.Second)
+}
+
+// SetProgress updates progress of the job running with ctx, if any,
+// and adds progress event when it changes.
+func SetProgress(ctx context.Context, p Progress) {
+	j, ok := ctx.Value(contextKey{}).(*Job)
+	if !ok {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.progress == p {
+		return
+	}
+	j.progress = p
+	j.addEventLocked("progress", p.String())
+}
@@ -0,0 +1,72 @@
+package job
+
+// Priority defines order of queued jobs, higher runs first.
+type Priority int
+
+const (
+	PriorityVerify Priority = iota
+	PriorityScheduled
+	PriorityManual
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityVerify:
+		return "verify"
+	case PriorityScheduled:
+		return "scheduled"
+	case PriorityManual:
+		return "manual"
+	default:
+		return "unknown"
+	}
+}
+
+func parsePriority(s string) Priority {
+	switch s {
+	case "scheduled":
+		return PriorityScheduled
+	case "manual":
+		return PriorityManual
+	default:
+		return PriorityVerify
+	}
+}
+
+// queue implements heap.Interface ordering jobs by priority and then by queue time.
+type queue []*Job
+
+func (q queue) Len() int {
+	return len(q)
+}
+
+func (q queue) Less(i, k int) bool {
+	if q[i].Priority != q[k].Priority {
+		return q[i].Priority > q[k].Priority
+	}
+
+	return q[i].queuedAt.Before(q[k].queuedAt)
+}
+
+func (q queue) Swap(i, k int) {
+	q[i], q[k] = q[k], q[i]
+	q[i].index = i
+	q[k].index = k
+}
+
+func (q *queue) Push(x interface{}) {
+	j := x.(*Job)
+	j.index = len(*q)
+	*q = append(*q, j)
+}
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*q = old[:n-1]
+
+	return j
+}
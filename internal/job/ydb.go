@@ -0,0 +1,180 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ydbschema"
+)
+
+// YDBHistory keeps finished jobs in YDB table, jobs finished more
+// than ttl ago are deleted when new ones are saved.
+type YDBHistory struct {
+	db    *ydb.Driver
+	table string
+	ttl   time.Duration
+}
+
+func NewYDBHistory(db *ydb.Driver, table string, ttl time.Duration) *YDBHistory {
+	return &YDBHistory{
+		db:    db,
+		table: table,
+		ttl:   ttl,
+	}
+}
+
+func (h *YDBHistory) Save(ctx context.Context, s Status) error {
+	// YDB timestamps have microsecond precision, cursors must match stored ones
+	s.FinishedAt = s.FinishedAt.Truncate(time.Microsecond)
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return h.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, h.db.Name())
+		query += "DECLARE $finished_at AS Timestamp;"
+		query += "DECLARE $id AS Utf8;"
+		query += "DECLARE $state AS Utf8;"
+		query += "DECLARE $value AS Json;"
+		query += "DECLARE $expire AS Timestamp;"
+		query += fmt.Sprintf("UPSERT INTO %s (finished_at, id, state, value) VALUES ($finished_at, $id, $state, $value);", h.table)
+		if h.ttl > 0 {
+			query += fmt.Sprintf("DELETE FROM %s WHERE finished_at < $expire;", h.table)
+		}
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+			table.ValueParam("$finished_at", types.TimestampValueFromTime(s.FinishedAt)),
+			table.ValueParam("$id", types.TextValue(s.ID)),
+			table.ValueParam("$state", types.TextValue(string(s.State))),
+			table.ValueParam("$value", types.JSONValueFromBytes(b)),
+			table.ValueParam("$expire", types.TimestampValueFromTime(time.Now().Add(-h.ttl))),
+		))
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		return res.Close()
+	}, table.WithIdempotent())
+}
+
+func (h *YDBHistory) List(ctx context.Context, q Query) (Page, error) {
+	c, err := ParseCursor(q.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, h.db.Name())
+	query += "DECLARE $state AS Utf8;"
+	query += "DECLARE $since AS Timestamp;"
+	query += "DECLARE $until AS Timestamp;"
+	query += "DECLARE $cursor_at AS Timestamp;"
+	query += "DECLARE $cursor_id AS Utf8;"
+	query += "DECLARE $kind AS Utf8;"
+	query += "DECLARE $key AS Utf8;"
+	query += "DECLARE $limit AS Uint64;"
+	query += fmt.Sprintf("SELECT value FROM %s WHERE finished_at >= $since AND finished_at < $until", h.table)
+	if q.State != "" {
+		query += " AND state = $state"
+	}
+	if q.Kind != "" {
+		query += ` AND JSON_VALUE(value, "$.kind") = $kind`
+	}
+	if q.Key != "" {
+		query += ` AND JSON_VALUE(value, "$.idempotencyKey") = $key`
+	}
+	if c != nil {
+		query += " AND (finished_at < $cursor_at OR (finished_at = $cursor_at AND id < $cursor_id))"
+	}
+	// one more row tells whether there is the next page
+	query += " ORDER BY finished_at DESC, id DESC LIMIT $limit;"
+
+	// timestamps before unix epoch can't be stored in YDB
+	since, until := q.Since, q.Until
+	if since.IsZero() {
+		since = time.Unix(0, 0)
+	}
+	if until.IsZero() {
+		until = time.Now().Add(time.Hour)
+	}
+	cursor := Cursor{FinishedAt: time.Unix(0, 0)}
+	if c != nil {
+		cursor = *c
+	}
+
+	var jobs []Status
+	err = h.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		jobs = nil
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+			table.ValueParam("$state", types.TextValue(string(q.State))),
+			table.ValueParam("$since", types.TimestampValueFromTime(since)),
+			table.ValueParam("$until", types.TimestampValueFromTime(until)),
+			table.ValueParam("$cursor_at", types.TimestampValueFromTime(cursor.FinishedAt)),
+			table.ValueParam("$cursor_id", types.TextValue(cursor.ID)),
+			table.ValueParam("$kind", types.TextValue(string(q.Kind))),
+			table.ValueParam("$key", types.TextValue(q.Key)),
+			table.ValueParam("$limit", types.Uint64Value(uint64(q.Limit)+1)),
+		))
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		defer res.Close()
+
+		for res.NextResultSet(ctx) {
+			for res.NextRow() {
+				var value string
+				if err := res.ScanNamed(named.OptionalWithDefault("value", &value)); err != nil {
+					return err
+				}
+
+				var s Status
+				if err := json.Unmarshal([]byte(value), &s); err != nil {
+					return err
+				}
+				jobs = append(jobs, s)
+			}
+		}
+
+		return res.Err()
+	}, table.WithIdempotent())
+	if err != nil {
+		return Page{}, err
+	}
+
+	p := Page{Jobs: make([]Status, 0, len(jobs))}
+	if len(jobs) > q.Limit {
+		jobs = jobs[:q.Limit]
+		p.Next = nextCursor(jobs)
+	}
+	p.Jobs = append(p.Jobs, jobs...)
+
+	return p, nil
+}
+
+// HistoryTable returns structure of job history table, ordered
+// by finish time so history is read from the latest jobs.
+func HistoryTable(name string) ydbschema.Table {
+	return ydbschema.Table{
+		Name: name,
+		Columns: []options.Column{
+			{Name: "finished_at", Type: types.TypeTimestamp},
+			{Name: "id", Type: types.TypeUTF8},
+			{Name: "state", Type: types.Optional(types.TypeUTF8)},
+			{Name: "value", Type: types.Optional(types.TypeJSON)},
+		},
+		PrimaryKey: []string{"finished_at", "id"},
+	}
+}
@@ -0,0 +1,187 @@
+package lease
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+// FileLock is leader election lock keeping record in a file, for replicas
+// running on one host or sharing POSIX filesystem with working flock.
+// Record changes are serialized with flock of a sibling ".lock" file.
+type FileLock struct {
+	path     string
+	identity string
+
+	mu sync.Mutex
+	// raw is record read last, update fails when file has changed since
+	raw []byte
+}
+
+func NewFileLock(path, identity string) *FileLock {
+	return &FileLock{
+		path:     path,
+		identity: identity,
+	}
+}
+
+func (l *FileLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	klog.V(3).Infof("get leaderelection record %s", l.path)
+
+	var b []byte
+	err := withFlock(l.path, func() (err error) {
+		b, err = os.ReadFile(l.path)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{}, l.path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ler resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal(b, &ler); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.raw = b
+	l.mu.Unlock()
+
+	return &ler, b, nil
+}
+
+func (l *FileLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	klog.V(2).Infof("create leaderelection record %s", l.path)
+
+	return l.write(ler, func(current []byte, err error) error {
+		if err == nil {
+			return apierrors.NewAlreadyExists(schema.GroupResource{}, l.path)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (l *FileLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	klog.V(2).Infof("update leaderelection record %s", l.path)
+
+	l.mu.Lock()
+	observed := l.raw
+	l.mu.Unlock()
+
+	return l.write(ler, func(current []byte, err error) error {
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, observed) {
+			return apierrors.NewConflict(schema.GroupResource{}, l.path, errors.New("record has changed since it was read"))
+		}
+		return nil
+	})
+}
+
+// write replaces record under flock if check of current file content passes.
+func (l *FileLock) write(ler resourcelock.LeaderElectionRecord, check func(current []byte, err error) error) error {
+	b, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	err = withFlock(l.path, func() error {
+		if err := check(os.ReadFile(l.path)); err != nil {
+			return err
+		}
+
+		return writeFile(l.path, b)
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.raw = b
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *FileLock) RecordEvent(event string) {
+	klog.Infof("leaderelection event %s: %s", l.path, event)
+}
+
+func (l *FileLock) Identity() string {
+	return l.identity
+}
+
+func (l *FileLock) Describe() string {
+	return l.path
+}
+
+// FileStore keeps holder metadata in a file next to the lock record.
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Put(ctx context.Context, h Holder) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(s.path, b)
+}
+
+func (s *FileStore) Get(ctx context.Context) (*Holder, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var h Holder
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	return &h, nil
+}
+
+// writeFile replaces file atomically, so readers never see partial content.
+func writeFile(name string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-"+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
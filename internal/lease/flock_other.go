@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package lease
+
+import "errors"
+
+func withFlock(path string, fn func() error) error {
+	return errors.New("file lock is not supported on this platform")
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package lease
+
+import (
+	"os"
+	"syscall"
+)
+
+// withFlock runs fn holding exclusive flock of path with ".lock" suffix,
+// flock is released when file is closed.
+func withFlock(path string, fn func() error) error {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	return fn()
+}
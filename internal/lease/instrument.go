@@ -0,0 +1,88 @@
+package lease
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+const (
+	opGet     = "get"
+	opAcquire = "acquire"
+	opRenew   = "renew"
+	opRelease = "release"
+)
+
+// Instrument wraps lock to record latency and errors of its operations.
+// Updates are told apart by holder of record read last: lock held by this
+// replica is renewed, any other one is acquired.
+func Instrument(lock resourcelock.Interface) resourcelock.Interface {
+	return &instrumentedLock{Interface: lock}
+}
+
+type instrumentedLock struct {
+	resourcelock.Interface
+
+	mu     sync.Mutex
+	holder string
+}
+
+func (l *instrumentedLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	defer observe(opGet, time.Now())
+
+	ler, b, err := l.Interface.Get(ctx)
+	switch {
+	case apierrors.IsNotFound(err):
+		// missing record is created by caller, that's not a failure
+	case err != nil:
+		metrics.LeaseOperationErrors.WithLabelValues(opGet).Inc()
+	default:
+		l.mu.Lock()
+		l.holder = ler.HolderIdentity
+		l.mu.Unlock()
+	}
+
+	return ler, b, err
+}
+
+func (l *instrumentedLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	return l.do(opAcquire, func() error {
+		return l.Interface.Create(ctx, ler)
+	})
+}
+
+func (l *instrumentedLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	l.mu.Lock()
+	op := opAcquire
+	switch {
+	case ler.HolderIdentity == "":
+		op = opRelease
+	case l.holder == ler.HolderIdentity:
+		op = opRenew
+	}
+	l.mu.Unlock()
+
+	return l.do(op, func() error {
+		return l.Interface.Update(ctx, ler)
+	})
+}
+
+func (l *instrumentedLock) do(op string, fn func() error) error {
+	defer observe(op, time.Now())
+
+	err := fn()
+	if err != nil {
+		metrics.LeaseOperationErrors.WithLabelValues(op).Inc()
+	}
+
+	return err
+}
+
+func observe(op string, start time.Time) {
+	metrics.LeaseOperationDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
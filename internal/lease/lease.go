@@ -0,0 +1,28 @@
+// Package lease stores metadata of leader election lease holder next to
+// the lease record, so it's visible which replica owns backups.
+package lease
+
+import (
+	"context"
+	"time"
+)
+
+// Holder describes replica holding the lease.
+type Holder struct {
+	Identity  string    `json:"identity"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Node      string    `json:"node,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Store keeps metadata of the last replica started leading.
+type Store interface {
+	// Put replaces holder metadata, it's called by replica started leading.
+	Put(ctx context.Context, h Holder) error
+	// Get returns holder metadata, nil when no replica has written it yet.
+	Get(ctx context.Context) (*Holder, error)
+}
@@ -0,0 +1,173 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+// updateScript replaces record only when it's still the one read last.
+var updateScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// RedisLock is leader election lock keeping record in Redis key, standalone,
+// sentinel and cluster setups are supported with universal client.
+// Record expires after ttl, so lease of crashed leader is dropped by Redis
+// itself; ttl is expected to be at least lease duration.
+type RedisLock struct {
+	client   redis.UniversalClient
+	key      string
+	ttl      time.Duration
+	identity string
+
+	mu sync.Mutex
+	// raw is record read last, update fails when key has changed since
+	raw []byte
+}
+
+func NewRedisLock(client redis.UniversalClient, key string, ttl time.Duration, identity string) *RedisLock {
+	return &RedisLock{
+		client:   client,
+		key:      key,
+		ttl:      ttl,
+		identity: identity,
+	}
+}
+
+func (l *RedisLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	klog.V(3).Infof("get leaderelection record %s", l.key)
+
+	b, err := l.client.Get(ctx, l.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{}, l.key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ler resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal(b, &ler); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", l.key, err)
+	}
+
+	l.setRaw(b)
+
+	return &ler, b, nil
+}
+
+func (l *RedisLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	klog.V(2).Infof("create leaderelection record %s", l.key)
+
+	b, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	ok, err := l.client.SetNX(ctx, l.key, b, l.ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apierrors.NewAlreadyExists(schema.GroupResource{}, l.key)
+	}
+
+	l.setRaw(b)
+
+	return nil
+}
+
+func (l *RedisLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	klog.V(2).Infof("update leaderelection record %s", l.key)
+
+	b, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	observed := l.raw
+	l.mu.Unlock()
+
+	n, err := updateScript.Run(ctx, l.client, []string{l.key}, observed, b, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return apierrors.NewConflict(schema.GroupResource{}, l.key, errors.New("record has changed since it was read"))
+	}
+
+	l.setRaw(b)
+
+	return nil
+}
+
+func (l *RedisLock) setRaw(b []byte) {
+	l.mu.Lock()
+	l.raw = b
+	l.mu.Unlock()
+}
+
+func (l *RedisLock) RecordEvent(event string) {
+	klog.Infof("leaderelection event %s: %s", l.key, event)
+}
+
+func (l *RedisLock) Identity() string {
+	return l.identity
+}
+
+func (l *RedisLock) Describe() string {
+	return l.key
+}
+
+// RedisStore keeps holder metadata in Redis key next to the lock record.
+type RedisStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+func NewRedisStore(client redis.UniversalClient, key string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		key:    key,
+	}
+}
+
+func (s *RedisStore) Put(ctx context.Context, h Holder) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.key, b, 0).Err()
+}
+
+func (s *RedisStore) Get(ctx context.Context) (*Holder, error) {
+	b, err := s.client.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var h Holder
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.key, err)
+	}
+
+	return &h, nil
+}
@@ -0,0 +1,319 @@
+package lease
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+// Dialect is SQL database flavour of SQLLock.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+)
+
+// SQLLock is leader election lock keeping record in a table of PostgreSQL
+// or MySQL database. Record changes are serialized with advisory lock
+// named after the record and fail with conflict when record has changed
+// since it was read.
+type SQLLock struct {
+	db       *sql.DB
+	dialect  Dialect
+	table    string
+	name     string
+	identity string
+
+	mu sync.Mutex
+	// raw is record read last
+	raw []byte
+}
+
+func NewSQLLock(db *sql.DB, dialect Dialect, table, name, identity string) *SQLLock {
+	return &SQLLock{
+		db:       db,
+		dialect:  dialect,
+		table:    table,
+		name:     name,
+		identity: identity,
+	}
+}
+
+// CreateTable creates lease table unless it exists.
+func (l *SQLLock) CreateTable(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (name VARCHAR(255) PRIMARY KEY, value TEXT NOT NULL)", l.table))
+
+	return err
+}
+
+func (l *SQLLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	klog.V(3).Infof("get leaderelection record %s/%s", l.table, l.name)
+
+	b, err := getValue(ctx, l.db, l.dialect, l.table, l.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{}, l.name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ler resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal(b, &ler); err != nil {
+		return nil, nil, fmt.Errorf("%s/%s: %w", l.table, l.name, err)
+	}
+
+	l.mu.Lock()
+	l.raw = b
+	l.mu.Unlock()
+
+	return &ler, b, nil
+}
+
+func (l *SQLLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	klog.V(2).Infof("create leaderelection record %s/%s", l.table, l.name)
+
+	return l.write(ctx, ler, func(conn *sql.Conn, b []byte) error {
+		_, err := getValue(ctx, conn, l.dialect, l.table, l.name)
+		if err == nil {
+			return apierrors.NewAlreadyExists(schema.GroupResource{}, l.name)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		_, err = conn.ExecContext(ctx, l.query("INSERT INTO %s (name, value) VALUES (?, ?)"), l.name, string(b))
+		return err
+	})
+}
+
+func (l *SQLLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	klog.V(2).Infof("update leaderelection record %s/%s", l.table, l.name)
+
+	l.mu.Lock()
+	observed := l.raw
+	l.mu.Unlock()
+
+	return l.write(ctx, ler, func(conn *sql.Conn, b []byte) error {
+		current, err := getValue(ctx, conn, l.dialect, l.table, l.name)
+		if err != nil {
+			return err
+		}
+		if string(current) != string(observed) {
+			return apierrors.NewConflict(schema.GroupResource{}, l.name, errors.New("record has changed since it was read"))
+		}
+
+		_, err = conn.ExecContext(ctx, l.query("UPDATE %s SET value = ? WHERE name = ?"), string(b), l.name)
+		return err
+	})
+}
+
+// write runs fn with marshalled record holding advisory lock of the record,
+// lock is session level, so single connection is used for all statements.
+func (l *SQLLock) write(ctx context.Context, ler resourcelock.LeaderElectionRecord, fn func(conn *sql.Conn, b []byte) error) error {
+	b, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := l.lock(ctx, conn); err != nil {
+		return fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	defer func() {
+		// context may be done already, lock must be released anyway
+		if err := l.unlock(context.Background(), conn); err != nil {
+			klog.Warningf("failed to release advisory lock: %v", err)
+		}
+	}()
+
+	if err := fn(conn, b); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.raw = b
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *SQLLock) lock(ctx context.Context, conn *sql.Conn) error {
+	switch l.dialect {
+	case MySQL:
+		var ok sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", l.lockName(), 10).Scan(&ok); err != nil {
+			return err
+		}
+		if ok.Int64 != 1 {
+			return errors.New("timed out")
+		}
+		return nil
+	default:
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", l.lockKey())
+		return err
+	}
+}
+
+func (l *SQLLock) unlock(ctx context.Context, conn *sql.Conn) error {
+	var err error
+	switch l.dialect {
+	case MySQL:
+		_, err = conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.lockName())
+	default:
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.lockKey())
+	}
+
+	return err
+}
+
+// lockName is MySQL lock name, it's limited to 64 characters.
+func (l *SQLLock) lockName() string {
+	name := path.Join(l.table, l.name)
+	if len(name) > 64 {
+		return fmt.Sprintf("%x", l.lockKey())
+	}
+
+	return name
+}
+
+// lockKey is PostgreSQL advisory lock key.
+func (l *SQLLock) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(path.Join(l.table, l.name)))
+
+	return int64(h.Sum64())
+}
+
+func (l *SQLLock) query(format string) string {
+	return placeholders(l.dialect, fmt.Sprintf(format, l.table))
+}
+
+func (l *SQLLock) RecordEvent(event string) {
+	klog.Infof("leaderelection event %s/%s: %s", l.table, l.name, event)
+}
+
+func (l *SQLLock) Identity() string {
+	return l.identity
+}
+
+func (l *SQLLock) Describe() string {
+	return fmt.Sprintf("%s/%s", l.table, l.name)
+}
+
+// SQLStore keeps holder metadata in the lease table,
+// in a row named after the lease with "/holder" suffix.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	name    string
+}
+
+func NewSQLStore(db *sql.DB, dialect Dialect, table, lease string) *SQLStore {
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+		name:    path.Join(lease, "holder"),
+	}
+}
+
+func (s *SQLStore) Put(ctx context.Context, h Holder) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := placeholders(s.dialect, fmt.Sprintf("UPDATE %s SET value = ? WHERE name = ?", s.table))
+	res, err := tx.ExecContext(ctx, query, string(b), s.name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		query := placeholders(s.dialect, fmt.Sprintf("INSERT INTO %s (name, value) VALUES (?, ?)", s.table))
+		if _, err := tx.ExecContext(ctx, query, s.name, string(b)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) Get(ctx context.Context) (*Holder, error) {
+	b, err := getValue(ctx, s.db, s.dialect, s.table, s.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var h Holder
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getValue(ctx context.Context, q queryer, dialect Dialect, table, name string) ([]byte, error) {
+	var value string
+	query := placeholders(dialect, fmt.Sprintf("SELECT value FROM %s WHERE name = ?", table))
+	if err := q.QueryRowContext(ctx, query, name).Scan(&value); err != nil {
+		return nil, err
+	}
+
+	return []byte(value), nil
+}
+
+// placeholders replaces ? with $N placeholders of PostgreSQL.
+func placeholders(dialect Dialect, query string) string {
+	if dialect != Postgres {
+		return query
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "$%d", n)
+	}
+
+	return b.String()
+}
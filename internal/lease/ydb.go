@@ -0,0 +1,109 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/ydbschema"
+)
+
+// YDBStore keeps holder metadata in the lease table,
+// in a row named after the lease with "/holder" suffix.
+type YDBStore struct {
+	db    *ydb.Driver
+	table string
+	name  string
+}
+
+func NewYDBStore(db *ydb.Driver, table, lease string) *YDBStore {
+	return &YDBStore{
+		db:    db,
+		table: table,
+		name:  path.Join(lease, "holder"),
+	}
+}
+
+func (s *YDBStore) Put(ctx context.Context, h Holder) error {
+	klog.V(2).Infof("update lease holder record %s/%s", s.table, s.name)
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, s.db.Name())
+		query += "DECLARE $name AS String;"
+		query += "DECLARE $value AS Json;"
+		query += fmt.Sprintf("UPSERT INTO %s (name, value) VALUES ($name, $value);", s.table)
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+			table.ValueParam("$name", types.StringValueFromString(s.name)),
+			table.ValueParam("$value", types.JSONValueFromBytes(b)),
+		))
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		return res.Close()
+	}, table.WithIdempotent())
+}
+
+func (s *YDBStore) Get(ctx context.Context) (*Holder, error) {
+	var value *string
+	err := s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		query := fmt.Sprintf(`PRAGMA TablePathPrefix("%s");`, s.db.Name())
+		query += "DECLARE $name AS String;"
+		query += fmt.Sprintf("SELECT value FROM %s WHERE name = $name;", s.table)
+		res, err := tx.Execute(ctx, query, table.NewQueryParameters(
+			table.ValueParam("$name", types.StringValueFromString(s.name)),
+		))
+		if err != nil {
+			return err
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		defer res.Close()
+
+		for res.NextResultSet(ctx) {
+			for res.NextRow() {
+				return res.Scan(&value)
+			}
+		}
+
+		return res.Err()
+	}, table.WithIdempotent())
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var h Holder
+	if err := json.Unmarshal([]byte(*value), &h); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// Table returns structure of lease table, it's shared by lease records
+// and holder metadata.
+func Table(name string) ydbschema.Table {
+	return ydbschema.Table{
+		Name: name,
+		Columns: []options.Column{
+			{Name: "name", Type: types.TypeString},
+			{Name: "value", Type: types.Optional(types.TypeJSON)},
+		},
+		PrimaryKey: []string{"name"},
+	}
+}
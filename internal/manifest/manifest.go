@@ -0,0 +1,202 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/acl"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/schema"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/podinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/signing"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// Name of the manifest file written next to exported files.
+const Name = "export-manifest.json"
+
+// SignatureName is the name of detached manifest signature.
+const SignatureName = "export-manifest.sig"
+
+// GraphQLSchemaName is the name of GraphQL schema file captured with
+// getGQLSchema and written next to exported files.
+const GraphQLSchemaName = "graphql-schema.graphql"
+
+// ErrUnsigned is returned by Verify for manifests without signature.
+var ErrUnsigned = errors.New("manifest is not signed")
+
+// Manifest describes single export.
+type Manifest struct {
+	CreatedAt   time.Time `json:"createdAt"`
+	Destination string    `json:"destination"`
+	Format      string    `json:"format"`
+	Files       []string  `json:"files"`
+	Cluster     Cluster   `json:"cluster"`
+
+	// Namespace is Dgraph namespace exported, negative for all of them.
+	// It's nil for older manifests and differential exports.
+	Namespace *int64 `json:"namespace,omitempty"`
+
+	// Sizes are sizes of files at the time export was finished,
+	// so truncated files are noticed. It's empty for older manifests.
+	Sizes map[string]int64 `json:"sizes,omitempty"`
+
+	// Checksums are checksums of files, e.g. sha256:<hex>,
+	// it's empty unless checksums are enabled.
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// ToolVersion is version of the tool export was taken with.
+	ToolVersion string `json:"toolVersion,omitempty"`
+
+	// Pod is Kubernetes pod export was taken by, nil outside Kubernetes.
+	Pod *podinfo.Info `json:"pod,omitempty"`
+
+	// Schema is summary of exported schema and SchemaDiff
+	// is its difference from the previous export.
+	Schema     *schema.Schema `json:"schema,omitempty"`
+	SchemaDiff *schema.Diff   `json:"schemaDiff,omitempty"`
+
+	// ACL is access control of exported namespace restores can apply
+	// to target cluster, it's nil unless recording it is enabled.
+	ACL *acl.ACL `json:"acl,omitempty"`
+
+	// GraphQL is GraphQL schema captured at export time, it's nil when
+	// none was applied to exported namespace or it couldn't be read.
+	GraphQL *GraphQLSchema `json:"graphql,omitempty"`
+
+	// Delta describes differential exports holding nodes modified
+	// since Since, it's nil for full exports.
+	Delta *Delta `json:"delta,omitempty"`
+
+	// Rebuilt is set on manifests written from destination listing for
+	// exports made without the tool, their cluster is unknown.
+	Rebuilt bool `json:"rebuilt,omitempty"`
+}
+
+// Delta is metadata of differential export, it has to be applied on top
+// of Base export and deltas preceding it.
+type Delta struct {
+	Base      string    `json:"base"`
+	Since     time.Time `json:"since"`
+	Predicate string    `json:"predicate"`
+}
+
+// GraphQLSchema is GraphQL schema file of namespace, it's covered by
+// manifest signature with its checksum.
+type GraphQLSchema struct {
+	File      string `json:"file"`
+	Namespace int64  `json:"namespace"`
+	Checksum  string `json:"checksum"`
+}
+
+// Cluster describes Dgraph cluster export was taken from.
+type Cluster struct {
+	Version string  `json:"version,omitempty"`
+	ID      string  `json:"id,omitempty"`
+	Groups  []Group `json:"groups,omitempty"`
+}
+
+// Group status values recorded when export waits for all groups' files.
+const (
+	GroupComplete = "complete"
+	GroupMissing  = "missing"
+)
+
+type Group struct {
+	ID         uint64   `json:"id"`
+	Members    []string `json:"members"`
+	Leader     string   `json:"leader,omitempty"`
+	Predicates []string `json:"predicates"`
+	Files      []string `json:"files,omitempty"`
+	Status     string   `json:"status,omitempty"`
+}
+
+// Dir returns export directory relative to destination,
+// Dgraph writes all files of single export into one directory.
+func (m *Manifest) Dir() string {
+	if len(m.Files) == 0 {
+		return ""
+	}
+
+	return path.Dir(m.Files[0])
+}
+
+// Read loads manifest of export stored in dir.
+func Read(ctx context.Context, s storage.Storage, dir string) (*Manifest, error) {
+	r, err := s.Get(ctx, path.Join(dir, Name))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode %s manifest: %w", dir, err)
+	}
+
+	return &m, nil
+}
+
+// Write stores manifest in the export directory, it's signed with signer
+// unless it's nil. Signature covers manifest bytes as they are stored.
+func (m *Manifest) Write(ctx context.Context, s storage.Storage, signer signing.Signer) (string, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	key := path.Join(m.Dir(), Name)
+	if err := s.Put(ctx, key, bytes.NewReader(b), int64(len(b))); err != nil {
+		return key, err
+	}
+	if signer == nil {
+		return key, nil
+	}
+
+	sig, err := signer.Sign(ctx, b)
+	if err != nil {
+		return key, fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	if b, err = json.MarshalIndent(sig, "", "  "); err != nil {
+		return key, err
+	}
+
+	return key, s.Put(ctx, path.Join(m.Dir(), SignatureName), bytes.NewReader(b), int64(len(b)))
+}
+
+// Verify checks signature of manifest of export stored in dir.
+func Verify(ctx context.Context, s storage.Storage, dir string, v signing.Verifier) error {
+	b, err := readAll(ctx, s, path.Join(dir, Name))
+	if err != nil {
+		return err
+	}
+	sb, err := readAll(ctx, s, path.Join(dir, SignatureName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrUnsigned
+	}
+	if err != nil {
+		return err
+	}
+
+	var sig signing.Signature
+	if err := json.Unmarshal(sb, &sig); err != nil {
+		return fmt.Errorf("%w: %w", signing.ErrInvalid, err)
+	}
+
+	return v.Verify(ctx, b, sig)
+}
+
+func readAll(ctx context.Context, s storage.Storage, key string) ([]byte, error) {
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	LabelCluster     = "cluster"
+	LabelNamespace   = "namespace"
+	LabelDestination = "destination"
+
+	// OverflowValue replaces label values seen after the limit is reached.
+	OverflowValue = "other"
+)
+
+// runLabels are labels of series describing single export run,
+// so per-tenant dashboards are built from one deployment.
+var runLabels = []string{LabelCluster, LabelNamespace, LabelDestination}
+
+// Run identifies export run in labels of its series.
+type Run struct {
+	Cluster   string
+	Namespace int64
+	// Destination is export destination URL, only its backend,
+	// e.g. s3 or gs, is used as label value.
+	Destination string
+}
+
+// labelLimiter drops disabled labels and caps number of distinct
+// values of enabled ones, so unbounded values don't blow up storage.
+type labelLimiter struct {
+	mu        sync.Mutex
+	enabled   map[string]bool
+	maxValues int
+	seen      map[string]map[string]bool
+}
+
+var limiter = &labelLimiter{
+	enabled: map[string]bool{LabelCluster: true, LabelNamespace: true, LabelDestination: true},
+	seen:    make(map[string]map[string]bool),
+}
+
+// ConfigureLabels sets run labels series carry, others are left empty,
+// and how many distinct values each label may have, values seen after
+// the limit are reported as OverflowValue. Zero maxValues disables the limit.
+func ConfigureLabels(enabled []string, maxValues int) error {
+	m := make(map[string]bool)
+	for _, name := range enabled {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isRunLabel(name) {
+			return fmt.Errorf("unknown metric label %q, expected one of %s", name, strings.Join(runLabels, ", "))
+		}
+		m[name] = true
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.enabled = m
+	limiter.maxValues = maxValues
+	limiter.seen = make(map[string]map[string]bool)
+
+	return nil
+}
+
+func isRunLabel(name string) bool {
+	for _, l := range runLabels {
+		if l == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Values returns label values of run series, extra values of series own
+// labels go first.
+func (r Run) Values(extra ...string) []string {
+	values := append([]string{}, extra...)
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	return append(values,
+		limiter.value(LabelCluster, r.Cluster),
+		limiter.value(LabelNamespace, strconv.FormatInt(r.Namespace, 10)),
+		limiter.value(LabelDestination, Backend(r.Destination)),
+	)
+}
+
+func (l *labelLimiter) value(name, value string) string {
+	if !l.enabled[name] || value == "" {
+		return ""
+	}
+
+	seen := l.seen[name]
+	if seen == nil {
+		seen = make(map[string]bool)
+		l.seen[name] = seen
+	}
+	if !seen[value] {
+		if l.maxValues > 0 && len(seen) >= l.maxValues {
+			return OverflowValue
+		}
+		seen[value] = true
+	}
+
+	return value
+}
+
+// Backend returns storage backend of destination URL, e.g. s3,
+// local paths without scheme are reported as file.
+func Backend(dest string) string {
+	if dest == "" {
+		return ""
+	}
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme == "" {
+		return "file"
+	}
+
+	return strings.ToLower(u.Scheme)
+}
+
+func withRunLabels(names ...string) []string {
+	return append(names, runLabels...)
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunValues(t *testing.T) {
+	defer ConfigureLabels(runLabels, 0)
+
+	if err := ConfigureLabels([]string{"cluster", "tenant"}, 0); err == nil {
+		t.Error("ConfigureLabels() with unknown label succeeded, want error")
+	}
+
+	if err := ConfigureLabels([]string{"namespace", " destination"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		run  Run
+		want []string
+	}{
+		{Run{Cluster: "prod", Namespace: 1, Destination: "s3://s3.amazonaws.com/bucket"}, []string{"auth", "", "1", "s3"}},
+		{Run{Namespace: 2, Destination: "/mnt/backups"}, []string{"auth", "", "2", "file"}},
+		{Run{Namespace: 3, Destination: "gs://bucket"}, []string{"auth", "", OverflowValue, OverflowValue}},
+		{Run{Namespace: 1, Destination: "s3://s3.amazonaws.com/other"}, []string{"auth", "", "1", "s3"}},
+	} {
+		if got := tc.run.Values("auth"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%+v.Values() = %q, want %q", tc.run, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dgraph_export_tool"
+
+var (
+	BuildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Always 1, labeled with version, commit and build date of the running binary.",
+	}, []string{"version", "commit", "build_date", "goversion"})
+
+	JobQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_queue_depth",
+		Help:      "Number of jobs waiting to run.",
+	})
+
+	ExportWrittenFiles = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "export_written_files",
+		Help:      "Number of files written to destination by running export.",
+	}, withRunLabels())
+
+	ExportWrittenBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "export_written_bytes",
+		Help:      "Number of bytes written to destination by running export.",
+	}, withRunLabels())
+
+	LastExportSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_export_success",
+		Help:      "Whether the last finished export succeeded.",
+	}, withRunLabels())
+
+	LastExportTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_export_timestamp_seconds",
+		Help:      "Unix time the last export finished at.",
+	}, withRunLabels())
+
+	LastExportDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_export_duration_seconds",
+		Help:      "Duration of the last finished export.",
+	}, withRunLabels())
+
+	BackupSuccessRatio = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_success_ratio",
+		Help:      "Ratio of successful exports over SLO window.",
+	})
+
+	BackupSLOTarget = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_slo_target",
+		Help:      "Target ratio of successful exports.",
+	})
+
+	BackupSLOBurnRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_slo_burn_rate",
+		Help:      "How fast failure budget is spent, values above 1 mean SLO will be violated.",
+	})
+
+	DgraphCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dgraph_circuit_open",
+		Help:      "Whether requests to Dgraph admin endpoint are suspended after consecutive failures.",
+	})
+
+	TenantReady = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tenant_ready",
+		Help:      "Whether tenant credentials grant write access to its export destination.",
+	}, []string{"tenant"})
+
+	LeaseOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "lease_operation_duration_seconds",
+		Help:      "Duration of leader election lock operations by operation: get, acquire, renew or release.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation"})
+
+	LeaseOperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lease_operation_errors_total",
+		Help:      "Number of failed leader election lock operations by operation.",
+	}, []string{"operation"})
+
+	WorkerQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_queue_depth",
+		Help:      "Number of tasks waiting for free worker by task, e.g. download or upload.",
+	}, []string{"task"})
+
+	WorkerTaskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_task_duration_seconds",
+		Help:      "Duration of tasks run by workers by task.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"task"})
+
+	ExportPeriodDrift = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "export_period_drift_seconds",
+		Help:      "How late scheduled exports start compared to export period counted from the previous one.",
+		Buckets:   []float64{1, 10, 30, 60, 300, 600, 1800, 3600, 3 * 3600, 6 * 3600, 24 * 3600},
+	}, withRunLabels())
+
+	ExportsDeferred = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exports_deferred_total",
+		Help:      "Number of times scheduled export was deferred due to cluster load.",
+	})
+
+	ExportsBusy = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exports_busy_total",
+		Help:      "Number of exports refused by alpha running another operation or draining.",
+	}, withRunLabels())
+
+	ExportFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "export_failures_total",
+		Help:      "Number of failed exports by error class, e.g. auth or destination.",
+	}, withRunLabels("class"))
+
+	ExportsStalled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exports_stalled_total",
+		Help:      "Number of export attempts cancelled because nothing was written for stall timeout.",
+	}, withRunLabels())
+
+	EventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_published_total",
+		Help:      "Number of lifecycle events published to event sink by type.",
+	}, []string{"type"})
+
+	EventsFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_failed_total",
+		Help:      "Number of lifecycle events event sink failed to accept.",
+	})
+
+	EventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Number of lifecycle events dropped because queue was full.",
+	})
+
+	RollingCycleNamespaces = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rolling_cycle_namespaces",
+		Help:      "Number of namespaces of the current rolling export cycle by state: total, succeeded or failed.",
+	}, []string{"state"})
+
+	RollingCycleCompleted = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rolling_cycle_completed_timestamp_seconds",
+		Help:      "Unix time the last rolling export cycle finished exporting all namespaces.",
+	})
+
+	VerifyCheckedBackups = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "verify_checked_backups",
+		Help:      "Number of backups checked by the last verification run by result: ok or problem.",
+	}, []string{"result"})
+
+	LastVerifyTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_verify_timestamp_seconds",
+		Help:      "Unix time the last verification run of backups at destination finished.",
+	})
+
+	SchemaChangeExports = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "schema_change_exports_total",
+		Help:      "Number of exports started after schema change, by source of notification: webhook or poll.",
+	}, []string{"source"})
+
+	ValidatedFiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validated_files_total",
+		Help:      "Number of exported files parsed after export, by result: ok or invalid.",
+	}, []string{"result"})
+
+	InjectedFaults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "injected_faults_total",
+		Help:      "Number of failures injected by debug flags, by point: export, upload, verify or lock-renew.",
+	}, []string{"point"})
+)
+
+// Handler serves metrics in Prometheus format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
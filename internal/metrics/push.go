@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Push replaces metrics of job at Prometheus Pushgateway with current
+// values, so runs exiting before they are scraped are still observable.
+func Push(ctx context.Context, url, job string) error {
+	return push.New(url, job).Gatherer(prometheus.DefaultGatherer).PushContext(ctx)
+}
+
+// RemoteWrite sends current metric values to Prometheus remote write
+// endpoint, job label is added to all series.
+func RemoteWrite(ctx context.Context, url, job string) error {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	body := s2.EncodeSnappy(nil, writeRequest(families, job, time.Now()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write failed with status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// writeRequest encodes families as remote write protobuf message:
+// https://github.com/prometheus/prometheus/blob/v2.45.0/prompb/remote.proto
+func writeRequest(families []*dto.MetricFamily, job string, now time.Time) []byte {
+	ts := now.UnixMilli()
+
+	var b []byte
+	add := func(name string, labels []*dto.LabelPair, value float64, extra ...string) {
+		pairs := [][2]string{{"__name__", name}, {"job", job}}
+		for _, l := range labels {
+			pairs = append(pairs, [2]string{l.GetName(), l.GetValue()})
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			pairs = append(pairs, [2]string{extra[i], extra[i+1]})
+		}
+		// remote write receivers expect labels sorted by name
+		sort.Slice(pairs, func(i, k int) bool { return pairs[i][0] < pairs[k][0] })
+
+		var series []byte
+		for _, p := range pairs {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, p[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, p[1])
+
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts))
+
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, series)
+	}
+
+	for _, f := range families {
+		name := f.GetName()
+		for _, m := range f.GetMetric() {
+			labels := m.GetLabel()
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, labels, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, labels, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, labels, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, bucket := range h.GetBucket() {
+					add(name+"_bucket", labels, float64(bucket.GetCumulativeCount()),
+						"le", strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64))
+				}
+				add(name+"_bucket", labels, float64(h.GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", labels, h.GetSampleSum())
+				add(name+"_count", labels, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, labels, q.GetValue(),
+						"quantile", strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64))
+				}
+				add(name+"_sum", labels, s.GetSampleSum())
+				add(name+"_count", labels, float64(s.GetSampleCount()))
+			}
+		}
+	}
+
+	return b
+}
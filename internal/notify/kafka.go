@@ -0,0 +1,367 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kafkaPublisher is minimal Kafka producer: it finds partition leader with
+// Metadata request and writes single record with Produce request, acks=1.
+// Records with the same key go to the same partition. TLS and SASL aren't
+// supported.
+// https://kafka.apache.org/protocol
+type kafkaPublisher struct {
+	brokers []string
+	topic   string
+	cfg     *config
+}
+
+const (
+	kafkaProduce         = 0
+	kafkaMetadata        = 3
+	kafkaProduceVersion  = 3
+	kafkaMetadataVersion = 4
+	kafkaClientID        = "dgraph-export-tool"
+)
+
+func newKafka(target string, cfg *config) (*kafkaPublisher, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka target: %w", err)
+	}
+	topic := strings.Trim(u.Path, "/")
+	if u.Host == "" || topic == "" || strings.Contains(topic, "/") {
+		return nil, fmt.Errorf("Kafka target must be kafka://host:port[,host:port]/topic")
+	}
+
+	k := &kafkaPublisher{topic: topic, cfg: cfg}
+	for _, addr := range strings.Split(u.Host, ",") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "9092")
+		}
+		k.brokers = append(k.brokers, addr)
+	}
+
+	return k, nil
+}
+
+// Publish writes body to topic with subject as record key.
+func (k *kafkaPublisher) Publish(ctx context.Context, subject string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, k.cfg.timeout)
+	defer cancel()
+
+	var (
+		leader    string
+		partition int32
+		err       error
+	)
+	for _, broker := range k.brokers {
+		if leader, partition, err = k.leader(ctx, broker, subject); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialKafka(ctx, leader)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var req kafkaEncoder
+	req.string(nil)      // transactional id
+	req.int16(1)         // acks
+	req.int32(10 * 1000) // timeout ms
+	req.int32(1)
+	req.string(&k.topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(recordBatch([]byte(subject), body, time.Now()))
+
+	resp, err := conn.roundTrip(kafkaProduce, kafkaProduceVersion, req.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// responses [name [index error_code base_offset log_append_time]] throttle
+	d := kafkaDecoder{b: resp}
+	for topics := d.int32(); topics > 0; topics-- {
+		d.string()
+		for partitions := d.int32(); partitions > 0; partitions-- {
+			d.int32()
+			code := d.int16()
+			d.int64()
+			d.int64()
+			if code != 0 {
+				return fmt.Errorf("kafka produce failed with error code %d", code)
+			}
+		}
+	}
+
+	return d.err
+}
+
+// leader returns address of leader of partition key belongs to.
+func (k *kafkaPublisher) leader(ctx context.Context, broker, key string) (string, int32, error) {
+	conn, err := dialKafka(ctx, broker)
+	if err != nil {
+		return "", 0, err
+	}
+	defer conn.Close()
+
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(&k.topic)
+	req.bool(false) // allow auto topic creation
+
+	resp, err := conn.roundTrip(kafkaMetadata, kafkaMetadataVersion, req.Bytes())
+	if err != nil {
+		return "", 0, err
+	}
+
+	d := kafkaDecoder{b: resp}
+	d.int32() // throttle
+	brokers := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster id
+	d.int32()  // controller id
+
+	leaders := make(map[int32]int32)
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		if code := d.int16(); code != 0 {
+			return "", 0, fmt.Errorf("kafka topic %s metadata error code %d", k.topic, code)
+		}
+		d.string()
+		d.bool()
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			d.int16()
+			index := d.int32()
+			leaders[index] = d.int32()
+			d.int32s() // replicas
+			d.int32s() // isr
+		}
+	}
+	if d.err != nil {
+		return "", 0, fmt.Errorf("failed to decode kafka metadata: %w", d.err)
+	}
+	if len(leaders) == 0 {
+		return "", 0, fmt.Errorf("kafka topic %s has no partitions", k.topic)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	partition := int32(h.Sum32() % uint32(len(leaders)))
+	addr, ok := brokers[leaders[partition]]
+	if !ok {
+		return "", 0, fmt.Errorf("kafka partition %s/%d has no leader", k.topic, partition)
+	}
+
+	return addr, partition, nil
+}
+
+// recordBatch encodes single record as record batch v2.
+func recordBatch(key, value []byte, now time.Time) []byte {
+	var rec []byte
+	rec = append(rec, 0)              // attributes
+	rec = binary.AppendVarint(rec, 0) // timestamp delta
+	rec = binary.AppendVarint(rec, 0) // offset delta
+	rec = binary.AppendVarint(rec, int64(len(key)))
+	rec = append(rec, key...)
+	rec = binary.AppendVarint(rec, int64(len(value)))
+	rec = append(rec, value...)
+	rec = binary.AppendVarint(rec, 0) // headers
+
+	// attributes up to the end are covered by crc
+	var tail kafkaEncoder
+	tail.int16(0) // attributes
+	tail.int32(0) // last offset delta
+	ts := now.UnixMilli()
+	tail.int64(ts) // first timestamp
+	tail.int64(ts) // max timestamp
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(1)  // records
+	tail.Write(binary.AppendVarint(nil, int64(len(rec))))
+	tail.Write(rec)
+
+	var batch kafkaEncoder
+	batch.int64(0)                             // base offset
+	batch.int32(int32(4 + 1 + 4 + tail.Len())) // batch length
+	batch.int32(-1)                            // partition leader epoch
+	batch.WriteByte(2)                         // magic
+	batch.int32(int32(crc32.Checksum(tail.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	batch.Write(tail.Bytes())
+
+	return batch.Bytes()
+}
+
+type kafkaConn struct {
+	net.Conn
+	r  *bufio.Reader
+	id int32
+}
+
+func dialKafka(ctx context.Context, addr string) (*kafkaConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	return &kafkaConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// roundTrip sends request with header v1 and returns response body.
+func (c *kafkaConn) roundTrip(apiKey, version int16, body []byte) ([]byte, error) {
+	c.id++
+	clientID := kafkaClientID
+
+	var req kafkaEncoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.id)
+	req.string(&clientID)
+	req.Write(body)
+	b := req.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+
+	if _, err := c.Write(b); err != nil {
+		return nil, err
+	}
+
+	var size int32
+	if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read kafka response: %w", err)
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("invalid kafka response size %d", size)
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, fmt.Errorf("failed to read kafka response: %w", err)
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != c.id {
+		return nil, fmt.Errorf("kafka response correlation id %d, want %d", id, c.id)
+	}
+
+	return resp[4:], nil
+}
+
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int16(v int16) { _ = binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) int32(v int32) { _ = binary.Write(e, binary.BigEndian, v) }
+func (e *kafkaEncoder) int64(v int64) { _ = binary.Write(e, binary.BigEndian, v) }
+
+func (e *kafkaEncoder) bool(v bool) {
+	if v {
+		e.WriteByte(1)
+	} else {
+		e.WriteByte(0)
+	}
+}
+
+// string writes nullable string, nil is encoded as null.
+func (e *kafkaEncoder) string(s *string) {
+	if s == nil {
+		e.int16(-1)
+		return
+	}
+	e.int16(int16(len(*s)))
+	e.WriteString(*s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+var errShortResponse = errors.New("short kafka response")
+
+// kafkaDecoder reads response fields, the first error is kept in err
+// and following reads return zero values.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.b) < n {
+		d.err = errShortResponse
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+
+	return v
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) bool() bool {
+	b := d.next(1)
+	return b != nil && b[0] != 0
+}
+
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n <= 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) int32s() {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
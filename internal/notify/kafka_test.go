@@ -0,0 +1,337 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKafka is a broker answering Metadata v4 and Produce v3 requests
+// for single topic, it records requests it got.
+type fakeKafka struct {
+	ln         net.Listener
+	partitions int32
+	// leader is node id reported as leader of every partition,
+	// the broker itself is node 1.
+	leader       int32
+	topicError   int16
+	produceError int16
+
+	mu       sync.Mutex
+	requests []kafkaRequest
+}
+
+type kafkaRequest struct {
+	apiKey   int16
+	version  int16
+	clientID string
+	body     []byte
+}
+
+func newFakeKafka(t *testing.T) *fakeKafka {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	k := &fakeKafka{ln: ln, partitions: 1, leader: 1}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go k.serve(conn)
+		}
+	}()
+
+	return k
+}
+
+func (k *fakeKafka) addr() string {
+	return k.ln.Addr().String()
+}
+
+func (k *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+
+		d := kafkaDecoder{b: b}
+		req := kafkaRequest{apiKey: d.int16(), version: d.int16()}
+		id := d.int32()
+		req.clientID = d.string()
+		req.body = d.b
+		k.mu.Lock()
+		k.requests = append(k.requests, req)
+		k.mu.Unlock()
+
+		var resp kafkaEncoder
+		resp.int32(0)
+		resp.int32(id)
+		switch req.apiKey {
+		case kafkaMetadata:
+			k.metadata(&resp)
+		case kafkaProduce:
+			k.produce(&resp)
+		default:
+			return
+		}
+		out := resp.Bytes()
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func (k *fakeKafka) metadata(resp *kafkaEncoder) {
+	host, port, _ := net.SplitHostPort(k.addr())
+	p, _ := strconv.Atoi(port)
+	topic := "exports"
+
+	resp.int32(0) // throttle
+	resp.int32(1) // brokers
+	resp.int32(1)
+	resp.string(&host)
+	resp.int32(int32(p))
+	resp.string(nil) // rack
+	resp.string(nil) // cluster id
+	resp.int32(1)    // controller id
+	resp.int32(1)    // topics
+	resp.int16(k.topicError)
+	resp.string(&topic)
+	resp.bool(false)
+	resp.int32(k.partitions)
+	for i := int32(0); i < k.partitions; i++ {
+		resp.int16(0)
+		resp.int32(i)
+		resp.int32(k.leader)
+		resp.int32(1) // replicas
+		resp.int32(1)
+		resp.int32(1) // isr
+		resp.int32(1)
+	}
+}
+
+func (k *fakeKafka) produce(resp *kafkaEncoder) {
+	topic := "exports"
+
+	resp.int32(1)
+	resp.string(&topic)
+	resp.int32(1)
+	resp.int32(0)
+	resp.int16(k.produceError)
+	resp.int64(42) // base offset
+	resp.int64(-1) // log append time
+	resp.int32(0)  // throttle
+}
+
+func (k *fakeKafka) requested() []kafkaRequest {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]kafkaRequest(nil), k.requests...)
+}
+
+func TestRecordBatch(t *testing.T) {
+	got := recordBatch([]byte("key"), []byte("value"), time.UnixMilli(1700000000000))
+
+	// crc32c is computed independently of hash/crc32
+	want, _ := hex.DecodeString(strings.Join([]string{
+		"0000000000000000", // base offset
+		"00000040",         // batch length
+		"ffffffff",         // partition leader epoch
+		"02",               // magic
+		"db5e9cdd",         // crc32c of the rest
+		"0000",             // attributes
+		"00000000",         // last offset delta
+		"0000018bcfe56800", // first timestamp
+		"0000018bcfe56800", // max timestamp
+		"ffffffffffffffff", // producer id
+		"ffff",             // producer epoch
+		"ffffffff",         // base sequence
+		"00000001",         // records
+		"1c",               // record length, zigzag varint 14
+		"00",               // attributes
+		"00",               // timestamp delta
+		"00",               // offset delta
+		"06", "6b6579",     // key
+		"0a", "76616c7565", // value
+		"00", // headers
+	}, ""))
+	if !bytes.Equal(got, want) {
+		t.Errorf("recordBatch() =\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestKafkaPublish(t *testing.T) {
+	k := newFakeKafka(t)
+	k.partitions = 4
+
+	p, err := New("kafka://" + k.addr() + "/exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().Truncate(time.Millisecond)
+	if err := p.Publish(context.Background(), "dgraph.export.completed", []byte(`{"id":"dgraph.r1"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := k.requested()
+	if len(reqs) != 2 {
+		t.Fatalf("broker got %d requests, want metadata and produce", len(reqs))
+	}
+	for i, want := range []struct{ apiKey, version int16 }{{kafkaMetadata, 4}, {kafkaProduce, 3}} {
+		if reqs[i].apiKey != want.apiKey || reqs[i].version != want.version || reqs[i].clientID != kafkaClientID {
+			t.Errorf("request %d is api %d v%d of %q, want api %d v%d of %q",
+				i, reqs[i].apiKey, reqs[i].version, reqs[i].clientID, want.apiKey, want.version, kafkaClientID)
+		}
+	}
+
+	// topics [exports], allow auto topic creation false
+	metadata, _ := hex.DecodeString("00000001" + "0007" + hex.EncodeToString([]byte("exports")) + "00")
+	if !bytes.Equal(reqs[0].body, metadata) {
+		t.Errorf("metadata request is %x, want %x", reqs[0].body, metadata)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte("dgraph.export.completed"))
+	partition := h.Sum32() % 4
+
+	var prefix kafkaEncoder
+	prefix.Write([]byte{0xff, 0xff})             // transactional id
+	prefix.Write([]byte{0x00, 0x01})             // acks
+	prefix.Write([]byte{0x00, 0x00, 0x27, 0x10}) // timeout
+	prefix.Write([]byte{0x00, 0x00, 0x00, 0x01}) // topics
+	prefix.Write([]byte{0x00, 0x07})             // topic name
+	prefix.WriteString("exports")                // topic name
+	prefix.Write([]byte{0x00, 0x00, 0x00, 0x01}) // partitions
+	prefix.Write(binary.BigEndian.AppendUint32(nil, partition))
+	body := reqs[1].body
+	if !bytes.HasPrefix(body, prefix.Bytes()) {
+		t.Fatalf("produce request is %x, want prefix %x", body, prefix.Bytes())
+	}
+
+	d := kafkaDecoder{b: body[prefix.Len():]}
+	batch := d.next(int(d.int32()))
+	if d.err != nil || len(d.b) != 0 {
+		t.Fatalf("produce request records are %x", body[prefix.Len():])
+	}
+	if got := binary.BigEndian.Uint32(batch[8:]); int(got) != len(batch)-12 {
+		t.Errorf("batch length is %d, batch has %d bytes after it", got, len(batch)-12)
+	}
+	if batch[16] != 2 {
+		t.Errorf("batch magic is %d, want 2", batch[16])
+	}
+	if got, want := binary.BigEndian.Uint32(batch[17:]), crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli)); got != want {
+		t.Errorf("batch crc is %x, want %x", got, want)
+	}
+	ts := time.UnixMilli(int64(binary.BigEndian.Uint64(batch[27:])))
+	if ts.Before(before) || ts.After(time.Now()) {
+		t.Errorf("batch timestamp %s isn't time of publish", ts)
+	}
+	if want := recordBatch([]byte("dgraph.export.completed"), []byte(`{"id":"dgraph.r1"}`), ts); !bytes.Equal(batch, want) {
+		t.Errorf("batch is %x, want %x", batch, want)
+	}
+}
+
+func TestKafkaPublishErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(k *fakeKafka)
+		err   string
+	}{
+		{
+			name:  "topic error",
+			setup: func(k *fakeKafka) { k.topicError = 3 },
+			err:   "metadata error code 3",
+		},
+		{
+			name:  "no partitions",
+			setup: func(k *fakeKafka) { k.partitions = 0 },
+			err:   "has no partitions",
+		},
+		{
+			name:  "unknown leader",
+			setup: func(k *fakeKafka) { k.leader = 2 },
+			err:   "has no leader",
+		},
+		{
+			name:  "produce error",
+			setup: func(k *fakeKafka) { k.produceError = 7 },
+			err:   "error code 7",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newFakeKafka(t)
+			tc.setup(k)
+
+			p, err := New("kafka://" + k.addr() + "/exports")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Publish(context.Background(), "subject", []byte("{}")); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Publish() = %v, want error with %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestKafkaBrokerFailover(t *testing.T) {
+	k := newFakeKafka(t)
+
+	// nothing listens on closed listener's port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	p, err := New("kafka://" + down + "," + k.addr() + "/exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), "subject", []byte("{}")); err != nil {
+		t.Fatalf("Publish() with the first broker down = %v", err)
+	}
+	if got := len(k.requested()); got != 2 {
+		t.Errorf("the second broker got %d requests, want 2", got)
+	}
+}
+
+func TestNewKafka(t *testing.T) {
+	k, err := newKafka("kafka://kafka-0,kafka-1:9093/exports", &config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"kafka-0:9092", "kafka-1:9093"}; strings.Join(k.brokers, ",") != strings.Join(want, ",") || k.topic != "exports" {
+		t.Errorf("newKafka() = %v brokers, topic %q", k.brokers, k.topic)
+	}
+
+	for _, target := range []string{"kafka://kafka-0:9092", "kafka:///exports", "kafka://kafka-0/a/b"} {
+		if _, err := newKafka(target, &config{}); err == nil {
+			t.Errorf("newKafka(%q) succeeded, want error", target)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// natsPublisher publishes with NATS core protocol, subject is taken from
+// target path, so messages aren't persisted unless JetStream stream
+// listens on it.
+// https://docs.nats.io/reference/reference-protocols/nats-protocol
+type natsPublisher struct {
+	addr    string
+	subject string
+	user    *url.Userinfo
+	cfg     *config
+}
+
+func newNATS(target string, cfg *config) (*natsPublisher, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS target: %w", err)
+	}
+	subject := strings.Trim(u.Path, "/")
+	if u.Host == "" || subject == "" || strings.ContainsAny(subject, " \t\r\n/") {
+		return nil, fmt.Errorf("NATS target must be nats://host:port/subject")
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	return &natsPublisher{addr: addr, subject: subject, user: u.User, cfg: cfg}, nil
+}
+
+// Publish connects, publishes message and waits for server to process it.
+// Subject argument is ignored, NATS subject is part of target.
+func (n *natsPublisher) Publish(ctx context.Context, _ string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, n.cfg.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read NATS server info: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", strings.TrimSpace(line))
+	}
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "dgraph-export-tool"}
+	if n.user != nil {
+		if password, ok := n.user.Password(); ok {
+			opts["user"], opts["pass"] = n.user.Username(), password
+		} else {
+			opts["auth_token"] = n.user.Username()
+		}
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\n", connect)
+	fmt.Fprintf(w, "PUB %s %d\r\n", n.subject, len(body))
+	w.Write(body)
+	w.WriteString("\r\nPING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// server answers PONG after processing preceding commands
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read NATS server reply: %w", err)
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server: %s", strings.TrimPrefix(line, "-ERR "))
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS is a server speaking enough of NATS protocol for publishing,
+// it records CONNECT options and messages it got.
+type fakeNATS struct {
+	ln       net.Listener
+	greeting string
+	// reply is sent on PING, connection is closed when it's empty and
+	// left idle when it's "-".
+	reply string
+
+	mu       sync.Mutex
+	conns    int
+	connects []map[string]interface{}
+	msgs     []natsMsg
+}
+
+type natsMsg struct {
+	subject string
+	body    string
+}
+
+// newFakeNATS starts server, INFO greeting is sent when greeting is empty.
+func newFakeNATS(t *testing.T, greeting, reply string) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	if greeting == "" {
+		greeting = `INFO {"server_id":"fake","max_payload":1048576}`
+	}
+	n := &fakeNATS{ln: ln, greeting: greeting, reply: reply}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+
+	return n
+}
+
+func (n *fakeNATS) target(userinfo string) string {
+	return "nats://" + userinfo + n.ln.Addr().String() + "/exports"
+}
+
+func (n *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	n.mu.Lock()
+	n.conns++
+	n.mu.Unlock()
+
+	if _, err := io.WriteString(conn, n.greeting+"\r\n"); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch cmd {
+		case "CONNECT":
+			var opts map[string]interface{}
+			if err := json.Unmarshal([]byte(args), &opts); err != nil {
+				io.WriteString(conn, "-ERR 'Invalid CONNECT'\r\n")
+				return
+			}
+			n.mu.Lock()
+			n.connects = append(n.connects, opts)
+			n.mu.Unlock()
+		case "PUB":
+			fields := strings.Fields(args)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			n.mu.Lock()
+			n.msgs = append(n.msgs, natsMsg{subject: fields[0], body: string(payload[:size])})
+			n.mu.Unlock()
+		case "PING":
+			n.mu.Lock()
+			reply := n.reply
+			n.mu.Unlock()
+			switch reply {
+			case "":
+				return
+			case "-":
+				// never answers, client times out
+				io.Copy(io.Discard, r)
+				return
+			}
+			io.WriteString(conn, reply+"\r\n")
+		}
+	}
+}
+
+func (n *fakeNATS) state() (int, []map[string]interface{}, []natsMsg) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.conns, append([]map[string]interface{}(nil), n.connects...), append([]natsMsg(nil), n.msgs...)
+}
+
+func TestNATSPublish(t *testing.T) {
+	n := newFakeNATS(t, "", "PONG")
+
+	p, err := New(n.target("user:secret@"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"id":"dgraph.r1"}`, `{"id":"dgraph.r2"}`} {
+		// NATS subject is part of target, publish subject is ignored
+		if err := p.Publish(context.Background(), "dgraph.export.completed", []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conns, connects, msgs := n.state()
+	if conns != 2 {
+		t.Errorf("server got %d connections, want one per publish", conns)
+	}
+	want := []natsMsg{{"exports", `{"id":"dgraph.r1"}`}, {"exports", `{"id":"dgraph.r2"}`}}
+	if len(msgs) != len(want) || msgs[0] != want[0] || msgs[1] != want[1] {
+		t.Errorf("server got messages %v, want %v", msgs, want)
+	}
+	for _, opts := range connects {
+		if opts["user"] != "user" || opts["pass"] != "secret" || opts["verbose"] != false || opts["name"] != "dgraph-export-tool" {
+			t.Errorf("CONNECT options are %v", opts)
+		}
+	}
+}
+
+func TestNATSPublishToken(t *testing.T) {
+	// server may interleave acknowledgements and pings before PONG
+	n := newFakeNATS(t, "", "+OK\r\nPING\r\nPONG")
+
+	p, err := New(n.target("s3cr3t@"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), "subject", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, connects, _ := n.state()
+	if len(connects) != 1 || connects[0]["auth_token"] != "s3cr3t" || connects[0]["user"] != nil {
+		t.Errorf("CONNECT options are %v, want auth token", connects)
+	}
+}
+
+func TestNATSPublishErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		greeting string
+		reply    string
+		err      string
+	}{
+		{
+			name:  "server error",
+			reply: "-ERR 'Authorization Violation'",
+			err:   "NATS server: 'Authorization Violation'",
+		},
+		{
+			name:     "unexpected greeting",
+			greeting: "HTTP/1.1 400 Bad Request",
+			err:      `unexpected NATS greeting "HTTP/1.1 400 Bad Request"`,
+		},
+		{
+			name: "connection closed",
+			err:  "failed to read NATS server reply: EOF",
+		},
+		{
+			name:  "no reply",
+			reply: "-",
+			err:   "i/o timeout",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newFakeNATS(t, tc.greeting, tc.reply)
+
+			p, err := New(n.target(""), WithTimeout(200*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Publish(context.Background(), "subject", []byte("{}")); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Publish() = %v, want error with %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestNATSPublishReconnects(t *testing.T) {
+	n := newFakeNATS(t, "", "")
+
+	p, err := New(n.target(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), "subject", []byte("lost")); err == nil {
+		t.Fatal("Publish() without PONG succeeded")
+	}
+
+	// failed publish leaves nothing behind, the next one connects anew
+	n.mu.Lock()
+	n.reply = "PONG"
+	n.mu.Unlock()
+	if err := p.Publish(context.Background(), "subject", []byte("delivered")); err != nil {
+		t.Fatal(err)
+	}
+	if conns, _, msgs := n.state(); conns != 2 || len(msgs) != 2 || msgs[1].body != "delivered" {
+		t.Errorf("server got %d connections and messages %v", conns, msgs)
+	}
+
+	n.ln.Close()
+	if err := p.Publish(context.Background(), "subject", []byte("{}")); err == nil {
+		t.Error("Publish() to stopped server succeeded")
+	}
+}
+
+func TestNewNATS(t *testing.T) {
+	n, err := newNATS("nats://nats/exports.dgraph", &config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.addr != "nats:4222" || n.subject != "exports.dgraph" {
+		t.Errorf("newNATS() = %s, subject %q", n.addr, n.subject)
+	}
+
+	for _, target := range []string{"nats://nats:4222", "nats:///exports", "nats://nats/a/b"} {
+		if _, err := newNATS(target, &config{}); err == nil {
+			t.Errorf("newNATS(%q) succeeded, want error", target)
+		}
+	}
+}
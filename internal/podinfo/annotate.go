@@ -0,0 +1,130 @@
+package podinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// patchTimeout limits single pod annotation update, it's made with
+// its own context, so cancelled work doesn't leave annotation behind.
+const patchTimeout = 10 * time.Second
+
+// Annotator keeps annotation on pod while work is in flight, so cluster
+// automation like node drains or chaos tools can wait for backup windows
+// to end. Nil Annotator annotates nothing.
+type Annotator struct {
+	client kubernetes.Interface
+	info   Info
+	key    string
+	value  string
+
+	mu     sync.Mutex
+	active int
+}
+
+// NewAnnotator returns annotator of pod i with annotation "key=value",
+// value is "true" when omitted. Annotation left by previous run of the
+// container is removed.
+func NewAnnotator(ctx context.Context, i Info, annotation string) (*Annotator, error) {
+	key, value, ok := strings.Cut(annotation, "=")
+	if !ok {
+		value = "true"
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid pod annotation %q: %s", key, strings.Join(errs, ", "))
+	}
+	if i.Pod == "" || i.Namespace == "" {
+		return nil, errors.New("pod annotation requires pod name and namespace")
+	}
+
+	client, err := inClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Annotator{
+		client: client,
+		info:   i,
+		key:    key,
+		value:  value,
+	}
+	if err := a.patch(ctx, false); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Begin sets annotation unless other work keeps it already, returned
+// func removes it after the last work ends. Failed updates are only
+// logged, annotation is advisory and doesn't fail work.
+func (a *Annotator) Begin() (end func()) {
+	if a == nil {
+		return func() {}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.active++; a.active == 1 {
+		a.update(true)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			if a.active--; a.active == 0 {
+				a.update(false)
+			}
+		})
+	}
+}
+
+func (a *Annotator) update(set bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), patchTimeout)
+	defer cancel()
+
+	if err := a.patch(ctx, set); err != nil {
+		klog.Warningf("failed to update pod annotation %s: %v", a.key, err)
+		return
+	}
+	klog.V(2).Infof("pod %s annotation %s is set: %t", a.info, a.key, set)
+}
+
+// patch sets or removes annotation with merge patch, so other metadata
+// of the pod isn't touched.
+func (a *Annotator) patch(ctx context.Context, set bool) error {
+	var value interface{}
+	if set {
+		value = a.value
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{a.key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.CoreV1().Pods(a.info.Namespace).Patch(ctx, a.info.Pod, types.MergePatchType, b, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch pod %s/%s: %w", a.info.Namespace, a.info.Pod, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package podinfo describes Kubernetes pod the tool runs in, so logs,
+// manifests and restore points can be correlated with deployment history.
+package podinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Info is pod metadata, usually exposed with Downward API environment
+// variables. Fields are empty outside Kubernetes.
+type Info struct {
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Image     string `json:"image,omitempty"`
+}
+
+// Empty returns whether nothing is known about the pod.
+func (i Info) Empty() bool {
+	return i == Info{}
+}
+
+func (i Info) String() string {
+	s := i.Namespace + "/" + i.Pod
+	if i.Node != "" {
+		s += " on node " + i.Node
+	}
+	if i.Image != "" {
+		s += ", image " + i.Image
+	}
+
+	return s
+}
+
+// Lookup returns i with node and image filled from pod object read with
+// in-cluster client, since Downward API doesn't expose image. Image is
+// one of container named container, or of the first one when container
+// is empty. Info is returned as is outside Kubernetes or when pod name
+// or namespace is unknown.
+func Lookup(ctx context.Context, i Info, container string) (Info, error) {
+	if i.Pod == "" || i.Namespace == "" || i.Node != "" && i.Image != "" {
+		return i, nil
+	}
+
+	client, err := inClusterClient()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		return i, nil
+	}
+	if err != nil {
+		return i, err
+	}
+
+	pod, err := client.CoreV1().Pods(i.Namespace).Get(ctx, i.Pod, metav1.GetOptions{})
+	if err != nil {
+		return i, fmt.Errorf("failed to get pod %s/%s: %w", i.Namespace, i.Pod, err)
+	}
+
+	if i.Node == "" {
+		i.Node = pod.Spec.NodeName
+	}
+	if i.Image == "" {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == container || container == "" {
+				i.Image = c.Image
+				break
+			}
+		}
+	}
+
+	return i, nil
+}
+
+func inClusterClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
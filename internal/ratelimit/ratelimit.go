@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientTTL is how long idle client buckets are kept.
+const clientTTL = 10 * time.Minute
+
+// Limiter is token bucket rate limiting middleware with global
+// and per-client buckets. Zero limit disables corresponding bucket.
+type Limiter struct {
+	global       *rate.Limiter
+	clientLimit  rate.Limit
+	clientBurst  int
+	mu           sync.Mutex
+	clients      map[string]*client
+	lastExpireAt time.Time
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func New(limit float64, burst int, clientLimit float64, clientBurst int) *Limiter {
+	l := &Limiter{
+		clientLimit: rate.Limit(clientLimit),
+		clientBurst: clientBurst,
+		clients:     make(map[string]*client),
+	}
+	if limit > 0 {
+		l.global = rate.NewLimiter(rate.Limit(limit), burst)
+	}
+
+	return l
+}
+
+// Handler responds with 429 Too Many Requests when either bucket is empty.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(clientAddr(r)) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow takes token of client addr and global bucket, it returns false
+// when either is empty.
+func (l *Limiter) Allow(addr string) bool {
+	if l.clientLimit > 0 {
+		now := time.Now()
+
+		l.mu.Lock()
+		l.expire(now)
+		c, ok := l.clients[addr]
+		if !ok {
+			c = &client{limiter: rate.NewLimiter(l.clientLimit, l.clientBurst)}
+			l.clients[addr] = c
+		}
+		c.lastSeen = now
+		allowed := c.limiter.Allow()
+		l.mu.Unlock()
+
+		if !allowed {
+			return false
+		}
+	}
+
+	return l.global == nil || l.global.Allow()
+}
+
+// expire forgets clients idle for clientTTL, not more often than once a minute.
+func (l *Limiter) expire(now time.Time) {
+	if now.Sub(l.lastExpireAt) < time.Minute {
+		return
+	}
+	l.lastExpireAt = now
+
+	for addr, c := range l.clients {
+		if now.Sub(c.lastSeen) > clientTTL {
+			delete(l.clients, addr)
+		}
+	}
+}
+
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Placeholder replaces secret values.
+const Placeholder = "[REDACTED]"
+
+// String replaces every occurrence of non-empty secrets in s.
+func String(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Placeholder)
+		}
+	}
+
+	return s
+}
+
+// Error returns err with secrets removed from its message.
+// The original error is still available with errors.Is and errors.As.
+func Error(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := String(err.Error(), secrets...)
+	if msg == err.Error() {
+		return err
+	}
+
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// URL returns destination url with password and credential query parameters hidden.
+func URL(dest string) string {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme == "" {
+		return dest
+	}
+
+	var secrets []string
+	if password, ok := u.User.Password(); ok {
+		secrets = append(secrets, password)
+	}
+	for key, values := range u.Query() {
+		switch strings.ToLower(key) {
+		case "accesskey", "secretkey", "sessiontoken", "token":
+			secrets = append(secrets, values...)
+		}
+	}
+
+	return String(dest, secrets...)
+}
@@ -0,0 +1,204 @@
+package restore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/checksum"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// ErrChecksum is returned when downloaded file doesn't match
+// checksum recorded in export manifest.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// ErrUnlisted is returned for data files of backup its manifest doesn't
+// list or, when manifests are signed, doesn't record checksum of, such
+// files could have been put at destination after export.
+var ErrUnlisted = errors.New("file isn't covered by manifest")
+
+// chunked returns whether object is downloaded in parallel ranged requests.
+func (r *Restorer) chunked(obj storage.Object) bool {
+	_, ok := r.storage.(storage.RangeReader)
+	return ok && r.chunkSize > 0 && obj.Size > r.chunkSize
+}
+
+// fetch downloads object into file in chunks requested on pool workers
+// and checks it against want checksum unless it's empty. Finished chunks
+// are listed in file.chunks, so download of file left by failed restore
+// resumes with missing chunks.
+func (r *Restorer) fetch(ctx context.Context, obj storage.Object, file, want string) error {
+	rr := r.storage.(storage.RangeReader)
+
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	done, err := r.openChunks(file+".chunks", obj, f)
+	if err != nil {
+		return err
+	}
+	defer done.Close()
+
+	chunks := int((obj.Size + r.chunkSize - 1) / r.chunkSize)
+	if n := len(done.indexes); n > 0 {
+		klog.Infof("resuming download of %s, %d of %d chunks are done", obj.Key, n, chunks)
+	}
+
+	err = r.pool.Run(ctx, "download", chunks, func(ctx context.Context, i int) error {
+		if done.has(i) {
+			return nil
+		}
+
+		offset := int64(i) * r.chunkSize
+		length := min(r.chunkSize, obj.Size-offset)
+		rc, err := rr.GetRange(ctx, obj.Key, offset, length)
+		if err != nil {
+			return failure.Wrap(failure.ErrDestination, err)
+		}
+		defer rc.Close()
+
+		n, err := io.Copy(io.NewOffsetWriter(f, offset), rc)
+		if err != nil {
+			return fmt.Errorf("chunk %d of %s: %w", i, obj.Key, err)
+		}
+		if n != length {
+			return fmt.Errorf("chunk %d of %s has %d bytes, want %d", i, obj.Key, n, length)
+		}
+
+		return done.add(i)
+	})
+	if err != nil {
+		return err
+	}
+
+	if want == "" {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	got, _, err := checksum.Compute(f)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		// corrupted file is downloaded again by the next restore
+		os.Remove(done.Name())
+		return fmt.Errorf("%s: %w: got %s, want %s", obj.Key, ErrChecksum, got, want)
+	}
+
+	return nil
+}
+
+// chunkLog records indexes of downloaded chunks, one per line,
+// after the first line identifying object.
+type chunkLog struct {
+	*os.File
+	mu      sync.Mutex
+	indexes map[int]bool
+}
+
+// openChunks reads chunk log of object download into f, download starts
+// over when the log is missing or belongs to another version of object.
+func (r *Restorer) openChunks(name string, obj storage.Object, f *os.File) (*chunkLog, error) {
+	header := fmt.Sprintf("%d %s", obj.Size, obj.ETag)
+	l := &chunkLog{indexes: make(map[int]bool)}
+
+	if b, err := os.ReadFile(name); err == nil {
+		sc := bufio.NewScanner(strings.NewReader(string(b)))
+		if sc.Scan() && sc.Text() == header {
+			for sc.Scan() {
+				if i, err := strconv.Atoi(sc.Text()); err == nil {
+					l.indexes[i] = true
+				}
+			}
+		}
+	}
+
+	var err error
+	if len(l.indexes) == 0 {
+		if err := f.Truncate(obj.Size); err != nil {
+			return nil, err
+		}
+		if l.File, err = os.Create(name); err != nil {
+			return nil, err
+		}
+		if _, err := fmt.Fprintln(l.File, header); err != nil {
+			l.Close()
+			return nil, err
+		}
+
+		return l, nil
+	}
+
+	if l.File, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *chunkLog) has(i int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.indexes[i]
+}
+
+func (l *chunkLog) add(i int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.indexes[i] = true
+	_, err := fmt.Fprintln(l.File, i)
+
+	return err
+}
+
+// verifyReader hashes object data read through it, check
+// compares checksum once all of it is read.
+type verifyReader struct {
+	io.Reader
+	key  string
+	want string
+	sum  *checksum.Writer
+}
+
+func newVerifyReader(r io.Reader, key, want string) *verifyReader {
+	sum := checksum.NewWriter(io.Discard)
+	return &verifyReader{
+		Reader: io.TeeReader(r, sum),
+		key:    key,
+		want:   want,
+		sum:    sum,
+	}
+}
+
+// check reads the rest of data, e.g. left unread after gzip stream
+// end, and compares checksum, nothing is checked with empty want.
+func (v *verifyReader) check() error {
+	if v.want == "" {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, v.Reader); err != nil {
+		return err
+	}
+	if got := v.sum.Sum(); got != v.want {
+		return fmt.Errorf("%s: %w: got %s, want %s", v.key, ErrChecksum, got, v.want)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd)
+
+package restore
+
+import (
+	"fmt"
+	"os"
+)
+
+func mkfifo(path string) error {
+	return fmt.Errorf("throttled restore is not supported on this platform")
+}
+
+func openReleasing(path string) (*os.File, error) {
+	return nil, fmt.Errorf("throttled restore is not supported on this platform")
+}
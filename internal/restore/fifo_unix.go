@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package restore
+
+import (
+	"os"
+	"syscall"
+)
+
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0o600)
+}
+
+// openReleasing opens pipe for reading without blocking,
+// releasing writer waiting for a reader.
+func openReleasing(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+}
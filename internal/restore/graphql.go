@@ -0,0 +1,58 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/gqlschema"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+)
+
+// applyGQLSchema applies GraphQL schema captured with backup id to
+// namespace its data was loaded into. Schema is checked against its
+// checksum recorded in manifest m.
+func (r *Restorer) applyGQLSchema(ctx context.Context, id string, m *manifest.Manifest, opts Options) error {
+	// prepare checked it's recorded for restored namespace
+	ns, _ := recordedTarget(m.GraphQL.Namespace, opts)
+
+	rc, err := r.storage.Get(ctx, m.GraphQL.File)
+	if err != nil {
+		return failure.Wrap(failure.ErrDestination, err)
+	}
+	defer rc.Close()
+
+	vr := newVerifyReader(rc, m.GraphQL.File, m.GraphQL.Checksum)
+	schema, err := io.ReadAll(vr)
+	if err != nil {
+		return failure.Wrap(failure.ErrDestination, fmt.Errorf("%s: %w", m.GraphQL.File, err))
+	}
+	if err := vr.check(); err != nil {
+		return err
+	}
+
+	c, err := r.adminClient(ctx, ns, opts)
+	if err != nil {
+		return err
+	}
+	gc, err := gqlschema.NewClient(opts.Admin,
+		gqlschema.WithRetries(r.adminAttempts),
+		gqlschema.WithUserAgent(r.userAgent),
+		gqlschema.WithAccessJWT(c.AccessJWT()),
+	)
+	if err != nil {
+		return err
+	}
+	if err := gc.Update(ctx, string(schema)); err != nil {
+		return fmt.Errorf("failed to apply GraphQL schema of backup %s: %w", id, err)
+	}
+
+	klog.Infof("applied GraphQL schema of backup %s to namespace %d", id, ns)
+	job.Report(ctx, "graphql-schema", "applied to namespace %d", ns)
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package restore
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+// subjectRe matches subject uid of exported N-Quad.
+var subjectRe = regexp.MustCompile(`^<0x([0-9a-f]+)>`)
+
+// deltas returns differential exports to be applied on top of base
+// until point until, oldest first.
+func (r *Restorer) deltas(ctx context.Context, base string, until restorepoint.Point) ([]restorepoint.Point, error) {
+	points, err := restorepoint.List(ctx, r.storage, r.pointOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	var deltas []restorepoint.Point
+	for _, p := range points {
+		if p.Type != restorepoint.TypeDelta || p.Base != base {
+			continue
+		}
+		if until.Type == restorepoint.TypeDelta && p.Time.After(until.Time) {
+			continue
+		}
+		if !p.Verified {
+			return nil, fmt.Errorf("delta %s can't be applied: %s", p.ID, p.Problem)
+		}
+		deltas = append(deltas, p)
+	}
+
+	sort.Slice(deltas, func(i, k int) bool {
+		return deltas[i].Time.Before(deltas[k].Time)
+	})
+
+	return deltas, nil
+}
+
+// materialize merges nodes of deltas into single JSON file in dir, later
+// versions of node replace earlier ones. It returns uids of merged nodes,
+// their N-Quads are dropped from base export.
+func (r *Restorer) materialize(ctx context.Context, deltas []restorepoint.Point, dir string) (file string, modified map[uint64]bool, err error) {
+	nodes := make(map[uint64]json.RawMessage)
+	for _, d := range deltas {
+		objects, err := r.storage.List(ctx, d.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, obj := range objects {
+			if !strings.HasSuffix(path.Base(obj.Key), ".json.gz") {
+				continue
+			}
+			job.Report(ctx, "download", "%s", obj.Key)
+			if err := r.mergeNodes(ctx, obj.Key, nodes); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	klog.Infof("materialized %d nodes of %d deltas", len(nodes), len(deltas))
+
+	uids := make([]uint64, 0, len(nodes))
+	modified = make(map[uint64]bool, len(nodes))
+	for uid := range nodes {
+		uids = append(uids, uid)
+		modified[uid] = true
+	}
+	sort.Slice(uids, func(i, k int) bool { return uids[i] < uids[k] })
+
+	file = filepath.Join(dir, "delta.json.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	if _, err := io.WriteString(zw, "["); err != nil {
+		return "", nil, err
+	}
+	for i, uid := range uids {
+		sep := ",\n"
+		if i == 0 {
+			sep = "\n"
+		}
+		if _, err := io.WriteString(zw, sep); err != nil {
+			return "", nil, err
+		}
+		if _, err := zw.Write(nodes[uid]); err != nil {
+			return "", nil, err
+		}
+	}
+	if _, err := io.WriteString(zw, "\n]\n"); err != nil {
+		return "", nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return "", nil, err
+	}
+
+	return file, modified, f.Close()
+}
+
+// mergeNodes reads JSON array of nodes from object key into nodes by uid.
+func (r *Restorer) mergeNodes(ctx context.Context, key string, nodes map[uint64]json.RawMessage) error {
+	rc, err := r.storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	defer zr.Close()
+
+	var page []json.RawMessage
+	if err := json.NewDecoder(zr).Decode(&page); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	for _, node := range page {
+		var n struct {
+			UID string `json:"uid"`
+		}
+		if err := json.Unmarshal(node, &n); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		uid, err := strconv.ParseUint(strings.TrimPrefix(n.UID, "0x"), 16, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid uid %q", key, n.UID)
+		}
+		nodes[uid] = node
+	}
+
+	return nil
+}
+
+// dropModified wraps data filter to also drop N-Quads of modified nodes.
+func dropModified(filter filterFunc, modified map[uint64]bool) filterFunc {
+	if len(modified) == 0 {
+		return filter
+	}
+
+	return func(r io.Reader, w io.Writer, ns int64) error {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(filter(r, pw, ns))
+		}()
+		defer pr.Close()
+
+		return filterLines(pr, w, func(line string) bool {
+			m := subjectRe.FindStringSubmatch(line)
+			if m == nil {
+				return true
+			}
+			uid, err := strconv.ParseUint(m[1], 16, 64)
+			return err != nil || !modified[uid]
+		})
+	}
+}
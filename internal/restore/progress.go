@@ -0,0 +1,99 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+)
+
+const (
+	// progressReportInterval is how often job progress is updated,
+	// every update is an event of job stream.
+	progressReportInterval = 10 * time.Second
+	// progressLogInterval is how often restore progress is logged.
+	progressLogInterval = time.Minute
+)
+
+// liveProgressRe matches N-Quads count of live loader progress lines, e.g.
+// "[12:00:05Z] Elapsed: 05s Txns: 12 N-Quads: 12000 N-Quads/s [last 5s]: 2400".
+var liveProgressRe = regexp.MustCompile(`\bN-Quads: (\d+)`)
+
+// lineCounter counts lines written to downloaded data files, they are
+// N-Quads restore progress is measured against.
+type lineCounter struct {
+	w     io.Writer
+	lines *int64
+}
+
+func (c lineCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+
+	return n, err
+}
+
+// progress tracks N-Quads loaded by live loader against total
+// downloaded, N-Quads of materialized deltas aren't counted in it.
+type progress struct {
+	total    int64
+	start    time.Time
+	loaded   int64
+	reported time.Time
+	logged   time.Time
+}
+
+func newProgress(total int64) *progress {
+	now := time.Now()
+	return &progress{total: total, start: now, logged: now}
+}
+
+// observe updates progress from live loader output line.
+func (p *progress) observe(ctx context.Context, line string) {
+	m := liveProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return
+	}
+	p.loaded = n
+
+	now := time.Now()
+	if now.Sub(p.reported) >= progressReportInterval {
+		p.reported = now
+		job.SetProgress(ctx, p.status())
+	}
+	if now.Sub(p.logged) >= progressLogInterval {
+		p.logged = now
+		klog.Infof("restore progress: %s", p.status())
+	}
+}
+
+// done reports restore completion.
+func (p *progress) done(ctx context.Context) {
+	p.loaded = max(p.loaded, p.total)
+	job.SetProgress(ctx, p.status())
+}
+
+func (p *progress) status() job.Progress {
+	pr := job.Progress{NQuads: p.loaded, TotalNQuads: p.total}
+	if p.total == 0 {
+		return pr
+	}
+
+	pr.Percent = min(100, float64(p.loaded*1000/p.total)/10)
+	if p.loaded > 0 && p.loaded < p.total {
+		elapsed := time.Since(p.start)
+		pr.RemainingSeconds = int64(elapsed.Seconds() * float64(p.total-p.loaded) / float64(p.loaded))
+	}
+
+	return pr
+}
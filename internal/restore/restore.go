@@ -0,0 +1,560 @@
+// Package restore loads exports into Dgraph cluster with live loader.
+package restore
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/signing"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/worker"
+)
+
+// AllNamespaces disables namespace filtering or mapping.
+const AllNamespaces = -1
+
+// Options describes restore target. Backup can be restored into
+// another cluster and, with namespace mapping, into another namespace.
+type Options struct {
+	// Alpha and Zero are gRPC addresses of target cluster, e.g. alpha:9080.
+	Alpha string
+	Zero  string
+	// User and Password are ACL credentials of target cluster.
+	User     string
+	Password string
+	// SourceNamespace selects data of single namespace of the backup,
+	// TargetNamespace loads data into given namespace.
+	SourceNamespace int64
+	TargetNamespace int64
+	// Materialize merges differential exports taken on top of backup
+	// into its data before loading, backup may be a delta then.
+	Materialize bool
+	// Admin is HTTP admin endpoint of target cluster, e.g.
+	// http://alpha:8080/admin, it's required by CreateNamespace, ApplyACL
+	// and ApplyGraphQLSchema.
+	Admin string
+	// CreateNamespace creates restored namespace unless it exists,
+	// User has to be guardian of the galaxy then.
+	CreateNamespace bool
+	// ApplyACL creates ACL groups recorded in backup manifest in restored
+	// namespace and updates rules of existing ones.
+	ApplyACL bool
+	// ApplyGraphQLSchema applies GraphQL schema captured at export time
+	// once data is loaded, so GraphQL applications are fully restored.
+	ApplyGraphQLSchema bool
+	// NamespacePassword is password of groot of restored namespace, it's
+	// set on created namespace and ACL is applied with it. Password is
+	// used when it's empty.
+	NamespacePassword string
+}
+
+func (o Options) String() string {
+	return fmt.Sprintf("{Alpha:%s Zero:%s User:%s Password:%s SourceNamespace:%d TargetNamespace:%d Materialize:%t Admin:%s CreateNamespace:%t ApplyACL:%t ApplyGraphQLSchema:%t NamespacePassword:%s}",
+		o.Alpha, o.Zero, o.User, hidden(o.Password), o.SourceNamespace, o.TargetNamespace, o.Materialize,
+		o.Admin, o.CreateNamespace, o.ApplyACL, o.ApplyGraphQLSchema, hidden(o.NamespacePassword))
+}
+
+func hidden(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return redact.Placeholder
+}
+
+// Restorer downloads backup files and feeds them to live loader.
+type Restorer struct {
+	storage   storage.Storage
+	binary    string
+	tmpDir    string
+	verifier  signing.Verifier
+	pool      *worker.Pool
+	chunkSize int64
+	throttle  Throttle
+	// adminAttempts and userAgent configure target cluster admin requests.
+	adminAttempts int
+	userAgent     string
+}
+
+type Option func(*Restorer)
+
+// WithVerifier makes restorer refuse backups and deltas
+// without valid manifest signature.
+func WithVerifier(v signing.Verifier) Option {
+	return func(r *Restorer) {
+		r.verifier = v
+	}
+}
+
+// WithPool requests chunks of large files on pool workers.
+func WithPool(pool *worker.Pool) Option {
+	return func(r *Restorer) {
+		r.pool = pool
+	}
+}
+
+// WithChunkSize downloads files larger than size in parallel ranged
+// requests of size bytes, files are downloaded in single request
+// when size is zero or storage doesn't serve ranges.
+func WithChunkSize(size int64) Option {
+	return func(r *Restorer) {
+		r.chunkSize = size
+	}
+}
+
+// New returns restorer using live loader binary, e.g. dgraph,
+// and downloading files into tmpDir.
+func New(s storage.Storage, binary, tmpDir string, opts ...Option) *Restorer {
+	r := &Restorer{
+		storage: s,
+		binary:  binary,
+		tmpDir:  tmpDir,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Restore loads backup with id according to opts.
+func (r *Restorer) Restore(ctx context.Context, id string, opts Options) error {
+	if opts.Alpha == "" || opts.Zero == "" {
+		return fmt.Errorf("alpha and zero addresses of target cluster are required")
+	}
+
+	point, err := restorepoint.Get(ctx, r.storage, id, r.pointOptions()...)
+	if err != nil {
+		return err
+	}
+	if err := signed(*point); err != nil {
+		return err
+	}
+	if point.Type == restorepoint.TypeFull && !point.Restorable() {
+		return fmt.Errorf("%s is a %s export, only %s exports can be restored", id, point.Format, restorepoint.FormatRDF)
+	}
+	if !point.Verified {
+		klog.Warningf("restoring unverified backup %s: %s", id, point.Problem)
+	}
+
+	base := id
+	if point.Type == restorepoint.TypeDelta {
+		if !opts.Materialize {
+			return fmt.Errorf("%s is a differential export, it can only be restored with materialize", id)
+		}
+		base = point.Base
+
+		bp, err := restorepoint.Get(ctx, r.storage, base, r.pointOptions()...)
+		if err != nil {
+			return err
+		}
+		if err := signed(*bp); err != nil {
+			return err
+		}
+	}
+
+	var deltas []restorepoint.Point
+	if opts.Materialize {
+		if deltas, err = r.deltas(ctx, base, *point); err != nil {
+			return err
+		}
+		// deltas are queried without login, so they hold default namespace only
+		if len(deltas) > 0 && opts.SourceNamespace != AllNamespaces && opts.SourceNamespace != 0 {
+			return fmt.Errorf("deltas of %s can't be applied to namespace %d", base, opts.SourceNamespace)
+		}
+	}
+
+	// namespace has to exist before live loader loads data into it
+	m, err := r.prepare(ctx, base, opts)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp(r.tmpDir, "restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// chunked downloads outlive failed restore to be resumed by the next one
+	parts := filepath.Join(r.tmpDir, "restore-"+strings.ReplaceAll(base, "/", "_")+".parts")
+	if err := os.MkdirAll(parts, 0o700); err != nil {
+		return err
+	}
+
+	var (
+		delta    string
+		modified map[uint64]bool
+	)
+	if len(deltas) > 0 {
+		if delta, modified, err = r.materialize(ctx, deltas, dir); err != nil {
+			return err
+		}
+	}
+
+	err = r.restore(ctx, base, dir, parts, delta, opts, modified)
+	// cancelled restore isn't resumed, its chunks are removed as well
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	if err := os.RemoveAll(parts); err != nil {
+		klog.Warningf("failed to remove downloaded chunks: %v", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.ApplyGraphQLSchema {
+		return r.applyGQLSchema(ctx, base, m, opts)
+	}
+
+	return nil
+}
+
+// restore downloads backup files and loads them with delta file, if any.
+func (r *Restorer) restore(ctx context.Context, base, dir, parts, delta string, opts Options, modified map[uint64]bool) error {
+	files, schema, nquads, err := r.download(ctx, base, dir, parts, opts.SourceNamespace, modified)
+	if err != nil {
+		return err
+	}
+	if delta != "" {
+		files = append(files, delta)
+	}
+
+	return r.load(ctx, files, schema, nquads, opts)
+}
+
+// pointOptions returns options restore points are checked with.
+func (r *Restorer) pointOptions() []restorepoint.Option {
+	if r.verifier == nil {
+		return nil
+	}
+
+	return []restorepoint.Option{restorepoint.WithVerifier(r.verifier)}
+}
+
+// signed returns error for point with missing or invalid manifest
+// signature, unlike other problems it's never only warned about.
+func signed(p restorepoint.Point) error {
+	if p.Signature == "" || p.Signature == restorepoint.SignatureValid {
+		return nil
+	}
+
+	return fmt.Errorf("%s can't be restored: manifest signature is %s", p.ID, p.Signature)
+}
+
+// download fetches backup data and schema files into dir, keeping only
+// data of namespace ns unless it's AllNamespaces and dropping nodes
+// modified by deltas. Schema files of all groups are merged into one,
+// since live loader accepts single schema. Only files listed in manifest
+// are restored and checked against its checksums, which signed manifests
+// must have. Large files are fetched into parts dir first.
+// N-Quads of data files kept are counted for restore progress.
+func (r *Restorer) download(ctx context.Context, id, dir, parts string, ns int64, modified map[uint64]bool) (files []string, schema string, nquads int64, err error) {
+	objects, err := r.storage.List(ctx, id)
+	if err != nil {
+		return nil, "", 0, failure.Wrap(failure.ErrDestination, err)
+	}
+
+	// backups made without manifest are restored from files found
+	var (
+		checksums map[string]string
+		listed    map[string]bool
+	)
+	m, err := manifest.Read(ctx, r.storage, id)
+	switch {
+	case err == nil:
+		checksums = m.Checksums
+		listed = make(map[string]bool, len(m.Files))
+		for _, file := range m.Files {
+			listed[file] = true
+		}
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, "", 0, failure.Wrap(failure.ErrDestination, err)
+	}
+	covered := func(key string) error {
+		switch {
+		case listed == nil:
+		case !listed[key]:
+			return fmt.Errorf("%s: %w: it isn't listed", key, ErrUnlisted)
+		case r.verifier != nil && checksums[key] == "":
+			return fmt.Errorf("%s: %w: signed manifest has no checksum of it", key, ErrUnlisted)
+		}
+		delete(listed, key)
+
+		return nil
+	}
+
+	schema = filepath.Join(dir, "schema.gz")
+	sf, err := os.Create(schema)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer sf.Close()
+	sw := gzip.NewWriter(sf)
+
+	for _, obj := range objects {
+		name := path.Base(obj.Key)
+		switch {
+		case strings.HasSuffix(name, ".gql_schema.gz"):
+			continue
+		case strings.HasSuffix(name, ".schema.gz"):
+			if err := covered(obj.Key); err != nil {
+				return nil, "", 0, err
+			}
+			job.Report(ctx, "download", "%s", obj.Key)
+			if err := r.copy(ctx, obj, checksums[obj.Key], parts, sw, filterSchema, ns); err != nil {
+				return nil, "", 0, err
+			}
+		case strings.HasSuffix(name, ".rdf.gz"):
+			if err := covered(obj.Key); err != nil {
+				return nil, "", 0, err
+			}
+			job.Report(ctx, "download", "%s", obj.Key)
+			file := filepath.Join(dir, name)
+			if err := r.downloadData(ctx, obj, checksums[obj.Key], parts, file, ns, modified, &nquads); err != nil {
+				return nil, "", 0, err
+			}
+			files = append(files, file)
+		}
+	}
+
+	for file := range listed {
+		name := path.Base(file)
+		if strings.HasSuffix(name, ".rdf.gz") || strings.HasSuffix(name, ".schema.gz") && !strings.HasSuffix(name, ".gql_schema.gz") {
+			return nil, "", 0, fmt.Errorf("file %s of backup %s is missing", file, id)
+		}
+	}
+
+	if err := sw.Close(); err != nil {
+		return nil, "", 0, err
+	}
+	if len(files) == 0 {
+		return nil, "", 0, fmt.Errorf("backup %s has no data files", id)
+	}
+
+	return files, schema, nquads, sf.Close()
+}
+
+func (r *Restorer) downloadData(ctx context.Context, obj storage.Object, want, parts, file string, ns int64, modified map[uint64]bool, nquads *int64) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	if err := r.copy(ctx, obj, want, parts, lineCounter{zw, nquads}, dropModified(filterData, modified), ns); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+type filterFunc func(r io.Reader, w io.Writer, ns int64) error
+
+// copy decompresses object, filters it and writes into w, object is
+// checked against want checksum unless it's empty.
+func (r *Restorer) copy(ctx context.Context, obj storage.Object, want, parts string, w io.Writer, filter filterFunc, ns int64) error {
+	key := obj.Key
+
+	var rc io.ReadCloser
+	if r.chunked(obj) {
+		file := filepath.Join(parts, path.Base(key))
+		if err := r.fetch(ctx, obj, file, want); err != nil {
+			return err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		rc, want = f, ""
+	} else {
+		var err error
+		if rc, err = r.storage.Get(ctx, key); err != nil {
+			return failure.Wrap(failure.ErrDestination, err)
+		}
+	}
+	defer rc.Close()
+
+	vr := newVerifyReader(rc, key, want)
+	zr, err := gzip.NewReader(vr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	defer zr.Close()
+
+	if err := filter(zr, w, ns); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	return vr.check()
+}
+
+var (
+	// dataNamespaceRe matches namespace label of exported N-Quad,
+	// optionally followed by facets.
+	dataNamespaceRe = regexp.MustCompile(`\s<0x([0-9a-f]+)>(\s+\(.*\))?\s*\.\s*$`)
+	// schemaNamespaceRe matches namespace prefix of exported schema line.
+	schemaNamespaceRe = regexp.MustCompile(`^\[0x([0-9a-f]+)\]`)
+)
+
+func filterData(r io.Reader, w io.Writer, ns int64) error {
+	if ns == AllNamespaces {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	return filterLines(r, w, func(line string) bool {
+		m := dataNamespaceRe.FindStringSubmatch(line)
+		return m == nil && ns == 0 || m != nil && parseNamespace(m[1]) == ns
+	})
+}
+
+func filterSchema(r io.Reader, w io.Writer, ns int64) error {
+	if ns == AllNamespaces {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	// type definitions span multiple lines and inner lines have no prefix,
+	// exports made before namespaces were added have no prefixes at all
+	keep := ns == 0
+	return filterLines(r, w, func(line string) bool {
+		if m := schemaNamespaceRe.FindStringSubmatch(line); m != nil {
+			keep = parseNamespace(m[1]) == ns
+		}
+		return keep
+	})
+}
+
+func filterLines(r io.Reader, w io.Writer, keep func(line string) bool) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if !keep(sc.Text()) {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, sc.Text()); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+func parseNamespace(hex string) int64 {
+	n, err := strconv.ParseInt(hex, 16, 64)
+	if err != nil {
+		return AllNamespaces
+	}
+
+	return n
+}
+
+// load runs live loader, its output goes to the log and its progress
+// against nquads downloaded is reported. With throttle rate RDF files
+// are fed to live loader through named pipes.
+func (r *Restorer) load(ctx context.Context, files []string, schema string, nquads int64, opts Options) (err error) {
+	var fd *feeder
+	if r.throttle.MutationsPerSecond > 0 {
+		fd = newFeeder(r.throttle)
+		fctx, stop := context.WithCancel(ctx)
+		defer func() {
+			stop()
+			if ferr := fd.close(); ferr != nil && err == nil {
+				err = fmt.Errorf("failed to feed live loader: %w", ferr)
+			}
+		}()
+		go fd.recoverRate(fctx)
+
+		piped := make([]string, 0, len(files))
+		for _, file := range files {
+			pipe, err := fd.pipe(fctx, file, filepath.Dir(schema))
+			if err != nil {
+				return err
+			}
+			piped = append(piped, pipe)
+		}
+		files = piped
+		klog.Infof("restore is throttled to %.1f mutations/s", r.throttle.MutationsPerSecond)
+	}
+
+	args := []string{"live",
+		"--files", strings.Join(files, ","),
+		"--schema", schema,
+		"--alpha", opts.Alpha,
+		"--zero", opts.Zero,
+	}
+	if opts.TargetNamespace != AllNamespaces {
+		args = append(args, "--force-namespace", strconv.FormatInt(opts.TargetNamespace, 10))
+	}
+	args = append(args, r.throttle.args()...)
+
+	cmd := exec.CommandContext(ctx, r.binary, args...)
+	cmd.Env = os.Environ()
+	// loader output is redacted of every credential it may echo
+	secrets := []string{opts.Password, opts.NamespacePassword}
+	if opts.User != "" {
+		// credentials are passed with environment to keep them out of process list
+		creds := fmt.Sprintf("user=%s;password=%s", opts.User, opts.Password)
+		cmd.Env = append(cmd.Env, "DGRAPH_LIVE_CREDS="+creds)
+		secrets = append([]string{creds}, secrets...)
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	klog.Infof("running %s %s", r.binary, strings.Join(args, " "))
+	job.Report(ctx, "load", "running live loader into %s", opts.Alpha)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// the last line of output usually explains failure, e.g. rejected login
+	var last string
+	pr := newProgress(nquads)
+	sc := bufio.NewScanner(out)
+	for sc.Scan() {
+		last = redact.String(sc.Text(), secrets...)
+		klog.Info(last)
+		pr.observe(ctx, last)
+		if fd != nil {
+			fd.observe(ctx, last)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if last != "" {
+			err = fmt.Errorf("%w: %s", err, last)
+		}
+		return failure.Classify(fmt.Errorf("live loader failed: %w", err))
+	}
+	pr.done(ctx)
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/acl"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/failure"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// WithAdmin sets retries and User-Agent of target cluster admin endpoint
+// requests, which create namespaces, apply ACL and GraphQL schema.
+func WithAdmin(attempts int, userAgent string) Option {
+	return func(r *Restorer) {
+		r.adminAttempts = attempts
+		r.userAgent = userAgent
+	}
+}
+
+// prepare creates restored namespace and applies ACL recorded in manifest
+// of backup id to it as requested by opts, so restored environment is
+// usable without manual admin steps. Manifest is returned for applying
+// GraphQL schema after load, it's nil when nothing is requested.
+func (r *Restorer) prepare(ctx context.Context, id string, opts Options) (*manifest.Manifest, error) {
+	if !opts.CreateNamespace && !opts.ApplyACL && !opts.ApplyGraphQLSchema {
+		return nil, nil
+	}
+	if opts.Admin == "" {
+		return nil, fmt.Errorf("admin endpoint of target cluster is required to create namespace, apply ACL or GraphQL schema")
+	}
+	if (opts.CreateNamespace || opts.ApplyACL) && opts.User == "" {
+		return nil, fmt.Errorf("user of target cluster is required to create namespace or apply ACL")
+	}
+
+	m, err := manifest.Read(ctx, r.storage, id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		m = &manifest.Manifest{}
+	case err != nil:
+		return nil, failure.Wrap(failure.ErrDestination, err)
+	}
+
+	// GraphQL schema is applied after load, it's checked before it
+	if opts.ApplyGraphQLSchema {
+		if m.GraphQL == nil {
+			return nil, fmt.Errorf("backup %s has no GraphQL schema captured", id)
+		}
+		ns, err := recordedTarget(m.GraphQL.Namespace, opts)
+		if err != nil {
+			return nil, fmt.Errorf("GraphQL schema of backup %s: %w", id, err)
+		}
+		if ns != 0 && opts.User == "" {
+			return nil, fmt.Errorf("user of target cluster is required to apply GraphQL schema to namespace %d", ns)
+		}
+	}
+
+	if opts.CreateNamespace {
+		ns, ok := restoredNamespace(opts, m)
+		if !ok {
+			return nil, fmt.Errorf("backup holds all namespaces, source or target namespace is required to create namespace")
+		}
+		if err := r.createNamespace(ctx, ns, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ApplyACL {
+		if err := r.applyACL(ctx, id, m, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// restoredNamespace returns namespace of target cluster data is loaded
+// into, it's unknown when all namespaces of backup are restored as is.
+func restoredNamespace(opts Options, m *manifest.Manifest) (int64, bool) {
+	switch {
+	case opts.TargetNamespace != AllNamespaces:
+		return opts.TargetNamespace, true
+	case opts.SourceNamespace != AllNamespaces:
+		return opts.SourceNamespace, true
+	case m.Namespace != nil && *m.Namespace >= 0:
+		return *m.Namespace, true
+	}
+
+	return 0, false
+}
+
+// recordedTarget returns namespace of target cluster ACL or GraphQL
+// schema recorded for namespace ns of backup is applied to, it fails
+// when data of another namespace is restored.
+func recordedTarget(ns int64, opts Options) (int64, error) {
+	if opts.SourceNamespace != AllNamespaces && opts.SourceNamespace != ns {
+		return 0, fmt.Errorf("it's recorded for namespace %d, not restored namespace %d", ns, opts.SourceNamespace)
+	}
+	if opts.TargetNamespace != AllNamespaces {
+		return opts.TargetNamespace, nil
+	}
+
+	return ns, nil
+}
+
+// adminClient returns client of target cluster admin endpoint logged into
+// namespace ns, as groot unless it's default namespace. Client isn't
+// logged in without user, e.g. in clusters without ACL.
+func (r *Restorer) adminClient(ctx context.Context, ns int64, opts Options) (*acl.Client, error) {
+	c, err := acl.NewClient(opts.Admin,
+		acl.WithRetries(r.adminAttempts),
+		acl.WithUserAgent(r.userAgent),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if opts.User == "" {
+		return c, nil
+	}
+
+	user, password := opts.User, opts.Password
+	if ns != 0 {
+		user, password = acl.Groot, opts.namespacePassword()
+	}
+	if err := c.Login(ctx, user, password, ns); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (o Options) namespacePassword() string {
+	if o.NamespacePassword != "" {
+		return o.NamespacePassword
+	}
+
+	return o.Password
+}
+
+// createNamespace creates namespace ns unless it exists. Dgraph chooses
+// IDs of created namespaces, so restore fails when it's not ns.
+func (r *Restorer) createNamespace(ctx context.Context, ns int64, opts Options) error {
+	// default namespace always exists
+	if ns == 0 {
+		return nil
+	}
+
+	c, err := r.adminClient(ctx, 0, opts)
+	if err != nil {
+		return err
+	}
+
+	namespaces, err := c.Namespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	if slices.Contains(namespaces, ns) {
+		klog.Infof("namespace %d exists in target cluster", ns)
+		return nil
+	}
+
+	id, err := c.AddNamespace(ctx, opts.namespacePassword())
+	if err != nil {
+		return err
+	}
+	if id != ns {
+		return fmt.Errorf("dgraph created namespace %d instead of %d, it chooses IDs of new namespaces; restore into namespace %d instead", id, ns, id)
+	}
+
+	klog.Infof("created namespace %d in target cluster", ns)
+	job.Report(ctx, "namespace", "created %d", ns)
+
+	return nil
+}
+
+// applyACL creates groups recorded in manifest m of backup id in
+// namespace they are restored into.
+func (r *Restorer) applyACL(ctx context.Context, id string, m *manifest.Manifest, opts Options) error {
+	if m.ACL == nil {
+		return fmt.Errorf("backup %s has no ACL recorded", id)
+	}
+	ns, err := recordedTarget(m.ACL.Namespace, opts)
+	if err != nil {
+		return fmt.Errorf("ACL of backup %s: %w", id, err)
+	}
+
+	c, err := r.adminClient(ctx, ns, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Apply(ctx, m.ACL.Groups); err != nil {
+		return err
+	}
+
+	klog.Infof("applied %d ACL groups of backup %s to namespace %d", len(m.ACL.Groups), id, ns)
+	job.Report(ctx, "acl", "applied %d groups to namespace %d", len(m.ACL.Groups), ns)
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package restore
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+)
+
+// Throttle limits load live loader puts on target cluster, so
+// restores into live clusters don't take the service down.
+type Throttle struct {
+	// MutationsPerSecond is initial and maximal rate of mutations,
+	// it's halved when Dgraph reports backpressure and recovers while
+	// it doesn't. Zero disables rate limiting.
+	MutationsPerSecond float64
+	// Batch is number of N-Quads per mutation, live loader default when zero.
+	Batch int
+	// MaxPending caps transactions live loader has pending at once,
+	// live loader default when zero.
+	MaxPending int
+}
+
+// WithThrottle limits mutations of live loader.
+func WithThrottle(t Throttle) Option {
+	return func(r *Restorer) {
+		r.throttle = t
+	}
+}
+
+// liveBatch is default --batch of live loader.
+const liveBatch = 1000
+
+const (
+	// throttleCooldown is how long rate isn't lowered again after
+	// backpressure, live loader logs every failed mutation of a burst.
+	throttleCooldown = 10 * time.Second
+	// throttleRecovery is how often rate is raised back while there
+	// is no backpressure.
+	throttleRecovery = 30 * time.Second
+)
+
+// backpressureRe matches live loader output lines with errors Dgraph
+// returns when it can't keep up with mutations.
+var backpressureRe = regexp.MustCompile(`(?i)too many pending|pending proposals|overloaded|resourceexhausted|too many requests`)
+
+// args returns live loader flags of t.
+func (t Throttle) args() []string {
+	var args []string
+	if t.Batch > 0 {
+		args = append(args, "--batch", strconv.Itoa(t.Batch))
+	}
+	if t.MaxPending > 0 {
+		args = append(args, "--conc", strconv.Itoa(t.MaxPending))
+	}
+
+	return args
+}
+
+// feeder streams RDF files to live loader through named pipes at
+// limited rate, which is adapted to backpressure reported by Dgraph.
+type feeder struct {
+	limiter *rate.Limiter
+	max     rate.Limit
+	batch   int
+
+	mu   sync.Mutex
+	last time.Time
+
+	wg    sync.WaitGroup
+	pipes []string
+	errs  chan error
+}
+
+func newFeeder(t Throttle) *feeder {
+	batch := t.Batch
+	if batch == 0 {
+		batch = liveBatch
+	}
+
+	return &feeder{
+		limiter: rate.NewLimiter(rate.Limit(t.MutationsPerSecond), 1),
+		max:     rate.Limit(t.MutationsPerSecond),
+		batch:   batch,
+		errs:    make(chan error, 1),
+	}
+}
+
+// pipe returns path live loader reads file from. RDF files are fed
+// through named pipe in dir, other ones, e.g. JSON of materialized
+// deltas, aren't split into mutations by lines and are read as is.
+func (f *feeder) pipe(ctx context.Context, file, dir string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(file), ".gz")
+	if filepath.Ext(name) != ".rdf" {
+		return file, nil
+	}
+
+	pipe := filepath.Join(dir, fmt.Sprintf("throttled-%d-%s", len(f.pipes), name))
+	if err := mkfifo(pipe); err != nil {
+		return "", err
+	}
+	f.pipes = append(f.pipes, pipe)
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		// pipe closed early looks like complete file to live loader,
+		// so error is kept even when live loader exited meanwhile
+		if err := f.feed(ctx, file, pipe); err != nil && !errors.Is(err, context.Canceled) {
+			select {
+			case f.errs <- fmt.Errorf("%s: %w", filepath.Base(file), err):
+			default:
+			}
+		}
+	}()
+
+	return pipe, nil
+}
+
+// feed writes lines of file into pipe, waiting for limiter before
+// every batch of them.
+func (f *feeder) feed(ctx context.Context, file, pipe string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if strings.HasSuffix(file, ".gz") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	// opening blocks until live loader opens pipe for reading
+	out, err := os.OpenFile(pipe, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n := 0; sc.Scan(); n++ {
+		if n%f.batch == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if err := f.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, sc.Text()); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// observe slows feeding down when live loader output line reports
+// backpressure.
+func (f *feeder) observe(ctx context.Context, line string) {
+	if !backpressureRe.MatchString(line) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.last) < throttleCooldown {
+		return
+	}
+	f.last = time.Now()
+
+	limit := max(f.limiter.Limit()/2, f.max/100)
+	f.limiter.SetLimit(limit)
+	klog.Warningf("dgraph reports backpressure, restore is slowed down to %.1f mutations/s", float64(limit))
+	job.Report(ctx, "throttle", "backpressure, %.1f mutations/s", float64(limit))
+}
+
+// recoverRate raises rate back by quarter every throttleRecovery
+// without backpressure until ctx is done.
+func (f *feeder) recoverRate(ctx context.Context) {
+	t := time.NewTicker(throttleRecovery)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			f.mu.Lock()
+			if limit := f.limiter.Limit(); limit < f.max && time.Since(f.last) >= throttleRecovery {
+				limit = min(limit*5/4, f.max)
+				f.limiter.SetLimit(limit)
+				klog.Infof("no backpressure from dgraph, restore is sped up to %.1f mutations/s", float64(limit))
+				job.Report(ctx, "throttle", "recovered, %.1f mutations/s", float64(limit))
+			}
+			f.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// close waits for feeding goroutines once live loader exited and
+// returns error of the first failed one. Writers still waiting for
+// live loader to open their pipes are released by opening them.
+func (f *feeder) close() error {
+	for _, pipe := range f.pipes {
+		if p, err := openReleasing(pipe); err == nil {
+			p.Close()
+		}
+	}
+	f.wg.Wait()
+
+	select {
+	case err := <-f.errs:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package restorepoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/checksum"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// Check returns restore point by id like Get, and when it's verified
+// also reads its files back on pool workers and compares them with
+// checksums recorded in manifest, so silently corrupted files are found
+// before restore needs them. Point of mismatched or vanished file is not
+// verified and has the Problem set.
+func Check(ctx context.Context, s storage.Storage, id string, opts ...Option) (*Point, error) {
+	o := newOptions(opts)
+
+	p, err := Get(ctx, s, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Verified {
+		return p, nil
+	}
+
+	m, err := manifest.Read(ctx, s, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Checksums) == 0 {
+		return p, nil
+	}
+
+	var (
+		cache        *verification
+		fingerprints map[string]string
+	)
+	if o.cache {
+		if cache, fingerprints, err = readVerification(ctx, s, id); err != nil {
+			return nil, err
+		}
+	}
+
+	problems := make([]string, len(m.Files))
+	verified := make([]*verifiedFile, len(m.Files))
+	var cached atomic.Int64
+	err = o.pool.Run(ctx, "verify", len(m.Files), func(ctx context.Context, i int) error {
+		file := m.Files[i]
+		want, ok := m.Checksums[file]
+		if !ok {
+			return nil
+		}
+		fp := fingerprints[file]
+		if cache.fresh(file, fp, want, o.cacheAge) {
+			cached.Add(1)
+			return nil
+		}
+
+		r, err := s.Get(ctx, file)
+		if errors.Is(err, storage.ErrNotFound) {
+			problems[i] = fmt.Sprintf("file %s is missing", file)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		got, _, err := checksum.Compute(r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if got != want {
+			problems[i] = fmt.Sprintf("file %s has checksum %s, %s expected", file, got, want)
+		} else if fp != "" {
+			verified[i] = &verifiedFile{Fingerprint: fp, Checksum: got, VerifiedAt: time.Now()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cache != nil {
+		if n := cached.Load(); n > 0 {
+			klog.Infof("%d files of %s are unchanged since verified last time", n, id)
+		}
+		if updateVerification(cache, m.Files, verified) {
+			// cache only saves reading files next time, verification stands without it
+			if err := writeVerification(ctx, s, id, cache); err != nil {
+				klog.Warningf("failed to write verification cache of %s: %v", id, err)
+			}
+		}
+	}
+
+	for _, problem := range problems {
+		if problem != "" {
+			p.Problem = problem
+			p.Verified = false
+			break
+		}
+	}
+
+	return p, nil
+}
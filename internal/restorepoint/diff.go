@@ -0,0 +1,132 @@
+package restorepoint
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/dgraph/schema"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// Diff tells how much changed between two restore points. Files are
+// matched by name, since every export is written into its own directory.
+type Diff struct {
+	From Point `json:"from"`
+	To   Point `json:"to"`
+	// FilesChange and SizeChange are differences of To and From.
+	FilesChange  int          `json:"filesChange"`
+	SizeChange   int64        `json:"sizeChange"`
+	AddedFiles   []string     `json:"addedFiles,omitempty"`
+	RemovedFiles []string     `json:"removedFiles,omitempty"`
+	ChangedFiles []FileChange `json:"changedFiles,omitempty"`
+	// Schema is schema change, it's nil unless requested and recorded
+	// in manifests of both points.
+	Schema *schema.Diff `json:"schema,omitempty"`
+}
+
+// FileChange is size change of file present in both points.
+type FileChange struct {
+	Name     string `json:"name"`
+	FromSize int64  `json:"fromSize"`
+	ToSize   int64  `json:"toSize"`
+}
+
+// Compare returns difference between restore points from and to,
+// schema summaries recorded in their manifests are compared as well
+// when withSchema is set.
+func Compare(ctx context.Context, s storage.Storage, from, to string, withSchema bool, opts ...Option) (*Diff, error) {
+	fp, err := Get(ctx, s, from, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tp, err := Get(ctx, s, to, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{
+		From:        *fp,
+		To:          *tp,
+		FilesChange: tp.Files - fp.Files,
+		SizeChange:  tp.Size - fp.Size,
+	}
+
+	fromSizes, err := fileSizes(ctx, s, from)
+	if err != nil {
+		return nil, err
+	}
+	toSizes, err := fileSizes(ctx, s, to)
+	if err != nil {
+		return nil, err
+	}
+	for name, size := range toSizes {
+		prev, ok := fromSizes[name]
+		switch {
+		case !ok:
+			d.AddedFiles = append(d.AddedFiles, name)
+		case prev != size:
+			d.ChangedFiles = append(d.ChangedFiles, FileChange{Name: name, FromSize: prev, ToSize: size})
+		}
+	}
+	for name := range fromSizes {
+		if _, ok := toSizes[name]; !ok {
+			d.RemovedFiles = append(d.RemovedFiles, name)
+		}
+	}
+	sort.Strings(d.AddedFiles)
+	sort.Strings(d.RemovedFiles)
+	sort.Slice(d.ChangedFiles, func(i, j int) bool { return d.ChangedFiles[i].Name < d.ChangedFiles[j].Name })
+
+	if withSchema {
+		if d.Schema, err = compareSchema(ctx, s, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// fileSizes returns sizes of files of point id by name, service
+// objects like manifest aren't included, as they aren't in Point.Files.
+func fileSizes(ctx context.Context, s storage.Storage, id string) (map[string]int64, error) {
+	objs, err := s.List(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(objs))
+	for _, obj := range objs {
+		switch name := path.Base(obj.Key); name {
+		case manifest.Name, manifest.SignatureName, HoldName, VerificationName:
+		default:
+			sizes[name] = obj.Size
+		}
+	}
+
+	return sizes, nil
+}
+
+// compareSchema returns schema change between points, nil when manifest
+// of either point has no schema summary.
+func compareSchema(ctx context.Context, s storage.Storage, from, to string) (*schema.Diff, error) {
+	var schemas []*schema.Schema
+	for _, id := range []string{from, to} {
+		m, err := manifest.Read(ctx, s, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m.Schema == nil {
+			return nil, nil
+		}
+		schemas = append(schemas, m.Schema)
+	}
+
+	diff := schemas[1].Compare(schemas[0])
+	return &diff, nil
+}
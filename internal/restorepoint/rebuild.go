@@ -0,0 +1,111 @@
+package restorepoint
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/signing"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// exportDirRe matches directory name of Dgraph export,
+// e.g. dgraph.r20054.u1013.1114 exported on October 13 at 11:14 UTC.
+var exportDirRe = regexp.MustCompile(`^dgraph\.r\d+\.u(\d{4}\.\d{4})$`)
+
+// Rebuild writes manifests for exports found at destination without them,
+// e.g. made before the tool was adopted, so they become verified restore
+// points. Manifests are signed with signer unless it's nil. Returns ids
+// of rebuilt points, in dry-run mode nothing is written.
+func Rebuild(ctx context.Context, s storage.Storage, dest string, signer signing.Signer, dryRun bool) ([]string, error) {
+	objects, err := s.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string][]storage.Object)
+	for _, obj := range objects {
+		dir, _, ok := strings.Cut(obj.Key, "/")
+		if ok && strings.HasPrefix(dir, exportDirPrefix) {
+			dirs[dir] = append(dirs[dir], obj)
+		}
+	}
+
+	var rebuilt []string
+	for dir, objs := range dirs {
+		m := rebuildManifest(dir, objs)
+		if m == nil {
+			continue
+		}
+		m.Destination = dest
+
+		if dryRun {
+			klog.Infof("dry-run: would write manifest of %s with %d files", dir, len(m.Files))
+		} else if _, err := m.Write(ctx, s, signer); err != nil {
+			return rebuilt, err
+		}
+		rebuilt = append(rebuilt, dir)
+	}
+	sort.Strings(rebuilt)
+
+	return rebuilt, nil
+}
+
+// rebuildManifest returns manifest of export in dir,
+// nil when it has one already or has no exported files.
+func rebuildManifest(dir string, objs []storage.Object) *manifest.Manifest {
+	m := &manifest.Manifest{Rebuilt: true}
+	var modified time.Time
+	for _, obj := range objs {
+		name := path.Base(obj.Key)
+		switch {
+		case name == manifest.Name:
+			return nil
+		case name == HoldName, name == manifest.SignatureName, name == VerificationName:
+			continue
+		case strings.HasSuffix(name, ".rdf.gz"):
+			m.Format = "rdf"
+		case strings.HasSuffix(name, ".json.gz") && m.Format == "":
+			m.Format = "json"
+		}
+		m.Files = append(m.Files, obj.Key)
+		if obj.LastModified.After(modified) {
+			modified = obj.LastModified
+		}
+	}
+	if len(m.Files) == 0 {
+		return nil
+	}
+	sort.Strings(m.Files)
+	m.CreatedAt = exportTime(dir, modified)
+
+	return m
+}
+
+// exportTime returns export time encoded in directory name, the name
+// has no year, so it's taken from modification time of exported files.
+func exportTime(dir string, modified time.Time) time.Time {
+	match := exportDirRe.FindStringSubmatch(dir)
+	if match == nil || modified.IsZero() {
+		return modified
+	}
+
+	modified = modified.UTC()
+	t, err := time.Parse("0102.1504", match[1])
+	if err != nil {
+		return modified
+	}
+	t = t.AddDate(modified.Year()-t.Year(), 0, 0)
+	if t.After(modified) {
+		// export started in previous year and finished in this one
+		t = t.AddDate(-1, 0, 0)
+	}
+
+	return t
+}
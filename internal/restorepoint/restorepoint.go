@@ -0,0 +1,449 @@
+package restorepoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/manifest"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/podinfo"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/signing"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/worker"
+)
+
+// ErrProtected is returned by Delete for backups that must be kept.
+var ErrProtected = errors.New("backup is protected")
+
+// TypeFull is the type of points made by exports, each export
+// contains whole dataset and doesn't depend on others.
+const TypeFull = "full"
+
+// TypeDelta is the type of points made by differential exports, they hold
+// nodes modified since the previous point and depend on Base export.
+const TypeDelta = "delta"
+
+// FormatRDF is the format of exports restore loads, exports in other
+// formats, e.g. json for analytics, can't be restored from.
+const FormatRDF = "rdf"
+
+// HoldName is the name of marker object excluding export from retention.
+const HoldName = "export-hold.json"
+
+// exportDirPrefix is the prefix of directories Dgraph writes exports to,
+// e.g. dgraph.r20054.u1013.1114.
+const exportDirPrefix = "dgraph."
+
+// Point is an export that can be restored from.
+type Point struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Files    int       `json:"files"`
+	Size     int64     `json:"size"`
+	Verified bool      `json:"verified"`
+	Held     bool      `json:"held"`
+	Problem  string    `json:"problem,omitempty"`
+	Base     string    `json:"base,omitempty"`
+	// Format is format of exported files, rdf or json, it's empty
+	// when manifest is missing.
+	Format string `json:"format,omitempty"`
+	// Namespace is Dgraph namespace exported, negative for all of
+	// them, it's nil when manifest doesn't record it.
+	Namespace *int64 `json:"namespace,omitempty"`
+	// Pod is Kubernetes pod export was taken by, if manifest records it.
+	Pod *podinfo.Info `json:"pod,omitempty"`
+	// Signature is state of manifest signature, it's empty
+	// when points are listed without verifier.
+	Signature string `json:"signature,omitempty"`
+}
+
+// Cluster returns whether point is export of the whole cluster, exports
+// without recorded namespace are made of it.
+func (p Point) Cluster() bool {
+	return p.Namespace == nil || *p.Namespace < 0
+}
+
+// Restorable returns whether point is full export restore can load,
+// exports in formats other than RDF aren't.
+func (p Point) Restorable() bool {
+	return p.Type == TypeFull && (p.Format == "" || p.Format == FormatRDF)
+}
+
+// SameNamespace returns whether p and other are exports of the same
+// namespace or both of the whole cluster.
+func (p Point) SameNamespace(other Point) bool {
+	if p.Cluster() || other.Cluster() {
+		return p.Cluster() == other.Cluster()
+	}
+
+	return *p.Namespace == *other.Namespace
+}
+
+// Signature states of points listed with verifier.
+const (
+	SignatureValid   = "valid"
+	SignatureMissing = "missing"
+	SignatureInvalid = "invalid"
+)
+
+type options struct {
+	verifier  signing.Verifier
+	freshness time.Duration
+	pool      *worker.Pool
+	cache     bool
+	cacheAge  time.Duration
+}
+
+type Option func(*options)
+
+// WithVerifier checks manifest signatures, points with missing
+// or invalid one are not verified.
+func WithVerifier(v signing.Verifier) Option {
+	return func(o *options) {
+		o.verifier = v
+	}
+}
+
+// WithFreshness makes Delete refuse deleting backups unless a verified
+// full backup was made within window, see Fresh.
+func WithFreshness(window time.Duration) Option {
+	return func(o *options) {
+		o.freshness = window
+	}
+}
+
+// WithPool makes Copy upload objects on pool workers.
+func WithPool(pool *worker.Pool) Option {
+	return func(o *options) {
+		o.pool = pool
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// List returns restore points found at destination, newest first.
+// Point is verified when its manifest exists and all files listed
+// in the manifest are present.
+func List(ctx context.Context, s storage.Storage, opts ...Option) ([]Point, error) {
+	o := newOptions(opts)
+
+	objects, err := s.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string][]storage.Object)
+	for _, obj := range objects {
+		dir, _, ok := strings.Cut(obj.Key, "/")
+		if !ok {
+			continue
+		}
+		dirs[dir] = append(dirs[dir], obj)
+	}
+
+	points := make([]Point, 0, len(dirs))
+	for dir, objs := range dirs {
+		p, ok, err := point(ctx, s, dir, objs, o)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			points = append(points, p)
+		}
+	}
+
+	sort.Slice(points, func(i, k int) bool {
+		return points[i].Time.After(points[k].Time)
+	})
+
+	return points, nil
+}
+
+// Get returns restore point by id.
+func Get(ctx context.Context, s storage.Storage, id string, opts ...Option) (*Point, error) {
+	if id == "" || strings.Contains(id, "/") || id == "." || id == ".." {
+		return nil, fmt.Errorf("%w: %q", storage.ErrNotFound, id)
+	}
+
+	objs, err := s.List(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	p, _, err := point(ctx, s, id, objs, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Hold excludes restore point from retention until it's released.
+func Hold(ctx context.Context, s storage.Storage, id, reason string) (*Point, error) {
+	if _, err := Get(ctx, s, id); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(struct {
+		Reason    string    `json:"reason,omitempty"`
+		CreatedAt time.Time `json:"createdAt"`
+	}{
+		Reason:    reason,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Put(ctx, path.Join(id, HoldName), bytes.NewReader(b), int64(len(b))); err != nil {
+		return nil, err
+	}
+
+	return Get(ctx, s, id)
+}
+
+// Release makes held restore point subject to retention again.
+func Release(ctx context.Context, s storage.Storage, id string) (*Point, error) {
+	if _, err := Get(ctx, s, id); err != nil {
+		return nil, err
+	}
+
+	if err := s.Delete(ctx, path.Join(id, HoldName)); err != nil {
+		return nil, err
+	}
+
+	return Get(ctx, s, id)
+}
+
+// Delete removes restore point objects. Unless force is set, it refuses
+// to delete held point, the last verified restorable one and any point
+// when there is no fresh backup.
+func Delete(ctx context.Context, s storage.Storage, id string, force bool, opts ...Option) error {
+	o := newOptions(opts)
+
+	p, err := Get(ctx, s, id, opts...)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		if p.Held {
+			return fmt.Errorf("%w: %s is held", ErrProtected, id)
+		}
+
+		points, err := List(ctx, s, opts...)
+		if err != nil {
+			return err
+		}
+		if err := Fresh(points, o.freshness, time.Now()); err != nil {
+			return err
+		}
+
+		if p.Verified && p.Restorable() {
+			other := 0
+			for _, point := range points {
+				if point.ID != id && point.Verified && point.Restorable() && point.SameNamespace(*p) {
+					other++
+				}
+			}
+			if other == 0 {
+				return fmt.Errorf("%w: %s is the only remaining verified full RDF backup of its namespace", ErrProtected, id)
+			}
+		}
+	}
+
+	return DeleteObjects(ctx, s, id)
+}
+
+// Fresh returns error wrapping ErrProtected unless points have a verified
+// full backup of the whole cluster made within window, so older backups
+// aren't deleted while exports fail. Exports of single namespaces and in
+// formats restore doesn't load don't count, cluster can't be restored
+// from them. Zero window disables the check.
+func Fresh(points []Point, window time.Duration, now time.Time) error {
+	if window <= 0 {
+		return nil
+	}
+
+	for _, p := range points {
+		if p.Restorable() && p.Cluster() && p.Verified && now.Sub(p.Time) <= window {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no verified full backup was made in the last %s", ErrProtected, window)
+}
+
+// DeleteObjects removes all objects of restore point, skipping ones
+// retention policy (e.g. S3 Object Lock) forbids deleting.
+func DeleteObjects(ctx context.Context, s storage.Storage, id string) error {
+	objects, err := s.List(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		err := s.Delete(ctx, obj.Key)
+		if errors.Is(err, storage.ErrRetained) {
+			klog.Warningf("skip deleting %s: %v", obj.Key, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Copy copies restore point objects from src to dst storage,
+// hold marker is not copied. It returns number of copied bytes.
+func Copy(ctx context.Context, dst, src storage.Storage, id string, opts ...Option) (int64, error) {
+	o := newOptions(opts)
+
+	if _, err := Get(ctx, src, id); err != nil {
+		return 0, err
+	}
+
+	objects, err := src.List(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var copied []storage.Object
+	for _, obj := range objects {
+		// verification cache holds ETags of source objects
+		if name := path.Base(obj.Key); name != HoldName && name != VerificationName {
+			copied = append(copied, obj)
+		}
+	}
+
+	var size atomic.Int64
+	err = o.pool.Run(ctx, "upload", len(copied), func(ctx context.Context, i int) error {
+		obj := copied[i]
+		if err := storage.Copy(ctx, dst, src, obj); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", obj.Key, err)
+		}
+		size.Add(obj.Size)
+
+		return nil
+	})
+
+	return size.Load(), err
+}
+
+func point(ctx context.Context, s storage.Storage, dir string, objs []storage.Object, o *options) (Point, bool, error) {
+	p := Point{
+		ID:   dir,
+		Type: TypeFull,
+	}
+
+	present := make(map[string]int64, len(objs))
+	hasManifest := false
+	for _, obj := range objs {
+		switch path.Base(obj.Key) {
+		case manifest.Name:
+			hasManifest = true
+			continue
+		case manifest.SignatureName, VerificationName:
+			continue
+		case HoldName:
+			p.Held = true
+			continue
+		}
+		present[obj.Key] = obj.Size
+		p.Files++
+		p.Size += obj.Size
+		if obj.LastModified.After(p.Time) {
+			p.Time = obj.LastModified
+		}
+	}
+
+	if !hasManifest {
+		p.Problem = "manifest is missing"
+		return p, strings.HasPrefix(dir, exportDirPrefix), nil
+	}
+
+	m, err := manifest.Read(ctx, s, dir)
+	if err != nil {
+		return p, false, err
+	}
+	p.Time = m.CreatedAt
+	p.Format = m.Format
+	p.Namespace = m.Namespace
+	p.Pod = m.Pod
+	if m.Delta != nil {
+		p.Type = TypeDelta
+		p.Base = m.Delta.Base
+	}
+	p.Problem = problem(m, present)
+	if o.verifier != nil {
+		err := manifest.Verify(ctx, s, dir, o.verifier)
+		switch {
+		case err == nil:
+			p.Signature = SignatureValid
+		case errors.Is(err, manifest.ErrUnsigned):
+			p.Signature = SignatureMissing
+		case errors.Is(err, signing.ErrInvalid):
+			p.Signature = SignatureInvalid
+		default:
+			return p, false, fmt.Errorf("failed to verify manifest of %s: %w", dir, err)
+		}
+		// other problems come from manifest that can't be trusted then
+		if p.Signature != SignatureValid {
+			p.Problem = fmt.Sprintf("manifest signature is %s", p.Signature)
+		}
+	}
+	p.Verified = p.Problem == ""
+
+	return p, true, nil
+}
+
+// problem returns why export described by m can't be restored from,
+// present are sizes of files found at destination.
+func problem(m *manifest.Manifest, present map[string]int64) string {
+	if len(m.Files) == 0 {
+		return "manifest lists no files"
+	}
+	for _, file := range m.Files {
+		size, ok := present[file]
+		if !ok {
+			return fmt.Sprintf("file %s is missing", file)
+		}
+		if want, ok := m.Sizes[file]; ok && size != want {
+			return fmt.Sprintf("file %s has %d bytes, %d expected", file, size, want)
+		}
+	}
+	if m.GraphQL != nil {
+		if _, ok := present[m.GraphQL.File]; !ok {
+			return fmt.Sprintf("GraphQL schema file %s is missing", m.GraphQL.File)
+		}
+	}
+	for _, g := range m.Cluster.Groups {
+		if g.Status == manifest.GroupMissing {
+			return fmt.Sprintf("files of group %d are missing", g.ID)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,130 @@
+package restorepoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// VerificationName is the name of object results of Check are cached in,
+// so files which haven't changed since aren't read back again.
+const VerificationName = "verification.json"
+
+// WithVerificationCache makes Check skip reading files which have the same
+// ETag and checksum as when it verified them last time, within maxAge or,
+// when it's 0, until they change.
+func WithVerificationCache(maxAge time.Duration) Option {
+	return func(o *options) {
+		o.cache = true
+		o.cacheAge = maxAge
+	}
+}
+
+// verification is results of Check of restore point files by key.
+type verification struct {
+	Files map[string]verifiedFile `json:"files"`
+}
+
+// verifiedFile tells file with Fingerprint matched Checksum at VerifiedAt.
+type verifiedFile struct {
+	Fingerprint string    `json:"fingerprint"`
+	Checksum    string    `json:"checksum"`
+	VerifiedAt  time.Time `json:"verifiedAt"`
+}
+
+// fingerprint identifies object content without reading it: by ETag where
+// storage reports it, by size and modification time otherwise.
+func fingerprint(obj storage.Object) string {
+	if obj.ETag != "" {
+		return obj.ETag
+	}
+
+	return fmt.Sprintf("%d-%d", obj.Size, obj.LastModified.UnixNano())
+}
+
+// fresh tells whether file with fingerprint fp was verified to have checksum
+// want recently enough to be trusted without reading it.
+func (v *verification) fresh(file, fp, want string, maxAge time.Duration) bool {
+	if v == nil || fp == "" {
+		return false
+	}
+	f, ok := v.Files[file]
+	if !ok || f.Fingerprint != fp || f.Checksum != want {
+		return false
+	}
+
+	return maxAge == 0 || time.Since(f.VerifiedAt) < maxAge
+}
+
+// updateVerification records files verified by Check in cache and drops
+// ones no longer in manifest, it tells whether cache has changed.
+func updateVerification(v *verification, files []string, verified []*verifiedFile) bool {
+	changed := false
+	for i, f := range verified {
+		if f != nil {
+			v.Files[files[i]] = *f
+			changed = true
+		}
+	}
+
+	keep := make(map[string]bool, len(files))
+	for _, file := range files {
+		keep[file] = true
+	}
+	for file := range v.Files {
+		if !keep[file] {
+			delete(v.Files, file)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// readVerification returns cached results of point id and fingerprints of
+// its objects by key.
+func readVerification(ctx context.Context, s storage.Storage, id string) (*verification, map[string]string, error) {
+	objs, err := s.List(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	fingerprints := make(map[string]string, len(objs))
+	for _, obj := range objs {
+		fingerprints[obj.Key] = fingerprint(obj)
+	}
+
+	v := &verification{Files: map[string]verifiedFile{}}
+	r, err := s.Get(ctx, path.Join(id, VerificationName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return v, fingerprints, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	// broken cache is rewritten after files are read back
+	if err := json.NewDecoder(r).Decode(v); err != nil || v.Files == nil {
+		klog.Warningf("verification cache of %s is ignored: %v", id, err)
+		v.Files = map[string]verifiedFile{}
+	}
+
+	return v, fingerprints, nil
+}
+
+func writeVerification(ctx context.Context, s storage.Storage, id string, v *verification) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, path.Join(id, VerificationName), bytes.NewReader(b), int64(len(b)))
+}
@@ -0,0 +1,230 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+type Action string
+
+const (
+	// ActionDelete removes expired exports.
+	ActionDelete Action = "delete"
+	// ActionTransition moves expired exports to archival storage class.
+	ActionTransition Action = "transition"
+)
+
+// Policy selects exports to expire. Export expires when it's not
+// among KeepLast newest ones and is older than MaxAge, zero values
+// don't limit corresponding dimension.
+type Policy struct {
+	KeepLast     int
+	MaxAge       time.Duration
+	Action       Action
+	StorageClass string
+
+	// MaxTotalSize expires the oldest exports with their deltas until
+	// total size of the rest is within it, zero disables the quota.
+	MaxTotalSize int64
+
+	// Freshness blocks deleting expired exports unless a verified full
+	// export was made within it, zero disables the check.
+	Freshness time.Duration
+}
+
+// Enabled returns whether policy expires anything.
+func (p Policy) Enabled() bool {
+	return p.KeepLast > 0 || p.MaxAge > 0 || p.MaxTotalSize > 0
+}
+
+// Expired returns points expired by policy, points are sorted newest first.
+// Held points never expire. Exports of every namespace and of the whole
+// cluster are kept separately, so tenant exports don't evict cluster ones.
+// Deltas don't count as exports kept, they expire with their base export,
+// since they can't be restored without it.
+func (p Policy) Expired(points []restorepoint.Point, now time.Time) []restorepoint.Point {
+	if !p.Enabled() {
+		return nil
+	}
+
+	var expired []restorepoint.Point
+	for _, group := range byNamespace(points) {
+		expired = append(expired, p.expired(group, now)...)
+	}
+
+	return expired
+}
+
+// byNamespace groups points by namespace they export, keeping order of
+// points and of groups by their newest point.
+func byNamespace(points []restorepoint.Point) [][]restorepoint.Point {
+	var groups [][]restorepoint.Point
+	index := make(map[int64]int)
+	for _, point := range points {
+		ns := int64(-1)
+		if !point.Cluster() {
+			ns = *point.Namespace
+		}
+		i, ok := index[ns]
+		if !ok {
+			i = len(groups)
+			index[ns] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], point)
+	}
+
+	return groups
+}
+
+// expired returns points of single namespace expired by policy.
+func (p Policy) expired(points []restorepoint.Point, now time.Time) []restorepoint.Point {
+	var expired []restorepoint.Point
+	// bases maps full exports to whether they are kept
+	bases := make(map[string]bool)
+	i := 0
+	for _, point := range points {
+		if point.Type == restorepoint.TypeDelta {
+			continue
+		}
+		bases[point.ID] = true
+		i++
+		if i <= p.KeepLast || point.Held {
+			continue
+		}
+		if p.KeepLast == 0 && p.MaxAge == 0 {
+			continue
+		}
+		if p.MaxAge > 0 && now.Sub(point.Time) < p.MaxAge {
+			continue
+		}
+		expired = append(expired, point)
+		bases[point.ID] = false
+	}
+	if p.MaxTotalSize > 0 {
+		expired = append(expired, p.overQuota(points, bases)...)
+	}
+
+	for _, point := range points {
+		if point.Type == restorepoint.TypeDelta && !point.Held && !bases[point.Base] {
+			expired = append(expired, point)
+		}
+	}
+
+	return expired
+}
+
+// overQuota returns the oldest kept full exports to expire, so points
+// left with their deltas fit MaxTotalSize, and marks them in bases.
+// Held points, bases of held deltas and the newest verified export restore
+// can load are never returned, so total size may stay over quota.
+func (p Policy) overQuota(points []restorepoint.Point, bases map[string]bool) []restorepoint.Point {
+	var total int64
+	sizes := make(map[string]int64)
+	pinned := make(map[string]bool)
+	newest := ""
+	for _, point := range points {
+		switch {
+		case point.Type == restorepoint.TypeDelta:
+			if !bases[point.Base] {
+				continue
+			}
+			sizes[point.Base] += point.Size
+			pinned[point.Base] = pinned[point.Base] || point.Held
+		case !bases[point.ID]:
+			continue
+		case newest == "" && point.Verified && point.Restorable():
+			newest = point.ID
+		}
+		total += point.Size
+	}
+
+	var expired []restorepoint.Point
+	for i := len(points) - 1; i >= 0 && total > p.MaxTotalSize; i-- {
+		point := points[i]
+		if point.Type == restorepoint.TypeDelta || !bases[point.ID] {
+			continue
+		}
+		if point.Held || pinned[point.ID] || point.ID == newest {
+			continue
+		}
+		expired = append(expired, point)
+		bases[point.ID] = false
+		total -= point.Size + sizes[point.ID]
+	}
+
+	return expired
+}
+
+// Apply applies policy action to expired exports at destination
+// and returns ids of processed exports. In dry-run mode nothing is changed,
+// ids of exports which would be processed are returned.
+// Deletion is refused with error wrapping restorepoint.ErrProtected
+// when there is no fresh export.
+func Apply(ctx context.Context, s storage.Storage, p Policy, dryRun bool, opts ...restorepoint.Option) ([]string, error) {
+	points, err := restorepoint.List(ctx, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if p.Action == ActionDelete {
+		if err := restorepoint.Fresh(points, p.Freshness, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	var done []string
+	for _, point := range p.Expired(points, time.Now()) {
+		if dryRun {
+			klog.Infof("dry-run: would %s export %s", p.Action, point.ID)
+			done = append(done, point.ID)
+			continue
+		}
+
+		if err := apply(ctx, s, p, point.ID); err != nil {
+			return done, fmt.Errorf("failed to %s export %s: %w", p.Action, point.ID, err)
+		}
+		done = append(done, point.ID)
+	}
+
+	return done, nil
+}
+
+func apply(ctx context.Context, s storage.Storage, p Policy, dir string) error {
+	switch p.Action {
+	case ActionDelete:
+		return restorepoint.DeleteObjects(ctx, s, dir)
+	case ActionTransition:
+		return transition(ctx, s, dir, p.StorageClass)
+	default:
+		return fmt.Errorf("unsupported retention action %q", p.Action)
+	}
+}
+
+func transition(ctx context.Context, s storage.Storage, dir, class string) error {
+	t, ok := s.(storage.Transitioner)
+	if !ok {
+		return fmt.Errorf("destination doesn't support storage classes")
+	}
+
+	objects, err := s.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if obj.StorageClass == class {
+			continue
+		}
+		if err := t.Transition(ctx, obj.Key, class); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
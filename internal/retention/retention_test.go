@@ -0,0 +1,208 @@
+package retention
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+)
+
+var now = time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+// point returns full export of namespace ns made days ago, ns -1 is
+// export of the whole cluster without namespace recorded.
+func point(id string, days int, ns int64) restorepoint.Point {
+	p := restorepoint.Point{
+		ID:       id,
+		Time:     now.Add(-time.Duration(days) * 24 * time.Hour),
+		Type:     restorepoint.TypeFull,
+		Size:     10,
+		Verified: true,
+	}
+	if ns >= 0 {
+		p.Namespace = &ns
+	}
+
+	return p
+}
+
+func delta(id string, days int, ns int64, base string) restorepoint.Point {
+	p := point(id, days, ns)
+	p.Type = restorepoint.TypeDelta
+	p.Base = base
+	p.Size = 1
+
+	return p
+}
+
+func held(p restorepoint.Point) restorepoint.Point {
+	p.Held = true
+	return p
+}
+
+func TestExpired(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		points []restorepoint.Point
+		want   []string
+	}{
+		{
+			name:   "disabled",
+			policy: Policy{},
+			points: []restorepoint.Point{point("c3", 1, -1), point("c2", 2, -1), point("c1", 3, -1)},
+		},
+		{
+			name:   "keep last",
+			policy: Policy{KeepLast: 2},
+			points: []restorepoint.Point{point("c3", 1, -1), point("c2", 2, -1), point("c1", 3, -1)},
+			want:   []string{"c1"},
+		},
+		{
+			name:   "keep last of every namespace",
+			policy: Policy{KeepLast: 1},
+			points: []restorepoint.Point{
+				point("n5b", 1, 5), point("n5a", 2, 5), point("c2", 3, -1),
+				point("n7a", 4, 7), point("c1", 5, 0), point("c0", 6, -1),
+			},
+			want: []string{"n5a", "c0"},
+		},
+		{
+			name:   "namespace 0 is not cluster",
+			policy: Policy{KeepLast: 1},
+			points: []restorepoint.Point{point("n0", 1, 0), point("c1", 2, -1)},
+		},
+		{
+			name:   "max age",
+			policy: Policy{MaxAge: 48 * time.Hour},
+			points: []restorepoint.Point{point("c3", 1, -1), point("c2", 3, -1), point("n1", 4, 1)},
+			want:   []string{"c2", "n1"},
+		},
+		{
+			name:   "keep last within max age",
+			policy: Policy{KeepLast: 1, MaxAge: 72 * time.Hour},
+			points: []restorepoint.Point{point("c3", 1, -1), point("c2", 2, -1), point("c1", 3, -1)},
+			want:   []string{"c1"},
+		},
+		{
+			name:   "held",
+			policy: Policy{KeepLast: 1},
+			points: []restorepoint.Point{point("c3", 1, -1), held(point("c2", 2, -1)), point("c1", 3, -1)},
+			want:   []string{"c1"},
+		},
+		{
+			name:   "deltas expire with base",
+			policy: Policy{KeepLast: 1},
+			points: []restorepoint.Point{
+				delta("d3", 1, -1, "c2"), point("c2", 2, -1), delta("d2", 3, -1, "c1"), point("c1", 4, -1),
+			},
+			want: []string{"c1", "d2"},
+		},
+		{
+			name:   "held delta keeps its base",
+			policy: Policy{KeepLast: 1},
+			points: []restorepoint.Point{
+				point("c2", 2, -1), held(delta("d2", 3, -1, "c1")), point("c1", 4, -1),
+			},
+			want: []string{"c1"},
+		},
+		{
+			name:   "deltas of namespace",
+			policy: Policy{KeepLast: 1},
+			points: []restorepoint.Point{
+				delta("d5", 1, 5, "n5b"), point("n5b", 2, 5), point("c1", 3, -1),
+				delta("d4", 4, 5, "n5a"), point("n5a", 5, 5),
+			},
+			want: []string{"n5a", "d4"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ids(tc.policy.Expired(tc.points, now)); !slices.Equal(got, tc.want) {
+				t.Errorf("Expired() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOverQuota(t *testing.T) {
+	unverified := func(p restorepoint.Point) restorepoint.Point {
+		p.Verified = false
+		return p
+	}
+	json := func(p restorepoint.Point) restorepoint.Point {
+		p.Format = "json"
+		return p
+	}
+
+	for _, tc := range []struct {
+		name   string
+		quota  int64
+		points []restorepoint.Point
+		want   []string
+	}{
+		{
+			name:   "within quota",
+			quota:  30,
+			points: []restorepoint.Point{point("c3", 1, -1), point("c2", 2, -1), point("c1", 3, -1)},
+		},
+		{
+			name:   "oldest first",
+			quota:  15,
+			points: []restorepoint.Point{point("c3", 1, -1), point("c2", 2, -1), point("c1", 3, -1)},
+			want:   []string{"c1", "c2"},
+		},
+		{
+			name:  "with deltas",
+			quota: 21,
+			points: []restorepoint.Point{
+				delta("d3", 1, -1, "c2"), point("c2", 2, -1), delta("d2", 3, -1, "c1"), point("c1", 4, -1),
+			},
+			want: []string{"c1", "d2"},
+		},
+		{
+			name:   "newest verified is kept",
+			quota:  5,
+			points: []restorepoint.Point{unverified(point("c3", 1, -1)), point("c2", 2, -1), point("c1", 3, -1)},
+			want:   []string{"c1", "c3"},
+		},
+		{
+			name:   "newest verified rdf is kept",
+			quota:  5,
+			points: []restorepoint.Point{json(point("j3", 1, -1)), point("c2", 2, -1), point("c1", 3, -1)},
+			want:   []string{"c1", "j3"},
+		},
+		{
+			name:   "held and base of held delta are kept",
+			quota:  5,
+			points: []restorepoint.Point{point("c3", 1, -1), held(point("c2", 2, -1)), held(delta("d1", 3, -1, "c1")), point("c1", 4, -1)},
+		},
+		{
+			name:  "quota of every namespace",
+			quota: 15,
+			points: []restorepoint.Point{
+				point("n2", 1, 5), point("c2", 2, -1), point("n1", 3, 5), point("c1", 4, -1),
+			},
+			want: []string{"n1", "c1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ids(Policy{MaxTotalSize: tc.quota}.Expired(tc.points, now))
+			slices.Sort(got)
+			want := slices.Clone(tc.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("Expired() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func ids(points []restorepoint.Point) []string {
+	var ids []string
+	for _, p := range points {
+		ids = append(ids, p.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,61 @@
+package secret
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source provides current value of a secret.
+type Source interface {
+	Get() (string, error)
+}
+
+// Static is a secret known on start, e.g. from environment variable.
+type Static string
+
+func (s Static) Get() (string, error) {
+	return string(s), nil
+}
+
+// File is a secret stored in a file, e.g. mounted Kubernetes secret.
+// The file is read again once its modification time or size changes,
+// so rotated secrets are picked up without restart.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Get() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.value, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.value = strings.TrimSpace(string(b))
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	return f.value, nil
+}
@@ -0,0 +1,87 @@
+package signing
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+const algorithmEd25519 = "ed25519"
+
+// ed25519Key signs with private key or only verifies with public one.
+type ed25519Key struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+	id      string
+}
+
+func loadEd25519(file string) (*ed25519Key, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM file", file)
+	}
+
+	k := &ed25519Key{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s holds %T, not Ed25519 key", file, key)
+		}
+		k.private = private
+		k.public = private.Public().(ed25519.PublicKey)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s holds %T, not Ed25519 key", file, key)
+		}
+		k.public = public
+	default:
+		return nil, fmt.Errorf("%s holds %s, expected PRIVATE KEY or PUBLIC KEY", file, block.Type)
+	}
+
+	// key id tells which key signed manifest once keys are rotated
+	sum := sha256.Sum256(k.public)
+	k.id = hex.EncodeToString(sum[:8])
+
+	return k, nil
+}
+
+func (k *ed25519Key) Sign(ctx context.Context, msg []byte) (Signature, error) {
+	return Signature{
+		Algorithm: algorithmEd25519,
+		KeyID:     k.id,
+		Value:     ed25519.Sign(k.private, msg),
+	}, nil
+}
+
+func (k *ed25519Key) Verify(ctx context.Context, msg []byte, sig Signature) error {
+	if sig.Algorithm != algorithmEd25519 {
+		return fmt.Errorf("%w: signed with %s, expected %s", ErrInvalid, sig.Algorithm, algorithmEd25519)
+	}
+	if sig.KeyID != "" && sig.KeyID != k.id {
+		return fmt.Errorf("%w: signed with key %s, expected %s", ErrInvalid, sig.KeyID, k.id)
+	}
+	if !ed25519.Verify(k.public, msg, sig.Value) {
+		return ErrInvalid
+	}
+
+	return nil
+}
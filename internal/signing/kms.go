@@ -0,0 +1,192 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/secret"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/sigv4"
+)
+
+const (
+	algorithmKMSPrefix  = "awskms:"
+	defaultKMSAlgorithm = "ECDSA_SHA_256"
+	kmsTimeout          = 30 * time.Second
+)
+
+// kms signs with asymmetric AWS KMS key, private key never leaves KMS.
+// Messages are signed as digests, since KMS accepts raw ones up to 4 KiB.
+// https://docs.aws.amazon.com/kms/latest/APIReference/API_Sign.html
+type kms struct {
+	key       string
+	region    string
+	endpoint  string
+	algorithm string
+	accessKey secret.Source
+	secretKey secret.Source
+}
+
+func newKMS(key string, opts ...Option) (*kms, error) {
+	cfg := &config{algorithm: defaultKMSAlgorithm}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if digest(cfg.algorithm) == nil {
+		return nil, fmt.Errorf("unsupported KMS signing algorithm %q", cfg.algorithm)
+	}
+
+	k := &kms{
+		key:       key,
+		region:    cfg.region,
+		endpoint:  cfg.endpoint,
+		algorithm: cfg.algorithm,
+		accessKey: cfg.accessKey,
+		secretKey: cfg.secretKey,
+	}
+	if k.region == "" {
+		// arn:aws:kms:region:account:key/id
+		parts := strings.Split(key, ":")
+		if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kms" {
+			return nil, fmt.Errorf("can't get region from KMS key %q, set it explicitly", key)
+		}
+		k.region = parts[3]
+	}
+	if k.endpoint == "" {
+		k.endpoint = "https://kms." + k.region + ".amazonaws.com/"
+	}
+
+	return k, nil
+}
+
+// digest returns hash algorithm signs digests of, nil for unknown algorithm.
+func digest(algorithm string) hash.Hash {
+	switch {
+	case strings.HasSuffix(algorithm, "_SHA_256"):
+		return sha256.New()
+	case strings.HasSuffix(algorithm, "_SHA_384"):
+		return sha512.New384()
+	case strings.HasSuffix(algorithm, "_SHA_512"):
+		return sha512.New()
+	}
+
+	return nil
+}
+
+func (k *kms) Sign(ctx context.Context, msg []byte) (Signature, error) {
+	var out struct {
+		KeyID     string `json:"KeyId"`
+		Signature []byte `json:"Signature"`
+	}
+	err := k.call(ctx, "Sign", map[string]interface{}{
+		"KeyId":            k.key,
+		"Message":          k.digest(msg),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": k.algorithm,
+	}, &out)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	return Signature{
+		Algorithm: algorithmKMSPrefix + k.algorithm,
+		KeyID:     out.KeyID,
+		Value:     out.Signature,
+	}, nil
+}
+
+func (k *kms) Verify(ctx context.Context, msg []byte, sig Signature) error {
+	if sig.Algorithm != algorithmKMSPrefix+k.algorithm {
+		return fmt.Errorf("%w: signed with %s, expected %s%s", ErrInvalid, sig.Algorithm, algorithmKMSPrefix, k.algorithm)
+	}
+
+	var out struct {
+		SignatureValid bool `json:"SignatureValid"`
+	}
+	err := k.call(ctx, "Verify", map[string]interface{}{
+		"KeyId":            k.key,
+		"Message":          k.digest(msg),
+		"MessageType":      "DIGEST",
+		"Signature":        sig.Value,
+		"SigningAlgorithm": k.algorithm,
+	}, &out)
+	if err != nil {
+		return err
+	}
+	if !out.SignatureValid {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+func (k *kms) digest(msg []byte) []byte {
+	h := digest(k.algorithm)
+	h.Write(msg)
+
+	return h.Sum(nil)
+}
+
+// call sends KMS JSON API request, []byte fields are sent base64 encoded.
+func (k *kms) call(ctx context.Context, action string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, kmsTimeout)
+	defer cancel()
+
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	var creds sigv4.Credentials
+	if k.accessKey != nil {
+		if creds.AccessKey, err = k.accessKey.Get(); err != nil {
+			return fmt.Errorf("failed to get access key: %w", err)
+		}
+	}
+	if k.secretKey != nil {
+		if creds.SecretKey, err = k.secretKey.Get(); err != nil {
+			return fmt.Errorf("failed to get secret key: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	sigv4.Sign(req, creds, k.region, "kms", sigv4.HashPayload(payload), time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(b, &e)
+		// failed verification is reported as error by KMS
+		if strings.HasSuffix(e.Type, "KMSInvalidSignatureException") {
+			return ErrInvalid
+		}
+		return fmt.Errorf("kms %s responded with %s: %s", action, resp.Status, bytes.TrimSpace(b))
+	}
+
+	return json.Unmarshal(b, out)
+}
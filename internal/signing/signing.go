@@ -0,0 +1,110 @@
+// Package signing signs export manifests, so backup sets changed
+// at destination are detected before they are restored.
+package signing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/secret"
+)
+
+// ErrInvalid is returned when signature doesn't match message.
+var ErrInvalid = errors.New("signature is invalid")
+
+// Signature is detached signature of message.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId,omitempty"`
+	Value     []byte `json:"signature"`
+}
+
+type Signer interface {
+	Sign(ctx context.Context, msg []byte) (Signature, error)
+}
+
+type Verifier interface {
+	// Verify returns error wrapping ErrInvalid when sig isn't signature of msg.
+	Verify(ctx context.Context, msg []byte, sig Signature) error
+}
+
+type config struct {
+	accessKey secret.Source
+	secretKey secret.Source
+	region    string
+	endpoint  string
+	algorithm string
+}
+
+type Option func(*config)
+
+// WithCredentials sets AWS access keys KMS requests are signed with,
+// they are read on every request, so rotated keys are picked up.
+func WithCredentials(accessKey, secretKey secret.Source) Option {
+	return func(c *config) {
+		c.accessKey = accessKey
+		c.secretKey = secretKey
+	}
+}
+
+// WithRegion overrides region taken from KMS key ARN.
+func WithRegion(value string) Option {
+	return func(c *config) {
+		c.region = value
+	}
+}
+
+// WithEndpoint overrides KMS endpoint, e.g. for compatible services.
+func WithEndpoint(value string) Option {
+	return func(c *config) {
+		c.endpoint = value
+	}
+}
+
+// WithAlgorithm sets KMS signing algorithm, ECDSA_SHA_256 by default.
+func WithAlgorithm(value string) Option {
+	return func(c *config) {
+		c.algorithm = value
+	}
+}
+
+// NewSigner returns signer using key, one of:
+//
+//	ed25519:/etc/keys/manifest.pem
+//	awskms:arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab
+//
+// Ed25519 key is PKCS #8 private key in PEM file.
+func NewSigner(key string, opts ...Option) (Signer, error) {
+	scheme, rest, _ := strings.Cut(key, ":")
+	switch scheme {
+	case "ed25519":
+		k, err := loadEd25519(rest)
+		if err != nil {
+			return nil, err
+		}
+		if k.private == nil {
+			return nil, fmt.Errorf("%s holds public key, signing requires private one", rest)
+		}
+		return k, nil
+	case "awskms":
+		return newKMS(rest, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported signing key %q, it must start with ed25519: or awskms:", key)
+	}
+}
+
+// NewVerifier returns verifier using key in the same form as NewSigner,
+// Ed25519 key file may hold PKIX public key instead of private one.
+func NewVerifier(key string, opts ...Option) (Verifier, error) {
+	scheme, rest, _ := strings.Cut(key, ":")
+	switch scheme {
+	case "ed25519":
+		return loadEd25519(rest)
+	case "awskms":
+		return newKMS(rest, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported verification key %q, it must start with ed25519: or awskms:", key)
+	}
+}
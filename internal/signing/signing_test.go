@@ -0,0 +1,137 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePEM(t *testing.T, typ string, b []byte) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestEd25519(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateFile := writePEM(t, "PRIVATE KEY", privateDER)
+	publicFile := writePEM(t, "PUBLIC KEY", publicDER)
+
+	ctx := context.Background()
+	msg := []byte(`{"files":["dgraph.r1.u1013.1114/g01.rdf.gz"]}`)
+
+	signer, err := NewSigner("ed25519:" + privateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signer.Sign(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := NewVerifier("ed25519:" + publicFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(ctx, msg, sig); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+	if err := verifier.Verify(ctx, append(msg, ' '), sig); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() of changed message = %v, want ErrInvalid", err)
+	}
+
+	if _, err := NewSigner("ed25519:" + publicFile); err == nil {
+		t.Error("NewSigner() with public key succeeded, want error")
+	}
+}
+
+func TestKMS(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			KeyID       string `json:"KeyId"`
+			Message     []byte `json:"Message"`
+			MessageType string `json:"MessageType"`
+			Signature   []byte `json:"Signature"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.MessageType != "DIGEST" {
+			http.Error(w, `{"__type":"ValidationException"}`, http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Sign":
+			sig, err := ecdsa.SignASN1(rand.Reader, private, in.Message)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": in.KeyID, "Signature": sig})
+		case "TrentService.Verify":
+			if !ecdsa.VerifyASN1(&private.PublicKey, in.Message, in.Signature) {
+				http.Error(w, `{"__type":"KMSInvalidSignatureException"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": in.KeyID, "SignatureValid": true})
+		}
+	}))
+	defer srv.Close()
+
+	k, err := newKMS("arn:aws:kms:us-east-1:123456789012:key/test", WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.region != "us-east-1" {
+		t.Errorf("region = %q, want us-east-1", k.region)
+	}
+
+	ctx := context.Background()
+	msg := []byte(`{"files":[]}`)
+	sig, err := k.Sign(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(msg)
+	if !ecdsa.VerifyASN1(&private.PublicKey, digest[:], sig.Value) {
+		t.Error("signature isn't signature of message digest")
+	}
+
+	if err := k.Verify(ctx, msg, sig); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+	if err := k.Verify(ctx, append(msg, ' '), sig); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() of changed message = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,109 @@
+package slo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+// Tracker tracks export success rate over rolling window
+// against target ratio. Results are kept in memory only.
+type Tracker struct {
+	window time.Duration
+	target float64
+
+	mu      sync.Mutex
+	results []result
+}
+
+type result struct {
+	at time.Time
+	ok bool
+}
+
+func New(window time.Duration, target float64) *Tracker {
+	metrics.BackupSLOTarget.Set(target)
+	metrics.BackupSuccessRatio.Set(1)
+
+	return &Tracker{
+		window: window,
+		target: target,
+	}
+}
+
+// Record adds export result.
+func (t *Tracker) Record(ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.results = append(t.results, result{at: now, ok: ok})
+	t.expire(now)
+
+	ratio, _ := t.ratio()
+	metrics.BackupSuccessRatio.Set(ratio)
+	metrics.BackupSLOBurnRate.Set(t.burnRate(ratio))
+}
+
+// Ratio returns success ratio and number of exports in window,
+// ratio is 1 when there were no exports.
+func (t *Tracker) Ratio() (float64, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(time.Now())
+
+	return t.ratio()
+}
+
+// Violated returns whether success ratio is below target.
+func (t *Tracker) Violated() bool {
+	ratio, _ := t.Ratio()
+
+	return ratio < t.target
+}
+
+// String returns status like "99.2% (target 99%)".
+func (t *Tracker) String() string {
+	ratio, _ := t.Ratio()
+
+	return fmt.Sprintf("%.1f%% (target %g%%)", ratio*100, t.target*100)
+}
+
+func (t *Tracker) ratio() (float64, int) {
+	if len(t.results) == 0 {
+		return 1, 0
+	}
+
+	ok := 0
+	for _, r := range t.results {
+		if r.ok {
+			ok++
+		}
+	}
+
+	return float64(ok) / float64(len(t.results)), len(t.results)
+}
+
+// burnRate returns how fast failure budget is spent, 1 means
+// budget is spent exactly by the end of window.
+func (t *Tracker) burnRate(ratio float64) float64 {
+	if t.target >= 1 {
+		if ratio < 1 {
+			return 1
+		}
+		return 0
+	}
+
+	return (1 - ratio) / (1 - t.target)
+}
+
+func (t *Tracker) expire(now time.Time) {
+	i := 0
+	for i < len(t.results) && now.Sub(t.results[i].at) > t.window {
+		i++
+	}
+	t.results = t.results[i:]
+}
@@ -0,0 +1,44 @@
+// Package snapshot keeps state of the tool at destination, so backup
+// history, holds and retention settings survive loss of the lease database.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/job"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/lease"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/restorepoint"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// Name is snapshot object key at destination root, restore points are
+// directories, so it's never taken for one.
+const Name = "export-tool-state.json"
+
+// Snapshot is state of the tool at CreatedAt.
+type Snapshot struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Identity  string    `json:"identity"`
+	Version   string    `json:"version"`
+	// Leader is lease holder metadata, nil when it's unknown.
+	Leader *lease.Holder `json:"leader,omitempty"`
+	// Config is command line flag values, secrets are only ever passed
+	// with files or environment, so they are not part of it.
+	Config        map[string]string    `json:"config"`
+	BackupSLO     string               `json:"backupSLO"`
+	RestorePoints []restorepoint.Point `json:"restorePoints"`
+	Jobs          []job.Status         `json:"jobs"`
+}
+
+// Write stores snapshot at destination root replacing previous one.
+func (snap *Snapshot) Write(ctx context.Context, s storage.Storage) error {
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, Name, bytes.NewReader(b), int64(len(b)))
+}
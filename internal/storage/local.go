@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localStorage is a directory on local or network (e.g. NFS) filesystem,
+// the tool must have the same directory mounted as Dgraph alphas.
+type localStorage struct {
+	root string
+	config
+}
+
+func newLocal(root string, cfg *config) (*localStorage, error) {
+	if !filepath.IsAbs(root) {
+		return nil, fmt.Errorf("%w: local destination %q is not absolute path", ErrUnsupported, root)
+	}
+
+	return &localStorage{root: filepath.Clean(root), config: *cfg}, nil
+}
+
+func (s *localStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Put writes object to temporary file first, so partially written
+// objects are never visible under their key.
+func (s *localStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := s.beforePut(key); err != nil {
+		return err
+	}
+
+	name := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-"+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, contextReader{ctx, r}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+func (s *localStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{contextReader{ctx, f}, f}, nil
+}
+
+func (s *localStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{contextReader{ctx, io.NewSectionReader(f, offset, length)}, f}, nil
+}
+
+func (s *localStorage) open(key string) (*os.File, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return f, err
+}
+
+// Delete removes object and parent directories left empty.
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	name := s.path(key)
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for dir := filepath.Dir(name); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *localStorage) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+
+	err := filepath.WalkDir(s.path(prefix), func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{
+			Key:          filepath.ToSlash(rel),
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+
+		return ctx.Err()
+	})
+
+	return objects, err
+}
+
+// FreeSpace returns bytes available to unprivileged users on the mount.
+func (s *localStorage) FreeSpace(ctx context.Context) (uint64, error) {
+	return freeSpace(s.root)
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package storage
+
+import "fmt"
+
+func freeSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("%w: free space of %s is unknown on this platform", ErrUnsupported, path)
+}
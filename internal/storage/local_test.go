@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWindowsPath(t *testing.T) {
+	for dest, want := range map[string]bool{
+		`C:\exports`:            true,
+		`d:/exports`:            true,
+		`\\server\share\export`: true,
+		`/mnt/exports`:          false,
+		`C:`:                    false,
+		`s3://host/bucket`:      false,
+		`file:///mnt/exports`:   false,
+	} {
+		if got := windowsPath(dest); got != want {
+			t.Errorf("windowsPath(%q) = %t, want %t", dest, got, want)
+		}
+	}
+}
+
+func TestFileURLPath(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		windows bool
+	}{
+		{url: "file:///mnt/exports", want: "/mnt/exports"},
+		{url: "file:///C:/exports", want: "C:/exports", windows: true},
+		{url: "file://server/share/exports", want: `\\server\share\exports`, windows: true},
+	}
+	for _, tt := range tests {
+		if tt.windows != (runtime.GOOS == "windows") {
+			continue
+		}
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fileURLPath(u); got != tt.want {
+			t.Errorf("fileURLPath(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	s, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "dgraph.r1.u0101.0000/g01.rdf.gz"
+	if err := s.Put(ctx, key, bytes.NewReader([]byte("data")), 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dgraph.r1.u0101.0000", "g01.rdf.gz")); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := s.List(ctx, "dgraph.r1.u0101.0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != key || objects[0].Size != 4 {
+		t.Fatalf("List() = %+v, want single object %s", objects, key)
+	}
+
+	r, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "data" {
+		t.Fatalf("Get() = %q, %v", b, err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dgraph.r1.u0101.0000")); !os.IsNotExist(err) {
+		t.Errorf("empty export dir is left after delete: %v", err)
+	}
+}
+
+func TestLocalCancel(t *testing.T) {
+	root := t.TempDir()
+	s, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "dgraph.r1.u0101.0000/g01.rdf.gz"
+	if err := s.Put(context.Background(), key, bytes.NewReader([]byte("data")), 4); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.(RangeReader).GetRange(context.Background(), key, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "at" {
+		t.Fatalf("GetRange() = %q, %v", b, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Put(ctx, "other", bytes.NewReader([]byte("data")), 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("Put() = %v, want context.Canceled", err)
+	}
+	r, err = s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(r)
+	r.Close()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("reading Get() = %v, want context.Canceled", err)
+	}
+	if err := s.Delete(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Errorf("Delete() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,588 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/sigv4"
+)
+
+var (
+	// singleLimit is size of the largest object S3 accepts with single
+	// PUT or CopyObject, larger ones are uploaded and copied in parts.
+	singleLimit int64 = 5 << 30
+	// minPartSize is size of parts unless object needs larger ones to
+	// fit in 10000 parts.
+	minPartSize int64 = 128 << 20
+)
+
+const (
+	maxParts = 10000
+	// abortTimeout limits abort of failed multipart upload, it's made
+	// with its own context, so parts of cancelled upload are removed.
+	abortTimeout = 30 * time.Second
+)
+
+type s3Storage struct {
+	cli      *http.Client
+	endpoint *url.URL
+	region   string
+	bucket   string
+	prefix   string
+	config
+}
+
+func newS3(u *url.URL, cfg *config) (*s3Storage, error) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("bucket name is not set in destination %q", u.Redacted())
+	}
+
+	s := &s3Storage{
+		cli:    http.DefaultClient,
+		bucket: parts[0],
+		config: *cfg,
+	}
+	if len(parts) > 1 {
+		s.prefix = strings.Trim(parts[1], "/")
+	}
+
+	host := u.Host
+	if host == "" {
+		host = "s3.amazonaws.com"
+	}
+
+	scheme := "https"
+	if u.Query().Get("secure") == "false" {
+		scheme = "http"
+	}
+	s.endpoint = &url.URL{Scheme: scheme, Host: host}
+	s.region = region(host)
+
+	return s, nil
+}
+
+// region detects bucket region by endpoint host,
+// AWS_REGION environment variable takes precedence.
+func region(host string) string {
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+
+	switch {
+	case host == "storage.yandexcloud.net":
+		return "ru-central1"
+	case strings.HasSuffix(host, ".amazonaws.com"):
+		name := strings.TrimSuffix(host, ".amazonaws.com")
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "s3."), "s3-")
+		if name != "" && name != "s3" {
+			return name
+		}
+	}
+
+	return "us-east-1"
+}
+
+// Put uploads object with single PUT, objects larger than S3 accepts
+// with it are uploaded in parts.
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := s.beforePut(key); err != nil {
+		return err
+	}
+	key = join(s.prefix, key)
+
+	if size > singleLimit {
+		return s.multipart(ctx, key, nil, size, func(query url.Values, offset, length int64) (string, error) {
+			req, err := s.newRequest(ctx, http.MethodPut, key, query, io.LimitReader(r, length))
+			if err != nil {
+				return "", err
+			}
+			req.ContentLength = length
+
+			return s.part(req)
+		})
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	return s.do(req, nil)
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.get(ctx, key, "")
+}
+
+// GetRange reads part of object with Range header.
+func (s *s3Storage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	return s.get(ctx, key, fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+}
+
+func (s *s3Storage) get(ctx context.Context, key, byteRange string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, join(s.prefix, key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+
+	resp, err := s.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s.responseError(req, resp)
+	}
+	// whole object is served by storages ignoring ranges
+	if byteRange != "" && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: range requests are not supported, got %s", req.URL.Path, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// Retain sets object retention with PutObjectRetention, bucket must have Object Lock enabled.
+func (s *s3Storage) Retain(ctx context.Context, key string, mode RetentionMode, until time.Time) error {
+	body, err := xml.Marshal(struct {
+		XMLName         xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ Retention"`
+		Mode            RetentionMode `xml:"Mode"`
+		RetainUntilDate string        `xml:"RetainUntilDate"`
+	}{
+		Mode:            mode,
+		RetainUntilDate: until.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, join(s.prefix, key), url.Values{"retention": {""}}, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	return s.do(req, nil)
+}
+
+// Transition moves object to another storage class by copying it onto
+// itself. Versioned buckets, e.g. ones with Object Lock, keep previous
+// version of the object in its storage class, lifecycle rule expiring
+// noncurrent versions is needed to get rid of it.
+func (s *s3Storage) Transition(ctx context.Context, key, class string) error {
+	key = join(s.prefix, key)
+	source := "/" + s.bucket + "/" + key
+
+	size, header, err := s.head(ctx, s, key)
+	if err != nil {
+		return err
+	}
+	if size > singleLimit {
+		header.Set("X-Amz-Storage-Class", class)
+		return s.copyParts(ctx, key, source, size, header)
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", escapePath(source))
+	req.Header.Set("X-Amz-Storage-Class", class)
+	req.Header.Set("X-Amz-Metadata-Directive", "COPY")
+
+	return s.do(req, nil)
+}
+
+// copyFrom copies object of size from bucket of the same endpoint with
+// CopyObject or in parts when it's too large for it, credentials of s
+// must allow reading src.
+func (s *s3Storage) copyFrom(ctx context.Context, src *s3Storage, key string, size int64) error {
+	source := join(src.prefix, key)
+	key = join(s.prefix, key)
+
+	if size > singleLimit {
+		size, header, err := s.head(ctx, src, source)
+		if err != nil {
+			return err
+		}
+		return s.copyParts(ctx, key, "/"+src.bucket+"/"+source, size, header)
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", escapePath("/"+src.bucket+"/"+source))
+
+	return s.do(req, nil)
+}
+
+// head returns size of object key of bucket src and its headers copy of
+// it is created with, CopyObject keeps them but multipart upload doesn't.
+func (s *s3Storage) head(ctx context.Context, src *s3Storage, key string) (int64, http.Header, error) {
+	req, err := src.newRequest(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := s.send(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if resp.StatusCode/100 != 2 {
+		return 0, nil, s.responseError(req, resp)
+	}
+
+	header := make(http.Header)
+	for name, values := range resp.Header {
+		switch {
+		case strings.HasPrefix(name, "X-Amz-Meta-"),
+			name == "Content-Type", name == "Content-Encoding", name == "Cache-Control", name == "Content-Disposition":
+			header[name] = values
+		}
+	}
+
+	return resp.ContentLength, header, nil
+}
+
+// copyParts copies object source of size to key with UploadPartCopy.
+func (s *s3Storage) copyParts(ctx context.Context, key, source string, size int64, header http.Header) error {
+	return s.multipart(ctx, key, header, size, func(query url.Values, offset, length int64) (string, error) {
+		req, err := s.newRequest(ctx, http.MethodPut, key, query, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-Amz-Copy-Source", escapePath(source))
+		req.Header.Set("X-Amz-Copy-Source-Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+		return s.part(req)
+	})
+}
+
+// multipart creates object key of size with multipart upload, upload
+// is called for every part in order and returns its ETag. Failed
+// upload is aborted, so its parts aren't left in bucket.
+func (s *s3Storage) multipart(ctx context.Context, key string, header http.Header, size int64, upload func(query url.Values, offset, length int64) (string, error)) error {
+	req, err := s.newRequest(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.do(req, &created); err != nil {
+		return err
+	}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var complete struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+	length := max(minPartSize, (size+maxParts-1)/maxParts)
+	for offset, n := int64(0), 1; offset < size; offset, n = offset+length, n+1 {
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {created.UploadID}}
+		etag, err := upload(query, offset, min(length, size-offset))
+		if err != nil {
+			return s.abort(key, created.UploadID, err)
+		}
+		complete.Parts = append(complete.Parts, part{PartNumber: n, ETag: etag})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return s.abort(key, created.UploadID, err)
+	}
+	req, err = s.newRequest(ctx, http.MethodPost, key, url.Values{"uploadId": {created.UploadID}}, bytes.NewReader(body))
+	if err != nil {
+		return s.abort(key, created.UploadID, err)
+	}
+	// completion may fail after 200 OK is sent, with error in body
+	var completed struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := s.do(req, &completed); err != nil {
+		return s.abort(key, created.UploadID, err)
+	}
+	if completed.XMLName.Local == "Error" {
+		return s.abort(key, created.UploadID, fmt.Errorf("POST %s: %s: %s", req.URL.Path, completed.Code, completed.Message))
+	}
+
+	return nil
+}
+
+// part sends request uploading or copying part and returns its ETag,
+// which UploadPart reports in header and UploadPartCopy in body.
+func (s *s3Storage) part(req *http.Request) (string, error) {
+	resp, err := s.send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", s.responseError(req, resp)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+
+	var out struct {
+		ETag string `xml:"ETag"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+	}
+	if out.ETag == "" {
+		return "", fmt.Errorf("%s %s: no ETag of part in response", req.Method, req.URL.Path)
+	}
+
+	return out.ETag, nil
+}
+
+// abort aborts multipart upload failed with err and returns err.
+func (s *s3Storage) abort(key, uploadID string, err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+
+	req, rerr := s.newRequest(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	if rerr == nil {
+		rerr = s.do(req, nil)
+	}
+	if rerr != nil {
+		return errors.Join(err, fmt.Errorf("failed to abort multipart upload: %w", rerr))
+	}
+
+	return err
+}
+
+// Delete removes object. DELETE without version only adds delete marker
+// in versioned buckets, e.g. ones with Object Lock, and succeeds even for
+// retained objects, so retention and legal hold are checked beforehand.
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	key = join(s.prefix, key)
+	if err := s.locked(ctx, key); err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.do(req, nil)
+}
+
+// locked returns error wrapping ErrRetained when Object Lock retention
+// or legal hold protects current version of object key. HEAD reports
+// them only with s3:GetObjectRetention and s3:GetObjectLegalHold allowed.
+func (s *s3Storage) locked(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return s.responseError(req, resp)
+	}
+
+	if resp.Header.Get("X-Amz-Object-Lock-Legal-Hold") == "ON" {
+		return fmt.Errorf("DELETE %s: %w: legal hold is on", req.URL.Path, ErrRetained)
+	}
+	if v := resp.Header.Get("X-Amz-Object-Lock-Retain-Until-Date"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("HEAD %s: parse retain until date: %w", req.URL.Path, err)
+		}
+		if time.Now().Before(until) {
+			mode := resp.Header.Get("X-Amz-Object-Lock-Mode")
+			return fmt.Errorf("DELETE %s: %w: %s mode until %s", req.URL.Path, ErrRetained, mode, until.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// List returns objects with keys under prefix using ListObjectsV2.
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]Object, error) {
+	base := s.prefix
+	if base != "" {
+		base += "/"
+	}
+	full := base
+	if prefix != "" {
+		full = join(s.prefix, prefix) + "/"
+	}
+
+	var (
+		objects []Object
+		token   string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {full}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newRequest(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var out struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+				StorageClass string    `xml:"StorageClass"`
+				ETag         string    `xml:"ETag"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := s.do(req, &out); err != nil {
+			return nil, err
+		}
+
+		for _, c := range out.Contents {
+			objects = append(objects, Object{
+				Key:          strings.TrimPrefix(c.Key, base),
+				Size:         c.Size,
+				LastModified: c.LastModified,
+				StorageClass: c.StorageClass,
+				ETag:         strings.Trim(c.ETag, `"`),
+			})
+		}
+
+		if !out.IsTruncated || out.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = out.NextContinuationToken
+	}
+}
+
+func (s *s3Storage) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// send signs and sends request, so headers set after newRequest are signed too.
+func (s *s3Storage) send(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+
+	return s.cli.Do(req)
+}
+
+func (s *s3Storage) do(req *http.Request, out interface{}) error {
+	resp, err := s.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return s.responseError(req, resp)
+	}
+
+	if out != nil {
+		return xml.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// responseError builds error from S3 error response body.
+func (s *s3Storage) responseError(req *http.Request, resp *http.Response) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if err := xml.Unmarshal(b, &e); err != nil || e.Code == "" {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	if e.Code == "AccessDenied" && strings.Contains(strings.ToLower(e.Message), "object lock") {
+		return fmt.Errorf("%s %s: %w: %s", req.Method, req.URL.Path, ErrRetained, e.Message)
+	}
+
+	return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, e.Code, e.Message)
+}
+
+// sign signs request with AWS Signature Version 4.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *s3Storage) sign(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", sigv4.UnsignedPayload)
+
+	sigv4.Sign(req, sigv4.Credentials{
+		AccessKey:    s.accessKey,
+		SecretKey:    s.secretKey,
+		SessionToken: s.sessionToken,
+	}, s.region, "s3", sigv4.UnsignedPayload, now)
+}
+
+// escapePath encodes path as S3 expects: every byte except unreserved ones and slashes.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 serves objects and multipart uploads the way S3 does, so far
+// as the tool uses them.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]*fakeUpload
+	// singles counts objects created with single PUT or CopyObject.
+	singles int
+}
+
+type fakeObject struct {
+	data   []byte
+	header http.Header
+}
+
+type fakeUpload struct {
+	key    string
+	header http.Header
+	parts  map[int][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		objects: make(map[string]fakeObject),
+		uploads: make(map[string]*fakeUpload),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for name, values := range obj.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = &fakeUpload{key: key, header: r.Header.Clone(), parts: make(map[int][]byte)}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		upload, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			var from, to int
+			fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &from, &to)
+			upload.parts[n] = f.source(src)[from : to+1]
+			fmt.Fprintf(w, `<CopyPartResult><ETag>"%d"</ETag></CopyPartResult>`, n)
+			return
+		}
+		upload.parts[n], _ = io.ReadAll(r.Body)
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		upload := f.uploads[query.Get("uploadId")]
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for i, p := range complete.Parts {
+			if p.PartNumber != i+1 || p.ETag != fmt.Sprintf(`"%d"`, p.PartNumber) {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code></Error>")
+				return
+			}
+			data = append(data, upload.parts[p.PartNumber]...)
+		}
+		f.objects[upload.key] = fakeObject{data: data, header: upload.header}
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.singles++
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			f.objects[key] = fakeObject{data: f.source(src), header: r.Header.Clone()}
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = fakeObject{data: data, header: r.Header.Clone()}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) source(src string) []byte {
+	key, _ := url.PathUnescape(src)
+	return f.objects[key].data
+}
+
+func TestS3Multipart(t *testing.T) {
+	defer func(limit, part int64) { singleLimit, minPartSize = limit, part }(singleLimit, minPartSize)
+	singleLimit, minPartSize = 10, 4
+
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	s, err := New("s3://" + host + "/bucket/exports?secure=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := New("s3://" + host + "/archive?secure=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small, large := []byte("small"), []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	for key, data := range map[string][]byte{"a/small": small, "a/large": large} {
+		if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatalf("Put(%s) = %v", key, err)
+		}
+	}
+	if got := f.objects["/bucket/exports/a/large"].data; !bytes.Equal(got, large) {
+		t.Errorf("object uploaded in parts is %q, want %q", got, large)
+	}
+	if f.singles != 1 {
+		t.Errorf("%d objects are put with single request, want only small one", f.singles)
+	}
+
+	f.objects["/bucket/exports/a/large"].header.Set("Content-Type", "application/gzip")
+	for _, key := range []string{"a/small", "a/large"} {
+		if err := s.(Transitioner).Transition(ctx, key, "GLACIER"); err != nil {
+			t.Fatalf("Transition(%s) = %v", key, err)
+		}
+	}
+	obj := f.objects["/bucket/exports/a/large"]
+	if !bytes.Equal(obj.data, large) || obj.header.Get("X-Amz-Storage-Class") != "GLACIER" || obj.header.Get("Content-Type") != "application/gzip" {
+		t.Errorf("object transitioned in parts is %q with headers %v", obj.data, obj.header)
+	}
+
+	for key, data := range map[string][]byte{"a/small": small, "a/large": large} {
+		if err := Copy(ctx, archive, s, Object{Key: key, Size: int64(len(data))}); err != nil {
+			t.Fatalf("Copy(%s) = %v", key, err)
+		}
+	}
+	if got := f.objects["/archive/a/large"].data; !bytes.Equal(got, large) {
+		t.Errorf("object copied in parts is %q, want %q", got, large)
+	}
+	if f.singles != 3 {
+		t.Errorf("%d objects are created with single request, want only small ones", f.singles)
+	}
+
+	errRead := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(large[:8]), errReader{errRead})
+	if err := s.Put(ctx, "a/failed", r, int64(len(large))); !errors.Is(err, errRead) {
+		t.Errorf("Put() of failed reader = %v, want %v", err, errRead)
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("failed upload isn't aborted")
+	}
+}
+
+func TestS3DeleteLocked(t *testing.T) {
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	s, err := New("s3://" + strings.TrimPrefix(srv.URL, "http://") + "/bucket?secure=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	for key, header := range map[string]http.Header{
+		"retained": {"X-Amz-Object-Lock-Mode": {"COMPLIANCE"}, "X-Amz-Object-Lock-Retain-Until-Date": {now.Add(time.Hour).Format(time.RFC3339)}},
+		"held":     {"X-Amz-Object-Lock-Legal-Hold": {"ON"}},
+		"expired":  {"X-Amz-Object-Lock-Mode": {"GOVERNANCE"}, "X-Amz-Object-Lock-Retain-Until-Date": {now.Add(-time.Hour).Format(time.RFC3339)}},
+		"released": {"X-Amz-Object-Lock-Legal-Hold": {"OFF"}},
+		"plain":    {},
+	} {
+		f.objects["/bucket/"+key] = fakeObject{data: []byte(key), header: header}
+	}
+
+	for key, locked := range map[string]bool{"retained": true, "held": true, "expired": false, "released": false, "plain": false, "missing": false} {
+		err := s.Delete(ctx, key)
+		if locked != errors.Is(err, ErrRetained) || !locked && err != nil {
+			t.Errorf("Delete(%s) = %v, want retained: %t", key, err, locked)
+		}
+		if _, ok := f.objects["/bucket/"+key]; ok != locked {
+			t.Errorf("object %s exists after Delete(): %t, want %t", key, ok, locked)
+		}
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupported is returned by New for destinations without storage backend.
+	ErrUnsupported = errors.New("unsupported destination")
+	// ErrNotFound is returned by Get for missing objects.
+	ErrNotFound = errors.New("object not found")
+	// ErrRetained is returned when retention policy forbids changing object.
+	ErrRetained = errors.New("object is retained")
+)
+
+// Storage is a destination where Dgraph writes export files.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Object is an item of storage listing, Key is relative to destination.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	StorageClass string
+	// ETag is entity tag reported by S3 compatible storages, it's MD5
+	// of content for objects uploaded in single part.
+	ETag string
+}
+
+// RangeReader is implemented by storages serving parts of objects,
+// large objects are downloaded in parallel chunks then.
+type RangeReader interface {
+	// GetRange returns length bytes of object starting at offset.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Retainer is implemented by storages supporting object retention,
+// e.g. S3 Object Lock.
+type Retainer interface {
+	// Retain protects object from deletion and overwriting until given time.
+	Retain(ctx context.Context, key string, mode RetentionMode, until time.Time) error
+}
+
+// SpaceReporter is implemented by storages with limited capacity.
+type SpaceReporter interface {
+	// FreeSpace returns number of bytes available for writing.
+	FreeSpace(ctx context.Context) (uint64, error)
+}
+
+// Transitioner is implemented by storages with multiple storage classes.
+type Transitioner interface {
+	// Transition moves object to given storage class, e.g. GLACIER.
+	Transition(ctx context.Context, key, class string) error
+}
+
+type RetentionMode string
+
+const (
+	RetentionGovernance RetentionMode = "GOVERNANCE"
+	RetentionCompliance RetentionMode = "COMPLIANCE"
+)
+
+type config struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	putHook      func(key string) error
+}
+
+type Option func(*config)
+
+func WithAccessKey(value string) Option {
+	return func(c *config) {
+		c.accessKey = value
+	}
+}
+
+func WithSecretKey(value string) Option {
+	return func(c *config) {
+		c.secretKey = value
+	}
+}
+
+func WithSessionToken(value string) Option {
+	return func(c *config) {
+		c.sessionToken = value
+	}
+}
+
+// WithPutHook sets function called before every Put, error it returns
+// fails the Put, e.g. to inject upload failures in resilience tests.
+func WithPutHook(hook func(key string) error) Option {
+	return func(c *config) {
+		c.putHook = hook
+	}
+}
+
+func (c *config) beforePut(key string) error {
+	if c.putHook == nil {
+		return nil
+	}
+
+	return c.putHook(key)
+}
+
+// New returns storage for Dgraph export destination url,
+// e.g. s3://s3.us-west-2.amazonaws.com/bucket/path, minio://host:9000/bucket/path?secure=false
+// or local path /mnt/nfs/exports, optionally with file:// scheme.
+func New(dest string, opts ...Option) (Storage, error) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	// url.Parse takes drive letter for scheme
+	if windowsPath(dest) {
+		return newLocal(dest, cfg)
+	}
+
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "s3", "minio":
+		return newS3(u, cfg)
+	case "", "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("%w: destination is not set", ErrUnsupported)
+		}
+		return newLocal(fileURLPath(u), cfg)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupported, dest)
+	}
+}
+
+// IsLocal returns whether s keeps objects in local filesystem,
+// listing it doesn't cost any requests.
+func IsLocal(s Storage) bool {
+	_, ok := s.(*localStorage)
+	return ok
+}
+
+// windowsPath tells whether dest is Windows path with drive letter,
+// e.g. C:\exports, or UNC path of network share, e.g. \\server\share.
+func windowsPath(dest string) bool {
+	if strings.HasPrefix(dest, `\\`) {
+		return true
+	}
+
+	return len(dest) >= 3 && dest[1] == ':' && (dest[2] == '\\' || dest[2] == '/') &&
+		('a' <= dest[0] && dest[0] <= 'z' || 'A' <= dest[0] && dest[0] <= 'Z')
+}
+
+// fileURLPath returns local path of file url. On Windows file:///C:/exports
+// is path with drive letter and file://server/share is UNC path.
+func fileURLPath(u *url.URL) string {
+	if runtime.GOOS != "windows" {
+		return u.Path
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return `\\` + u.Host + filepath.FromSlash(u.Path)
+	}
+	if p := strings.TrimPrefix(u.Path, "/"); windowsPath(p) {
+		return p
+	}
+
+	return u.Path
+}
+
+// Copy copies object from src to dst under the same key. Copy between
+// buckets of the same S3 endpoint is done server-side, other objects
+// are streamed through the tool.
+func Copy(ctx context.Context, dst, src Storage, obj Object) error {
+	if d, ok := dst.(*s3Storage); ok {
+		if s, ok := src.(*s3Storage); ok && d.endpoint.String() == s.endpoint.String() {
+			return d.copyFrom(ctx, s, obj.Key, obj.Size)
+		}
+	}
+
+	r, err := src.Get(ctx, obj.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return dst.Put(ctx, obj.Key, r, obj.Size)
+}
+
+// contextReader fails reads once ctx is done, so copying of local
+// files stops on cancellation like requests to remote storages do.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+// Probe checks that storage is writable by creating and deleting small object.
+func Probe(ctx context.Context, s Storage) error {
+	key := fmt.Sprintf(".dgraph-export-tool-probe-%d", time.Now().UnixNano())
+	body := []byte("probe")
+
+	if err := s.Put(ctx, key, bytes.NewReader(body), int64(len(body))); err != nil {
+		return fmt.Errorf("failed to write probe object: %w", err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete probe object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func join(prefix, key string) string {
+	return path.Join(prefix, key)
+}
@@ -0,0 +1,189 @@
+// Package tenant validates export destinations of Dgraph namespaces
+// backed up to their own buckets with their own credentials.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/redact"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/secret"
+	"github.com/sputnik-systems/dgraph-export-tool/internal/storage"
+)
+
+// Tenant is a namespace with its own export destination.
+type Tenant struct {
+	Name          string `json:"name"`
+	Namespace     int64  `json:"namespace"`
+	Destination   string `json:"destination"`
+	AccessKeyFile string `json:"accessKeyFile,omitempty"`
+	SecretKeyFile string `json:"secretKeyFile,omitempty"`
+	Anonymous     bool   `json:"anonymous,omitempty"`
+}
+
+// Load reads JSON list of tenants from file.
+func Load(path string) ([]Tenant, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []Tenant
+	if err := json.Unmarshal(b, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants config %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for _, t := range tenants {
+		switch {
+		case t.Name == "":
+			return nil, fmt.Errorf("tenant of namespace %d has no name", t.Namespace)
+		case names[t.Name]:
+			return nil, fmt.Errorf("tenant %q is configured twice", t.Name)
+		case t.Destination == "":
+			return nil, fmt.Errorf("tenant %q has no destination", t.Name)
+		}
+		names[t.Name] = true
+	}
+
+	return tenants, nil
+}
+
+// Readiness is result of the last tenant destination check.
+type Readiness struct {
+	Name        string    `json:"name"`
+	Namespace   int64     `json:"namespace"`
+	Destination string    `json:"destination"`
+	Ready       bool      `json:"ready"`
+	Error       string    `json:"error,omitempty"`
+	CheckedAt   time.Time `json:"checkedAt"`
+}
+
+// Checker checks that tenant credentials grant write access to their
+// destinations, so expired keys are noticed before exports fail.
+type Checker struct {
+	tenants []tenant
+
+	mu     sync.Mutex
+	status map[string]Readiness
+}
+
+type tenant struct {
+	Tenant
+	accessKey secret.Source
+	secretKey secret.Source
+}
+
+func NewChecker(tenants []Tenant) *Checker {
+	c := &Checker{status: make(map[string]Readiness)}
+	for _, t := range tenants {
+		c.tenants = append(c.tenants, tenant{
+			Tenant:    t,
+			accessKey: fileSecret(t.AccessKeyFile),
+			secretKey: fileSecret(t.SecretKeyFile),
+		})
+	}
+
+	return c
+}
+
+// fileSecret returns secret stored in file, empty one if path isn't set.
+func fileSecret(path string) secret.Source {
+	if path == "" {
+		return secret.Static("")
+	}
+
+	return secret.NewFile(path)
+}
+
+// Check probes destinations of all tenants and returns number of ready ones.
+func (c *Checker) Check(ctx context.Context) int {
+	ready := 0
+	for _, t := range c.tenants {
+		r := Readiness{
+			Name:        t.Name,
+			Namespace:   t.Namespace,
+			Destination: redact.URL(t.Destination),
+			CheckedAt:   time.Now(),
+		}
+
+		if err := t.probe(ctx); err != nil {
+			klog.Warningf("tenant %s destination %s is not ready: %v", t.Name, r.Destination, err)
+			r.Error = err.Error()
+			metrics.TenantReady.WithLabelValues(t.Name).Set(0)
+		} else {
+			r.Ready = true
+			ready++
+			metrics.TenantReady.WithLabelValues(t.Name).Set(1)
+		}
+
+		c.mu.Lock()
+		c.status[t.Name] = r
+		c.mu.Unlock()
+	}
+
+	return ready
+}
+
+func (t tenant) probe(ctx context.Context) error {
+	var opts []storage.Option
+	if !t.Anonymous {
+		accessKey, err := t.accessKey.Get()
+		if err != nil {
+			return fmt.Errorf("failed to read access key: %w", err)
+		}
+		secretKey, err := t.secretKey.Get()
+		if err != nil {
+			return fmt.Errorf("failed to read secret key: %w", err)
+		}
+		opts = append(opts, storage.WithAccessKey(accessKey), storage.WithSecretKey(secretKey))
+	}
+
+	s, err := storage.New(t.Destination, opts...)
+	if errors.Is(err, storage.ErrUnsupported) {
+		return fmt.Errorf("destination can't be validated: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return storage.Probe(ctx, s)
+}
+
+// Run checks tenants every interval until ctx is done.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Status returns readiness of tenants checked so far, sorted by name.
+func (c *Checker) Status() []Readiness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := make([]Readiness, 0, len(c.status))
+	for _, r := range c.status {
+		status = append(status, r)
+	}
+	sort.Slice(status, func(i, k int) bool { return status[i].Name < status[k].Name })
+
+	return status
+}
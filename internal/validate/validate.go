@@ -0,0 +1,238 @@
+// Package validate parses exported files to find truncated or corrupted
+// ones, e.g. cut short by failed upload, while export can still be retried
+// instead of when restore needs them.
+package validate
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrInvalid is wrapped by errors of files which are not intact gzip
+// or whose data doesn't parse.
+var ErrInvalid = errors.New("invalid export file")
+
+// File reads gzipped export file name from r and checks gzip stream is
+// intact and data parses as RDF N-Quads or JSON according to its name.
+// Other files, e.g. schema, are only decompressed. Errors of r itself
+// are returned as is.
+func File(r io.Reader, name string) error {
+	src := &sourceReader{r: r}
+
+	err := parse(src, name)
+	if src.err != nil {
+		return src.err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w: %v", name, ErrInvalid, err)
+	}
+
+	return nil
+}
+
+func parse(r io.Reader, name string) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	switch base := strings.TrimSuffix(path.Base(name), ".gz"); {
+	case strings.HasSuffix(base, ".rdf"):
+		return RDF(zr)
+	case strings.HasSuffix(base, ".json"):
+		return JSON(zr)
+	}
+
+	_, err = io.Copy(io.Discard, zr)
+	return err
+}
+
+// sourceReader keeps error of underlying reader, so failed reads aren't
+// reported as invalid data.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+
+	return n, err
+}
+
+// RDF checks every line of r is N-Quad like the ones Dgraph exports:
+// subject, predicate, object, optional namespace label and facets.
+func RDF(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := nquad(line); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	return sc.Err()
+}
+
+func nquad(line string) error {
+	rest, err := node(line, "subject")
+	if err != nil {
+		return err
+	}
+	if rest, err = iri(rest, "predicate"); err != nil {
+		return err
+	}
+	if rest, err = object(rest); err != nil {
+		return err
+	}
+
+	// label and facets follow in either order
+	label, facets := false, false
+	for {
+		switch {
+		case strings.HasPrefix(rest, "<") && !label:
+			label = true
+			rest, err = iri(rest, "label")
+		case strings.HasPrefix(rest, "(") && !facets:
+			facets = true
+			rest, err = facetList(rest)
+		case rest == ".":
+			return nil
+		default:
+			return fmt.Errorf("unexpected %q, N-Quad has to end with dot", clip(rest))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// node parses IRI or blank node and returns the rest of s.
+func node(s, what string) (string, error) {
+	if strings.HasPrefix(s, "_:") {
+		end := strings.IndexAny(s, " \t")
+		if end < 0 || end == 2 {
+			return "", fmt.Errorf("incomplete blank node %s", what)
+		}
+		return strings.TrimLeft(s[end:], " \t"), nil
+	}
+
+	return iri(s, what)
+}
+
+func iri(s, what string) (string, error) {
+	if !strings.HasPrefix(s, "<") {
+		return "", fmt.Errorf("%s is expected at %q", what, clip(s))
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 {
+		return "", fmt.Errorf("incomplete %s %q", what, clip(s))
+	}
+
+	return strings.TrimLeft(s[end+1:], " \t"), nil
+}
+
+func object(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return node(s, "object")
+	}
+
+	rest, err := quoted(s)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(rest, "^^"):
+		return iri(rest[2:], "datatype")
+	case strings.HasPrefix(rest, "@"):
+		end := strings.IndexAny(rest, " \t")
+		if end < 2 {
+			return "", fmt.Errorf("incomplete language tag %q", clip(rest))
+		}
+		rest = rest[end:]
+	}
+
+	return strings.TrimLeft(rest, " \t"), nil
+}
+
+// quoted skips string literal s starts with, keeping escaped quotes.
+func quoted(s string) (string, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[i+1:], nil
+		}
+	}
+
+	return "", fmt.Errorf("unterminated literal %q", clip(s))
+}
+
+func facetList(s string) (string, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			rest, err := quoted(s[i:])
+			if err != nil {
+				return "", err
+			}
+			i = len(s) - len(rest) - 1
+		case ')':
+			return strings.TrimLeft(s[i+1:], " \t"), nil
+		}
+	}
+
+	return "", fmt.Errorf("unterminated facets %q", clip(s))
+}
+
+// clip shortens s quoted in errors.
+func clip(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "..."
+	}
+
+	return s
+}
+
+// JSON checks r is JSON array, which Dgraph exports nodes as. Elements
+// are decoded one by one, so memory use doesn't depend on file size.
+func JSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("array is expected, got %v", tok)
+	}
+	for dec.More() {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after array")
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package validate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRDF(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		ok   bool
+	}{
+		{`<0x1> <name> "Alice"^^<xs:string> <0x0> .`, true},
+		{`<0x1> <dgraph.type> "Person" .`, true},
+		{`<0x1> <friend> <0x2> <0x0> (since=2006-01-02T15:04:05, close=true) .`, true},
+		{`<0x1> <friend> <0x2> (note="a \"quoted) .\"") <0x3> .`, true},
+		{`_:a <name> "Bob"@en .`, true},
+		{`<0x1> <name> "esc\"aped" .`, true},
+		{`<0x1> <name> "Alice`, false},
+		{`<0x1> <name> "Alice"^^<xs:str`, false},
+		{`<0x1> <name>`, false},
+		{`<0x1> <friend> <0x2> <0x0>`, false},
+		{`<0x1> <friend> <0x2> (since=2006 .`, false},
+		{`name "Alice" .`, false},
+	} {
+		err := RDF(strings.NewReader(tt.line + "\n"))
+		if (err == nil) != tt.ok {
+			t.Errorf("RDF(%q) = %v, want ok %t", tt.line, err, tt.ok)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		ok   bool
+	}{
+		{`[]`, true},
+		{"[\n{\"uid\":\"0x1\",\"name\":\"Alice\"},\n{\"uid\":\"0x2\"}\n]\n", true},
+		{`[{"uid":"0x1"},{"uid":`, false},
+		{`[{"uid":"0x1"}`, false},
+		{`{"uid":"0x1"}`, false},
+		{`[] []`, false},
+	} {
+		err := JSON(strings.NewReader(tt.data))
+		if (err == nil) != tt.ok {
+			t.Errorf("JSON(%q) = %v, want ok %t", tt.data, err, tt.ok)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	rdf := gzipped(t, "<0x1> <name> \"Alice\" <0x0> .\n<0x2> <name> \"Bob\" <0x0> .\n")
+
+	if err := File(bytes.NewReader(rdf), "export/g01.rdf.gz"); err != nil {
+		t.Errorf("File() of valid RDF = %v", err)
+	}
+
+	truncated := rdf[:len(rdf)-10]
+	if err := File(bytes.NewReader(truncated), "export/g01.rdf.gz"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("File() of truncated gzip = %v, want %v", err, ErrInvalid)
+	}
+
+	schema := gzipped(t, "<name>: string @index(exact) .\n")
+	if err := File(bytes.NewReader(schema), "export/g01.schema.gz"); err != nil {
+		t.Errorf("File() of schema = %v", err)
+	}
+
+	json := gzipped(t, `[{"uid":"0x1"}`)
+	if err := File(bytes.NewReader(json), "export/g01.json.gz"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("File() of incomplete JSON = %v, want %v", err, ErrInvalid)
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestFileReadError(t *testing.T) {
+	want := errors.New("connection reset")
+	err := File(failingReader{want}, "export/g01.rdf.gz")
+	if !errors.Is(err, want) || errors.Is(err, ErrInvalid) {
+		t.Errorf("File() = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Package worker runs per-file tasks, e.g. downloads and uploads of
+// export files, on bounded number of workers, so exports with thousands
+// of files don't open as many connections and temporary files at once.
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sputnik-systems/dgraph-export-tool/internal/metrics"
+)
+
+// Pool bounds number of tasks running at once by all its users.
+// Nil pool runs tasks one by one.
+type Pool struct {
+	slots chan struct{}
+}
+
+// New returns pool running up to concurrency tasks at once.
+func New(concurrency int) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Pool{slots: make(chan struct{}, concurrency)}
+}
+
+// Run calls fn for indexes from 0 to n on pool workers and waits for them
+// to finish. The first failed task cancels ctx of others and its error is
+// returned. Task names queue depth and latency metrics, e.g. upload.
+func (p *Pool) Run(ctx context.Context, task string, n int, fn func(ctx context.Context, i int) error) error {
+	if p == nil {
+		p = New(1)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+
+	queued := metrics.WorkerQueueDepth.WithLabelValues(task)
+	queued.Add(float64(n))
+	for i := 0; i < n; i++ {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			queued.Sub(float64(n - i))
+			wg.Wait()
+			if first != nil {
+				return first
+			}
+			return ctx.Err()
+		}
+		queued.Dec()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-p.slots }()
+
+			start := time.Now()
+			err := fn(ctx, i)
+			metrics.WorkerTaskDuration.WithLabelValues(task).Observe(time.Since(start).Seconds())
+			if err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return first
+}
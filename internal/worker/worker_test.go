@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	p := New(3)
+
+	var running, peak, done atomic.Int32
+	err := p.Run(context.Background(), "test", 20, func(ctx context.Context, i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := peak.Load()
+			if n <= m || peak.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		done.Add(1)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Load() != 20 {
+		t.Errorf("%d tasks done, want 20", done.Load())
+	}
+	if peak.Load() > 3 {
+		t.Errorf("%d tasks ran at once, want at most 3", peak.Load())
+	}
+}
+
+func TestRunError(t *testing.T) {
+	errTask := errors.New("task failed")
+
+	var started atomic.Int32
+	err := New(1).Run(context.Background(), "test", 10, func(ctx context.Context, i int) error {
+		started.Add(1)
+		if i == 2 {
+			return errTask
+		}
+
+		return nil
+	})
+	if !errors.Is(err, errTask) {
+		t.Errorf("Run() = %v, want %v", err, errTask)
+	}
+	if started.Load() > 4 {
+		t.Errorf("%d tasks started after failure, want no more than one", started.Load()-3)
+	}
+
+	var nilPool *Pool
+	if err := nilPool.Run(context.Background(), "test", 2, func(context.Context, int) error { return nil }); err != nil {
+		t.Errorf("Run() of nil pool = %v, want nil", err)
+	}
+}
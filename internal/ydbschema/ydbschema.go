@@ -0,0 +1,101 @@
+// Package ydbschema brings YDB tables used by the tool to expected structure.
+package ydbschema
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"k8s.io/klog"
+)
+
+// Table is expected table structure.
+type Table struct {
+	Name       string
+	Columns    []options.Column
+	PrimaryKey []string
+}
+
+// Migrate creates table when it's missing and adds missing columns to
+// existing one. Columns of other types or different primary key can't be
+// altered in YDB, so they fail migration; unknown columns are left as is.
+func Migrate(ctx context.Context, db *ydb.Driver, t Table) error {
+	tablePath := path.Join(db.Name(), t.Name)
+
+	return db.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
+		desc, err := s.DescribeTable(ctx, tablePath)
+		if ydb.IsOperationErrorSchemeError(err) || ydb.IsOperationErrorNotFoundError(err) {
+			klog.Infof("creating table %s", t.Name)
+
+			opts := []options.CreateTableOption{options.WithPrimaryKeyColumn(t.PrimaryKey...)}
+			for _, c := range t.Columns {
+				opts = append(opts, options.WithColumnMeta(c))
+			}
+
+			return s.CreateTable(ctx, tablePath, opts...)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to describe table %s: %w", t.Name, err)
+		}
+
+		opts, err := alterOptions(t, desc)
+		if err != nil || len(opts) == 0 {
+			return err
+		}
+
+		return s.AlterTable(ctx, tablePath, opts...)
+	}, table.WithIdempotent())
+}
+
+func alterOptions(t Table, desc options.Description) ([]options.AlterTableOption, error) {
+	if strings.Join(desc.PrimaryKey, ",") != strings.Join(t.PrimaryKey, ",") {
+		return nil, fmt.Errorf("table %s has primary key (%s), want (%s)",
+			t.Name, strings.Join(desc.PrimaryKey, ", "), strings.Join(t.PrimaryKey, ", "))
+	}
+
+	existing := make(map[string]types.Type, len(desc.Columns))
+	for _, c := range desc.Columns {
+		existing[c.Name] = c.Type
+	}
+
+	var opts []options.AlterTableOption
+	for _, c := range t.Columns {
+		typ, ok := existing[c.Name]
+		if !ok {
+			klog.Infof("adding column %s %s to table %s", c.Name, c.Type.Yql(), t.Name)
+			// columns added to existing rows are nullable
+			opts = append(opts, options.WithAddColumn(c.Name, optional(c.Type)))
+			continue
+		}
+		if baseType(typ) != baseType(c.Type) {
+			return nil, fmt.Errorf("column %s of table %s has type %s, want %s",
+				c.Name, t.Name, typ.Yql(), c.Type.Yql())
+		}
+	}
+
+	return opts, nil
+}
+
+func optional(t types.Type) types.Type {
+	if strings.HasPrefix(t.Yql(), "Optional<") {
+		return t
+	}
+
+	return types.Optional(t)
+}
+
+// baseType returns type name without Optional, since YDB may
+// report key columns created as not null ones as optional.
+func baseType(t types.Type) string {
+	name := t.Yql()
+	if inner, ok := strings.CutPrefix(name, "Optional<"); ok {
+		return strings.TrimSuffix(inner, ">")
+	}
+
+	return name
+}
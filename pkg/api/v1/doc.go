@@ -0,0 +1,4 @@
+// Package apiv1 contains gRPC management API of the tool.
+package apiv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative management.proto
@@ -0,0 +1,316 @@
+// Package dgraphtest provides a fake Dgraph /admin GraphQL server for tests.
+package dgraphtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server is a fake Dgraph alpha serving the /admin GraphQL endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	export   ExportResponse
+	health   []NodeState
+	state    State
+	schema   Schema
+	failures []int
+	// exportFailures fail export mutations only.
+	exportFailures []int
+	requests       []Request
+}
+
+// Request is a GraphQL request received by the fake server. Requests
+// to legacy /admin/export have Method set and form values in Variables.
+type Request struct {
+	Method    string                 `json:"-"`
+	Header    http.Header            `json:"-"`
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// ExportResponse is the payload returned by the export mutation.
+// SignedURLs are returned by Dgraph Cloud export mutation only.
+// When Errors are set, they are returned as GraphQL errors instead.
+type ExportResponse struct {
+	Code       string
+	Message    string
+	Files      []string
+	SignedURLs []string
+	Errors     []string
+}
+
+// NodeState is an item of the health query response.
+type NodeState struct {
+	Instance string `json:"instance"`
+	Address  string `json:"address"`
+	Status   string `json:"status"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+}
+
+// State is the payload returned by the state query.
+type State struct {
+	Cid    string  `json:"cid"`
+	Groups []Group `json:"groups"`
+}
+
+// Group is an item of the state query groups list.
+type Group struct {
+	ID      uint64   `json:"id"`
+	Members []Member `json:"members"`
+	Tablets []Tablet `json:"tablets"`
+}
+
+type Member struct {
+	Addr   string `json:"addr"`
+	Leader bool   `json:"leader"`
+}
+
+type Tablet struct {
+	Predicate string `json:"predicate"`
+}
+
+// Schema lists admin API fields returned by schema introspection.
+type Schema struct {
+	Queries           []string
+	Mutations         []string
+	ExportInputFields []string
+	ManifestFields    []string
+}
+
+// NewServer starts a fake server answering successful exports.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		export: ExportResponse{
+			Code:    "Success",
+			Message: "Export completed.",
+			Files:   []string{"dgraph.r1.u0101.0000/g01.rdf.gz", "dgraph.r1.u0101.0000/g01.schema.gz"},
+		},
+		health: []NodeState{
+			{Instance: "zero", Address: "localhost:5080", Status: "healthy", Group: "0", Version: "v23.1.0"},
+			{Instance: "alpha", Address: "localhost:7080", Status: "healthy", Group: "1", Version: "v23.1.0"},
+		},
+		state: State{
+			Cid: "00000000-0000-0000-0000-000000000001",
+			Groups: []Group{{
+				ID:      1,
+				Members: []Member{{Addr: "localhost:7080", Leader: true}},
+				Tablets: []Tablet{{Predicate: "dgraph.type"}},
+			}},
+		},
+		schema: Schema{
+			Queries:           []string{"health", "state", "listBackups"},
+			Mutations:         []string{"export", "backup", "restore"},
+			ExportInputFields: []string{"format", "namespace", "destination", "accessKey", "secretKey", "sessionToken", "anonymous"},
+		},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// AdminURL returns the /admin endpoint URL of the server.
+func (s *Server) AdminURL() string {
+	return s.URL + "/admin"
+}
+
+// SetExportResponse changes the payload returned by the export mutation.
+func (s *Server) SetExportResponse(resp ExportResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.export = resp
+}
+
+// SetHealth changes the nodes returned by the health query.
+func (s *Server) SetHealth(nodes ...NodeState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.health = nodes
+}
+
+// SetState changes the payload returned by the state query.
+func (s *Server) SetState(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+}
+
+// SetSchema changes admin API fields returned by schema introspection.
+func (s *Server) SetSchema(schema Schema) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schema = schema
+}
+
+// FailNext makes the next len(codes) requests fail with the given HTTP status codes.
+func (s *Server) FailNext(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, codes...)
+}
+
+// FailNextExport makes the next len(codes) export mutations fail with
+// the given HTTP status codes, other requests are answered as usual.
+func (s *Server) FailNextExport(codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.exportFailures = append(s.exportFailures, codes...)
+}
+
+// Requests returns all requests received by the server so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/admin/export" {
+		s.handleLegacyExport(w, r)
+		return
+	}
+	// /admin/slash is export endpoint of Dgraph Cloud
+	if r.URL.Path != "/admin" && r.URL.Path != "/admin/slash" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header = r.Header.Clone()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if len(s.failures) > 0 {
+		code := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	if len(s.exportFailures) > 0 && strings.Contains(req.Query, "export(") {
+		code := s.exportFailures[0]
+		s.exportFailures = s.exportFailures[1:]
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	export := s.export
+	health := s.health
+	state := s.state
+	schema := s.schema
+	s.mu.Unlock()
+
+	switch {
+	case strings.Contains(req.Query, "__schema"):
+		writeData(w, map[string]interface{}{
+			"__schema": map[string]interface{}{
+				"queryType":    map[string]interface{}{"fields": fields(schema.Queries)},
+				"mutationType": map[string]interface{}{"fields": fields(schema.Mutations)},
+			},
+			"__type":   map[string]interface{}{"inputFields": fields(schema.ExportInputFields)},
+			"manifest": map[string]interface{}{"fields": fields(schema.ManifestFields)},
+		})
+	case strings.Contains(req.Query, "export(") && len(export.Errors) > 0:
+		writeErrors(w, export.Errors...)
+	case strings.Contains(req.Query, "export("):
+		out := map[string]interface{}{
+			"response": map[string]interface{}{
+				"code":    export.Code,
+				"message": export.Message,
+			},
+		}
+		if export.SignedURLs != nil {
+			out["signedUrls"] = export.SignedURLs
+		} else {
+			out["exportedFiles"] = export.Files
+		}
+		writeData(w, map[string]interface{}{"export": out})
+	case strings.Contains(req.Query, "health"):
+		writeData(w, map[string]interface{}{"health": health})
+	case strings.Contains(req.Query, "state"):
+		writeData(w, map[string]interface{}{"state": state})
+	default:
+		writeErrors(w, "unsupported operation")
+	}
+}
+
+// handleLegacyExport serves HTTP export endpoint of Dgraph v1.x and v20.x.
+func (s *Server) handleLegacyExport(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := Request{Method: r.Method, Header: r.Header.Clone(), Variables: make(map[string]interface{})}
+	for key := range r.Form {
+		req.Variables[key] = r.Form.Get(key)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if len(s.failures) > 0 {
+		code := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	export := s.export
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(export.Errors) > 0 {
+		errs := make([]map[string]string, 0, len(export.Errors))
+		for _, msg := range export.Errors {
+			errs = append(errs, map[string]string{"code": "Error", "message": msg})
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"code": export.Code, "message": export.Message})
+}
+
+func fields(names []string) []map[string]string {
+	out := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		out = append(out, map[string]string{"name": name})
+	}
+
+	return out
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func writeErrors(w http.ResponseWriter, messages ...string) {
+	errs := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		errs = append(errs, map[string]interface{}{"message": msg})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+}